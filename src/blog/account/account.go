@@ -0,0 +1,274 @@
+package account
+
+import (
+	"blog/guest"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"info"
+	"model"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+/* 本站帐号：用户名、邮箱和密码注册，保存在user表里，类型为AccountTypeLocal，
+** open_id是小写的用户名，所以用户名不区分大小写。登录之后和QQ、微博登录的会话完全一样。
+** 忘记密码时往注册邮箱发一个一次性的链接，一个小时内有效。
+** 登录失败按帐号和ip计数，kLoginWindow内超过次数之后直接拒绝，不再校验密码。
+ */
+
+const (
+	kMinNameLength     = 2
+	kMaxNameLength     = 32
+	kMaxEmailLength    = 256
+	kMinPasswordLength = 8
+	kMaxPasswordLength = 128
+	kResetExpireTime   = time.Hour
+	// 每个帐号一个小时内最多申请几次找回密码
+	kMaxResetPerHour = 3
+	// 登录失败的统计窗口，窗口内每个帐号、每个ip最多失败的次数
+	kLoginWindow          = 15 * time.Minute
+	kMaxAccountLoginFails = 10
+	kMaxIPLoginFails      = 50
+)
+
+var (
+	ErrInvalidName   = errors.New("invalid username")
+	ErrInvalidEmail  = errors.New("invalid email")
+	ErrWeakPassword  = errors.New("password must be 8 to 128 characters")
+	ErrNameTaken     = errors.New("username is taken")
+	ErrEmailTaken    = errors.New("email is taken")
+	ErrWrongPassword = errors.New("wrong username or password")
+	ErrInvalidToken  = errors.New("invalid or expired token")
+	ErrTooManyLogins = errors.New("too many failed logins, try again later")
+)
+
+var emailRegexp = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+
+// 用户名里不能有@和空白，和游客昵称的规则一样，避免和@提及混淆
+func validateName(name string) error {
+	length := utf8.RuneCountInString(name)
+	if length < kMinNameLength || length > kMaxNameLength || strings.ContainsAny(name, "@ \t\r\n") {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	if len(email) > kMaxEmailLength || !emailRegexp.MatchString(email) {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < kMinPasswordLength || length > kMaxPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+func Register(name string, email string, password string) (*info.UserInfo, error) {
+	name = strings.TrimSpace(name)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+	openId := strings.ToLower(name)
+	existing, _, err := model.ShareUserModel().FetchLocalUserByName(openId)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrNameTaken
+	}
+	if existing, _, err = model.ShareUserModel().FetchLocalUserByEmail(email); err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrEmailTaken
+	}
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	userInfo := &info.UserInfo{
+		UserOpenID:      openId,
+		UserAccountType: info.AccountTypeLocal,
+		UserName:        name,
+		Email:           email,
+		SmallFigureurl:  guest.AvatarURL(email),
+	}
+	// 上面的检查和插入之间可能有并发的注册，以唯一索引为准
+	err = model.ShareUserModel().AddLocalUser(userInfo, passwordHash)
+	if err == model.ErrLocalNameExists {
+		return nil, ErrNameTaken
+	}
+	if err == model.ErrLocalEmailExists {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return userInfo, nil
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// 帐号不存在时也校验一次密码，响应时间上看不出帐号是否存在
+func verifyDummy(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy password")
+	})
+	if dummyHash != "" {
+		VerifyPassword(password, dummyHash)
+	}
+}
+
+/* account可以是用户名或者邮箱，用户不存在和密码错误返回同样的错误。
+** ip是客户端的地址，失败次数太多时返回ErrTooManyLogins
+ */
+func Authenticate(account string, password string, ip string) (*info.UserInfo, error) {
+	account = strings.ToLower(strings.TrimSpace(account))
+	var userInfo *info.UserInfo = nil
+	var passwordHash string
+	var err error
+	if strings.Contains(account, "@") {
+		userInfo, passwordHash, err = model.ShareUserModel().FetchLocalUserByEmail(account)
+	} else {
+		userInfo, passwordHash, err = model.ShareUserModel().FetchLocalUserByName(account)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 帐号存在时按用户名计数，用户名和邮箱轮流尝试也算在同一个帐号上
+	failureKey := account
+	if userInfo != nil {
+		failureKey = userInfo.UserOpenID
+	}
+	accountCount, ipCount, err := model.ShareLoginFailureModel().FetchRecentCount(failureKey, ip,
+		time.Now().Add(-kLoginWindow).Unix())
+	if err != nil {
+		return nil, err
+	}
+	if accountCount >= kMaxAccountLoginFails || ipCount >= kMaxIPLoginFails {
+		return nil, ErrTooManyLogins
+	}
+	ok := false
+	if userInfo == nil || passwordHash == "" {
+		verifyDummy(password)
+	} else if ok, err = VerifyPassword(password, passwordHash); err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err = model.ShareLoginFailureModel().AddLoginFailure(failureKey, ip); err != nil {
+			return nil, err
+		}
+		return nil, ErrWrongPassword
+	}
+	if err = model.ShareLoginFailureModel().ClearAccount(failureKey); err != nil {
+		return nil, err
+	}
+	if err = model.ShareUserModel().UpdateLoginTime(userInfo.UserID); err != nil {
+		return nil, err
+	}
+	return userInfo, nil
+}
+
+func ChangePassword(userId int64, oldPassword string, newPassword string) error {
+	userInfo, passwordHash, err := model.ShareUserModel().FetchLocalUserById(userId)
+	if err != nil {
+		return err
+	}
+	if userInfo == nil {
+		return ErrWrongPassword
+	}
+	ok, err := VerifyPassword(oldPassword, passwordHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+	return setPassword(userId, newPassword)
+}
+
+func setPassword(userId int64, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return model.ShareUserModel().SetPasswordHash(userId, passwordHash)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+/* 往注册邮箱发送找回密码的链接，链接是resetURL?token=xxx。
+** 邮箱没有注册或者申请太频繁时都返回nil，不让别人借此探测哪些邮箱注册过
+ */
+func RequestReset(email string, resetURL string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := validateEmail(email); err != nil {
+		return err
+	}
+	userInfo, _, err := model.ShareUserModel().FetchLocalUserByEmail(email)
+	if err != nil || userInfo == nil {
+		return err
+	}
+	count, err := model.SharePasswordResetModel().FetchRecentCount(userInfo.UserID, time.Now().Add(-time.Hour).Unix())
+	if err != nil {
+		return err
+	}
+	if count >= kMaxResetPerHour {
+		return nil
+	}
+	var buf [32]byte
+	if _, err = rand.Read(buf[:]); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf[:])
+	err = model.SharePasswordResetModel().AddPasswordReset(userInfo.UserID, hashToken(token),
+		time.Now().Add(kResetExpireTime).Unix())
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("%s，你好：\n\n请在一个小时内打开下面的链接设置新的密码：\n%s?token=%s\n\n"+
+		"如果不是你本人的操作，请忽略这封邮件。", userInfo.UserName, resetURL, token)
+	return sendMail(email, "找回密码", body)
+}
+
+// 用找回密码的令牌设置新的密码，令牌用过之后作废
+func ResetPassword(token string, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+	userId, err := model.SharePasswordResetModel().UsePasswordReset(hashToken(token))
+	if err != nil {
+		return err
+	}
+	if userId <= 0 {
+		return ErrInvalidToken
+	}
+	return setPassword(userId, newPassword)
+}
@@ -0,0 +1,53 @@
+package account
+
+import (
+	"framework/base/config"
+	"framework/base/mail"
+	"sync"
+)
+
+/* 发信方式由mail.sender决定：
+** log(默认)只打印到日志，file写到mail.file.dir目录下，smtp通过mail.smtp配置的服务器发送。
+ */
+
+var mailSender mail.Sender = nil
+var mailSenderOnce sync.Once
+var mailSenderMutex sync.Mutex
+
+func configString(key string) string {
+	value, _ := config.GetDefaultConfigJsonReader().Get(key).(string)
+	return value
+}
+
+func senderFromConfig() mail.Sender {
+	switch configString("mail.sender") {
+	case "file":
+		return mail.NewFileSender(configString("mail.file.dir"))
+	case "smtp":
+		port, _ := config.GetDefaultConfigJsonReader().Get("mail.smtp.port").(int64)
+		return mail.NewSMTPSender(configString("mail.smtp.host"), int(port), configString("mail.smtp.user"),
+			configString("mail.smtp.password"))
+	}
+	return &mail.LogSender{}
+}
+
+// 替换发信方式，比如换成其他邮件服务
+func SetMailSender(sender mail.Sender) {
+	mailSenderMutex.Lock()
+	defer mailSenderMutex.Unlock()
+	mailSenderOnce.Do(func() {})
+	mailSender = sender
+}
+
+func MailSender() mail.Sender {
+	mailSenderMutex.Lock()
+	defer mailSenderMutex.Unlock()
+	mailSenderOnce.Do(func() {
+		mailSender = senderFromConfig()
+	})
+	return mailSender
+}
+
+func sendMail(to string, subject string, body string) error {
+	return MailSender().Send(&mail.Message{From: configString("mail.from"), To: to, Subject: subject, Body: body})
+}
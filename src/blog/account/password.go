@@ -0,0 +1,68 @@
+package account
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"framework/base/scrypt"
+	"strconv"
+	"strings"
+)
+
+/* 密码用scrypt做摘要，保存成 scrypt$N$r$p$salt$hash 的格式，salt和hash用base64编码。
+** 参数跟着摘要一起保存，以后调大N时老的密码依然可以验证。
+ */
+
+const (
+	kScryptN       = 1 << 15
+	kScryptR       = 8
+	kScryptP       = 1
+	kSaltLength    = 16
+	kHashLength    = 32
+	kPasswordAlgor = "scrypt"
+)
+
+var errInvalidHash = errors.New("invalid password hash")
+
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, kSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	hash, err := scrypt.Key([]byte(password), salt, kScryptN, kScryptR, kScryptP, kHashLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%d$%d$%s$%s", kPasswordAlgor, kScryptN, kScryptR, kScryptP,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+func VerifyPassword(password string, encoded string) (bool, error) {
+	values := strings.Split(encoded, "$")
+	if len(values) != 6 || values[0] != kPasswordAlgor {
+		return false, errInvalidHash
+	}
+	var params [3]int
+	for i := range params {
+		value, err := strconv.Atoi(values[i+1])
+		if err != nil {
+			return false, errInvalidHash
+		}
+		params[i] = value
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(values[4])
+	if err != nil {
+		return false, errInvalidHash
+	}
+	expect, err := base64.RawStdEncoding.DecodeString(values[5])
+	if err != nil || len(expect) == 0 {
+		return false, errInvalidHash
+	}
+	hash, err := scrypt.Key([]byte(password), salt, params[0], params[1], params[2], len(expect))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(hash, expect) == 1, nil
+}
@@ -0,0 +1,136 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"info"
+	"model"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/* 主人签发的API令牌，桌面客户端用 Authorization: Bearer <令牌> 调用/personal下的接口，
+** 不需要先模拟/personal/auth登录。
+** 1. 令牌是blt_加32个随机字节，只在签发时返回一次，表里只保存sha256；
+** 2. 每个令牌有一组scope，见info.TokenScope_*，接口按需要的scope检查；
+** 3. 可以设置有效期，可以随时撤销，每次使用记下最近使用时间(一分钟内只写一次)。
+** 签发和撤销令牌、两步验证、角色管理以及审计日志只能用主人密码登录的会话，令牌不能用，
+** 这样令牌泄露之后不能给自己续期、提升权限或者掩盖痕迹。
+ */
+
+const (
+	kTokenPrefix    = "blt_"
+	kTokenSize      = 32
+	kMaxNameLength  = 64
+	kLastUsedPeriod = 60
+)
+
+var (
+	ErrInvalidName  = errors.New("invalid token name")
+	ErrInvalidScope = errors.New("invalid token scope")
+	ErrNoSuchToken  = errors.New("no such token")
+)
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 去掉重复的scope，有不认识的返回ErrInvalidScope
+func normalizeScopes(scopes []string) ([]string, error) {
+	var ret []string = nil
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		if !info.IsTokenScope(scope) {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			ret = append(ret, scope)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, ErrInvalidScope
+	}
+	return ret, nil
+}
+
+// 签发令牌，ttl为0表示不过期，返回的明文令牌只有这一次机会看到
+func Issue(name string, scopes []string, ttl time.Duration) (string, *info.APITokenInfo, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > kMaxNameLength {
+		return "", nil, ErrInvalidName
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	buf := make([]byte, kTokenSize)
+	if _, err = rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := kTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	now := time.Now()
+	tokenInfo := &info.APITokenInfo{
+		Name:       name,
+		Scopes:     scopes,
+		Prefix:     token[:len(kTokenPrefix)+6],
+		CreateTime: now.Unix(),
+	}
+	if ttl > 0 {
+		tokenInfo.ExpireAt = now.Add(ttl).Unix()
+	}
+	if tokenInfo.ID, err = model.ShareAPITokenModel().AddToken(tokenInfo, hashToken(token)); err != nil {
+		return "", nil, err
+	}
+	return token, tokenInfo, nil
+}
+
+func List() ([]*info.APITokenInfo, error) {
+	return model.ShareAPITokenModel().FetchTokenList()
+}
+
+func Revoke(id int64) error {
+	ok, err := model.ShareAPITokenModel().RevokeToken(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoSuchToken
+	}
+	return nil
+}
+
+// 没有撤销也没有过期的令牌，找不到时返回nil
+func Lookup(token string) (*info.APITokenInfo, error) {
+	if !strings.HasPrefix(token, kTokenPrefix) {
+		return nil, nil
+	}
+	tokenInfo, err := model.ShareAPITokenModel().FetchTokenByHash(hashToken(token))
+	if err != nil || tokenInfo == nil {
+		return nil, err
+	}
+	if !tokenInfo.IsValid(time.Now().Unix()) {
+		return nil, nil
+	}
+	return tokenInfo, nil
+}
+
+// 令牌有效并且有scope时返回true，同时记下使用时间
+func Authorize(token string, scope string) (bool, error) {
+	tokenInfo, err := Lookup(token)
+	if err != nil || tokenInfo == nil || !tokenInfo.HasScope(scope) {
+		return false, err
+	}
+	now := time.Now().Unix()
+	if now-tokenInfo.LastUsed >= kLastUsedPeriod {
+		if err = model.ShareAPITokenModel().UpdateLastUsed(tokenInfo.ID, now); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
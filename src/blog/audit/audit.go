@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"info"
+	"model"
+	"time"
+	"unicode/utf8"
+)
+
+/* 审计日志：记录主人、API令牌和admin、moderator所有改变数据的操作，
+** 包括谁(操作者、ip、user agent)、什么时候、做了什么(action)、对哪个对象，以及操作前后的摘要。
+** 表只追加不修改，写日志失败只打印错误，不影响操作本身。
+** action的格式是 对象.动作，比如blog.upload、comment.approve、owner.login。
+ */
+
+// 操作者的类型
+const (
+	// 用主人密码登录的会话
+	ActorOwner = "owner"
+	// 主人签发的API令牌，ID和Name是令牌的
+	ActorToken = "token"
+	// 登录的admin或者moderator，ID和Name是用户的
+	ActorUser = "user"
+	// 还没有通过验证的请求，比如登录失败
+	ActorAnonymous = "anonymous"
+)
+
+// 操作的对象
+const (
+	TargetBlog     = "blog"
+	TargetComment  = "comment"
+	TargetPlugin   = "plugin"
+	TargetCategory = "category"
+	TargetTag      = "tag"
+	TargetToken    = "token"
+	TargetUser     = "user"
+	TargetOwner    = "owner"
+	TargetStats    = "stats"
+)
+
+const (
+	kResultOK = "ok"
+	// 摘要和user agent太长时截断
+	kMaxSummaryLength   = 2000
+	kMaxUserAgentLength = 512
+	kMaxResultLength    = 512
+	// 和audit_log.ip的长度一致
+	kMaxIPLength = 64
+)
+
+type Actor struct {
+	Type      string
+	ID        int64
+	Name      string
+	IP        string
+	UserAgent string
+}
+
+func truncate(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	text = text[:size]
+	// 不截断半个utf8字符
+	for len(text) > 0 && !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// nil记为空，字符串原样保存，其他的转成json
+func summarize(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return truncate(v, kMaxSummaryLength)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return truncate(string(data), kMaxSummaryLength)
+}
+
+func resultText(err error) string {
+	if err == nil {
+		return kResultOK
+	}
+	return truncate(err.Error(), kMaxResultLength)
+}
+
+/* 记一条日志，before和after是操作前后的摘要，可以是nil、字符串或者能转成json的值，
+** err是操作的结果，失败的操作也要记，比如登录失败。
+ */
+func (a *Actor) Record(action string, targetType string, targetId int64, before interface{}, after interface{},
+	err error) {
+	auditInfo := &info.AuditInfo{
+		Time:       time.Now().Unix(),
+		ActorType:  a.Type,
+		ActorID:    a.ID,
+		ActorName:  a.Name,
+		IP:         truncate(a.IP, kMaxIPLength),
+		UserAgent:  truncate(a.UserAgent, kMaxUserAgentLength),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetId,
+		Before:     summarize(before),
+		After:      summarize(after),
+		Result:     resultText(err),
+	}
+	if dbErr := model.ShareAuditModel().AddAudit(auditInfo); dbErr != nil {
+		fmt.Println("add audit error: ", dbErr, ", action: ", action)
+	}
+}
+
+// 一页日志和符合条件的总数
+func Query(filter *info.AuditFilter, offset int, limit int) ([]*info.AuditInfo, int, error) {
+	total, err := model.ShareAuditModel().FetchAuditCount(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	auditList, err := model.ShareAuditModel().FetchAuditList(filter, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return auditList, total, nil
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"encoding/csv"
+	"info"
+	"io"
+	"model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 导出时每次从数据库读的条数
+	kExportBatchSize = 500
+	// 最多导出的条数，需要更多时缩小时间范围
+	kMaxExportCount = 100000
+)
+
+var csvHeader = []string{"id", "time", "actor_type", "actor_id", "actor_name", "ip", "user_agent", "action",
+	"target_type", "target_id", "before", "after", "result"}
+
+// 文本列都要转义，包括ip，老的日志里可能有伪造的X-Forwarded-For
+func csvRecord(auditInfo *info.AuditInfo) []string {
+	return []string{
+		strconv.FormatInt(auditInfo.ID, 10),
+		time.Unix(auditInfo.Time, 0).Format("2006-01-02 15:04:05"),
+		csvSafe(auditInfo.ActorType),
+		strconv.FormatInt(auditInfo.ActorID, 10),
+		csvSafe(auditInfo.ActorName),
+		csvSafe(auditInfo.IP),
+		csvSafe(auditInfo.UserAgent),
+		csvSafe(auditInfo.Action),
+		csvSafe(auditInfo.TargetType),
+		strconv.FormatInt(auditInfo.TargetID, 10),
+		csvSafe(auditInfo.Before),
+		csvSafe(auditInfo.After),
+		csvSafe(auditInfo.Result),
+	}
+}
+
+// 用表格软件打开时，=、+、-、@、tab和回车开头的内容会被当成公式，前面加一个单引号
+func csvSafe(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+type fetchFunc func(filter *info.AuditFilter, offset int, limit int) ([]*info.AuditInfo, error)
+
+// 按id从大到小分批读取，导出过程中新写的日志不会打乱分页
+func exportCSV(w io.Writer, filter *info.AuditFilter, fetch fetchFunc) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	batchFilter := *filter
+	for count := 0; count < kMaxExportCount; {
+		auditList, err := fetch(&batchFilter, 0, kExportBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, auditInfo := range auditList {
+			if err = writer.Write(csvRecord(auditInfo)); err != nil {
+				return err
+			}
+		}
+		count += len(auditList)
+		if len(auditList) < kExportBatchSize {
+			break
+		}
+		batchFilter.BeforeID = auditList[len(auditList)-1].ID
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// 按条件导出所有日志，最多kMaxExportCount条
+func Export(w io.Writer, filter *info.AuditFilter) error {
+	return exportCSV(w, filter, model.ShareAuditModel().FetchAuditList)
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"info"
+	"strings"
+	"testing"
+)
+
+// 模拟按id倒序的分页查询
+func fakeFetch(total int, calls *int) fetchFunc {
+	return func(filter *info.AuditFilter, offset int, limit int) ([]*info.AuditInfo, error) {
+		*calls++
+		var auditList []*info.AuditInfo = nil
+		for id := int64(total); id > 0 && len(auditList) < limit; id-- {
+			if filter.BeforeID > 0 && id >= filter.BeforeID {
+				continue
+			}
+			auditList = append(auditList, &info.AuditInfo{ID: id, Action: "blog.upload", Result: "ok"})
+		}
+		return auditList, nil
+	}
+}
+
+func Test_ExportBatches(t *testing.T) {
+	var buf bytes.Buffer
+	calls := 0
+	total := kExportBatchSize*2 + 3
+	if err := exportCSV(&buf, &info.AuditFilter{}, fakeFetch(total, &calls)); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != total+1 {
+		t.Fatal("expect ", total+1, " rows, got ", len(records))
+	}
+	if strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Error("wrong header: ", records[0])
+	}
+	// 没有重复也没有遗漏
+	if records[1][0] != "1003" || records[len(records)-1][0] != "1" {
+		t.Error("wrong order: ", records[1][0], " ", records[len(records)-1][0])
+	}
+	if calls != 3 {
+		t.Error("expect 3 batches, got ", calls)
+	}
+}
+
+func Test_CSVSafe(t *testing.T) {
+	var buf bytes.Buffer
+	fetch := func(filter *info.AuditFilter, offset int, limit int) ([]*info.AuditInfo, error) {
+		return []*info.AuditInfo{{ID: 1, ActorName: "=cmd|' /C calc'!A0", IP: `=HYPERLINK("http://x")`,
+			UserAgent: "\t=1+1", Result: "\r@SUM(1)", Before: `{"title":"a,b"}`, After: "line1\nline2"}}, nil
+	}
+	if err := exportCSV(&buf, &info.AuditFilter{}, fetch); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatal("expect 2 rows, got ", len(records))
+	}
+	if records[1][4] != "'=cmd|' /C calc'!A0" {
+		t.Error("formula should be escaped: ", records[1][4])
+	}
+	if records[1][5] != `'=HYPERLINK("http://x")` {
+		t.Error("ip should be escaped: ", records[1][5])
+	}
+	if records[1][6] != "'\t=1+1" || records[1][12] != "'\r@SUM(1)" {
+		t.Error("tab and carriage return should be escaped: ", records[1][6], records[1][12])
+	}
+	if records[1][10] != `{"title":"a,b"}` || records[1][11] != "line1\nline2" {
+		t.Error("summary should round trip: ", records[1][10], records[1][11])
+	}
+}
+
+func Test_Summarize(t *testing.T) {
+	if summarize(nil) != "" {
+		t.Error("nil should be empty")
+	}
+	if summarize(map[string]interface{}{"title": "标题"}) != `{"title":"标题"}` {
+		t.Error("wrong json summary: ", summarize(map[string]interface{}{"title": "标题"}))
+	}
+	long := summarize(strings.Repeat("中", kMaxSummaryLength))
+	if len(long) > kMaxSummaryLength || !strings.HasPrefix(long, "中") || strings.Trim(long, "中") != "" {
+		t.Error("summary should be truncated at rune boundary")
+	}
+}
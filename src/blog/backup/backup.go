@@ -0,0 +1,309 @@
+package backup
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"framework/base/config"
+	"framework/base/timer"
+	"framework/database"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* 全站备份：一个zip文件里包含
+** manifest.json，版本、时间以及其它每个文件的大小和sha256；
+** db/<表名>.json，数据库里每张表的导出，格式见framework/database/dump.go；
+** files/<目录名>/...，storage.file下raw、blog、plugin、cache几个目录的全部文件。
+** 恢复时先校验全部文件，校验通过之后才会改动数据库和目录。
+ */
+
+const (
+	// 2开始表数据按base64导出，1的备份仍然可以恢复
+	kBackupVersion  = 2
+	kManifestName   = "manifest.json"
+	kDBPrefix       = "db/"
+	kFilesPrefix    = "files/"
+	kBackupPrefix   = "blog-backup-"
+	kBackupTimeFmt  = "20060102-150405"
+	kBackupFileMode = 0644
+)
+
+const (
+	kDefaultBackupKeep         = 7
+	kDefaultBackupIntervalHour = 24
+)
+
+// 需要备份的存储目录，对应storage.file下的配置
+var storageNameList []string = []string{"raw", "blog", "plugin", "cache"}
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	Version int              `json:"version"`
+	Time    int64            `json:"time"`
+	Tables  []string         `json:"tables"`
+	Storage []string         `json:"storage"`
+	Entries []*ManifestEntry `json:"entries"`
+}
+
+var backupLock sync.Mutex
+
+var backupTimer *timer.Timer = nil
+
+var backupOnce sync.Once
+
+func configInteger(key string, defaultValue int) int {
+	if value, ok := config.GetDefaultConfigJsonReader().Get(key).(int64); ok && value > 0 {
+		return int(value)
+	}
+	return defaultValue
+}
+
+func configString(key string) string {
+	value, _ := config.GetDefaultConfigJsonReader().Get(key).(string)
+	return value
+}
+
+func storagePath(name string) string {
+	return configString("storage.file." + name)
+}
+
+func isStorageName(name string) bool {
+	for _, storageName := range storageNameList {
+		if name == storageName {
+			return true
+		}
+	}
+	return false
+}
+
+// 写入zip的同时计算大小和sha256
+type entryWriter struct {
+	w    io.Writer
+	hash hash.Hash
+	size int64
+}
+
+func (e *entryWriter) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	e.hash.Write(p[:n])
+	e.size += int64(n)
+	return n, err
+}
+
+type archiveWriter struct {
+	zipWriter *zip.Writer
+	manifest  *Manifest
+}
+
+func (a *archiveWriter) addEntry(name string, modTime time.Time, write func(w io.Writer) error) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	header.SetModTime(modTime)
+	header.SetMode(kBackupFileMode)
+	w, err := a.zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	writer := &entryWriter{w: w, hash: sha256.New()}
+	if err = write(writer); err != nil {
+		return err
+	}
+	a.manifest.Entries = append(a.manifest.Entries, &ManifestEntry{
+		Path:   name,
+		Size:   writer.size,
+		SHA256: hex.EncodeToString(writer.hash.Sum(nil)),
+	})
+	return nil
+}
+
+// 所有的表在同一个快照里导出
+func (a *archiveWriter) addTables() error {
+	snapshot, err := database.DatabaseInstance().BeginSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	tableList, err := snapshot.TableList()
+	if err != nil {
+		return err
+	}
+	for _, table := range tableList {
+		err = a.addEntry(kDBPrefix+table+".json", time.Now(), func(w io.Writer) error {
+			return snapshot.DumpTable(table, w)
+		})
+		if err != nil {
+			return fmt.Errorf("dump table %s: %v", table, err)
+		}
+		a.manifest.Tables = append(a.manifest.Tables, table)
+	}
+	return nil
+}
+
+func (a *archiveWriter) addStorage(name string, root string) error {
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+	err := filepath.Walk(root, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return a.addEntry(kFilesPrefix+name+"/"+filepath.ToSlash(rel), fileInfo.ModTime(), func(w io.Writer) error {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	a.manifest.Storage = append(a.manifest.Storage, name)
+	return nil
+}
+
+/* 备份到dir目录下，返回备份文件的路径。
+** 先写到临时文件，全部成功之后才改名，失败时不会留下不完整的备份。
+ */
+func Backup(dir string) (string, error) {
+	backupLock.Lock()
+	defer backupLock.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	backupPath := filepath.Join(dir, kBackupPrefix+now.Format(kBackupTimeFmt)+".zip")
+	tmpPath := backupPath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, kBackupFileMode)
+	if err != nil {
+		return "", err
+	}
+	err = writeArchive(f, now)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return backupPath, os.Rename(tmpPath, backupPath)
+}
+
+func writeArchive(w io.Writer, now time.Time) error {
+	a := &archiveWriter{
+		zipWriter: zip.NewWriter(w),
+		manifest:  &Manifest{Version: kBackupVersion, Time: now.Unix()},
+	}
+	if err := a.addTables(); err != nil {
+		return err
+	}
+	for _, name := range storageNameList {
+		root := storagePath(name)
+		if root == "" {
+			continue
+		}
+		if err := a.addStorage(name, root); err != nil {
+			return fmt.Errorf("backup storage %s: %v", name, err)
+		}
+	}
+	manifest, err := json.MarshalIndent(a.manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	manifestWriter, err := a.zipWriter.Create(kManifestName)
+	if err != nil {
+		return err
+	}
+	if _, err = manifestWriter.Write(manifest); err != nil {
+		return err
+	}
+	return a.zipWriter.Close()
+}
+
+// dir下已有的备份，按时间从旧到新
+func List(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, kBackupPrefix+"*.zip"))
+	if err != nil {
+		return nil, err
+	}
+	// 文件名里的时间格式保证了字典序就是时间顺序
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// 只保留最新的keep个备份
+func Prune(dir string, keep int) (int, error) {
+	backupList, err := List(dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := 0; i < len(backupList)-keep; i++ {
+		if err = os.Remove(backupList[i]); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+/* 定时备份，配置了backup.dir才会启动。
+** 每隔backup.interval小时备份一次，只保留最新的backup.keep个。
+ */
+func StartBackupTimer() {
+	dir := configString("backup.dir")
+	if dir == "" {
+		return
+	}
+	backupOnce.Do(func() {
+		interval := time.Duration(configInteger("backup.interval", kDefaultBackupIntervalHour)) * time.Hour
+		backupTimer = timer.NewRepeatingTimer()
+		backupTimer.Start(interval, func() {
+			path, err := Backup(dir)
+			if err != nil {
+				fmt.Println("backup error: ", err)
+				return
+			}
+			fmt.Println("backup: ", path)
+			if _, err = Prune(dir, configInteger("backup.keep", kDefaultBackupKeep)); err != nil {
+				fmt.Println("prune backup error: ", err)
+			}
+		})
+	})
+}
+
+// 备份里的路径不能跳出目标目录
+func safeRelPath(name string, prefix string) (string, error) {
+	rel := strings.TrimPrefix(name, prefix)
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if rel == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path in backup: %s", name)
+	}
+	return clean, nil
+}
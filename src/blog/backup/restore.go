@@ -0,0 +1,242 @@
+package backup
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"framework/database"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+func readManifest(fileMap map[string]*zip.File) (*Manifest, error) {
+	f, ok := fileMap[kManifestName]
+	if !ok {
+		return nil, fmt.Errorf("no %s in backup", kManifestName)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version <= 0 || manifest.Version > kBackupVersion {
+		return nil, fmt.Errorf("unsupport backup version: %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+func checkEntry(f *zip.File, entry *ManifestEntry) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, rc)
+	if err != nil {
+		return err
+	}
+	if size != entry.Size || hex.EncodeToString(h.Sum(nil)) != entry.SHA256 {
+		return fmt.Errorf("%s: %v", entry.Path, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// 校验备份里的每个文件，备份里不能有manifest之外的文件
+func verifyArchive(reader *zip.Reader) (*Manifest, map[string]*zip.File, error) {
+	var fileMap map[string]*zip.File = make(map[string]*zip.File)
+	for _, f := range reader.File {
+		fileMap[f.Name] = f
+	}
+	manifest, err := readManifest(fileMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	var listed map[string]bool = map[string]bool{kManifestName: true}
+	for _, entry := range manifest.Entries {
+		if strings.HasPrefix(entry.Path, kFilesPrefix) {
+			if _, err = safeRelPath(entry.Path, kFilesPrefix); err != nil {
+				return nil, nil, err
+			}
+		} else if !strings.HasPrefix(entry.Path, kDBPrefix) {
+			return nil, nil, fmt.Errorf("invalid path in backup: %s", entry.Path)
+		}
+		f, ok := fileMap[entry.Path]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s is missing", entry.Path)
+		}
+		if err = checkEntry(f, entry); err != nil {
+			return nil, nil, err
+		}
+		listed[entry.Path] = true
+	}
+	for name := range fileMap {
+		if !listed[name] {
+			return nil, nil, fmt.Errorf("%s is not in manifest", name)
+		}
+	}
+	for _, table := range manifest.Tables {
+		if !tableNameRegexp.MatchString(table) {
+			return nil, nil, fmt.Errorf("invalid table name: %s", table)
+		}
+		if !listed[kDBPrefix+table+".json"] {
+			return nil, nil, fmt.Errorf("table %s is missing", table)
+		}
+	}
+	for _, name := range manifest.Storage {
+		if !isStorageName(name) {
+			return nil, nil, fmt.Errorf("unsupport storage: %s", name)
+		}
+	}
+	return manifest, fileMap, nil
+}
+
+// 只校验不恢复
+func Verify(path string) (*Manifest, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	manifest, _, err := verifyArchive(&reader.Reader)
+	return manifest, err
+}
+
+// 导入到临时表，表头里的表名和manifest对不上时不会执行任何DDL
+func stageTable(f *zip.File, table string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err = database.DatabaseInstance().StageTable(rc, table); err != nil {
+		return fmt.Errorf("restore table %s: %v", table, err)
+	}
+	return nil
+}
+
+/* 所有的表都先导入到临时表，全部成功之后用一条RENAME TABLE一起替换，
+** 失败时原来的表保持不变。
+ */
+func restoreTables(manifest *Manifest, fileMap map[string]*zip.File) error {
+	var stagedList []string = nil
+	for _, table := range manifest.Tables {
+		if err := stageTable(fileMap[kDBPrefix+table+".json"], table); err != nil {
+			database.DatabaseInstance().DropStagedTables(stagedList)
+			return err
+		}
+		stagedList = append(stagedList, table)
+	}
+	if err := database.DatabaseInstance().SwapStagedTables(stagedList); err != nil {
+		database.DatabaseInstance().DropStagedTables(stagedList)
+		return err
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, kBackupFileMode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, rc); err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, f.Modified, f.Modified)
+}
+
+/* 先解压到目录旁边的临时目录，解压成功之后再替换原来的目录，
+** 失败时原来的目录保持不变。
+ */
+func restoreStorage(manifest *Manifest, fileMap map[string]*zip.File, name string) error {
+	root := storagePath(name)
+	if root == "" {
+		return fmt.Errorf("storage.file.%s is not configured", name)
+	}
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	tmpRoot := root + ".restore-" + suffix
+	prefix := kFilesPrefix + name + "/"
+	if err := os.MkdirAll(tmpRoot, 0755); err != nil {
+		return err
+	}
+	for _, entry := range manifest.Entries {
+		if !strings.HasPrefix(entry.Path, prefix) {
+			continue
+		}
+		rel, err := safeRelPath(entry.Path, prefix)
+		if err == nil {
+			err = extractFile(fileMap[entry.Path], filepath.Join(tmpRoot, rel))
+		}
+		if err != nil {
+			os.RemoveAll(tmpRoot)
+			return err
+		}
+	}
+	oldRoot := root + ".old-" + suffix
+	if err := os.Rename(root, oldRoot); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(tmpRoot)
+		return err
+	}
+	if err := os.Rename(tmpRoot, root); err != nil {
+		os.Rename(oldRoot, root)
+		return err
+	}
+	return os.RemoveAll(oldRoot)
+}
+
+/* 从备份恢复数据库和存储目录，备份里的表会被整张替换，备份里没有的表和目录保持不变。
+** 恢复时服务最好是停止的，命令行见startup/command.go。
+ */
+func Restore(path string) (*Manifest, error) {
+	backupLock.Lock()
+	defer backupLock.Unlock()
+
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	manifest, fileMap, err := verifyArchive(&reader.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err = restoreTables(manifest, fileMap); err != nil {
+		return manifest, err
+	}
+	for _, name := range manifest.Storage {
+		if err = restoreStorage(manifest, fileMap, name); err != nil {
+			return manifest, fmt.Errorf("restore storage %s: %v", name, err)
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,134 @@
+package guest
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"framework/base/config"
+	"framework/base/markdown"
+	"info"
+	"model"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+/* 游客评论：comment.guest.enable为1时，没有登录的读者填写昵称(必填)、邮箱和网址(可选)就能评论。
+** 游客保存在user表里，类型为AccountTypeGuest，同一个会话里再次评论时更新原来的记录。
+** 头像根据邮箱生成，没有填邮箱时根据随机生成的标识生成，见/avatar。
+** 昵称不能和主人以及登录用户的名字相同，免得冒充别人。
+ */
+
+const (
+	kMaxNameLength    = 32
+	kMaxEmailLength   = 256
+	kMaxWebsiteLength = 256
+)
+
+var (
+	ErrGuestDisabled  = errors.New("guest comment is disabled")
+	ErrInvalidName    = errors.New("invalid nickname")
+	ErrInvalidEmail   = errors.New("invalid email")
+	ErrInvalidWebsite = errors.New("invalid website")
+	ErrNameTaken      = errors.New("nickname is used by a registered user")
+)
+
+var emailRegexp = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+
+func Enabled() bool {
+	value, _ := config.GetDefaultConfigJsonReader().Get("comment.guest.enable").(int64)
+	return value == 1
+}
+
+// 昵称里不能有@和空白，避免和@提及混淆
+func Validate(userInfo *info.UserInfo) error {
+	userInfo.UserName = strings.TrimSpace(userInfo.UserName)
+	userInfo.Email = strings.TrimSpace(userInfo.Email)
+	userInfo.Website = strings.TrimSpace(userInfo.Website)
+	nameLength := utf8.RuneCountInString(userInfo.UserName)
+	if nameLength == 0 || nameLength > kMaxNameLength || strings.ContainsAny(userInfo.UserName, "@ \t\r\n") {
+		return ErrInvalidName
+	}
+	if userInfo.Email != "" && (len(userInfo.Email) > kMaxEmailLength || !emailRegexp.MatchString(userInfo.Email)) {
+		return ErrInvalidEmail
+	}
+	if userInfo.Website != "" {
+		lower := strings.ToLower(userInfo.Website)
+		if len(userInfo.Website) > kMaxWebsiteLength || !markdown.IsSafeURL(userInfo.Website) ||
+			!(strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")) {
+			return ErrInvalidWebsite
+		}
+	}
+	return nil
+}
+
+// 昵称是主人的名字或者已经被登录用户使用时返回ErrNameTaken
+func checkNameTaken(name string) error {
+	ownerName, _ := config.GetDefaultConfigJsonReader().Get("account.owner.name").(string)
+	if ownerName != "" && strings.EqualFold(name, ownerName) {
+		return ErrNameTaken
+	}
+	taken, err := model.ShareUserModel().IsMemberName(name)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrNameTaken
+	}
+	return nil
+}
+
+func AvatarURL(seed string) string {
+	sum := md5.Sum([]byte(seed))
+	return "/avatar?seed=" + hex.EncodeToString(sum[:])
+}
+
+func randomOpenId() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return "guest-" + hex.EncodeToString(buf[:]), nil
+}
+
+/* 保存游客信息，guestId是会话里记住的游客，为0或者已经不存在时新建一个。
+** 返回保存之后的游客，调用者把UserID记到会话里。
+ */
+func Save(guestId int64, userInfo *info.UserInfo) (*info.UserInfo, error) {
+	if !Enabled() {
+		return nil, ErrGuestDisabled
+	}
+	if err := Validate(userInfo); err != nil {
+		return nil, err
+	}
+	if err := checkNameTaken(userInfo.UserName); err != nil {
+		return nil, err
+	}
+	var saved *info.UserInfo = nil
+	if guestId > 0 {
+		var err error
+		if saved, err = model.ShareUserModel().FetchGuestInfo(guestId); err != nil {
+			return nil, err
+		}
+	}
+	if saved == nil {
+		openId, err := randomOpenId()
+		if err != nil {
+			return nil, err
+		}
+		saved = &info.UserInfo{UserOpenID: openId, UserAccountType: info.AccountTypeGuest}
+	}
+	saved.UserName = userInfo.UserName
+	saved.Email = userInfo.Email
+	saved.Website = userInfo.Website
+	if saved.Email != "" {
+		saved.SmallFigureurl = AvatarURL(strings.ToLower(saved.Email))
+	} else {
+		saved.SmallFigureurl = AvatarURL(saved.UserOpenID)
+	}
+	if saved.UserID > 0 {
+		return saved, model.ShareUserModel().UpdateGuest(saved)
+	}
+	return saved, model.ShareUserModel().AddGuest(saved)
+}
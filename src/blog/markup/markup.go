@@ -0,0 +1,54 @@
+package markup
+
+import (
+	"fmt"
+	"framework/base/markdown"
+	"info"
+	"model"
+)
+
+/* 评论内容按Markdown子集渲染，@昵称链接到对应读者的主页。
+** 渲染的结果和原文一起保存在comment表里，显示时直接使用，
+** 老的评论没有渲染结果，第一次显示时渲染并补上。
+ */
+
+// 一条评论最多把几个@渲染成链接
+const kMaxMentionCount = 10
+
+func UserURL(userId int64) string {
+	return fmt.Sprintf("/user/%d", userId)
+}
+
+func RenderComment(content string) (string, error) {
+	nameList := markdown.Mentions(content)
+	if len(nameList) > kMaxMentionCount {
+		nameList = nameList[:kMaxMentionCount]
+	}
+	userIdMap, err := model.ShareUserModel().FetchUserIdMapByName(nameList)
+	if err != nil {
+		return "", err
+	}
+	return markdown.Render(content, &markdown.Options{MentionURL: func(name string) string {
+		if userId, ok := userIdMap[name]; ok {
+			return UserURL(userId)
+		}
+		return ""
+	}}), nil
+}
+
+// 显示用的HTML，没有缓存时渲染之后写回数据库，查询昵称失败时先不带@链接显示
+func CommentHTML(commentInfo *info.CommentInfo) string {
+	if commentInfo.ContentHTML != "" || commentInfo.Content == "" {
+		return commentInfo.ContentHTML
+	}
+	contentHTML, err := RenderComment(commentInfo.Content)
+	if err != nil {
+		fmt.Println("render comment error: ", err)
+		return markdown.Render(commentInfo.Content, nil)
+	}
+	if err = model.ShareCommentModel().SetCommentHTML(commentInfo.CommentID, contentHTML); err != nil {
+		fmt.Println("save comment html error: ", err)
+	}
+	commentInfo.ContentHTML = contentHTML
+	return contentHTML
+}
@@ -0,0 +1,110 @@
+package moderation
+
+import (
+	"blog/markup"
+	"blog/trash"
+	"errors"
+	"info"
+	"model"
+	"time"
+)
+
+// 发表之后多少分钟内可以编辑
+const kDefaultEditWindowMinute = 15
+
+var (
+	ErrCommentNotExist = errors.New("no such comment")
+	ErrNotAuthor       = errors.New("not the author of the comment")
+	ErrEditExpired     = errors.New("comment can not be edited any more")
+)
+
+// 不管是博客还是插件下的评论，不包括回收站里的
+func fetchComment(commentId int) (*info.CommentInfo, error) {
+	commentInfo, err := model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Blog, commentId)
+	if err == nil && commentInfo == nil {
+		commentInfo, err = model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Plugin, commentId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if commentInfo == nil || commentInfo.IsRemoved() {
+		return nil, ErrCommentNotExist
+	}
+	return commentInfo, nil
+}
+
+func EditWindow() time.Duration {
+	return time.Duration(configInteger("comment.edit_window", kDefaultEditWindowMinute)) * time.Minute
+}
+
+// 被拒绝和标记为垃圾的评论作者看不到，也不能再编辑
+func isEditable(commentInfo *info.CommentInfo) bool {
+	return commentInfo.Status == info.CommentStatus_Approved || commentInfo.Status == info.CommentStatus_Pending
+}
+
+/* 作者在comment.edit_window分钟内编辑自己的评论，之前的内容保存在编辑历史里。
+** 编辑之后的内容重新按审核规则判断，不能直接通过的改回pending，已经通过的保持通过，返回新的状态。
+ */
+func Edit(commentId int, userId int64, content string) (string, error) {
+	commentInfo, err := fetchComment(commentId)
+	if err != nil {
+		return "", err
+	}
+	if userId <= 0 || commentInfo.UserID != userId {
+		return "", ErrNotAuthor
+	}
+	if !isEditable(commentInfo) {
+		return "", ErrCommentNotExist
+	}
+	if time.Since(time.Unix(commentInfo.Time, 0)) > EditWindow() {
+		return "", ErrEditExpired
+	}
+	status, err := Check(commentInfo.Type, commentInfo.TypeID, userId, content)
+	if err != nil {
+		return "", err
+	}
+	contentHTML, err := markup.RenderComment(content)
+	if err != nil {
+		return "", err
+	}
+	status, err = model.ShareCommentModel().EditComment(commentId, content, contentHTML,
+		status != info.CommentStatus_Approved)
+	if err == nil && status == "" {
+		// 检查之后被主人拒绝或者标记为垃圾
+		return "", ErrCommentNotExist
+	}
+	return status, err
+}
+
+// 作者删除自己的评论，没有时间限制
+func Delete(commentId int, userId int64) error {
+	commentInfo, err := fetchComment(commentId)
+	if err != nil {
+		return err
+	}
+	if userId <= 0 || commentInfo.UserID != userId {
+		return ErrNotAuthor
+	}
+	return remove(commentInfo)
+}
+
+// 主人删除任意一条评论
+func Remove(commentId int) error {
+	commentInfo, err := fetchComment(commentId)
+	if err != nil {
+		return err
+	}
+	return remove(commentInfo)
+}
+
+// 有回复的评论只清空内容留下占位，保证楼层完整，没有回复的直接放入回收站
+func remove(commentInfo *info.CommentInfo) error {
+	hasReply, err := model.ShareCommentModel().HasReply(commentInfo.CommentID)
+	if err != nil {
+		return err
+	}
+	if hasReply {
+		return model.ShareCommentModel().RemoveComment(commentInfo.CommentID)
+	}
+	return trash.TrashComment(commentInfo.CommentID)
+}
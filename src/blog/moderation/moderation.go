@@ -0,0 +1,180 @@
+package moderation
+
+import (
+	"blog/notify"
+	"blog/permission"
+	"blog/spam"
+	"errors"
+	"fmt"
+	"framework/base/config"
+	"info"
+	"model"
+	"strings"
+)
+
+/* 评论审核规则，新评论按下面的顺序判断，命中第一条就返回：
+** 1. 包含comment.moderation.blocked_words里的任意一个词，标记为垃圾评论；
+** 2. 链接数超过comment.moderation.max_links，等待审核；
+** 3. 博客(插件)设置了需要审核，等待审核；
+** 4. comment.moderation.first_time为1并且用户还没有审核通过的评论，等待审核；
+** 其它情况直接通过。
+** 没有命中第1条时再用贝叶斯分类器打分，超过comment.spam.threshold的标记为垃圾评论，见blog/spam。
+** 游客的评论不是垃圾评论时默认等待审核，comment.guest.moderation为0时和登录的读者一样处理。
+ */
+
+const kDefaultMaxLinks = 2
+
+var (
+	ErrCommentClosed = errors.New("comment is closed")
+	ErrNeedLogin     = errors.New("login required")
+)
+
+type Rule struct {
+	BlockedWords []string
+	MaxLinks     int
+	FirstTime    bool
+}
+
+func configInteger(key string, defaultValue int) int {
+	if value, ok := config.GetDefaultConfigJsonReader().Get(key).(int64); ok && value > 0 {
+		return int(value)
+	}
+	return defaultValue
+}
+
+// 每次都从配置里读，修改配置之后不用重启
+func ConfigRule() *Rule {
+	rule := &Rule{
+		MaxLinks:  configInteger("comment.moderation.max_links", kDefaultMaxLinks),
+		FirstTime: configInteger("comment.moderation.first_time", 0) == 1,
+	}
+	wordList, _ := config.GetDefaultConfigJsonReader().Get("comment.moderation.blocked_words").([]interface{})
+	for _, word := range wordList {
+		if s, ok := word.(string); ok && strings.TrimSpace(s) != "" {
+			rule.BlockedWords = append(rule.BlockedWords, strings.ToLower(strings.TrimSpace(s)))
+		}
+	}
+	return rule
+}
+
+// firstTime表示用户还没有审核通过的评论
+func (r *Rule) Evaluate(setting *info.CommentSettingInfo, firstTime bool, content string) string {
+	lowerContent := strings.ToLower(content)
+	for _, word := range r.BlockedWords {
+		if strings.Contains(lowerContent, word) {
+			return info.CommentStatus_Spam
+		}
+	}
+	if spam.CountLinks(content) > r.MaxLinks {
+		return info.CommentStatus_Pending
+	}
+	if setting != nil && setting.RequireApproval {
+		return info.CommentStatus_Pending
+	}
+	if r.FirstTime && firstTime {
+		return info.CommentStatus_Pending
+	}
+	return info.CommentStatus_Approved
+}
+
+// 检查博客(插件)是否允许评论，允许时返回新评论的状态，userId为0表示没有登录，被封禁的用户返回permission.ErrBanned
+func Check(commentType int, typeId int, userId int64, content string) (string, error) {
+	if userId > 0 {
+		if err := permission.Check(userId, info.Permission_Comment); err != nil {
+			return "", err
+		}
+	}
+	setting, err := model.ShareCommentSettingModel().FetchCommentSetting(commentType, typeId)
+	if err != nil {
+		return "", err
+	}
+	if setting.Closed {
+		return "", ErrCommentClosed
+	}
+	if setting.RequireLogin && userId <= 0 {
+		return "", ErrNeedLogin
+	}
+	rule := ConfigRule()
+	firstTime := true
+	if rule.FirstTime && userId > 0 {
+		hasApproved, err := model.ShareCommentModel().HasApprovedComment(userId)
+		if err != nil {
+			return "", err
+		}
+		firstTime = !hasApproved
+	}
+	status := rule.Evaluate(setting, firstTime, content)
+	if status == info.CommentStatus_Spam {
+		return status, nil
+	}
+	// 分类器出错时不影响评论，只按规则处理
+	score, ok, err := spam.Score(userId, content)
+	if err != nil {
+		fmt.Println("spam score error: ", err)
+	} else if ok && score >= spam.Threshold() {
+		status = info.CommentStatus_Spam
+	}
+	return status, nil
+}
+
+// 游客发表评论，博客(插件)要求登录时不能评论
+func CheckGuest(commentType int, typeId int, guestId int64, content string) (string, error) {
+	setting, err := model.ShareCommentSettingModel().FetchCommentSetting(commentType, typeId)
+	if err != nil {
+		return "", err
+	}
+	if setting.RequireLogin {
+		return "", ErrNeedLogin
+	}
+	status, err := Check(commentType, typeId, guestId, content)
+	if err != nil || status != info.CommentStatus_Approved {
+		return status, err
+	}
+	if value, ok := config.GetDefaultConfigJsonReader().Get("comment.guest.moderation").(int64); ok && value == 0 {
+		return status, nil
+	}
+	return info.CommentStatus_Pending, nil
+}
+
+/* 主人审核评论，批量修改状态，返回实际修改的条数。
+** 通过和标记为垃圾的评论会用来训练分类器，拒绝只表示不显示，不参与训练。
+ */
+func SetStatus(commentIdList []int, status string) (int, error) {
+	commentList, err := model.ShareCommentModel().FetchAnyCommentListByIdList(commentIdList)
+	if err != nil {
+		return 0, err
+	}
+	count, err := model.ShareCommentModel().SetCommentStatus(commentIdList, status)
+	if err != nil {
+		return 0, err
+	}
+	if status == info.CommentStatus_Approved {
+		// 第一次审核通过时才通知
+		for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+			commentInfo := iter.Value.(info.CommentInfo)
+			if commentInfo.Status != info.CommentStatus_Approved && commentInfo.DeletedAt == 0 &&
+				!commentInfo.IsRemoved() {
+				if err = notify.OnComment(&commentInfo); err != nil {
+					fmt.Println("notify error: ", err)
+				}
+			}
+		}
+	}
+	var label string
+	switch status {
+	case info.CommentStatus_Approved:
+		label = info.SpamLabel_Ham
+	case info.CommentStatus_Spam:
+		label = info.SpamLabel_Spam
+	default:
+		return count, nil
+	}
+	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+		commentInfo := iter.Value.(info.CommentInfo)
+		commentInfo.Status = status
+		if err = spam.Train(&commentInfo, label); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
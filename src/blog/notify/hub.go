@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"info"
+	"sync"
+)
+
+// 每个连接最多缓存的通知数，客户端读得太慢时多出来的直接丢掉，刷新页面时可以从收件箱拿到
+const kSubscriberBufferSize = 16
+
+// 在线读者的实时推送连接，同一个读者可以同时打开多个页面
+type hub struct {
+	lock          sync.Mutex
+	subscriberMap map[int64]map[chan *info.NotificationInfo]bool
+}
+
+var defaultHub *hub = &hub{subscriberMap: make(map[int64]map[chan *info.NotificationInfo]bool)}
+
+// 订阅某个读者的通知，连接断开时必须调用返回的cancel
+func Subscribe(userId int64) (<-chan *info.NotificationInfo, func()) {
+	ch := make(chan *info.NotificationInfo, kSubscriberBufferSize)
+	defaultHub.lock.Lock()
+	defer defaultHub.lock.Unlock()
+	if defaultHub.subscriberMap[userId] == nil {
+		defaultHub.subscriberMap[userId] = make(map[chan *info.NotificationInfo]bool)
+	}
+	defaultHub.subscriberMap[userId][ch] = true
+	cancel := func() {
+		defaultHub.lock.Lock()
+		defer defaultHub.lock.Unlock()
+		if _, ok := defaultHub.subscriberMap[userId][ch]; !ok {
+			return
+		}
+		delete(defaultHub.subscriberMap[userId], ch)
+		if len(defaultHub.subscriberMap[userId]) == 0 {
+			delete(defaultHub.subscriberMap, userId)
+		}
+		close(ch)
+	}
+	return ch, cancel
+}
+
+func publish(notification *info.NotificationInfo) {
+	defaultHub.lock.Lock()
+	defer defaultHub.lock.Unlock()
+	for ch := range defaultHub.subscriberMap[notification.UserID] {
+		select {
+		case ch <- notification:
+		default:
+		}
+	}
+}
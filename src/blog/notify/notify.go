@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"blog/permission"
+	"framework/base/markdown"
+	"info"
+	"model"
+	"unicode/utf8"
+)
+
+/* 评论通知：评论审核通过之后给相关的读者发通知，写入收件箱的同时推送给在线的读者。
+** 1. 回复了谁的评论就通知谁；
+** 2. 评论里@了谁就通知谁，按昵称匹配；
+** 3. 主人(account.owner.user_id对应的读者帐号)发表评论时通知所有在这篇博客(插件)下评论过的读者。
+** 同一个读者对同一条评论只收到一条通知，按上面的顺序取第一种，自己不会通知自己。
+ */
+
+const (
+	// 通知里保存的评论摘要的长度
+	kContentLength = 80
+	// 一条评论最多@几个人
+	kMaxMentionCount = 10
+)
+
+func summary(content string) string {
+	if utf8.RuneCountInString(content) <= kContentLength {
+		return content
+	}
+	return string([]rune(content)[:kContentLength]) + "..."
+}
+
+// 和渲染时的规则一样，代码里的@不算
+func mentionNameList(content string) []string {
+	nameList := markdown.Mentions(content)
+	if len(nameList) > kMaxMentionCount {
+		nameList = nameList[:kMaxMentionCount]
+	}
+	return nameList
+}
+
+// 每个读者对应的通知类型
+func recipients(commentInfo *info.CommentInfo) (map[int64]string, error) {
+	var recipientMap map[int64]string = make(map[int64]string)
+	add := func(userId int64, notifyType string) {
+		if userId <= 0 || userId == commentInfo.UserID {
+			return
+		}
+		if _, ok := recipientMap[userId]; !ok {
+			recipientMap[userId] = notifyType
+		}
+	}
+	if commentInfo.ParentCommentID != -1 {
+		parent, err := model.ShareCommentModel().FetchCommentByCommentId(commentInfo.Type, commentInfo.ParentCommentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil && !parent.IsRemoved() {
+			add(parent.UserID, info.NotifyType_Reply)
+		}
+	}
+	userIdList, err := model.ShareUserModel().FetchUserIdListByName(mentionNameList(commentInfo.Content))
+	if err != nil {
+		return nil, err
+	}
+	for _, userId := range userIdList {
+		add(userId, info.NotifyType_Mention)
+	}
+	if owner := permission.OwnerUserId(); owner > 0 && commentInfo.UserID == owner {
+		userIdList, err = model.ShareCommentModel().FetchCommenterIdList(commentInfo.Type, commentInfo.TypeID)
+		if err != nil {
+			return nil, err
+		}
+		for _, userId := range userIdList {
+			add(userId, info.NotifyType_OwnerReply)
+		}
+	}
+	return recipientMap, nil
+}
+
+// 评论对所有人可见(审核通过)之后调用，每条评论只应该调用一次
+func OnComment(commentInfo *info.CommentInfo) error {
+	recipientMap, err := recipients(commentInfo)
+	if err != nil {
+		return err
+	}
+	var notificationList []*info.NotificationInfo = nil
+	for userId, notifyType := range recipientMap {
+		notificationList = append(notificationList, &info.NotificationInfo{
+			UserID:      userId,
+			Type:        notifyType,
+			ActorID:     commentInfo.UserID,
+			CommentID:   commentInfo.CommentID,
+			CommentType: commentInfo.Type,
+			TypeID:      commentInfo.TypeID,
+			Content:     summary(commentInfo.Content),
+		})
+	}
+	if err = model.ShareNotificationModel().AddNotifications(notificationList); err != nil {
+		return err
+	}
+	for _, notification := range notificationList {
+		publish(notification)
+	}
+	return nil
+}
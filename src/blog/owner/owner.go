@@ -0,0 +1,159 @@
+package owner
+
+import (
+	"blog/account"
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"framework/base/config"
+	"info"
+	"model"
+	"strings"
+	"time"
+)
+
+/* 主人登录(/personal/auth)：
+** 1. 桌面客户端发送用户名和md5(用户名+密码)，服务器只保存后者的scrypt摘要(owner_auth表)，
+**    用命令行 main owner-password <username> 设置；
+** 2. 开启了两步验证时，密码正确之后还要再提交TOTP的code或者一个恢复码；
+** 3. 连续失败kFreeAttempts次之后锁定，之后每失败一次锁定时间翻倍，最长kMaxLockTime，
+**    锁定期间直接拒绝，不再校验密码。成功登录之后清零。
+ */
+
+const (
+	kFreeAttempts = 5
+	kBaseLockTime = time.Minute
+	kMaxLockTime  = 24 * time.Hour
+)
+
+var (
+	ErrNoCredential  = errors.New("owner credential not set")
+	ErrWrongPassword = errors.New("wrong username or password")
+	ErrInvalidName   = errors.New("invalid username")
+	ErrWeakPassword  = errors.New("password must be at least 8 characters")
+)
+
+// 连续失败太多次，Until之前不能再尝试
+type LockedError struct {
+	Until int64
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, locked until %s",
+		time.Unix(e.Until, 0).Format("2006-01-02 15:04:05"))
+}
+
+// 桌面客户端发送的密码：md5(用户名+密码)的十六进制
+func ClientSign(userName string, password string) string {
+	sum := md5.Sum([]byte(userName + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// 失败count次之后需要锁定的秒数
+func lockDuration(count int) int64 {
+	if count < kFreeAttempts {
+		return 0
+	}
+	duration := kBaseLockTime
+	for i := kFreeAttempts; i < count && duration < kMaxLockTime; i++ {
+		duration *= 2
+	}
+	if duration > kMaxLockTime {
+		duration = kMaxLockTime
+	}
+	return int64(duration / time.Second)
+}
+
+// 没有设置凭据时返回ErrNoCredential，锁定时返回*LockedError
+func fetchUnlocked() (*info.OwnerAuthInfo, error) {
+	authInfo, err := model.ShareOwnerAuthModel().FetchOwnerAuth()
+	if err != nil {
+		return nil, err
+	}
+	if authInfo == nil || authInfo.PasswordHash == "" {
+		return nil, ErrNoCredential
+	}
+	if authInfo.IsLocked(time.Now().Unix()) {
+		return nil, &LockedError{Until: authInfo.LockedUntil}
+	}
+	return authInfo, nil
+}
+
+// 记一次失败，刚好达到锁定条件时返回*LockedError，否则返回err
+func recordFailure(err error) error {
+	lockedUntil, dbErr := model.ShareOwnerAuthModel().RecordFailure(lockDuration)
+	if dbErr != nil {
+		return dbErr
+	}
+	if lockedUntil > time.Now().Unix() {
+		return &LockedError{Until: lockedUntil}
+	}
+	return err
+}
+
+// 命令行设置主人的用户名和密码，同时解除锁定
+func SetPassword(userName string, password string) error {
+	userName = strings.TrimSpace(userName)
+	if userName == "" {
+		return ErrInvalidName
+	}
+	if len(password) < 8 {
+		return ErrWeakPassword
+	}
+	hash, err := account.HashPassword(ClientSign(userName, password))
+	if err != nil {
+		return err
+	}
+	return model.ShareOwnerAuthModel().SetCredential(userName, hash)
+}
+
+/* 以前的版本把密码明文写在配置的account.owner.authPassword里，
+** 表里还没有凭据时把它转成摘要保存，之后就不再读配置里的密码了。
+ */
+func MigrateLegacyCredential() error {
+	defaultConfig := config.GetDefaultConfigJsonReader()
+	userName, _ := defaultConfig.Get("account.owner.authUserName").(string)
+	password, _ := defaultConfig.Get("account.owner.authPassword").(string)
+	if password == "" {
+		return nil
+	}
+	authInfo, err := model.ShareOwnerAuthModel().FetchOwnerAuth()
+	if err != nil {
+		return err
+	}
+	if authInfo == nil || authInfo.PasswordHash == "" {
+		hash, err := account.HashPassword(ClientSign(userName, password))
+		if err != nil {
+			return err
+		}
+		if err = model.ShareOwnerAuthModel().SetCredential(userName, hash); err != nil {
+			return err
+		}
+	}
+	fmt.Println("owner password is saved as hash, please remove account.owner.authPassword from config")
+	return nil
+}
+
+/* 校验用户名和客户端发来的md5，返回是否还需要两步验证。
+** 失败会累计次数，锁定期间返回*LockedError。
+ */
+func CheckPassword(userName string, sign string) (bool, error) {
+	authInfo, err := fetchUnlocked()
+	if err != nil {
+		return false, err
+	}
+	// 用户名不对也算一遍摘要，响应时间不泄露用户名是否正确
+	ok, err := account.VerifyPassword(sign, authInfo.PasswordHash)
+	if err != nil {
+		return false, err
+	}
+	if !ok || subtle.ConstantTimeCompare([]byte(userName), []byte(authInfo.UserName)) != 1 {
+		return false, recordFailure(ErrWrongPassword)
+	}
+	if authInfo.TOTPEnabled {
+		return true, nil
+	}
+	return false, model.ShareOwnerAuthModel().ResetFailure()
+}
@@ -0,0 +1,212 @@
+package owner
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"framework/base/config"
+	"framework/base/totp"
+	"info"
+	"model"
+	"strings"
+	"time"
+)
+
+/* 两步验证：
+** 1. SetupTOTP生成新的密钥，保存成待确认状态，返回密钥和otpauth链接(二维码的内容)；
+** 2. EnableTOTP用应用里显示的code确认，开启之后返回一次性的恢复码，只显示这一次；
+** 3. 登录的第二步、关闭两步验证和重新生成恢复码都要一个TOTP的code或者一个没用过的恢复码。
+ */
+
+const (
+	kRecoveryCodeCount = 10
+	// 6个字节，base32编码之后10个字符，显示成xxxxx-xxxxx
+	kRecoveryCodeSize = 6
+	// 允许手机时钟前后差一个时间步
+	kTOTPSkew = 1
+)
+
+var (
+	ErrInvalidCode     = errors.New("invalid verification code")
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrNoPendingSecret = errors.New("no pending two-factor secret, setup first")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// 用户输入的恢复码可能带-、空格或者大写
+func normalizeRecoveryCode(code string) string {
+	code = strings.Replace(strings.Replace(code, "-", "", -1), " ", "", -1)
+	return strings.ToLower(code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// 生成新的恢复码并替换掉原来的，返回明文
+func generateRecoveryCodes() ([]string, error) {
+	var codeList []string = nil
+	var hashList []string = nil
+	buf := make([]byte, kRecoveryCodeSize)
+	for i := 0; i < kRecoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+		code = code[:5] + "-" + code[5:]
+		codeList = append(codeList, code)
+		hashList = append(hashList, hashRecoveryCode(code))
+	}
+	if err := model.ShareOwnerAuthModel().ReplaceRecoveryCodes(hashList); err != nil {
+		return nil, err
+	}
+	return codeList, nil
+}
+
+// 6位数字按TOTP校验，其他的按恢复码校验，用过的code和恢复码都不能再用
+func verifyCode(authInfo *info.OwnerAuthInfo, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(authInfo.TOTPSecret, code, time.Now(), kTOTPSkew)
+		if !ok {
+			return false, nil
+		}
+		return model.ShareOwnerAuthModel().UseTOTPStep(step)
+	}
+	if code == "" {
+		return false, nil
+	}
+	return model.ShareOwnerAuthModel().UseRecoveryCode(hashRecoveryCode(code))
+}
+
+// 开启了两步验证并且没有锁定时校验code，失败和密码错误一样累计次数
+func checkCode(code string) error {
+	authInfo, err := fetchUnlocked()
+	if err != nil {
+		return err
+	}
+	if !authInfo.TOTPEnabled {
+		return ErrTOTPNotEnabled
+	}
+	ok, err := verifyCode(authInfo, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return recordFailure(ErrInvalidCode)
+	}
+	return nil
+}
+
+// 登录的第二步，成功之后清零失败次数
+func CheckSecondFactor(code string) error {
+	if err := checkCode(code); err != nil {
+		return err
+	}
+	return model.ShareOwnerAuthModel().ResetFailure()
+}
+
+// 是否开启了两步验证，以及剩下的恢复码个数
+func TOTPStatus() (bool, int, error) {
+	authInfo, err := model.ShareOwnerAuthModel().FetchOwnerAuth()
+	if err != nil {
+		return false, 0, err
+	}
+	if authInfo == nil || !authInfo.TOTPEnabled {
+		return false, 0, nil
+	}
+	count, err := model.ShareOwnerAuthModel().FetchRecoveryCodeCount()
+	if err != nil {
+		return false, 0, err
+	}
+	return true, count, nil
+}
+
+// 返回密钥和otpauth链接，重复调用会换一个新的密钥
+func SetupTOTP() (string, string, error) {
+	authInfo, err := model.ShareOwnerAuthModel().FetchOwnerAuth()
+	if err != nil {
+		return "", "", err
+	}
+	if authInfo == nil || authInfo.PasswordHash == "" {
+		return "", "", ErrNoCredential
+	}
+	if authInfo.TOTPEnabled {
+		return "", "", ErrTOTPEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err = model.ShareOwnerAuthModel().SetTOTP(secret, false); err != nil {
+		return "", "", err
+	}
+	issuer, _ := config.GetDefaultConfigJsonReader().Get("account.owner.name").(string)
+	if issuer == "" {
+		issuer = "blog"
+	}
+	return secret, totp.URI(issuer, authInfo.UserName, secret), nil
+}
+
+// 用待确认密钥的code开启两步验证，返回恢复码
+func EnableTOTP(code string) ([]string, error) {
+	authInfo, err := fetchUnlocked()
+	if err != nil {
+		return nil, err
+	}
+	if authInfo.TOTPEnabled {
+		return nil, ErrTOTPEnabled
+	}
+	if authInfo.TOTPSecret == "" {
+		return nil, ErrNoPendingSecret
+	}
+	step, ok := totp.Validate(authInfo.TOTPSecret, strings.TrimSpace(code), time.Now(), kTOTPSkew)
+	if !ok {
+		return nil, recordFailure(ErrInvalidCode)
+	}
+	codeList, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err = model.ShareOwnerAuthModel().SetTOTP(authInfo.TOTPSecret, true); err != nil {
+		return nil, err
+	}
+	if _, err = model.ShareOwnerAuthModel().UseTOTPStep(step); err != nil {
+		return nil, err
+	}
+	return codeList, nil
+}
+
+func DisableTOTP(code string) error {
+	if err := checkCode(code); err != nil {
+		return err
+	}
+	if err := model.ShareOwnerAuthModel().SetTOTP("", false); err != nil {
+		return err
+	}
+	return model.ShareOwnerAuthModel().ReplaceRecoveryCodes(nil)
+}
+
+// 原来的恢复码全部作废
+func RegenerateRecoveryCodes(code string) ([]string, error) {
+	if err := checkCode(code); err != nil {
+		return nil, err
+	}
+	return generateRecoveryCodes()
+}
+
+// 命令行用，手机和恢复码都丢了的时候关闭两步验证并解除锁定
+func ResetTOTP() error {
+	if err := model.ShareOwnerAuthModel().SetTOTP("", false); err != nil {
+		return err
+	}
+	if err := model.ShareOwnerAuthModel().ReplaceRecoveryCodes(nil); err != nil {
+		return err
+	}
+	return model.ShareOwnerAuthModel().ResetFailure()
+}
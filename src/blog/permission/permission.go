@@ -0,0 +1,134 @@
+package permission
+
+import (
+	"errors"
+	"framework/base/config"
+	"info"
+	"model"
+	"time"
+)
+
+/* 角色和权限，角色保存在user表里：
+** 1. account.owner.user_id对应的读者帐号总是owner，用主人密码登录(/personal/auth)的会话也按owner处理；
+** 2. 其余用户默认是commenter，owner可以把他们提升为admin、moderator或者降回commenter；
+** 3. owner和admin可以封禁比自己角色低的用户，可以指定期限，到期之后自动恢复成commenter。
+** 没有登录的读者(userId为0)按commenter处理，能不能匿名评论由评论设置决定。
+ */
+
+var (
+	ErrBanned           = errors.New("user is banned")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNoSuchUser       = errors.New("no such user")
+	ErrInvalidRole      = errors.New("invalid role")
+)
+
+func OwnerUserId() int64 {
+	value, _ := config.GetDefaultConfigJsonReader().Get("account.owner.user_id").(int64)
+	return value
+}
+
+// 用户当前的角色和封禁期限，封禁到期的按commenter返回
+func FetchRole(userId int64) (*info.RoleInfo, error) {
+	if userId <= 0 {
+		return &info.RoleInfo{Role: info.Role_Commenter}, nil
+	}
+	if owner := OwnerUserId(); owner > 0 && userId == owner {
+		return &info.RoleInfo{UserID: userId, Role: info.Role_Owner}, nil
+	}
+	roleInfo, err := model.ShareUserModel().FetchRoleInfo(userId)
+	if err != nil {
+		return nil, err
+	}
+	if roleInfo == nil {
+		return nil, ErrNoSuchUser
+	}
+	// owner只由配置决定，表里残留的owner按commenter处理
+	if roleInfo.Role == info.Role_Owner || !info.IsRole(roleInfo.Role) {
+		roleInfo.Role = info.Role_Commenter
+	}
+	roleInfo.Role = roleInfo.EffectiveRole(time.Now().Unix())
+	return roleInfo, nil
+}
+
+func Role(userId int64) (string, error) {
+	roleInfo, err := FetchRole(userId)
+	if err != nil {
+		return "", err
+	}
+	return roleInfo.Role, nil
+}
+
+func Can(userId int64, permission string) (bool, error) {
+	role, err := Role(userId)
+	if err != nil {
+		return false, err
+	}
+	return info.RoleHasPermission(role, permission), nil
+}
+
+// 没有权限时被封禁的用户返回ErrBanned，其他返回ErrPermissionDenied
+func Check(userId int64, permission string) error {
+	role, err := Role(userId)
+	if err != nil {
+		return err
+	}
+	if info.RoleHasPermission(role, permission) {
+		return nil
+	}
+	if role == info.Role_Banned {
+		return ErrBanned
+	}
+	return ErrPermissionDenied
+}
+
+// actorRole要有permission并且比目标用户的角色高
+func checkManage(actorRole string, permission string, userId int64) error {
+	if !info.RoleHasPermission(actorRole, permission) {
+		return ErrPermissionDenied
+	}
+	target, err := Role(userId)
+	if err != nil {
+		return err
+	}
+	if info.RoleRank(target) >= info.RoleRank(actorRole) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// 提升或者降低用户的角色，只能设置成admin、moderator和commenter
+func SetRole(actorRole string, userId int64, role string) error {
+	if role != info.Role_Admin && role != info.Role_Moderator && role != info.Role_Commenter {
+		return ErrInvalidRole
+	}
+	if err := checkManage(actorRole, info.Permission_ManageRole, userId); err != nil {
+		return err
+	}
+	return model.ShareUserModel().SetUserRole(userId, role, 0)
+}
+
+// duration为0表示永久封禁
+func Ban(actorRole string, userId int64, duration time.Duration) error {
+	if err := checkManage(actorRole, info.Permission_Ban, userId); err != nil {
+		return err
+	}
+	var bannedUntil int64 = 0
+	if duration > 0 {
+		bannedUntil = time.Now().Add(duration).Unix()
+	}
+	return model.ShareUserModel().SetUserRole(userId, info.Role_Banned, bannedUntil)
+}
+
+func Unban(actorRole string, userId int64) error {
+	if !info.RoleHasPermission(actorRole, info.Permission_Ban) {
+		return ErrPermissionDenied
+	}
+	role, err := Role(userId)
+	if err != nil {
+		return err
+	}
+	if role != info.Role_Banned {
+		return nil
+	}
+	return model.ShareUserModel().SetUserRole(userId, info.Role_Commenter, 0)
+}
@@ -0,0 +1,245 @@
+package publish
+
+import (
+	"blog/search"
+	"errors"
+	"fmt"
+	"framework/base/schedule"
+	"info"
+	"model"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* 博客的发布状态：
+** draft，草稿，不会出现在首页、侧边栏和搜索结果里，主人可以通过预览链接查看；
+** scheduled，到了publish_at之后由定时任务自动发布；
+** published，已经发布，和以前上传即发布的行为一样。
+ */
+
+var ErrInvalidStatus = errors.New("invalid status")
+
+var scheduleLock sync.Mutex
+
+// 每篇定时发布的博客对应一个定时任务，重新设置时间时停掉旧的
+var scheduleMap map[int]*schedule.Schedule = make(map[int]*schedule.Schedule)
+
+func IsValidStatus(status string) bool {
+	return status == info.BlogStatus_Published || status == info.BlogStatus_Draft ||
+		status == info.BlogStatus_Scheduled
+}
+
+// 发布状态变化之后更新搜索索引，草稿和定时发布的博客从索引里去掉
+func refreshIndex(blogInfo *info.BlogInfo) {
+	if err := search.IndexBlogByUUID(blogInfo.BlogUUID); err != nil {
+		fmt.Println("index blog error: ", err)
+	}
+}
+
+// 定时任务的参数，带上任务本身，触发时用来确认map里还是这个任务
+type scheduleParam struct {
+	blogId int
+	work   *schedule.Schedule
+}
+
+// 调用方需要持有scheduleLock
+func cancelScheduleLocked(blogId int) {
+	if work, ok := scheduleMap[blogId]; ok {
+		work.Stop()
+		delete(scheduleMap, blogId)
+	}
+}
+
+func cancelSchedule(blogId int) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+	cancelScheduleLocked(blogId)
+}
+
+// 停掉旧任务、注册新任务和写入map在同一把锁里，并发设置同一篇博客时不会留下没人管的任务
+func addSchedule(blogId int, publishAt int64) error {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+	cancelScheduleLocked(blogId)
+	param := &scheduleParam{blogId: blogId}
+	param.work = schedule.NewScheduleAtTime(onSchedule, param, publishAt)
+	if err := schedule.GetScheduleMgrInstance().RegisterSchedule(param.work); err != nil {
+		return err
+	}
+	scheduleMap[blogId] = param.work
+	return nil
+}
+
+// 定时任务触发时再检查一次，期间可能已经被改成草稿或者改了时间
+func onSchedule(param interface{}, stop *bool) {
+	scheduled := param.(*scheduleParam)
+	blogId := scheduled.blogId
+	scheduleLock.Lock()
+	// 期间已经换成了新的任务时不能删掉新任务
+	if scheduleMap[blogId] == scheduled.work {
+		delete(scheduleMap, blogId)
+	}
+	scheduleLock.Unlock()
+	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	if err != nil || blogInfo == nil {
+		fmt.Println("scheduled blog not found: ", blogId, err)
+		return
+	}
+	if blogInfo.BlogStatus != info.BlogStatus_Scheduled || blogInfo.BlogPublishAt > time.Now().Unix() {
+		return
+	}
+	if err = publishBlog(blogInfo, blogInfo.BlogPublishAt); err != nil {
+		fmt.Println("publish scheduled blog error: ", blogId, err)
+	}
+}
+
+func publishBlog(blogInfo *info.BlogInfo, publishTime int64) error {
+	if err := model.ShareBlogModel().PublishBlog(blogInfo.BlogID, publishTime); err != nil {
+		return err
+	}
+	blogInfo.BlogStatus = info.BlogStatus_Published
+	refreshIndex(blogInfo)
+	return nil
+}
+
+// 立即发布
+func Publish(blogId int) error {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	if err != nil {
+		return err
+	}
+	if blogInfo == nil {
+		return errors.New("no such blog")
+	}
+	cancelSchedule(blogId)
+	if blogInfo.IsPublished() {
+		return nil
+	}
+	return publishBlog(blogInfo, time.Now().Unix())
+}
+
+/* 设置博客的发布状态，上传和主人手动修改时调用。
+** scheduled的publishAt已经过去时直接发布。
+ */
+func SetStatus(blogId int, status string, publishAt int64) error {
+	if !IsValidStatus(status) {
+		return ErrInvalidStatus
+	}
+	if status == info.BlogStatus_Published {
+		return Publish(blogId)
+	}
+	if status == info.BlogStatus_Scheduled && publishAt <= time.Now().Unix() {
+		return Publish(blogId)
+	}
+	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	if err != nil {
+		return err
+	}
+	if blogInfo == nil {
+		return errors.New("no such blog")
+	}
+	if status == info.BlogStatus_Draft {
+		publishAt = 0
+	}
+	if err = model.ShareBlogModel().UpdateBlogStatus(blogId, status, publishAt); err != nil {
+		return err
+	}
+	blogInfo.BlogStatus = status
+	refreshIndex(blogInfo)
+	if status == info.BlogStatus_Scheduled {
+		return addSchedule(blogId, publishAt)
+	}
+	cancelSchedule(blogId)
+	return nil
+}
+
+// 通过uuid设置状态，上传时使用，status为空表示直接发布
+func SetStatusByUUID(uuid string, status string, publishAt int64) error {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByUUID(uuid)
+	if err != nil {
+		return err
+	}
+	if blogInfo == nil {
+		return fmt.Errorf("no such blog: %s", uuid)
+	}
+	if status == "" {
+		status = info.BlogStatus_Published
+	}
+	return SetStatus(blogInfo.BlogID, status, publishAt)
+}
+
+/* 解析发布时间，支持unix时间戳(秒)以及本地时间的字符串，
+** 例如"2017-04-01 08:00"或者"2017-04-01 08:00:00"，为空时返回0。
+ */
+func ParsePublishAt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return 0, nil
+		}
+		if t, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return t, nil
+		}
+		for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return t.Unix(), nil
+			}
+		}
+		return 0, fmt.Errorf("invalid publish time: %s", v)
+	}
+	return 0, fmt.Errorf("invalid publish time: %v", value)
+}
+
+// 预览链接，草稿和定时发布的博客带上key之后主人以外的人也可以看
+func PreviewURL(blogInfo *info.BlogInfo) string {
+	if blogInfo.IsPublished() || blogInfo.BlogPreviewKey == "" {
+		return fmt.Sprintf("/blog?id=%d", blogInfo.BlogID)
+	}
+	return fmt.Sprintf("/blog?id=%d&preview=%s", blogInfo.BlogID, blogInfo.BlogPreviewKey)
+}
+
+// 公开页面能否看到这篇博客，没有发布的需要带上正确的预览key
+func CanView(blogInfo *info.BlogInfo, previewKey string) bool {
+	if blogInfo == nil {
+		return false
+	}
+	if blogInfo.IsPublished() {
+		return true
+	}
+	return previewKey != "" && previewKey == blogInfo.BlogPreviewKey
+}
+
+/* 启动时把已经过了发布时间的博客发布掉，其余的注册定时任务。
+** 服务停止期间错过的发布会在这里补上。
+ */
+func StartScheduler() error {
+	schedule.GetScheduleMgrInstance().Run()
+	blogList, err := model.ShareBlogModel().FetchScheduledBlogList()
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for iter := blogList.Front(); iter != nil; iter = iter.Next() {
+		blogInfo := iter.Value.(info.BlogInfo)
+		if blogInfo.BlogPublishAt <= now {
+			err = publishBlog(&blogInfo, blogInfo.BlogPublishAt)
+		} else {
+			err = addSchedule(blogInfo.BlogID, blogInfo.BlogPublishAt)
+		}
+		if err != nil {
+			fmt.Println("schedule blog error: ", blogInfo.BlogID, err)
+		}
+	}
+	return nil
+}
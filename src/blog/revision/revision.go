@@ -0,0 +1,262 @@
+package revision
+
+import (
+	"blog/search"
+	"errors"
+	"fmt"
+	"framework/base/config"
+	"framework/base/diff"
+	"info"
+	"io"
+	"io/ioutil"
+	"model"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/* 博客的历史版本，每次上传都保存一份快照，目录结构如下：
+**	blog:
+**		- uuid
+**			- uuid.html, blog.info, cover.jpg, res ...  当前版本
+**			- revisions
+**				- 1
+**					- uuid.html, blog.info, cover.jpg, res ...
+**					- raw.zip
+**				- 2
+** 标题、分类、标签保存在blog_revision表里。
+ */
+
+const (
+	kRevisionDirName = "revisions"
+	kRawFileName     = "raw.zip"
+)
+
+var ErrNoSuchRevision = errors.New("no such revision")
+
+func blogPath(uuid string) string {
+	return filepath.Join(config.GetDefaultConfigJsonReader().GetString("storage.file.blog"), uuid)
+}
+
+func rawPath(uuid string) string {
+	return filepath.Join(config.GetDefaultConfigJsonReader().GetString("storage.file.raw"), uuid+".zip")
+}
+
+func revisionPath(uuid string, revision int) string {
+	return filepath.Join(blogPath(uuid), kRevisionDirName, fmt.Sprintf("%d", revision))
+}
+
+func copyFile(src string, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// 复制目录，skip返回true的顶层文件或目录不复制
+func copyDir(src string, dst string, skip func(name string) bool) error {
+	return filepath.Walk(src, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && skip != nil && skip(strings.Split(rel, string(filepath.Separator))[0]) {
+			if fileInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		if fileInfo.IsDir() {
+			return os.MkdirAll(target, 0775)
+		}
+		return copyFile(path, target, fileInfo.Mode())
+	})
+}
+
+/* 清掉当前版本的文件，保留revisions目录。上传新版本之前调用，
+** 上一版的res文件不会留在目录里，快照里只有这一版的文件
+ */
+func ClearCurrent(uuid string) error {
+	fileList, err := ioutil.ReadDir(blogPath(uuid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fileInfo := range fileList {
+		if fileInfo.Name() == kRevisionDirName {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(blogPath(uuid), fileInfo.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 把当前版本保存为一个新的快照，返回版本号
+func Snapshot(uuid string, note string) (int, error) {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByUUID(uuid)
+	if err != nil {
+		return 0, err
+	}
+	if blogInfo == nil {
+		return 0, fmt.Errorf("no such blog: %s", uuid)
+	}
+	revision, err := model.ShareRevisionModel().InsertRevision(blogInfo.BlogID, blogInfo.BlogTitle,
+		blogInfo.BlogSortType, blogInfo.BlogCategoryID, blogInfo.BlogTagList, note)
+	if err != nil {
+		return 0, err
+	}
+	target := revisionPath(uuid, revision)
+	err = copyDir(blogPath(uuid), target, func(name string) bool {
+		return name == kRevisionDirName
+	})
+	if err != nil {
+		return revision, err
+	}
+	err = copyFile(rawPath(uuid), filepath.Join(target, kRawFileName), 0664)
+	if err != nil && !os.IsNotExist(err) {
+		return revision, err
+	}
+	return revision, nil
+}
+
+// 老博客在第一次重新上传前还没有任何版本，先把当前内容存为第一个版本
+func EnsureBaseRevision(uuid string) error {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByUUID(uuid)
+	if err != nil || blogInfo == nil {
+		return err
+	}
+	count, err := model.ShareRevisionModel().FetchRevisionCount(blogInfo.BlogID)
+	if err != nil || count > 0 {
+		return err
+	}
+	if _, err = os.Stat(blogPath(uuid)); os.IsNotExist(err) {
+		return nil
+	}
+	_, err = Snapshot(uuid, "initial")
+	return err
+}
+
+func List(blogId int) ([]*info.RevisionInfo, error) {
+	return model.ShareRevisionModel().FetchRevisionList(blogId)
+}
+
+var blockTagRegexp = regexp.MustCompile(`(?i)<(/?(p|div|h[1-6]|li|ul|ol|pre|tr|table|blockquote)|br)[^>]*>`)
+
+// 把html转成按段落分行的纯文本，用于比较
+func htmlToLines(content string) string {
+	content = blockTagRegexp.ReplaceAllString(content, "\n")
+	var lines []string = nil
+	for _, line := range strings.Split(content, "\n") {
+		if line = search.ExtractText(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func revisionText(uuid string, revision *info.RevisionInfo) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(revisionPath(uuid, revision.Revision), uuid+".html"))
+	if err != nil {
+		return "", err
+	}
+	header := fmt.Sprintf("标题: %s\n分类: %s\n标签: %s\n",
+		revision.Title, revision.SortType, strings.Join(revision.TagList, ", "))
+	return header + htmlToLines(string(content)), nil
+}
+
+func fetchRevision(blogId int, revision int) (*info.BlogInfo, *info.RevisionInfo, error) {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if blogInfo == nil {
+		return nil, nil, errors.New("no such blog")
+	}
+	revisionInfo, err := model.ShareRevisionModel().FetchRevision(blogId, revision)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revisionInfo == nil {
+		return nil, nil, ErrNoSuchRevision
+	}
+	return blogInfo, revisionInfo, nil
+}
+
+// 比较两个版本，返回逐行的结果以及unified格式的文本
+func Diff(blogId int, from int, to int) ([]diff.Line, string, error) {
+	blogInfo, fromRevision, err := fetchRevision(blogId, from)
+	if err != nil {
+		return nil, "", err
+	}
+	_, toRevision, err := fetchRevision(blogId, to)
+	if err != nil {
+		return nil, "", err
+	}
+	fromText, err := revisionText(blogInfo.BlogUUID, fromRevision)
+	if err != nil {
+		return nil, "", err
+	}
+	toText, err := revisionText(blogInfo.BlogUUID, toRevision)
+	if err != nil {
+		return nil, "", err
+	}
+	lines := diff.Text(fromText, toText)
+	unified := diff.Unified(lines, fmt.Sprintf("revision %d", from), fmt.Sprintf("revision %d", to), 3)
+	return lines, unified, nil
+}
+
+/* 回滚到指定版本：用快照替换当前的文件和标题、分类、标签，
+** 然后把回滚后的内容再存为一个新版本，这样回滚本身也可以撤销。
+ */
+func Rollback(blogId int, revision int) (int, error) {
+	blogInfo, revisionInfo, err := fetchRevision(blogId, revision)
+	if err != nil {
+		return 0, err
+	}
+	uuid := blogInfo.BlogUUID
+	source := revisionPath(uuid, revision)
+	if _, err = os.Stat(source); err != nil {
+		return 0, err
+	}
+	if err = ClearCurrent(uuid); err != nil {
+		return 0, err
+	}
+	err = copyDir(source, blogPath(uuid), func(name string) bool {
+		return name == kRawFileName
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = copyFile(filepath.Join(source, kRawFileName), rawPath(uuid), 0664)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	err = model.ShareBlogModel().RollbackBlog(blogId, revisionInfo.Title, revisionInfo.CategoryID,
+		revisionInfo.SortType, revisionInfo.TagList)
+	if err != nil {
+		return 0, err
+	}
+	if err = search.IndexBlogByUUID(uuid); err != nil {
+		fmt.Println("index blog error: ", err)
+	}
+	return Snapshot(uuid, fmt.Sprintf("rollback to %d", revision))
+}
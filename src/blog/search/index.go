@@ -0,0 +1,273 @@
+package search
+
+import (
+	"framework/base/tokenizer"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// 标题里的词权重更高
+	kTitleWeight       = 5
+	kDescriptionWeight = 2
+	// BM25参数
+	kBM25K1 = 1.2
+	kBM25B  = 0.75
+)
+
+// 需要建索引的一篇博客
+type Document struct {
+	BlogID      int
+	UUID        string
+	Title       string
+	Description string
+	Content     string
+}
+
+type Result struct {
+	BlogID  int
+	UUID    string
+	Title   string
+	Score   float64
+	Snippet string
+}
+
+type indexedDocument struct {
+	Document
+	length int
+	terms  map[string]int
+}
+
+// 内存中的倒排索引，term -> blogId -> 加权词频
+type Index struct {
+	mutex         sync.RWMutex
+	documents     map[int]*indexedDocument
+	postings      map[string]map[int]int
+	titlePostings map[string]map[int]bool
+	totalLength   int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		documents:     make(map[int]*indexedDocument),
+		postings:      make(map[string]map[int]int),
+		titlePostings: make(map[string]map[int]bool),
+	}
+}
+
+func addTerms(terms map[string]int, text string, weight int) int {
+	tokens := tokenizer.Tokenize(text)
+	for _, token := range tokens {
+		terms[token.Term] += weight
+	}
+	return len(tokens) * weight
+}
+
+// 添加或者更新一篇博客
+func (i *Index) Add(doc *Document) {
+	indexed := &indexedDocument{Document: *doc, terms: make(map[string]int)}
+	indexed.length += addTerms(indexed.terms, doc.Title, kTitleWeight)
+	indexed.length += addTerms(indexed.terms, doc.Description, kDescriptionWeight)
+	indexed.length += addTerms(indexed.terms, doc.Content, 1)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.removeLocked(doc.BlogID)
+	i.documents[doc.BlogID] = indexed
+	i.totalLength += indexed.length
+	for term, freq := range indexed.terms {
+		if i.postings[term] == nil {
+			i.postings[term] = make(map[int]int)
+		}
+		i.postings[term][doc.BlogID] = freq
+	}
+	for _, term := range tokenizer.Terms(tokenizer.Tokenize(doc.Title)) {
+		if i.titlePostings[term] == nil {
+			i.titlePostings[term] = make(map[int]bool)
+		}
+		i.titlePostings[term][doc.BlogID] = true
+	}
+}
+
+func (i *Index) Remove(blogId int) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.removeLocked(blogId)
+}
+
+func (i *Index) removeLocked(blogId int) {
+	indexed, ok := i.documents[blogId]
+	if !ok {
+		return
+	}
+	for term := range indexed.terms {
+		delete(i.postings[term], blogId)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+	for _, term := range tokenizer.Terms(tokenizer.Tokenize(indexed.Title)) {
+		delete(i.titlePostings[term], blogId)
+		if len(i.titlePostings[term]) == 0 {
+			delete(i.titlePostings, term)
+		}
+	}
+	i.totalLength -= indexed.length
+	delete(i.documents, blogId)
+}
+
+func (i *Index) Len() int {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return len(i.documents)
+}
+
+func (i *Index) Contains(blogId int) bool {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	_, ok := i.documents[blogId]
+	return ok
+}
+
+// BM25打分，needAll为true时要求包含全部查询词
+func (i *Index) scoreLocked(terms []string, needAll bool) map[int]float64 {
+	scores := make(map[int]float64)
+	matched := make(map[int]int)
+	docCount := float64(len(i.documents))
+	avgLength := float64(i.totalLength) / math.Max(docCount, 1)
+	for _, term := range terms {
+		posting := i.postings[term]
+		if len(posting) == 0 {
+			continue
+		}
+		idf := math.Log(1 + (docCount-float64(len(posting))+0.5)/(float64(len(posting))+0.5))
+		for blogId, freq := range posting {
+			tf := float64(freq)
+			length := float64(i.documents[blogId].length)
+			scores[blogId] += idf * tf * (kBM25K1 + 1) / (tf + kBM25K1*(1-kBM25B+kBM25B*length/avgLength))
+			matched[blogId]++
+		}
+	}
+	if needAll {
+		for blogId := range scores {
+			if matched[blogId] < len(terms) {
+				delete(scores, blogId)
+			}
+		}
+	}
+	return scores
+}
+
+func sortScores(scores map[int]float64) []int {
+	var idList []int = make([]int, 0, len(scores))
+	for blogId := range scores {
+		idList = append(idList, blogId)
+	}
+	sort.Slice(idList, func(a, b int) bool {
+		if scores[idList[a]] != scores[idList[b]] {
+			return scores[idList[a]] > scores[idList[b]]
+		}
+		// 分数相同时新文章在前
+		return idList[a] > idList[b]
+	})
+	return idList
+}
+
+/* 查询，返回当前页的结果和总数。
+** 优先返回包含全部查询词的文章，一篇都没有时退化为包含任意一个词。
+ */
+func (i *Index) Search(query string, offset int, limit int) ([]*Result, int) {
+	queryTokens := tokenizer.TokenizeQuery(query)
+	terms := tokenizer.Terms(queryTokens)
+	if len(terms) == 0 {
+		return nil, 0
+	}
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	scores := i.scoreLocked(terms, true)
+	if len(scores) == 0 {
+		scores = i.scoreLocked(terms, false)
+	}
+	idList := sortScores(scores)
+	total := len(idList)
+	if offset >= total {
+		return nil, total
+	}
+	if offset+limit < total {
+		idList = idList[offset : offset+limit]
+	} else {
+		idList = idList[offset:]
+	}
+	var results []*Result = nil
+	for _, blogId := range idList {
+		doc := i.documents[blogId]
+		snippetSource := doc.Content
+		if snippetSource == "" {
+			snippetSource = doc.Description
+		}
+		results = append(results, &Result{
+			BlogID:  doc.BlogID,
+			UUID:    doc.UUID,
+			Title:   doc.Title,
+			Score:   scores[blogId],
+			Snippet: Highlight(snippetSource, terms, kSnippetLength),
+		})
+	}
+	return results, total
+}
+
+/* 输入提示，只匹配标题。
+** 最后一个英文词可能还没输完，按前缀展开成标题里出现过的词。
+ */
+func (i *Index) Suggest(query string, limit int) []*Result {
+	queryTokens := tokenizer.TokenizeQuery(query)
+	if len(queryTokens) == 0 {
+		return nil
+	}
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	var matchedSet []map[int]bool = nil
+	for index, token := range queryTokens {
+		matched := make(map[int]bool)
+		for blogId := range i.titlePostings[token.Term] {
+			matched[blogId] = true
+		}
+		last := index == len(queryTokens)-1
+		if last && !tokenizer.IsCJK([]rune(token.Term)[0]) {
+			for term, posting := range i.titlePostings {
+				if strings.HasPrefix(term, token.Term) {
+					for blogId := range posting {
+						matched[blogId] = true
+					}
+				}
+			}
+		}
+		matchedSet = append(matchedSet, matched)
+	}
+	scores := make(map[int]float64)
+	for blogId := range matchedSet[0] {
+		hit := true
+		for _, matched := range matchedSet[1:] {
+			if !matched[blogId] {
+				hit = false
+				break
+			}
+		}
+		if hit {
+			// 标题越短越接近输入
+			scores[blogId] = 1 / float64(len(i.documents[blogId].Title)+1)
+		}
+	}
+	idList := sortScores(scores)
+	if len(idList) > limit {
+		idList = idList[:limit]
+	}
+	var results []*Result = nil
+	for _, blogId := range idList {
+		doc := i.documents[blogId]
+		results = append(results, &Result{BlogID: doc.BlogID, UUID: doc.UUID, Title: doc.Title, Score: scores[blogId]})
+	}
+	return results
+}
@@ -0,0 +1,105 @@
+package search
+
+import (
+	"fmt"
+	"framework/base/config"
+	"framework/base/json"
+	"html"
+	"info"
+	"io/ioutil"
+	"model"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var searchIndexInstance *Index = nil
+
+var searchIndexOnce sync.Once
+
+func ShareSearchIndex() *Index {
+	searchIndexOnce.Do(func() {
+		searchIndexInstance = NewIndex()
+	})
+	return searchIndexInstance
+}
+
+var (
+	scriptRegexp = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	tagRegexp    = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRegexp  = regexp.MustCompile(`\s+`)
+)
+
+// 去掉html标签，只保留正文
+func ExtractText(content string) string {
+	content = scriptRegexp.ReplaceAllString(content, " ")
+	content = tagRegexp.ReplaceAllString(content, " ")
+	content = html.UnescapeString(content)
+	return strings.TrimSpace(spaceRegexp.ReplaceAllString(content, " "))
+}
+
+// 从storage.file.blog/<uuid>下读取正文和blog.info里的描述
+func loadDocument(blogInfo *info.BlogInfo) (*Document, error) {
+	blogRootPath := config.GetDefaultConfigJsonReader().GetString("storage.file.blog")
+	blogPath := filepath.Join(blogRootPath, blogInfo.BlogUUID)
+	content, err := ioutil.ReadFile(filepath.Join(blogPath, blogInfo.BlogUUID+".html"))
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{
+		BlogID:  blogInfo.BlogID,
+		UUID:    blogInfo.BlogUUID,
+		Title:   blogInfo.BlogTitle,
+		Content: ExtractText(string(content)),
+	}
+	if description, ok := json.NewJsonReaderFromFile(filepath.Join(blogPath, "blog.info")).Get("descript").(string); ok {
+		doc.Description = description
+	}
+	return doc, nil
+}
+
+// 启动时全量建索引
+func BuildIndex() error {
+	blogList, err := model.ShareBlogModel().FetchAllBlog()
+	if err != nil {
+		return err
+	}
+	for iter := blogList.Front(); iter != nil; iter = iter.Next() {
+		blogInfo := iter.Value.(info.BlogInfo)
+		doc, err := loadDocument(&blogInfo)
+		if err != nil {
+			fmt.Println("search index blog error: ", blogInfo.BlogUUID, err)
+			continue
+		}
+		ShareSearchIndex().Add(doc)
+	}
+	fmt.Println("search index built: ", ShareSearchIndex().Len())
+	return nil
+}
+
+// 上传或更新博客之后调用，没有发布的博客不进索引
+func IndexBlogByUUID(uuid string) error {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByUUID(uuid)
+	if err != nil {
+		return err
+	}
+	if blogInfo == nil {
+		return fmt.Errorf("no such blog: %s", uuid)
+	}
+	if !blogInfo.IsPublished() {
+		RemoveBlog(blogInfo.BlogID)
+		return nil
+	}
+	doc, err := loadDocument(blogInfo)
+	if err != nil {
+		return err
+	}
+	ShareSearchIndex().Add(doc)
+	return nil
+}
+
+// 删除博客之后调用
+func RemoveBlog(blogId int) {
+	ShareSearchIndex().Remove(blogId)
+}
@@ -0,0 +1,120 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestIndex() *Index {
+	index := NewIndex()
+	index.Add(&Document{BlogID: 1, UUID: "a", Title: "Golang并发编程",
+		Content: "goroutine和channel是Go语言并发的基础"})
+	index.Add(&Document{BlogID: 2, UUID: "b", Title: "C++模板",
+		Content: "模板元编程，顺便提一下golang没有泛型"})
+	index.Add(&Document{BlogID: 3, UUID: "c", Title: "机器学习入门",
+		Description: "朴素贝叶斯", Content: "从线性回归开始"})
+	return index
+}
+
+func Test_SearchRanking(t *testing.T) {
+	index := newTestIndex()
+	results, total := index.Search("golang", 0, 10)
+	if total != 2 || len(results) != 2 {
+		t.Fatal("expect 2 results, got ", total)
+	}
+	// 标题命中的排在前面
+	if results[0].BlogID != 1 {
+		t.Error("expect blog 1 first, got ", results[0].BlogID)
+	}
+}
+
+func Test_SearchChinese(t *testing.T) {
+	index := newTestIndex()
+	results, total := index.Search("贝叶斯", 0, 10)
+	if total != 1 || results[0].BlogID != 3 {
+		t.Error("expect blog 3, got ", results)
+	}
+	_, total = index.Search("编程", 0, 10)
+	if total != 2 {
+		t.Error("expect 2 results, got ", total)
+	}
+}
+
+func Test_SearchPaging(t *testing.T) {
+	index := newTestIndex()
+	results, total := index.Search("编程", 1, 1)
+	if total != 2 || len(results) != 1 {
+		t.Error("paging error: ", total, len(results))
+	}
+	results, _ = index.Search("编程", 5, 1)
+	if len(results) != 0 {
+		t.Error("expect empty page")
+	}
+}
+
+func Test_Remove(t *testing.T) {
+	index := newTestIndex()
+	index.Remove(1)
+	results, total := index.Search("golang", 0, 10)
+	if total != 1 || results[0].BlogID != 2 {
+		t.Error("removed blog still found")
+	}
+	// 重复添加相当于更新
+	index.Add(&Document{BlogID: 2, UUID: "b", Title: "C++模板", Content: "没有了"})
+	if _, total = index.Search("golang", 0, 10); total != 0 {
+		t.Error("update not applied")
+	}
+	if index.Len() != 2 {
+		t.Error("expect 2 documents, got ", index.Len())
+	}
+}
+
+func Test_Suggest(t *testing.T) {
+	index := newTestIndex()
+	results := index.Suggest("gol", 5)
+	if len(results) != 1 || results[0].BlogID != 1 {
+		t.Error("prefix suggest error: ", results)
+	}
+	results = index.Suggest("机器", 5)
+	if len(results) != 1 || results[0].BlogID != 3 {
+		t.Error("chinese suggest error: ", results)
+	}
+}
+
+func Test_Highlight(t *testing.T) {
+	snippet := Highlight("学习<Go>语言", []string{"go"}, 100)
+	if snippet != "学习&lt;<em>Go</em>&gt;语言" {
+		t.Error("highlight error: ", snippet)
+	}
+	long := strings.Repeat("无关内容", 50) + "关键词" + strings.Repeat("无关内容", 50)
+	snippet = Highlight(long, []string{"关键"}, 40)
+	if !strings.Contains(snippet, "<em>关键</em>") || !strings.HasPrefix(snippet, "...") ||
+		!strings.HasSuffix(snippet, "...") {
+		t.Error("window error: ", snippet)
+	}
+}
+
+// 很长并且到处都是匹配的文章，窗口选在匹配最密的地方
+func Test_SnippetWindowLong(t *testing.T) {
+	text := strings.Repeat("go 无关 ", 20000) + strings.Repeat("go ", 50)
+	var ranges []matchRange = nil
+	for offset := strings.Index(text, "go"); offset >= 0; {
+		ranges = append(ranges, matchRange{offset, offset + 2})
+		next := strings.Index(text[offset+2:], "go")
+		if next < 0 {
+			break
+		}
+		offset += 2 + next
+	}
+	begin, end := snippetWindow(text, ranges, 60)
+	if begin < len(text)-300 || strings.Count(text[begin:end], "go") < 15 {
+		t.Error("wrong window: ", text[begin:end])
+	}
+}
+
+func Test_ExtractText(t *testing.T) {
+	text := ExtractText("<html><style>p{}</style><p>Hello&amp;</p>\n<script>var a;</script><b>世界</b></html>")
+	if text != "Hello& 世界" {
+		t.Error("extract error: ", text)
+	}
+}
@@ -0,0 +1,115 @@
+package search
+
+import (
+	"framework/base/tokenizer"
+	"html"
+	"sort"
+	"strings"
+)
+
+// 摘要的最大字数
+const kSnippetLength = 120
+
+type matchRange struct {
+	start int
+	end   int
+}
+
+/* 从text里截取包含查询词最多的一段，查询词用<em>包起来。
+** 返回的是已经转义过的html，可以直接输出到页面。
+ */
+func Highlight(text string, terms []string, length int) string {
+	termSet := make(map[string]bool)
+	for _, term := range terms {
+		termSet[term] = true
+	}
+	var ranges []matchRange = nil
+	for _, token := range tokenizer.Tokenize(text) {
+		if !termSet[token.Term] {
+			continue
+		}
+		// 合并重叠的区间，比如中文的单字和二元组
+		if len(ranges) > 0 && token.Start <= ranges[len(ranges)-1].end {
+			if token.End > ranges[len(ranges)-1].end {
+				ranges[len(ranges)-1].end = token.End
+			}
+			continue
+		}
+		ranges = append(ranges, matchRange{token.Start, token.End})
+	}
+	begin, end := snippetWindow(text, ranges, length)
+	var buffer []string = nil
+	if begin > 0 {
+		buffer = append(buffer, "...")
+	}
+	cursor := begin
+	for _, r := range ranges {
+		if r.end <= begin || r.start >= end {
+			continue
+		}
+		start := r.start
+		if start < cursor {
+			start = cursor
+		}
+		stop := r.end
+		if stop > end {
+			stop = end
+		}
+		buffer = append(buffer, html.EscapeString(text[cursor:start]), "<em>",
+			html.EscapeString(text[start:stop]), "</em>")
+		cursor = stop
+	}
+	buffer = append(buffer, html.EscapeString(text[cursor:end]))
+	if end < len(text) {
+		buffer = append(buffer, "...")
+	}
+	return strings.Join(buffer, "")
+}
+
+/* 选择包含匹配最多的窗口，返回字节偏移。
+** 每个字节偏移对应的字数用runeStarts二分查找，窗口用双指针滑动，长文章也是线性的。
+ */
+func snippetWindow(text string, ranges []matchRange, length int) (int, int) {
+	var runeStarts []int = nil
+	for offset := range text {
+		runeStarts = append(runeStarts, offset)
+	}
+	if len(runeStarts) <= length {
+		return 0, len(text)
+	}
+	runeIndex := func(offset int) int {
+		return sort.SearchInts(runeStarts, offset)
+	}
+	starts := make([]int, len(ranges))
+	ends := make([]int, len(ranges))
+	for i, r := range ranges {
+		starts[i], ends[i] = runeIndex(r.start), runeIndex(r.end)
+	}
+	bestStart, bestCount := 0, 0
+	last := 0
+	for i := range ranges {
+		if last < i {
+			last = i
+		}
+		for last < len(ranges) && ends[last]-starts[i] <= length {
+			last++
+		}
+		if count := last - i; count > bestCount {
+			bestStart, bestCount = starts[i], count
+		}
+	}
+	// 匹配的词前面留一点上下文
+	bestStart -= length / 5
+	if bestStart < 0 {
+		bestStart = 0
+	}
+	if bestStart+length > len(runeStarts) {
+		bestStart = len(runeStarts) - length
+	}
+	begin := runeStarts[bestStart]
+	end := len(text)
+	if bestStart+length < len(runeStarts) {
+		end = runeStarts[bestStart+length]
+	}
+	return begin, end
+}
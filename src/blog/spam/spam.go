@@ -0,0 +1,161 @@
+package spam
+
+import (
+	"fmt"
+	"framework/base/config"
+	"framework/base/tokenizer"
+	"info"
+	"math"
+	"model"
+	"regexp"
+	"unicode/utf8"
+)
+
+/* 本地的朴素贝叶斯垃圾评论分类器。
+** 特征包括评论内容的分词(英文按单词，中文按相邻两个字)、链接数和链接密度、作者以往评论的审核结果。
+** 主人在审核时把评论标记为通过或者垃圾，分类器就用这条评论增量训练一次，
+** 改判时会先撤销之前的训练，数据保存在数据库里，见model/spam.go。
+** 两类评论都训练到comment.spam.min_train条之前分类器不生效。
+ */
+
+const (
+	// 文档数记在这个特征下面，分词结果里不会有#
+	kDocumentToken  = "#doc"
+	kMaxTokenLength = 64
+
+	kDefaultThreshold = 0.9
+	kDefaultMinTrain  = 10
+)
+
+var linkRegexp = regexp.MustCompile(`(?i)https?://|www\.`)
+
+func configInteger(key string, defaultValue int) int {
+	if value, ok := config.GetDefaultConfigJsonReader().Get(key).(int64); ok && value > 0 {
+		return int(value)
+	}
+	return defaultValue
+}
+
+// 超过阈值的评论直接标记为垃圾评论，等待主人处理
+func Threshold() float64 {
+	switch value := config.GetDefaultConfigJsonReader().Get("comment.spam.threshold").(type) {
+	case float64:
+		if value > 0 && value <= 1 {
+			return value
+		}
+	case int64:
+		if value == 1 {
+			return 1
+		}
+	}
+	return kDefaultThreshold
+}
+
+func CountLinks(content string) int {
+	return len(linkRegexp.FindAllStringIndex(content, -1))
+}
+
+func linkFeatures(content string) []string {
+	links := CountLinks(content)
+	count := "many"
+	if links < 3 {
+		count = fmt.Sprint(links)
+	}
+	// 每100个字的链接数
+	density := "none"
+	if links > 0 {
+		ratio := float64(links) * 100 / float64(utf8.RuneCountInString(content)+1)
+		switch {
+		case ratio < 1:
+			density = "low"
+		case ratio < 5:
+			density = "medium"
+		default:
+			density = "high"
+		}
+	}
+	return []string{"#links:" + count, "#link_density:" + density}
+}
+
+// excludeStatus是评论自己当前的状态，统计作者以往的评论时要去掉自己
+func historyFeatures(userId int64, excludeStatus string) ([]string, error) {
+	if userId <= 0 {
+		return []string{"#author:guest"}, nil
+	}
+	countMap, err := model.ShareCommentModel().FetchUserCommentStatusCount(userId)
+	if err != nil {
+		return nil, err
+	}
+	if excludeStatus != "" {
+		countMap[excludeStatus]--
+	}
+	var featureList []string = nil
+	for _, status := range []string{info.CommentStatus_Approved, info.CommentStatus_Rejected,
+		info.CommentStatus_Spam} {
+		if countMap[status] > 0 {
+			featureList = append(featureList, "#author:"+status)
+		}
+	}
+	if len(featureList) == 0 {
+		featureList = append(featureList, "#author:new")
+	}
+	return featureList, nil
+}
+
+func features(userId int64, content string, excludeStatus string) ([]string, error) {
+	featureList, err := historyFeatures(userId, excludeStatus)
+	if err != nil {
+		return nil, err
+	}
+	featureList = append(featureList, linkFeatures(content)...)
+	for _, term := range tokenizer.Terms(tokenizer.TokenizeQuery(content)) {
+		if len(term) <= kMaxTokenLength {
+			featureList = append(featureList, term)
+		}
+	}
+	return featureList, nil
+}
+
+// 返回垃圾评论的概率，每个特征按出现过的评论数做拉普拉斯平滑，没有训练过的特征不参与计算
+func classify(featureList []string, tokenMap map[string]*info.SpamTokenInfo, spamDocs int, hamDocs int) float64 {
+	logSpam := math.Log(float64(spamDocs) / float64(spamDocs+hamDocs))
+	logHam := math.Log(float64(hamDocs) / float64(spamDocs+hamDocs))
+	for _, feature := range featureList {
+		token, ok := tokenMap[feature]
+		if !ok || token.Spam+token.Ham == 0 {
+			continue
+		}
+		logSpam += math.Log(float64(token.Spam+1) / float64(spamDocs+2))
+		logHam += math.Log(float64(token.Ham+1) / float64(hamDocs+2))
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam))
+}
+
+/* 给一条新评论打分，返回垃圾评论的概率。
+** 训练数据不够时ok为false，这时不应该根据分数做任何处理。
+ */
+func Score(userId int64, content string) (score float64, ok bool, err error) {
+	featureList, err := features(userId, content, "")
+	if err != nil {
+		return 0, false, err
+	}
+	tokenMap, err := model.ShareSpamModel().FetchSpamTokenMap(append(featureList, kDocumentToken))
+	if err != nil {
+		return 0, false, err
+	}
+	doc, exist := tokenMap[kDocumentToken]
+	minTrain := configInteger("comment.spam.min_train", kDefaultMinTrain)
+	if !exist || doc.Spam < minTrain || doc.Ham < minTrain {
+		return 0, false, nil
+	}
+	return classify(featureList, tokenMap, doc.Spam, doc.Ham), true, nil
+}
+
+// 主人审核之后用这条评论训练，label是info.SpamLabel_Spam或者info.SpamLabel_Ham
+func Train(commentInfo *info.CommentInfo, label string) error {
+	featureList, err := features(commentInfo.UserID, commentInfo.Content, commentInfo.Status)
+	if err != nil {
+		return err
+	}
+	return model.ShareSpamModel().TrainComment(commentInfo.CommentID, append(featureList, kDocumentToken), label)
+}
@@ -0,0 +1,344 @@
+package trash
+
+import (
+	"blog/search"
+	"errors"
+	"fmt"
+	"framework/base/config"
+	"framework/base/timer"
+	"info"
+	"model"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sync"
+	"time"
+)
+
+/* 回收站：删除博客、评论、插件时只标记删除时间，公开的查询都不会返回这些数据。
+** 超过保留期(trash.retention，单位天)的数据由定时任务彻底删除，包括存储目录。
+ */
+
+const (
+	KindBlog    = "blog"
+	KindComment = "comment"
+	KindPlugin  = "plugin"
+)
+
+const (
+	kDefaultRetentionDays     = 30
+	kDefaultPurgeIntervalHour = 24
+)
+
+var ErrNotInTrash = errors.New("not in trash")
+
+var purgeTimer *timer.Timer = nil
+
+var purgeOnce sync.Once
+
+func configInteger(key string, defaultValue int) int {
+	if value, ok := config.GetDefaultConfigJsonReader().Get(key).(int64); ok && value > 0 {
+		return int(value)
+	}
+	return defaultValue
+}
+
+func retention() time.Duration {
+	return time.Duration(configInteger("trash.retention", kDefaultRetentionDays)) * 24 * time.Hour
+}
+
+func TrashBlog(blogId int) error {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	if err != nil {
+		return err
+	}
+	if blogInfo == nil {
+		return errors.New("no such blog")
+	}
+	if err = model.ShareBlogModel().TrashBlog(blogId); err != nil {
+		return err
+	}
+	search.RemoveBlog(blogId)
+	return nil
+}
+
+func RestoreBlog(blogId int) error {
+	blogInfo, err := model.ShareBlogModel().FetchTrashBlogByBlogID(blogId)
+	if err != nil {
+		return err
+	}
+	if blogInfo == nil {
+		return ErrNotInTrash
+	}
+	if err = model.ShareBlogModel().RestoreBlog(blogId); err != nil {
+		return err
+	}
+	return search.IndexBlogByUUID(blogInfo.BlogUUID)
+}
+
+// 彻底删除博客，包括评论、投票、访问统计、标签关联、历史版本、blog目录和raw文件
+func purgeBlog(blogInfo *info.BlogInfo) error {
+	if err := model.ShareVoteModel().DeleteCommentVotesByTypeId(info.CommentType_Blog, blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareVoteModel().DeleteTargetVotes(info.VoteTarget_Blog, blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareVisitModel().DeleteTargetVisitStats(info.VisitTarget_Blog, blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareSpamModel().DeleteTrainedCommentsByTypeId(info.CommentType_Blog, blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareCommentHistoryModel().DeleteCommentHistoryByTypeId(info.CommentType_Blog, blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareNotificationModel().DeleteNotificationsByTypeId(info.CommentType_Blog, blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareCommentModel().DeleteAllBlogComment(info.CommentType_Blog, blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareCommentSettingModel().DeleteCommentSetting(info.CommentType_Blog, blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareRevisionModel().DeleteBlogRevisions(blogInfo.BlogID); err != nil {
+		return err
+	}
+	if err := model.ShareBlogModel().DeleteBlog(blogInfo.BlogID); err != nil {
+		return err
+	}
+	blogRootPath := config.GetDefaultConfigJsonReader().GetString("storage.file.blog")
+	if err := os.RemoveAll(filepath.Join(blogRootPath, blogInfo.BlogUUID)); err != nil {
+		return err
+	}
+	rawRootPath := config.GetDefaultConfigJsonReader().GetString("storage.file.raw")
+	err := os.Remove(filepath.Join(rawRootPath, blogInfo.BlogUUID+".zip"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func TrashComment(commentId int) error {
+	commentInfo, err := model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Blog, commentId)
+	if err == nil && commentInfo == nil {
+		commentInfo, err = model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Plugin, commentId)
+	}
+	if err != nil {
+		return err
+	}
+	if commentInfo == nil {
+		return errors.New("no such comment")
+	}
+	return model.ShareCommentModel().TrashComment(commentId)
+}
+
+func RestoreComment(commentId int) error {
+	commentInfo, err := model.ShareCommentModel().FetchTrashCommentByCommentId(commentId)
+	if err != nil {
+		return err
+	}
+	if commentInfo == nil {
+		return ErrNotInTrash
+	}
+	return model.ShareCommentModel().RestoreComment(commentId)
+}
+
+// 放入回收站的同时停掉正在运行的插件
+func TrashPlugin(pluginId int) error {
+	pluginInfo, err := model.SharePluginModel().FetchPluginByPluginID(pluginId)
+	if err != nil {
+		return err
+	}
+	if pluginInfo == nil {
+		return errors.New("no such plugin")
+	}
+	if err = model.SharePluginModel().TrashPlugin(pluginId); err != nil {
+		return err
+	}
+	// 插件没有运行时会返回错误，可以忽略
+	plugin.SharePluginMgrInstance().StopPlugin(pluginId)
+	return nil
+}
+
+// 恢复之后插件在下一次请求时自动启动
+func RestorePlugin(pluginId int) error {
+	pluginInfo, err := model.SharePluginModel().FetchTrashPluginByPluginID(pluginId)
+	if err != nil {
+		return err
+	}
+	if pluginInfo == nil {
+		return ErrNotInTrash
+	}
+	return model.SharePluginModel().RestorePlugin(pluginId)
+}
+
+func purgePlugin(pluginInfo *info.PluginInfo) error {
+	if err := model.ShareVoteModel().DeleteCommentVotesByTypeId(info.CommentType_Plugin, pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.ShareVoteModel().DeleteTargetVotes(info.VoteTarget_Plugin, pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.ShareRatingModel().DeletePluginRatings(pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.ShareVisitModel().DeleteTargetVisitStats(info.VisitTarget_Plugin, pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.ShareSpamModel().DeleteTrainedCommentsByTypeId(info.CommentType_Plugin, pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.ShareCommentHistoryModel().DeleteCommentHistoryByTypeId(info.CommentType_Plugin, pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.ShareNotificationModel().DeleteNotificationsByTypeId(info.CommentType_Plugin, pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.ShareCommentModel().DeleteAllBlogComment(info.CommentType_Plugin, pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.ShareCommentSettingModel().DeleteCommentSetting(info.CommentType_Plugin, pluginInfo.PluginID); err != nil {
+		return err
+	}
+	if err := model.SharePluginModel().DeletePlugin(pluginInfo.PluginID); err != nil {
+		return err
+	}
+	pluginRootPath := config.GetDefaultConfigJsonReader().GetString("storage.file.plugin")
+	return os.RemoveAll(filepath.Join(pluginRootPath, pluginInfo.PluginUUID))
+}
+
+func purgeComment(commentId int) error {
+	if err := model.ShareVoteModel().DeleteTargetVotes(info.VoteTarget_Comment, commentId); err != nil {
+		return err
+	}
+	if err := model.ShareSpamModel().DeleteTrainedComment(commentId); err != nil {
+		return err
+	}
+	if err := model.ShareCommentHistoryModel().DeleteCommentHistory(commentId); err != nil {
+		return err
+	}
+	if err := model.ShareNotificationModel().DeleteCommentNotifications(commentId); err != nil {
+		return err
+	}
+	return model.ShareCommentModel().DeleteComment(commentId)
+}
+
+// 回收站支持的种类，其它的kind在进回收站和写审计日志之前就拒绝
+func IsValidKind(kind string) bool {
+	return kind == KindBlog || kind == KindComment || kind == KindPlugin
+}
+
+func Trash(kind string, id int) error {
+	switch kind {
+	case KindBlog:
+		return TrashBlog(id)
+	case KindComment:
+		return TrashComment(id)
+	case KindPlugin:
+		return TrashPlugin(id)
+	}
+	return fmt.Errorf("unsupport kind: %s", kind)
+}
+
+func Restore(kind string, id int) error {
+	switch kind {
+	case KindBlog:
+		return RestoreBlog(id)
+	case KindComment:
+		return RestoreComment(id)
+	case KindPlugin:
+		return RestorePlugin(id)
+	}
+	return fmt.Errorf("unsupport kind: %s", kind)
+}
+
+// 不等保留期，立即彻底删除回收站里的某一项
+func Purge(kind string, id int) error {
+	switch kind {
+	case KindBlog:
+		blogInfo, err := model.ShareBlogModel().FetchTrashBlogByBlogID(id)
+		if err != nil {
+			return err
+		}
+		if blogInfo == nil {
+			return ErrNotInTrash
+		}
+		return purgeBlog(blogInfo)
+	case KindComment:
+		commentInfo, err := model.ShareCommentModel().FetchTrashCommentByCommentId(id)
+		if err != nil {
+			return err
+		}
+		if commentInfo == nil {
+			return ErrNotInTrash
+		}
+		return purgeComment(id)
+	case KindPlugin:
+		pluginInfo, err := model.SharePluginModel().FetchTrashPluginByPluginID(id)
+		if err != nil {
+			return err
+		}
+		if pluginInfo == nil {
+			return ErrNotInTrash
+		}
+		return purgePlugin(pluginInfo)
+	}
+	return fmt.Errorf("unsupport kind: %s", kind)
+}
+
+// 彻底删除超过保留期的数据，返回删除的条数
+func PurgeExpired() (int, error) {
+	beforeTime := time.Now().Add(-retention()).Unix()
+	count := 0
+	blogList, err := model.ShareBlogModel().FetchExpiredTrashBlogList(beforeTime)
+	if err != nil {
+		return count, err
+	}
+	for iter := blogList.Front(); iter != nil; iter = iter.Next() {
+		blogInfo := iter.Value.(info.BlogInfo)
+		if err = purgeBlog(&blogInfo); err != nil {
+			return count, err
+		}
+		count++
+	}
+	commentList, err := model.ShareCommentModel().FetchExpiredTrashCommentList(beforeTime)
+	if err != nil {
+		return count, err
+	}
+	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+		commentInfo := iter.Value.(info.CommentInfo)
+		if err = purgeComment(commentInfo.CommentID); err != nil {
+			return count, err
+		}
+		count++
+	}
+	pluginList, err := model.SharePluginModel().FetchExpiredTrashPluginList(beforeTime)
+	if err != nil {
+		return count, err
+	}
+	for iter := pluginList.Front(); iter != nil; iter = iter.Next() {
+		pluginInfo := iter.Value.(info.PluginInfo)
+		if err = purgePlugin(&pluginInfo); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// 启动定时清理，间隔为trash.purge_interval小时
+func StartPurgeTimer() {
+	purgeOnce.Do(func() {
+		interval := time.Duration(configInteger("trash.purge_interval", kDefaultPurgeIntervalHour)) * time.Hour
+		purgeTimer = timer.NewRepeatingTimer()
+		purgeTimer.Start(interval, func() {
+			count, err := PurgeExpired()
+			if err != nil {
+				fmt.Println("purge trash error: ", err)
+			}
+			fmt.Println("purge trash: ", count)
+		})
+	})
+}
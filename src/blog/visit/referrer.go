@@ -0,0 +1,74 @@
+package visit
+
+import (
+	"info"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const kMaxSourceLength = 64
+
+// 搜索引擎域名里的关键字以及搜索词所在的参数
+var searchEngineList = []struct {
+	keyword   string
+	paramList []string
+}{
+	{"google.", []string{"q"}},
+	{"bing.com", []string{"q"}},
+	{"baidu.com", []string{"wd", "word"}},
+	{"sogou.com", []string{"query", "keyword"}},
+	{"so.com", []string{"q"}},
+	{"sm.cn", []string{"q"}},
+	{"yahoo.", []string{"p"}},
+	{"duckduckgo.com", []string{"q"}},
+	{"yandex.", []string{"text"}},
+}
+
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= kMaxSourceLength {
+		return s
+	}
+	return string([]rune(s)[:kMaxSourceLength])
+}
+
+func hostName(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+/* 解析Referer，返回来源域名、搜索词以及是否是入口页。
+** 站内跳转的来源域名为空，不算入口页；没有Referer的算直接打开。
+ */
+func parseReferrer(referrer string, host string) (string, string, bool) {
+	if referrer == "" {
+		return info.VisitReferrer_Direct, "", true
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return info.VisitReferrer_Direct, "", true
+	}
+	domain := hostName(u.Host)
+	if domain == hostName(host) {
+		return "", "", false
+	}
+	term := ""
+	for _, engine := range searchEngineList {
+		if !strings.Contains(domain, engine.keyword) {
+			continue
+		}
+		query := u.Query()
+		for _, param := range engine.paramList {
+			if value := query.Get(param); value != "" {
+				term = strings.ToLower(truncate(value))
+				break
+			}
+		}
+		break
+	}
+	return truncate(domain), term, true
+}
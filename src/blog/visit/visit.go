@@ -0,0 +1,301 @@
+package visit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"framework/base/config"
+	"framework/base/timer"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* 访问统计：页面访问先记在内存里，由定时任务批量写入数据库，不再每次访问都更新blog表。
+** 同一个访客对同一篇博客(插件)一天只计一次独立访问，有session cookie时按session去重，
+** 否则按ip和User-Agent的指纹去重，去重记录写在visit_visitor表里，重启之后依然有效。
+** 爬虫按User-Agent排除，不计入任何统计。
+** 服务异常退出时最多丢失一个写入周期(visit.flush_interval，单位秒)的访问量。
+** 数据库一直写不进去时，内存里最多缓存visit.flush_size的kMaxPendingFactor倍，
+** 连续失败kMaxFlushFailures次之后丢掉这一批，避免内存无限增长。
+** 去重记录只保留今天和昨天的，每天第一次写入成功之后清理更早的。
+** 每次访问的来源也会写入原始记录表，每隔visit.rollup_interval分钟汇总成每日的来源统计，
+** 汇总之后原始记录就删掉了，所以来源统计最多滞后一个汇总周期。
+ */
+
+const (
+	kDefaultFlushIntervalSecond = 60
+	// 缓存的访问量达到这个数时不等定时任务，立即写入
+	kDefaultFlushSize            = 1000
+	kDefaultRollupIntervalMinute = 60
+	kMaxPendingFactor            = 10
+	kMaxFlushFailures            = 3
+)
+
+// User-Agent里包含这些关键字的当成爬虫
+var botKeywordList []string = []string{
+	"bot", "spider", "crawler", "slurp", "curl", "wget", "python-requests", "go-http-client",
+	"headless", "phantomjs", "facebookexternalhit", "feedfetcher", "mediapartners",
+}
+
+type visitKey struct {
+	targetType string
+	targetId   int
+	day        int
+}
+
+// visitorSet是这一批里出现过的访客，写入时再和数据库里当天的访客去重
+type visitCounter struct {
+	pageView   int
+	visitorSet map[string]bool
+}
+
+type visitBuffer struct {
+	lock     sync.Mutex
+	hitMap   map[visitKey]*visitCounter
+	hitList  []*info.VisitHitInfo
+	pending  int
+	visitors int
+	failures int
+}
+
+var buffer *visitBuffer = &visitBuffer{
+	hitMap: make(map[visitKey]*visitCounter),
+}
+
+var flushLock sync.Mutex
+
+var flushTimer *timer.Timer = nil
+
+var flushOnce sync.Once
+
+// 上次清理去重记录的日期，由flushLock保护
+var pruneDay int
+
+var rollupTimer *timer.Timer = nil
+
+var rollupOnce sync.Once
+
+func configInteger(key string, defaultValue int) int {
+	if value, ok := config.GetDefaultConfigJsonReader().Get(key).(int64); ok && value > 0 {
+		return int(value)
+	}
+	return defaultValue
+}
+
+// 日期，格式为20170401
+func DayOf(t time.Time) int {
+	year, month, day := t.Date()
+	return year*10000 + int(month)*100 + day
+}
+
+func IsBot(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+	userAgent = strings.ToLower(userAgent)
+	for _, keyword := range botKeywordList {
+		if strings.Contains(userAgent, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+/* 访客标识，32个字符的摘要。请求里带了session cookie才用session，
+** 否则每次请求都是新session，起不到去重的作用
+ */
+func visitorOf(r *http.Request, sessionId string) string {
+	var sum [sha256.Size]byte
+	if cookie, err := r.Cookie("s"); err == nil && sessionId != "" && cookie.Value == sessionId {
+		sum = sha256.Sum256([]byte("s:" + sessionId))
+	} else {
+		sum = sha256.Sum256([]byte("ip:" + server.ClientIP(r) + "|" + r.UserAgent()))
+	}
+	return hex.EncodeToString(sum[:16])
+}
+
+func maxPending() int {
+	return configInteger("visit.flush_size", kDefaultFlushSize) * kMaxPendingFactor
+}
+
+// 记录一次页面访问，sessionId可以为空
+func Hit(targetType string, targetId int, r *http.Request, sessionId string) {
+	if IsBot(r.UserAgent()) {
+		return
+	}
+	visitor := visitorOf(r, sessionId)
+	now := time.Now()
+	day := DayOf(now)
+
+	limit := maxPending()
+	buffer.lock.Lock()
+	key := visitKey{targetType: targetType, targetId: targetId, day: day}
+	counter, ok := buffer.hitMap[key]
+	if !ok {
+		counter = &visitCounter{visitorSet: make(map[string]bool)}
+		buffer.hitMap[key] = counter
+	}
+	counter.pageView++
+	// 写不进数据库积压太多时，不再记录新的访客和来源，只累加浏览次数
+	if !counter.visitorSet[visitor] && buffer.visitors < limit {
+		counter.visitorSet[visitor] = true
+		buffer.visitors++
+	}
+	if len(buffer.hitList) < limit {
+		referrer, term, entry := parseReferrer(r.Referer(), r.Host)
+		buffer.hitList = append(buffer.hitList, &info.VisitHitInfo{
+			TargetType: targetType,
+			TargetID:   targetId,
+			Day:        day,
+			Time:       now.Unix(),
+			Referrer:   referrer,
+			Term:       term,
+			Entry:      entry,
+		})
+	}
+	buffer.pending++
+	full := buffer.pending >= configInteger("visit.flush_size", kDefaultFlushSize)
+	buffer.lock.Unlock()
+
+	if full {
+		go flushAndLog()
+	}
+}
+
+// 还没有写入数据库的访客数，页面展示访问量时加上，避免显示滞后，其中可能有当天已经计过的访客
+func Pending(targetType string, targetId int) int {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	count := 0
+	for key, counter := range buffer.hitMap {
+		if key.targetType == targetType && key.targetId == targetId {
+			count += len(counter.visitorSet)
+		}
+	}
+	return count
+}
+
+/* 把缓存的访问量写入数据库，写入失败时放回缓存，下次再写。
+** 连续失败kMaxFlushFailures次之后丢掉这一批，放回时也不超过maxPending
+ */
+func Flush() error {
+	flushLock.Lock()
+	defer flushLock.Unlock()
+
+	buffer.lock.Lock()
+	hitMap := buffer.hitMap
+	hitList := buffer.hitList
+	buffer.hitMap = make(map[visitKey]*visitCounter)
+	buffer.hitList = nil
+	buffer.pending = 0
+	buffer.visitors = 0
+	buffer.lock.Unlock()
+
+	var statList []*info.VisitStatInfo = nil
+	for key, counter := range hitMap {
+		stat := &info.VisitStatInfo{
+			TargetType: key.targetType,
+			TargetID:   key.targetId,
+			Day:        key.day,
+			PageView:   counter.pageView,
+		}
+		for visitor := range counter.visitorSet {
+			stat.VisitorList = append(stat.VisitorList, visitor)
+		}
+		statList = append(statList, stat)
+	}
+	err := model.ShareVisitModel().AddVisits(statList, hitList)
+	if err == nil {
+		pruneVisitors()
+	}
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	if err == nil {
+		buffer.failures = 0
+		return nil
+	}
+	buffer.failures++
+	if buffer.failures >= kMaxFlushFailures {
+		buffer.failures = 0
+		return fmt.Errorf("drop %d visit hits after %d failures: %v", len(hitList), kMaxFlushFailures, err)
+	}
+	limit := maxPending()
+	for key, counter := range hitMap {
+		current, ok := buffer.hitMap[key]
+		if !ok {
+			current = &visitCounter{visitorSet: make(map[string]bool)}
+			buffer.hitMap[key] = current
+		}
+		current.pageView += counter.pageView
+		for visitor := range counter.visitorSet {
+			if !current.visitorSet[visitor] && buffer.visitors < limit {
+				current.visitorSet[visitor] = true
+				buffer.visitors++
+			}
+		}
+		buffer.pending += counter.pageView
+	}
+	if len(hitList)+len(buffer.hitList) > limit {
+		// 丢掉旧的原始记录，只影响来源统计
+		hitList = hitList[len(hitList)+len(buffer.hitList)-limit:]
+	}
+	buffer.hitList = append(hitList, buffer.hitList...)
+	return err
+}
+
+// 去重记录只保留今天和昨天的，昨天的留给跨天还没写入的访问
+func pruneVisitors() {
+	today := DayOf(time.Now())
+	if pruneDay == today {
+		return
+	}
+	yesterday := DayOf(time.Now().AddDate(0, 0, -1))
+	if err := model.ShareVisitModel().DeleteVisitorsBefore(yesterday); err != nil {
+		fmt.Println("delete visitors error: ", err)
+		return
+	}
+	pruneDay = today
+}
+
+func flushAndLog() {
+	if err := Flush(); err != nil {
+		fmt.Println("flush visit error: ", err)
+	}
+}
+
+// 启动定时写入，间隔为visit.flush_interval秒
+func StartFlushTimer() {
+	flushOnce.Do(func() {
+		interval := time.Duration(configInteger("visit.flush_interval", kDefaultFlushIntervalSecond)) * time.Second
+		flushTimer = timer.NewRepeatingTimer()
+		flushTimer.Start(interval, flushAndLog)
+	})
+}
+
+// 汇总原始访问记录，返回汇总的条数，先写入内存里的访问量，尽量汇总完整
+func Rollup() (int, error) {
+	if err := Flush(); err != nil {
+		return 0, err
+	}
+	return model.ShareVisitModel().RollupVisitHits()
+}
+
+// 启动定时汇总，间隔为visit.rollup_interval分钟
+func StartRollupTimer() {
+	rollupOnce.Do(func() {
+		interval := time.Duration(configInteger("visit.rollup_interval", kDefaultRollupIntervalMinute)) * time.Minute
+		rollupTimer = timer.NewRepeatingTimer()
+		rollupTimer.Start(interval, func() {
+			count, err := Rollup()
+			if err != nil {
+				fmt.Println("rollup visit error: ", err)
+			}
+			fmt.Println("rollup visit: ", count)
+		})
+	})
+}
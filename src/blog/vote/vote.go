@@ -0,0 +1,124 @@
+package vote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+/* 顶/踩以及插件评分。
+** 登录用户按用户id去重，匿名用户按ip和User-Agent算出的指纹去重，
+** 指纹只用来去重，不能可靠地区分同一个网络下的不同用户。
+ */
+
+const (
+	kMaxStars        = 5
+	kMaxReviewLength = 140
+)
+
+var ErrTargetNotExist = errors.New("vote target not exist")
+
+// 投票人的标识
+func Voter(userId int64, r *http.Request) string {
+	if userId > 0 {
+		return fmt.Sprintf("user:%d", userId)
+	}
+	sum := sha256.Sum256([]byte(server.ClientIP(r) + "|" + r.UserAgent()))
+	return "anon:" + hex.EncodeToString(sum[:16])
+}
+
+// 只能给公开可见的对象投票
+func checkTarget(targetType string, targetId int) error {
+	switch targetType {
+	case info.VoteTarget_Blog:
+		blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(targetId)
+		if err != nil {
+			return err
+		}
+		if blogInfo == nil || !blogInfo.IsPublished() {
+			return ErrTargetNotExist
+		}
+		return nil
+	case info.VoteTarget_Comment:
+		commentInfo, err := model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Blog, targetId)
+		if err == nil && commentInfo == nil {
+			commentInfo, err = model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Plugin, targetId)
+		}
+		if err != nil {
+			return err
+		}
+		// 还没有审核通过或者已经删除的评论不能投票
+		if commentInfo == nil || commentInfo.Status != info.CommentStatus_Approved || commentInfo.IsRemoved() {
+			return ErrTargetNotExist
+		}
+		return nil
+	case info.VoteTarget_Plugin:
+		return checkPlugin(targetId)
+	}
+	return fmt.Errorf("unsupport vote target: %s", targetType)
+}
+
+func checkPlugin(pluginId int) error {
+	pluginInfo, err := model.SharePluginModel().FetchPluginByPluginID(pluginId)
+	if err != nil {
+		return err
+	}
+	if pluginInfo == nil {
+		return ErrTargetNotExist
+	}
+	return nil
+}
+
+// 顶(Vote_Up)或者踩(Vote_Down)
+func Vote(targetType string, targetId int, voter string, value int) (*info.VoteCountInfo, error) {
+	if value != info.Vote_Up && value != info.Vote_Down {
+		return nil, fmt.Errorf("invalid vote value: %d", value)
+	}
+	if err := checkTarget(targetType, targetId); err != nil {
+		return nil, err
+	}
+	return model.ShareVoteModel().SetVote(targetType, targetId, voter, value)
+}
+
+func Unvote(targetType string, targetId int, voter string) (*info.VoteCountInfo, error) {
+	if err := checkTarget(targetType, targetId); err != nil {
+		return nil, err
+	}
+	return model.ShareVoteModel().SetVote(targetType, targetId, voter, info.Vote_None)
+}
+
+// 当前用户对一批对象的投票，用于渲染页面
+func VoteMap(targetType string, targetIdList []int, voter string) map[int]int {
+	voteMap, err := model.ShareVoteModel().FetchVoteMap(targetType, targetIdList, voter)
+	if err != nil {
+		fmt.Println("fetch vote error: ", err)
+		return map[int]int{}
+	}
+	return voteMap
+}
+
+// 给插件评分，review是可选的短评
+func Rate(pluginId int, voter string, userId int64, stars int, review string) error {
+	if stars < 1 || stars > kMaxStars {
+		return fmt.Errorf("stars should be 1 to %d", kMaxStars)
+	}
+	review = strings.TrimSpace(review)
+	if utf8.RuneCountInString(review) > kMaxReviewLength {
+		return fmt.Errorf("review should be less than %d characters", kMaxReviewLength)
+	}
+	if err := checkPlugin(pluginId); err != nil {
+		return err
+	}
+	return model.ShareRatingModel().SetRating(pluginId, voter, userId, stars, review)
+}
+
+func Unrate(pluginId int, voter string) error {
+	return model.ShareRatingModel().DeleteRating(pluginId, voter)
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"blog/account"
+	"encoding/json"
+	"fmt"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"html/template"
+	"info"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type resetPasswordRender struct {
+	Host  *hostRender
+	Token string
+}
+
+type AccountController struct {
+	server.SessionController
+}
+
+func NewAccountController() *AccountController {
+	return &AccountController{}
+}
+
+func (a *AccountController) Path() interface{} {
+	return "/account"
+}
+
+func (a *AccountController) SessionPath() string {
+	return "/"
+}
+
+// 和QQ、微博登录写一样的会话
+func (a *AccountController) writeLoginInfo(userInfo *info.UserInfo) {
+	a.WebSession.Set("from", "local")
+	a.WebSession.Set("id", strconv.Itoa(int(userInfo.UserID)))
+	a.WebSession.Set("status", "login")
+	a.ResetSessionDuration()
+}
+
+func accountErrorCode(err error) int {
+	switch err {
+	case account.ErrInvalidName, account.ErrInvalidEmail, account.ErrWeakPassword:
+		return framework.ErrorParamError
+	case account.ErrNameTaken, account.ErrEmailTaken:
+		return framework.ErrorAccountExist
+	case account.ErrWrongPassword:
+		return framework.ErrorAccountPasswordError
+	case account.ErrInvalidToken:
+		return framework.ErrorAccountTokenError
+	case account.ErrTooManyLogins:
+		return framework.ErrorAccountTooFrequent
+	}
+	return framework.ErrorSQLError
+}
+
+func userInfoToData(userInfo *info.UserInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   userInfo.UserID,
+		"name": userInfo.UserName,
+		"pic":  userInfo.SmallFigureurl,
+	}
+}
+
+// 邮件里的链接打开的页面，填写新的密码
+func (a *AccountController) renderResetPage(w http.ResponseWriter, token string) {
+	t, err := template.ParseFiles("./src/view/html/reset-password.html")
+	if err != nil {
+		fmt.Println("parse file error: ", err.Error())
+		return
+	}
+	t.Execute(w, &resetPasswordRender{Host: buildHostRender(), Token: token})
+}
+
+/* 本站帐号，json格式如下：
+** {"type": "register", "name": "用户名", "email": "邮箱", "password": "密码"}，注册成功之后直接登录
+** {"type": "login", "account": "用户名或者邮箱", "password": "密码"}
+** {"type": "logout"}
+** {"type": "changePassword", "old_password": "旧密码", "password": "新密码"}，需要登录
+** {"type": "requestReset", "email": "邮箱"}，往邮箱发送找回密码的链接
+** {"type": "resetPassword", "token": "邮件里的令牌", "password": "新密码"}
+** GET /account?token=xxx 是邮件里的链接打开的页面
+ */
+func (a *AccountController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		r.ParseForm()
+		a.renderResetPage(w, r.Form.Get("token"))
+		return
+	}
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		response.JsonResponse(w, framework.ErrorParamError)
+		return
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(body, &m); err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	a.SessionController.HandlerRequest(a, w, r)
+	actionType, _ := m["type"].(string)
+	password, _ := m["password"].(string)
+	switch actionType {
+	case "register":
+		name, _ := m["name"].(string)
+		email, _ := m["email"].(string)
+		userInfo, err := account.Register(name, email, password)
+		if err != nil {
+			response.JsonResponseWithMsg(w, accountErrorCode(err), err.Error())
+			return
+		}
+		a.writeLoginInfo(userInfo)
+		response.JsonResponseWithData(w, framework.ErrorOK, "", userInfoToData(userInfo))
+	case "login":
+		name, _ := m["account"].(string)
+		userInfo, err := account.Authenticate(name, password, server.ClientIP(r))
+		if err != nil {
+			response.JsonResponseWithMsg(w, accountErrorCode(err), err.Error())
+			return
+		}
+		a.writeLoginInfo(userInfo)
+		response.JsonResponseWithData(w, framework.ErrorOK, "", userInfoToData(userInfo))
+	case "logout":
+		if a.LoginUserId() > 0 {
+			if err = a.GetSessionMgr().DeleteSession(a.WebSession.SessionID()); err != nil {
+				response.JsonResponseWithMsg(w, framework.ErrorRunTimeError, err.Error())
+				return
+			}
+		}
+		response.JsonResponse(w, framework.ErrorOK)
+	case "changePassword":
+		userId := a.LoginUserId()
+		if userId <= 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "account not login")
+			return
+		}
+		oldPassword, _ := m["old_password"].(string)
+		if err = account.ChangePassword(userId, oldPassword, password); err != nil {
+			response.JsonResponseWithMsg(w, accountErrorCode(err), err.Error())
+			return
+		}
+		response.JsonResponse(w, framework.ErrorOK)
+	case "requestReset":
+		email, _ := m["email"].(string)
+		if err = account.RequestReset(email, buildHostRender().Host+"/account"); err != nil {
+			response.JsonResponseWithMsg(w, accountErrorCode(err), err.Error())
+			return
+		}
+		response.JsonResponse(w, framework.ErrorOK)
+	case "resetPassword":
+		token, _ := m["token"].(string)
+		if err = account.ResetPassword(token, password); err != nil {
+			response.JsonResponseWithMsg(w, accountErrorCode(err), err.Error())
+			return
+		}
+		response.JsonResponse(w, framework.ErrorOK)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+	}
+}
@@ -5,6 +5,10 @@ package controller
  */
 
 import (
+	"blog/markup"
+	"blog/moderation"
+	"blog/notify"
+	"blog/permission"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -24,11 +28,17 @@ type apiCommentRender struct {
 	UserName       string
 	Pic            string
 	CommentID      string
-	CommentContent string
+	CommentContent template.HTML
 	CommentTime    string
 	Floor          int
 	User           *info.UserInfo
 	ChildContent   template.HTML
+	Praise         int
+	Dissent        int
+	Vote           int
+	IsPending      bool
+	IsEdited       bool
+	IsRemoved      bool
 }
 
 type APIController struct {
@@ -54,6 +64,10 @@ func (a *APIController) buildComment(commentId int) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		// 父评论已经放入回收站
+		if comment == nil {
+			break
+		}
 		commentList = append(commentList, comment)
 		commentId = comment.ParentCommentID
 	}
@@ -64,25 +78,23 @@ func (a *APIController) buildComment(commentId int) (string, error) {
 		commentList[i] = commentList[commentListLength-i-1]
 		commentList[commentListLength-i-1] = tmp
 	}
-	comment := buildOneCommentFromCommentList(&commentList)
+	// 刚发表的评论还没有投票
+	comment := buildOneCommentFromCommentList(&commentList, nil)
 	return comment, nil
 }
 
+// 没有登录时，开启了游客评论的话按游客处理，见guestCommentUser
 func (a *APIController) handlePublicCommentAction(w http.ResponseWriter, inf map[string]interface{}) {
-	status, err := a.WebSession.Get("status")
-	if err != nil {
-		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, err.Error())
-		return
-	}
-	if status != "login" {
-		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "account not login")
-		return
-	}
-	uid, err := a.WebSession.Get("id")
-	userId, err := strconv.Atoi(uid.(string))
-	if err != nil {
-		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, err.Error())
-		return
+	userId := int(a.LoginUserId())
+	isGuest := false
+	if userId <= 0 {
+		guestId, code, msg := a.guestCommentUser(inf)
+		if code != framework.ErrorOK {
+			response.JsonResponseWithMsg(w, code, msg)
+			return
+		}
+		userId = int(guestId)
+		isGuest = true
 	}
 	parseInt := func(name string, retValue *int) bool {
 		var ok bool
@@ -104,16 +116,71 @@ func (a *APIController) handlePublicCommentAction(w http.ResponseWriter, inf map
 	var blogId, commentId int
 	var content string
 	if parseInt("blogId", &blogId) && parseInt("commentId", &commentId) {
+		// 不能评论已经放入回收站或者还没有发布的博客
+		if blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId); err != nil || blogInfo == nil ||
+			!blogInfo.IsPublished() {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no such blog")
+			return
+		}
+		// 只能回复自己看得到的评论
+		if commentId != -1 {
+			parent, err := model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Blog, commentId)
+			if err != nil || parent == nil || parent.TypeID != blogId || !parent.IsVisibleTo(int64(userId)) {
+				response.JsonResponseWithMsg(w, framework.ErrorCommentNotExist, "no such comment")
+				return
+			}
+		}
 		if _, ok := inf["content"]; ok {
 			switch inf["content"].(type) {
 			case string:
 				content = inf["content"].(string)
-				commentId, err := model.ShareCommentModel().AddComment(info.CommentType_Blog, userId, blogId, commentId, content)
+				var status string
+				var err error
+				if isGuest {
+					status, err = moderation.CheckGuest(info.CommentType_Blog, blogId, int64(userId), content)
+				} else {
+					status, err = moderation.Check(info.CommentType_Blog, blogId, int64(userId), content)
+				}
+				if err == moderation.ErrCommentClosed {
+					response.JsonResponseWithMsg(w, framework.ErrorCommentClosed, err.Error())
+					return
+				}
+				if err == moderation.ErrNeedLogin {
+					response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, err.Error())
+					return
+				}
+				if err == permission.ErrBanned {
+					response.JsonResponseWithMsg(w, framework.ErrorAccountBanned, err.Error())
+					return
+				}
+				if err != nil {
+					response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+					return
+				}
+				contentHTML, err := markup.RenderComment(content)
+				if err != nil {
+					response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+					return
+				}
+				commentId, err := model.ShareCommentModel().AddComment(info.CommentType_Blog, userId, blogId, commentId,
+					content, contentHTML, status)
 				if err == nil {
 					comment, err := a.buildComment(commentId)
 					if err == nil {
 						var data map[string]interface{} = make(map[string]interface{})
 						data["comment"] = base64.StdEncoding.EncodeToString([]byte(comment))
+						// pending时页面上提示等待审核，spam和rejected只有主人能看到
+						data["status"] = status
+						if created, err := model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Blog,
+							commentId); err == nil && created != nil {
+							data["item"] = commentListToData([]*info.CommentInfo{created}, "")[0]
+							// 等待审核的评论在审核通过时再通知
+							if status == info.CommentStatus_Approved {
+								if err = notify.OnComment(created); err != nil {
+									fmt.Println("notify error: ", err)
+								}
+							}
+						}
 						response.JsonResponseWithData(w, framework.ErrorOK, "", data)
 						return
 					}
@@ -148,9 +215,15 @@ func (a *APIController) handleGetUserInfoRequest(w http.ResponseWriter) {
 		response.JsonResponseWithMsg(w, framework.ErrorRunTimeError, err.Error())
 		return
 	}
+	// 页面根据角色决定是否显示审核入口
+	role, err := permission.Role(int64(userId))
+	if err != nil {
+		role = info.Role_Commenter
+	}
 	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
 		"name": userInfo.UserName,
 		"pic":  userInfo.SmallFigureurl,
+		"role": role,
 	})
 }
 
@@ -179,6 +252,37 @@ func (a *APIController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
 					a.handlePublicCommentAction(w, info)
 					return
 				case "blog":
+				case "comments":
+					a.SessionController.HandlerRequest(a, w, r)
+					a.handleCommentListAction(w, r, info)
+					return
+				case "notifications", "unreadCount", "markRead":
+					a.SessionController.HandlerRequest(a, w, r)
+					a.handleNotifyAction(w, info, api.(string))
+					return
+				case "previewComment":
+					a.handleCommentPreviewAction(w, info)
+					return
+				case "editComment", "deleteComment":
+					a.SessionController.HandlerRequest(a, w, r)
+					a.handleCommentEditAction(w, r, info, api.(string))
+					return
+				case "vote", "unvote", "voteState":
+					a.SessionController.HandlerRequest(a, w, r)
+					a.handleVoteAction(w, r, info, api.(string))
+					return
+				case "rate", "unrate", "ratings":
+					a.SessionController.HandlerRequest(a, w, r)
+					a.handleRatingAction(w, r, info, api.(string))
+					return
+				case "profile", "privacy", "setPrivacy":
+					a.SessionController.HandlerRequest(a, w, r)
+					a.handleProfileAction(w, info, api.(string))
+					return
+				case "guestInfo":
+					a.SessionController.HandlerRequest(a, w, r)
+					a.handleGuestInfoRequest(w)
+					return
 				case "getUserInfo":
 					fmt.Println("getUserInfo")
 					a.SessionController.HandlerRequest(a, w, r)
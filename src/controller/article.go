@@ -1,26 +1,38 @@
 package controller
 
 import (
+	"blog/publish"
 	"framework"
 	"framework/base/config"
 	"framework/response"
 	"framework/server"
+	"io/ioutil"
 	"model"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// 缓存的文件内容，文件被重新上传或回滚后修改时间和大小会变化，据此判断缓存是否失效
+type fileContentCache struct {
+	content *[]byte
+	modTime time.Time
+	size    int64
+}
+
 type ArticleController struct {
 	server.SessionController
-	blogContentMap map[string]*[]byte
+	blogContentMap  map[string]*fileContentCache
+	blogContentLock sync.RWMutex
 }
 
 func NewArticleController() *ArticleController {
 	controller := &ArticleController{}
-	controller.blogContentMap = make(map[string]*[]byte)
+	controller.blogContentMap = make(map[string]*fileContentCache)
 	return controller
 }
 
@@ -29,28 +41,38 @@ func (b *ArticleController) Path() (interface{}, bool) {
 }
 
 func (b *ArticleController) readFileContent(path string) *[]byte {
-	if v, ok := b.blogContentMap[path]; ok {
-		return v
-	}
 	fileInfo, err := os.Stat(path)
-	if err == nil {
-		content := make([]byte, fileInfo.Size())
-		file, _ := os.Open(path)
-		defer file.Close()
-		file.Read(content)
-		b.blogContentMap[path] = &content
-		return &content
+	if err != nil {
+		return nil
+	}
+	b.blogContentLock.RLock()
+	v, ok := b.blogContentMap[path]
+	b.blogContentLock.RUnlock()
+	if ok && v.modTime.Equal(fileInfo.ModTime()) && v.size == fileInfo.Size() {
+		return v.content
 	}
-	return nil
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	b.blogContentLock.Lock()
+	b.blogContentMap[path] = &fileContentCache{&content, fileInfo.ModTime(), fileInfo.Size()}
+	b.blogContentLock.Unlock()
+	return &content
 }
 
-func (b *ArticleController) readBlog(w http.ResponseWriter, blogId int) {
-	uuid, err := model.ShareBlogModel().GetBlogUUIDByBlogID(blogId)
-	// generate blog path
+func (b *ArticleController) readBlog(w http.ResponseWriter, blogId int, previewKey string) {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
 	if err != nil {
 		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
 		return
 	}
+	if !publish.CanView(blogInfo, previewKey) {
+		response.JsonResponseWithMsg(w, framework.ErrorBlogNotExist, "no such blog")
+		return
+	}
+	// generate blog path
+	uuid := blogInfo.BlogUUID
 	blogPath := config.GetDefaultConfigJsonReader().Get("storage.file.blog").(string)
 	blogPath = filepath.Join(blogPath, uuid, uuid+".html")
 	blogContent := b.readFileContent(blogPath)
@@ -80,7 +102,7 @@ func (b *ArticleController) HandlerRequest(w http.ResponseWriter, r *http.Reques
 			response.JsonResponseWithMsg(w, framework.ErrorParamError, "param error")
 			return
 		}
-		b.readBlog(w, id)
+		b.readBlog(w, id, r.Form.Get("preview"))
 	} else if r.URL.Path == "/cover" {
 		uuid := r.Form.Get("id")
 		blogPath := config.GetDefaultConfigJsonReader().Get("storage.file.blog").(string)
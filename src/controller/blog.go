@@ -1,6 +1,11 @@
 package controller
 
 import (
+	"blog/guest"
+	"blog/publish"
+	"blog/visit"
+	"blog/vote"
+	"controller/login"
 	"fmt"
 	"framework"
 	"framework/base/config"
@@ -29,14 +34,20 @@ type blogCommentRender struct {
 }
 
 type userRender struct {
-	IsLogin  bool
-	UserID   string
-	NickName string
-	Pic      string
+	IsLogin     bool
+	UserID      string
+	NickName    string
+	Pic         string
+	UnreadCount int
+	// 没有登录时是否显示游客评论的表单
+	GuestEnabled bool
+	// 已经配置的第三方登录
+	LoginProviders []*login.Provider
 }
 
 type blogRender struct {
 	CommentContent         template.HTML
+	CommentPage            *pageRender
 	BlogID                 string
 	BlogTitle              string
 	BlogTag                string
@@ -44,9 +55,14 @@ type blogRender struct {
 	BlogTime               string
 	Author                 string
 	BlogVisitCount         string
+	BlogPraiseCount        int
+	BlogDissentCount       int
+	BlogVote               int
 	BlogContent            template.HTML
 	BlogCommentCount       string
 	BlogCommentPeopleCount string
+	IsPreview              bool
+	BlogStatus             string
 	User                   userRender
 	Side                   *sideRender
 	Host                   *hostRender
@@ -71,8 +87,10 @@ func (b *BlogController) SessionPath() string {
 	return "/"
 }
 
-func (b *BlogController) fetchCommentContent(blogId int) (string, error) {
-	commentList, err := model.ShareCommentModel().FetchAllCommentByBlogId(info.CommentType_Blog, blogId)
+// 只显示审核通过的评论和viewerId自己还在等待审核的评论
+func (b *BlogController) fetchCommentContent(blogId int, page int, voter string, viewerId int64) (string, error) {
+	commentList, err := model.ShareCommentModel().FetchCommentListByBlogId(info.CommentType_Blog, blogId,
+		pageOffset(page, kCommentPageSize), kCommentPageSize, viewerId)
 	if err != nil {
 		return "", err
 	}
@@ -82,10 +100,14 @@ func (b *BlogController) fetchCommentContent(blogId int) (string, error) {
 		info := iter.Value.(info.CommentInfo)
 		commentTree[info.CommentID] = &info
 	}
+	if err = fillParentComments(info.CommentType_Blog, commentTree, viewerId); err != nil {
+		return "", err
+	}
+	voteMap := vote.VoteMap(info.VoteTarget_Comment, commentTreeIdList(commentTree), voter)
 	var rawComment string = ""
 	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
 		info := iter.Value.(info.CommentInfo)
-		rawComment += buildOneCommentFromCommentTree(&commentTree, &info)
+		rawComment += buildOneCommentFromCommentTree(&commentTree, commentTree[info.CommentID], voteMap)
 	}
 	return rawComment, nil
 }
@@ -109,27 +131,35 @@ func (b *BlogController) readBlogContent(blogId int) string {
 	return ""
 }
 
-func (b *BlogController) readBlogHtml(w http.ResponseWriter, blogId int) {
-	if err := model.ShareBlogModel().AddVisitCount(blogId); err != nil {
-		response.JsonResponseWithMsg(w, framework.ErrorRenderError, err.Error())
+func (b *BlogController) readBlogHtml(w http.ResponseWriter, r *http.Request, blogId int, commentPage int,
+	previewKey string) {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
 		return
 	}
-	t, err := template.ParseFiles("./src/view/html/blog.html")
-	if err != nil {
-		response.JsonResponseWithMsg(w, framework.ErrorRenderError, err.Error())
+	if !publish.CanView(blogInfo, previewKey) {
+		response.JsonResponseWithMsg(w, framework.ErrorBlogNotExist, "no such blog")
 		return
 	}
-	content, err := b.fetchCommentContent(blogId)
+	// 预览不计入访问量
+	if blogInfo.IsPublished() {
+		visit.Hit(info.VisitTarget_Blog, blogId, r, b.WebSession.SessionID())
+	}
+	t, err := template.ParseFiles("./src/view/html/blog.html")
 	if err != nil {
-		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		response.JsonResponseWithMsg(w, framework.ErrorRenderError, err.Error())
 		return
 	}
-	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	voter := sessionVoter(&b.SessionController, r)
+	content, err := b.fetchCommentContent(blogId, commentPage, voter, b.LoginUserId())
 	if err != nil {
 		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
 		return
 	}
 	var render blogRender
+	render.IsPreview = !blogInfo.IsPublished()
+	render.BlogStatus = blogInfo.BlogStatus
 	render.Host = buildHostRender()
 	render.BlogID = strconv.Itoa(blogInfo.BlogID)
 	render.BlogSortType = blogInfo.BlogSortType
@@ -138,9 +168,14 @@ func (b *BlogController) readBlogHtml(w http.ResponseWriter, blogId int) {
 	render.BlogTag = strings.Join(blogInfo.BlogTagList, "||")
 	commentCount, err := model.ShareCommentModel().FetchCommentCount(info.CommentType_Blog, blogInfo.BlogID)
 	render.BlogCommentCount = strconv.Itoa(commentCount)
+	render.CommentPage = buildPageRenderWithParam(fmt.Sprintf("/blog?id=%d", blogId), "comment_page",
+		commentPage, kCommentPageSize, commentCount)
 	peopleCount, err := model.ShareCommentModel().FetchCommentPeopleCount(info.CommentType_Blog, blogInfo.BlogID)
 	render.BlogCommentPeopleCount = strconv.Itoa(peopleCount)
-	render.BlogVisitCount = strconv.Itoa(blogInfo.BlogVisitCount)
+	render.BlogVisitCount = strconv.Itoa(blogInfo.BlogVisitCount + visit.Pending(info.VisitTarget_Blog, blogId))
+	render.BlogPraiseCount = blogInfo.BlogPraiseCount
+	render.BlogDissentCount = blogInfo.BlogDissentCount
+	render.BlogVote = vote.VoteMap(info.VoteTarget_Blog, []int{blogId}, voter)[blogId]
 	render.CommentContent = template.HTML(content)
 	render.BlogContent = template.HTML(b.readBlogContent(blogId))
 	render.Author = config.GetDefaultConfigJsonReader().Get("account.owner.name").(string)
@@ -156,6 +191,7 @@ func (b *BlogController) readBlogHtml(w http.ResponseWriter, blogId int) {
 					render.User.NickName = userInfo.UserName
 					render.User.Pic = userInfo.SmallFigureurl
 					render.User.UserID = uid.(string)
+					render.User.UnreadCount = unreadCount(int64(userId))
 				} else {
 					render.User.IsLogin = false
 				}
@@ -168,10 +204,9 @@ func (b *BlogController) readBlogHtml(w http.ResponseWriter, blogId int) {
 	} else {
 		render.User.IsLogin = false
 	}
-	blogList, err := model.ShareBlogModel().FetchAllBlog()
-	if err == nil {
-		render.Side = buildSideRender(blogList)
-	}
+	render.User.GuestEnabled = !render.User.IsLogin && guest.Enabled()
+	render.User.LoginProviders = login.Providers()
+	render.Side = buildSideRender()
 	t.Execute(w, render)
 }
 
@@ -184,7 +219,7 @@ func (b *BlogController) HandlerRequest(w http.ResponseWriter, r *http.Request)
 			response.JsonResponseWithMsg(w, framework.ErrorParamError, "param error")
 			return
 		}
-		b.readBlogHtml(w, id)
+		b.readBlogHtml(w, r, id, parsePageParam(r, "comment_page"), r.Form.Get("preview"))
 	} else {
 		response.JsonResponseWithMsg(w, framework.ErrorParamError, "param error")
 	}
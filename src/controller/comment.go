@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"blog/markup"
 	"bufio"
 	"bytes"
 	"fmt"
@@ -11,14 +12,20 @@ import (
 )
 
 func buildCommentRender(info *info.CommentInfo, childComment *string,
-	floor *int) apiCommentRender {
+	floor *int, voteMap map[int]int) apiCommentRender {
 	var render apiCommentRender
 	render.ChildContent = template.HTML(*childComment)
-	render.CommentContent = info.Content
+	render.CommentContent = template.HTML(markup.CommentHTML(info))
 	render.CommentTime = FormatTime(info.Time)
 	render.CommentID = strconv.Itoa(info.CommentID)
 	render.UserID = string(info.UserID)
 	render.Floor = *floor
+	render.Praise = info.Praise
+	render.Dissent = info.Dissent
+	render.Vote = voteMap[info.CommentID]
+	render.IsPending = info.IsPending()
+	render.IsEdited = info.EditedAt > 0
+	render.IsRemoved = info.IsRemoved()
 	userInfo, err := model.ShareUserModel().GetUserInfoById(info.UserID)
 	if err == nil {
 		render.User = userInfo
@@ -28,7 +35,7 @@ func buildCommentRender(info *info.CommentInfo, childComment *string,
 }
 
 func buildCommentString(child *string, info *info.CommentInfo,
-	step int, floor *int) string {
+	step int, floor *int, voteMap map[int]int) string {
 	var tmpl string = ""
 	if step == 0 {
 		tmpl = firstComment
@@ -39,7 +46,7 @@ func buildCommentString(child *string, info *info.CommentInfo,
 	buf := bytes.NewBuffer(make([]byte, 0))
 	strIO := bufio.NewWriter(buf)
 	if err == nil {
-		t.Execute(strIO, buildCommentRender(info, child, floor))
+		t.Execute(strIO, buildCommentRender(info, child, floor, voteMap))
 	} else {
 		fmt.Println(err)
 	}
@@ -47,7 +54,8 @@ func buildCommentString(child *string, info *info.CommentInfo,
 	return string(buf.Bytes())
 }
 
-func buildOneCommentFromCommentList(commentList *[]*info.CommentInfo) string {
+// voteMap是当前用户对这些评论的投票，可以为nil
+func buildOneCommentFromCommentList(commentList *[]*info.CommentInfo, voteMap map[int]int) string {
 	step := 0
 	var floor int = 1
 	var childCommentContent string = ""
@@ -58,27 +66,72 @@ func buildOneCommentFromCommentList(commentList *[]*info.CommentInfo) string {
 		} else {
 			step = 0
 		}
-		currentCommentContent := buildCommentString(&childCommentContent, commentInfo, step, &floor)
+		currentCommentContent := buildCommentString(&childCommentContent, commentInfo, step, &floor, voteMap)
 		childCommentContent = currentCommentContent
 	}
 	return childCommentContent
 }
 
+// 分页之后引用的父评论可能不在当前页里，逐层从数据库补齐，否则拼楼层时会找不到父评论
+func fillParentComments(commentType int, commentTree map[int]*info.CommentInfo, viewerId int64) error {
+	for {
+		var missingIdList []int = nil
+		for _, comment := range commentTree {
+			if comment.ParentCommentID == -1 {
+				continue
+			}
+			if _, ok := commentTree[comment.ParentCommentID]; !ok {
+				missingIdList = append(missingIdList, comment.ParentCommentID)
+			}
+		}
+		if len(missingIdList) == 0 {
+			return nil
+		}
+		parentList, err := model.ShareCommentModel().FetchCommentListByIdList(commentType, missingIdList, viewerId)
+		if err != nil {
+			return err
+		}
+		for iter := parentList.Front(); iter != nil; iter = iter.Next() {
+			parent := iter.Value.(info.CommentInfo)
+			commentTree[parent.CommentID] = &parent
+		}
+		// 父评论已经被删掉了或者看不到，当作顶级评论处理，避免死循环
+		for _, id := range missingIdList {
+			if _, ok := commentTree[id]; !ok {
+				for _, comment := range commentTree {
+					if comment.ParentCommentID == id {
+						comment.ParentCommentID = -1
+					}
+				}
+			}
+		}
+	}
+}
+
 func buildOneCommentFromCommentTree(commentTree *map[int]*info.CommentInfo,
-	currentComment *info.CommentInfo) string {
+	currentComment *info.CommentInfo, voteMap map[int]int) string {
 	step := 0
 	var floor int = 1
-	return buildOneCommentFromCommentTreeRecursion(commentTree, currentComment, step, &floor)
+	return buildOneCommentFromCommentTreeRecursion(commentTree, currentComment, step, &floor, voteMap)
 }
 
 func buildOneCommentFromCommentTreeRecursion(commentTree *map[int]*info.CommentInfo,
-	currentComment *info.CommentInfo, step int, floor *int) string {
+	currentComment *info.CommentInfo, step int, floor *int, voteMap map[int]int) string {
 	var childComment = ""
 	if currentComment.ParentCommentID == -1 {
-		return buildCommentString(&childComment, currentComment, step, floor)
+		return buildCommentString(&childComment, currentComment, step, floor, voteMap)
 	}
 	// 首先build 子元素
 	childInfo := (*commentTree)[currentComment.ParentCommentID]
-	childComment = buildOneCommentFromCommentTreeRecursion(commentTree, childInfo, step+1, floor)
-	return buildCommentString(&childComment, currentComment, step, floor)
+	childComment = buildOneCommentFromCommentTreeRecursion(commentTree, childInfo, step+1, floor, voteMap)
+	return buildCommentString(&childComment, currentComment, step, floor, voteMap)
+}
+
+// 评论树里所有评论的id，用来查询当前用户的投票
+func commentTreeIdList(commentTree map[int]*info.CommentInfo) []int {
+	var idList []int = nil
+	for id := range commentTree {
+		idList = append(idList, id)
+	}
+	return idList
 }
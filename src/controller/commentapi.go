@@ -0,0 +1,347 @@
+package controller
+
+import (
+	"blog/markup"
+	"blog/moderation"
+	"blog/permission"
+	"blog/vote"
+	"errors"
+	"framework"
+	"framework/response"
+	"info"
+	"model"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const kMaxCommentPageSize = 100
+
+// 和comment表content列的长度一致
+const kMaxPreviewLength = 1024
+
+var errNoSuchTarget = errors.New("no such target")
+
+// 评论所在的博客(插件)必须公开可见
+func commentTypeOfTarget(target string, id int) (int, error) {
+	switch target {
+	case "", "blog":
+		blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(id)
+		if err != nil {
+			return 0, err
+		}
+		if blogInfo == nil || !blogInfo.IsPublished() {
+			return 0, errNoSuchTarget
+		}
+		return info.CommentType_Blog, nil
+	case "plugin":
+		pluginInfo, err := model.SharePluginModel().FetchPluginByPluginID(id)
+		if err != nil {
+			return 0, err
+		}
+		if pluginInfo == nil {
+			return 0, errNoSuchTarget
+		}
+		return info.CommentType_Plugin, nil
+	}
+	return 0, errNoSuchTarget
+}
+
+// 一次查出所有评论的作者
+func commentUserMap(commentList []*info.CommentInfo) map[int64]*info.UserInfo {
+	var userIdList []int64 = nil
+	var seen map[int64]bool = make(map[int64]bool)
+	for _, comment := range commentList {
+		if !seen[comment.UserID] {
+			seen[comment.UserID] = true
+			userIdList = append(userIdList, comment.UserID)
+		}
+	}
+	userMap, err := model.ShareUserModel().FetchUserInfoMap(userIdList)
+	if err != nil {
+		return map[int64]*info.UserInfo{}
+	}
+	return userMap
+}
+
+func commentToData(comment *info.CommentInfo, userMap map[int64]*info.UserInfo,
+	voteMap map[int]int) map[string]interface{} {
+	user := map[string]interface{}{"id": comment.UserID, "name": "", "pic": "", "guest": false, "website": ""}
+	if userInfo, ok := userMap[comment.UserID]; ok {
+		user["name"] = userInfo.UserName
+		user["pic"] = userInfo.SmallFigureurl
+		user["guest"] = userInfo.IsGuest()
+		user["website"] = userInfo.Website
+	}
+	return map[string]interface{}{
+		"id":        comment.CommentID,
+		"parent":    comment.ParentCommentID,
+		"content":   comment.Content,
+		"html":      markup.CommentHTML(comment),
+		"time":      comment.Time,
+		"praise":    comment.Praise,
+		"dissent":   comment.Dissent,
+		"vote":      voteMap[comment.CommentID],
+		"status":    comment.Status,
+		"edited_at": comment.EditedAt,
+		"removed":   comment.IsRemoved(),
+		"user":      user,
+	}
+}
+
+func commentListToData(commentList []*info.CommentInfo, voter string) []interface{} {
+	userMap := commentUserMap(commentList)
+	var idList []int = nil
+	for _, comment := range commentList {
+		idList = append(idList, comment.CommentID)
+	}
+	voteMap := vote.VoteMap(info.VoteTarget_Comment, idList, voter)
+	var retList []interface{} = []interface{}{}
+	for _, comment := range commentList {
+		retList = append(retList, commentToData(comment, userMap, voteMap))
+	}
+	return retList
+}
+
+func sortCommentList(commentList []*info.CommentInfo, sortType string) {
+	sort.SliceStable(commentList, func(i, j int) bool {
+		if sortType == info.CommentSort_Votes {
+			vi := commentList[i].Praise - commentList[i].Dissent
+			vj := commentList[j].Praise - commentList[j].Dissent
+			if vi != vj {
+				return vi > vj
+			}
+		}
+		return commentList[i].CommentID > commentList[j].CommentID
+	})
+}
+
+type commentNode struct {
+	comment  *info.CommentInfo
+	children []*commentNode
+}
+
+func commentNodeToData(node *commentNode, userMap map[int64]*info.UserInfo,
+	voteMap map[int]int) map[string]interface{} {
+	data := commentToData(node.comment, userMap, voteMap)
+	var children []interface{} = []interface{}{}
+	for _, child := range node.children {
+		children = append(children, commentNodeToData(child, userMap, voteMap))
+	}
+	data["children"] = children
+	return data
+}
+
+/* 树形的评论，按顶级评论分页，每个顶级评论带上它下面的全部回复，回复按时间从早到晚。
+** 父评论看不到(还没有审核或者已经删除)的回复当作顶级评论。
+ */
+func commentTreeData(commentType int, typeId int, sortType string, page int, limit int, viewerId int64,
+	voter string) (int, []interface{}, error) {
+	commentList, err := model.ShareCommentModel().FetchAllCommentByBlogId(commentType, typeId, viewerId)
+	if err != nil {
+		return 0, nil, err
+	}
+	var nodeMap map[int]*commentNode = make(map[int]*commentNode)
+	var allList []*info.CommentInfo = nil
+	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+		comment := iter.Value.(info.CommentInfo)
+		nodeMap[comment.CommentID] = &commentNode{comment: &comment}
+		allList = append(allList, &comment)
+	}
+	// 从早到晚挂到父评论下面
+	var rootList []*info.CommentInfo = nil
+	for i := len(allList) - 1; i >= 0; i-- {
+		comment := allList[i]
+		if parent, ok := nodeMap[comment.ParentCommentID]; ok {
+			parent.children = append(parent.children, nodeMap[comment.CommentID])
+		} else {
+			rootList = append(rootList, comment)
+		}
+	}
+	sortCommentList(rootList, sortType)
+	total := len(rootList)
+	begin := pageOffset(page, limit)
+	if begin > total {
+		begin = total
+	}
+	end := begin + limit
+	if end > total {
+		end = total
+	}
+	// 只查当前页用到的作者和投票
+	var pageList []*info.CommentInfo = nil
+	var walk func(node *commentNode)
+	walk = func(node *commentNode) {
+		pageList = append(pageList, node.comment)
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	for _, root := range rootList[begin:end] {
+		walk(nodeMap[root.CommentID])
+	}
+	userMap := commentUserMap(pageList)
+	var idList []int = nil
+	for _, comment := range pageList {
+		idList = append(idList, comment.CommentID)
+	}
+	voteMap := vote.VoteMap(info.VoteTarget_Comment, idList, voter)
+	var retList []interface{} = []interface{}{}
+	for _, root := range rootList[begin:end] {
+		retList = append(retList, commentNodeToData(nodeMap[root.CommentID], userMap, voteMap))
+	}
+	return total, retList, nil
+}
+
+// 平铺的评论，每条评论用parent引用父评论，父评论不一定在当前页
+func commentFlatData(commentType int, typeId int, sortType string, page int, limit int, viewerId int64,
+	voter string) (int, []interface{}, error) {
+	total, err := model.ShareCommentModel().FetchVisibleCommentCount(commentType, typeId, viewerId)
+	if err != nil {
+		return 0, nil, err
+	}
+	commentList, err := model.ShareCommentModel().FetchSortedCommentList(commentType, typeId, sortType,
+		pageOffset(page, limit), limit, viewerId)
+	if err != nil {
+		return 0, nil, err
+	}
+	var pageList []*info.CommentInfo = nil
+	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+		comment := iter.Value.(info.CommentInfo)
+		pageList = append(pageList, &comment)
+	}
+	return total, commentListToData(pageList, voter), nil
+}
+
+/* 以json的形式获取评论，不需要登录，登录之后能看到自己还在等待审核的评论：
+** {"type": "comments", "target": "blog", "id": 1, "mode": "tree", "sort": "time", "page": 1, "limit": 20}
+** target是blog或者plugin；mode是tree或者flat，tree按顶级评论分页；sort是time或者votes。
+** 返回{"total": 总数, "page": 1, "list": [...]}，tree模式下每条评论带children。
+ */
+func (a *APIController) handleCommentListAction(w http.ResponseWriter, r *http.Request,
+	inf map[string]interface{}) {
+	id, ok := parseIntField(inf, "id")
+	if !ok {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	target, _ := inf["target"].(string)
+	commentType, err := commentTypeOfTarget(target, id)
+	if err == errNoSuchTarget {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	page, _ := parseIntField(inf, "page")
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := parseIntField(inf, "limit")
+	if limit <= 0 || limit > kMaxCommentPageSize {
+		limit = kCommentPageSize
+	}
+	sortType, _ := inf["sort"].(string)
+	if sortType != info.CommentSort_Votes {
+		sortType = info.CommentSort_Time
+	}
+	viewerId := a.LoginUserId()
+	voter := sessionVoter(&a.SessionController, r)
+	var total int
+	var retList []interface{}
+	if mode, _ := inf["mode"].(string); mode == "flat" {
+		total, retList, err = commentFlatData(commentType, id, sortType, page, limit, viewerId, voter)
+	} else {
+		total, retList, err = commentTreeData(commentType, id, sortType, page, limit, viewerId, voter)
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"total": total,
+		"page":  page,
+		"list":  retList,
+	})
+}
+
+func moderationErrorCode(err error) int {
+	switch err {
+	case moderation.ErrCommentNotExist:
+		return framework.ErrorCommentNotExist
+	case moderation.ErrCommentClosed:
+		return framework.ErrorCommentClosed
+	case moderation.ErrEditExpired:
+		return framework.ErrorCommentEditExpired
+	case moderation.ErrNotAuthor:
+		return framework.ErrorAccountAuthError
+	case moderation.ErrNeedLogin:
+		return framework.ErrorAccountNotLogin
+	case permission.ErrBanned:
+		return framework.ErrorAccountBanned
+	}
+	return framework.ErrorSQLError
+}
+
+/* 作者编辑或者删除自己的评论，需要登录：
+** {"type": "editComment", "id": 1, "content": "..."}，发表之后comment.edit_window分钟内可以编辑，返回修改之后的评论
+** {"type": "deleteComment", "id": 1}，有回复的评论只清空内容，显示为已删除
+ */
+func (a *APIController) handleCommentEditAction(w http.ResponseWriter, r *http.Request,
+	inf map[string]interface{}, action string) {
+	userId := a.LoginUserId()
+	if userId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "account not login")
+		return
+	}
+	id, ok := parseIntField(inf, "id")
+	if !ok {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	if action == "deleteComment" {
+		if err := moderation.Delete(id, userId); err != nil {
+			response.JsonResponseWithMsg(w, moderationErrorCode(err), err.Error())
+			return
+		}
+		response.JsonResponse(w, framework.ErrorOK)
+		return
+	}
+	content, _ := inf["content"].(string)
+	if strings.TrimSpace(content) == "" {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no content")
+		return
+	}
+	if _, err := moderation.Edit(id, userId, content); err != nil {
+		response.JsonResponseWithMsg(w, moderationErrorCode(err), err.Error())
+		return
+	}
+	commentList, err := model.ShareCommentModel().FetchAnyCommentListByIdList([]int{id})
+	if err != nil || commentList.Len() == 0 {
+		response.JsonResponse(w, framework.ErrorOK)
+		return
+	}
+	edited := commentList.Front().Value.(info.CommentInfo)
+	response.JsonResponseWithData(w, framework.ErrorOK, "",
+		commentListToData([]*info.CommentInfo{&edited}, sessionVoter(&a.SessionController, r))[0])
+}
+
+/* 预览评论渲染之后的样子，不需要登录，@昵称同样会链接到对应的读者：
+** {"type": "previewComment", "content": "..."}，返回{"html": "..."}
+ */
+func (a *APIController) handleCommentPreviewAction(w http.ResponseWriter, inf map[string]interface{}) {
+	content, _ := inf["content"].(string)
+	if utf8.RuneCountInString(content) > kMaxPreviewLength {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "content too long")
+		return
+	}
+	contentHTML, err := markup.RenderComment(content)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{"html": contentHTML})
+}
@@ -11,18 +11,20 @@ const (
 		<div class="msg-wrap-gw"> 
 			<div class="wrap-user-gw global-clear-spacing"> 
 				<span class="user-time-gw user-time-bg evt-time">{{.CommentTime}}</span> 
-				<span class="user-name-gw" title="{{.User.UserName}}"><a href="javascript:void(0)" href="{{.User.SmallFigureurl}}" uid="-1990645212">{{.User.UserName}}</a></span> 
+				<span class="user-name-gw" title="{{.User.UserName}}">{{if .User.Website}}<a href="{{.User.Website}}" rel="nofollow" target="_blank">{{.User.UserName}}</a>{{else}}<a href="/user/{{.User.UserID}}">{{.User.UserName}}</a>{{end}}</span> 
+				{{if .User.IsGuest}}<span class="comment-guest">游客</span>{{end}}
+				{{if .IsPending}}<span class="comment-pending">等待审核</span>{{end}}
 			</div> 
 			{{.ChildContent}}
 			<div class="wrap-issue-gw"> 
-				<p class="issue-wrap-gw"> <span class="wrap-word-bg ">{{.CommentContent}}</span> </p> 
+				<div class="issue-wrap-gw"> {{if .IsRemoved}}<span class="comment-removed">该评论已删除</span>{{else}}<div class="wrap-word-bg comment-markdown">{{.CommentContent}}</div>{{if .IsEdited}}<span class="comment-edited">(已编辑)</span>{{end}}{{end}} </div> 
 			</div> 
 			<div class="clear-g wrap-action-gw"> 
 				<div class="action-click-gw"> 
 					<i class="gap-gw"></i> 
-					<span class="click-ding-gw"><a href="javascript:void(0)" title="顶" class="evt-support"><i class="icon-gw icon-ding-bg"></i><em class="icon-name-bg"></em></a></span>
+					<span class="click-ding-gw"><a href="javascript:void(0)" title="顶" class="evt-support{{if eq .Vote 1}} voted{{end}}" data-id="{{.CommentID}}"><i class="icon-gw icon-ding-bg"></i><em class="icon-name-bg">{{if .Praise}}{{.Praise}}{{end}}</em></a></span>
 					<i class="gap-gw"></i>
-					<span class="click-cai-gw"><a href="javascript:void(0)" title="踩" class="evt-opposed"><i class="icon-gw icon-cai-bg"></i><em class="icon-name-bg"></em></a></span>
+					<span class="click-cai-gw"><a href="javascript:void(0)" title="踩" class="evt-opposed{{if eq .Vote -1}} voted{{end}}" data-id="{{.CommentID}}"><i class="icon-gw icon-cai-bg"></i><em class="icon-name-bg">{{if .Dissent}}{{.Dissent}}{{end}}</em></a></span>
 					<i class="gap-gw"></i>
 					<span class="click-reply-gw click-reply-eg"><a href="javascript:void(0)" class="evt-reply">回复</a></span>
 					<i class="gap-gw"></i>
@@ -63,19 +65,20 @@ const (
 				<span class="user-time-gw user-time-bg user-floor-gw">{{.Floor}}</span> 
 				<span class="user-name-gw">
 					<img style="height: 44px; width: 44px;" src="{{.User.SmallFigureurl}}" title="{{.User.UserName}}" uid="{{.UserID}}">
-						<a href="javascript:void(0)" style="margin-left: 5px;">{{.User.UserName}}</a>
+						{{if .User.Website}}<a href="{{.User.Website}}" rel="nofollow" target="_blank" style="margin-left: 5px;">{{.User.UserName}}</a>{{else}}<a href="/user/{{.User.UserID}}" style="margin-left: 5px;">{{.User.UserName}}</a>{{end}}
+						{{if .User.IsGuest}}<span class="comment-guest">游客</span>{{end}}
 					</img>
 				</span> 
 			</div> 
 			<div class="wrap-issue-gw"> 
-				<p class="issue-wrap-gw"> <span class="wrap-word-bg ">{{.CommentContent}}</span> </p> 
+				<div class="issue-wrap-gw"> {{if .IsRemoved}}<span class="comment-removed">该评论已删除</span>{{else}}<div class="wrap-word-bg comment-markdown">{{.CommentContent}}</div>{{if .IsEdited}}<span class="comment-edited">(已编辑)</span>{{end}}{{end}} </div> 
 			</div> 
 			<div class="comment-node clear-g wrap-action-gw evt-active-wrapper" style="visibility: hidden;"> 
 				<div class="action-click-gw"> 
 					<i class="gap-gw"></i> 
-					<span class="click-ding-gw"><a href="javascript:void(0)" title="顶" class="evt-support"><i class="icon-gw icon-ding-bg"></i><em class="icon-name-bg"></em></a></span> 
+					<span class="click-ding-gw"><a href="javascript:void(0)" title="顶" class="evt-support{{if eq .Vote 1}} voted{{end}}" data-id="{{.CommentID}}"><i class="icon-gw icon-ding-bg"></i><em class="icon-name-bg">{{if .Praise}}{{.Praise}}{{end}}</em></a></span> 
 					<i class="gap-gw"></i> 
-					<span class="click-cai-gw"><a href="javascript:void(0)" title="踩" class="evt-opposed"><i class="icon-gw icon-cai-bg"></i><em class="icon-name-bg"></em></a></span> 
+					<span class="click-cai-gw"><a href="javascript:void(0)" title="踩" class="evt-opposed{{if eq .Vote -1}} voted{{end}}" data-id="{{.CommentID}}"><i class="icon-gw icon-cai-bg"></i><em class="icon-name-bg">{{if .Dissent}}{{.Dissent}}{{end}}</em></a></span> 
 					<i class="gap-gw"></i> 
 					<span class="click-reply-gw click-reply-eg"><a href="javascript:void(0)" class="evt-reply">回复</a></span> 
 					<i class="gap-gw"></i> 
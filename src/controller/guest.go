@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"blog/guest"
+	"framework"
+	"framework/base/captcha"
+	"framework/base/identicon"
+	"framework/response"
+	"framework/server"
+	"image/png"
+	"info"
+	"model"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 验证码图片生成之后多久内有效
+	kCaptchaExpireTime = 10 * time.Minute
+	kDefaultAvatarSize = 48
+	kMinAvatarSize     = 16
+	kMaxAvatarSize     = 256
+)
+
+var avatarSeedRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// 会话里记住的游客，没有时返回0
+func sessionGuestId(s *server.SessionController) int64 {
+	value, err := s.WebSession.Get("guest_id")
+	if err != nil {
+		return 0
+	}
+	guestId, _ := value.(string)
+	id, err := strconv.ParseInt(guestId, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// 验证码只能用一次，不管对错都作废
+func checkCaptcha(s *server.SessionController, answer string) bool {
+	expect, err := s.WebSession.Get("captcha")
+	created, timeErr := s.WebSession.Get("captcha_time")
+	s.WebSession.Delete("captcha")
+	s.WebSession.Delete("captcha_time")
+	if err != nil || timeErr != nil {
+		return false
+	}
+	expectAnswer, _ := expect.(string)
+	createdTime, _ := created.(string)
+	createdAt, err := strconv.ParseInt(createdTime, 10, 64)
+	if err != nil || time.Since(time.Unix(createdAt, 0)) > kCaptchaExpireTime {
+		return false
+	}
+	return expectAnswer != "" && strings.TrimSpace(answer) == expectAnswer
+}
+
+/* 游客评论时带上的身份和验证码：
+** {"guest": {"name": "昵称", "email": "可选", "website": "可选"}, "captcha": "12"}
+** 验证通过之后保存游客信息并记到会话里，返回游客的用户id
+ */
+func (a *APIController) guestCommentUser(inf map[string]interface{}) (int64, int, string) {
+	if !guest.Enabled() {
+		return 0, framework.ErrorAccountNotLogin, "account not login"
+	}
+	identity, ok := inf["guest"].(map[string]interface{})
+	if !ok {
+		return 0, framework.ErrorAccountNotLogin, "account not login"
+	}
+	answer, _ := inf["captcha"].(string)
+	if !checkCaptcha(&a.SessionController, answer) {
+		return 0, framework.ErrorCaptchaError, "wrong captcha"
+	}
+	var userInfo info.UserInfo
+	userInfo.UserName, _ = identity["name"].(string)
+	userInfo.Email, _ = identity["email"].(string)
+	userInfo.Website, _ = identity["website"].(string)
+	saved, err := guest.Save(sessionGuestId(&a.SessionController), &userInfo)
+	switch err {
+	case nil:
+	case guest.ErrInvalidName, guest.ErrInvalidEmail, guest.ErrInvalidWebsite, guest.ErrNameTaken:
+		return 0, framework.ErrorParamError, err.Error()
+	default:
+		return 0, framework.ErrorSQLError, err.Error()
+	}
+	a.WebSession.Set("guest_id", strconv.FormatInt(saved.UserID, 10))
+	return saved.UserID, framework.ErrorOK, ""
+}
+
+// 会话里记住的游客信息，用来填好评论框
+func (a *APIController) handleGuestInfoRequest(w http.ResponseWriter) {
+	guestId := sessionGuestId(&a.SessionController)
+	if !guest.Enabled() || guestId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "no guest")
+		return
+	}
+	guestInfo, err := model.ShareUserModel().FetchGuestInfo(guestId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	if guestInfo == nil {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "no guest")
+		return
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"name":    guestInfo.UserName,
+		"email":   guestInfo.Email,
+		"website": guestInfo.Website,
+		"pic":     guestInfo.SmallFigureurl,
+	})
+}
+
+type CaptchaController struct {
+	server.SessionController
+}
+
+func NewCaptchaController() *CaptchaController {
+	return &CaptchaController{}
+}
+
+func (c *CaptchaController) Path() interface{} {
+	return "/captcha"
+}
+
+func (c *CaptchaController) SessionPath() string {
+	return "/"
+}
+
+// 每次请求生成一道新的题目，答案记在会话里，之前的题目作废
+func (c *CaptchaController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	c.SessionController.HandlerRequest(c, w, r)
+	challenge := captcha.NewArithmetic()
+	c.WebSession.Set("captcha", challenge.Answer)
+	c.WebSession.Set("captcha_time", strconv.FormatInt(time.Now().Unix(), 10))
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	png.Encode(w, captcha.Image(challenge.Question))
+}
+
+type AvatarController struct {
+}
+
+func NewAvatarController() *AvatarController {
+	return &AvatarController{}
+}
+
+func (a *AvatarController) Path() interface{} {
+	return "/avatar"
+}
+
+// /avatar?seed=<32位md5>&size=48，同一个seed的头像不会变，可以长期缓存
+func (a *AvatarController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	seed := r.URL.Query().Get("seed")
+	if !avatarSeedRegexp.MatchString(seed) {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "invalid seed")
+		return
+	}
+	size := kDefaultAvatarSize
+	value, err := strconv.Atoi(r.URL.Query().Get("size"))
+	if err == nil && value >= kMinAvatarSize && value <= kMaxAvatarSize {
+		size = value
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=2592000")
+	png.Encode(w, identicon.Generate(seed, size))
+}
@@ -11,6 +11,7 @@ import (
 	"log"
 	"model"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -28,12 +29,22 @@ type blogElementRender struct {
 	BlogVisitCount   int
 	BlogPraiseCount  int
 	BlogCommentCount int
+	BlogSnippet      template.HTML
+}
+
+type listHeaderRender struct {
+	Name        string
+	Description string
+	Count       int
 }
 
 type indexRender struct {
-	Host     *hostRender
-	BlogList []*blogElementRender
-	Side     *sideRender
+	Host        *hostRender
+	BlogList    []*blogElementRender
+	Side        *sideRender
+	Header      *listHeaderRender
+	Page        *pageRender
+	SearchQuery string
 }
 
 func buildBlogElementRender(inf *info.BlogInfo) *blogElementRender {
@@ -74,26 +85,74 @@ func (i *IndexController) HandlerRequest(w http.ResponseWriter, r *http.Request)
 		log.Println(err)
 	}
 	var blogList *list.List = nil
-	allBlogList, err := model.ShareBlogModel().FetchAllBlog()
+	var listHeader *listHeaderRender = nil
+	var page *pageRender = nil
 	switch r.URL.Path {
 	case "/index", "/":
-		blogList = allBlogList
+		count, countErr := model.ShareBlogModel().FetchBlogCount()
+		if countErr != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, countErr.Error())
+			return
+		}
+		pageNumber := clampPage(parsePageNumber(r), kIndexPageSize, count)
+		page = buildPageRender(r.URL.Path, pageNumber, kIndexPageSize, count)
+		blogList, err = model.ShareBlogModel().FetchBlogList(pageOffset(pageNumber, kIndexPageSize), kIndexPageSize)
 	case "/sort":
-		sortType := r.Form.Get("type")
-		blogList, err = model.ShareBlogModel().FetchAllBlogBySortType(sortType)
+		var category *info.CategoryInfo = nil
+		var categoryErr error = nil
+		var baseURL string
+		if slug := r.Form.Get("slug"); slug != "" {
+			category, categoryErr = model.ShareCategoryModel().FetchCategoryBySlug(slug)
+			baseURL = "/sort?slug=" + url.QueryEscape(slug)
+		} else {
+			sortType := r.Form.Get("type")
+			category, categoryErr = model.ShareCategoryModel().FetchCategoryByName(sortType)
+			baseURL = "/sort?type=" + url.QueryEscape(sortType)
+		}
+		if categoryErr != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, categoryErr.Error())
+			return
+		}
+		if category == nil {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no such sort")
+			return
+		}
+		// 包括所有子分类下的文章
+		categoryIdList, categoryErr := model.ShareCategoryModel().FetchDescendantCategoryIds(category.CategoryID)
+		if categoryErr != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, categoryErr.Error())
+			return
+		}
+		count, categoryErr := model.ShareBlogModel().FetchBlogCountByCategory(categoryIdList)
+		if categoryErr != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, categoryErr.Error())
+			return
+		}
+		listHeader = &listHeaderRender{category.CategoryName, category.CategoryDescription, count}
+		pageNumber := clampPage(parsePageNumber(r), kIndexPageSize, count)
+		page = buildPageRender(baseURL, pageNumber, kIndexPageSize, count)
+		blogList, err = model.ShareBlogModel().FetchAllBlogByCategory(categoryIdList,
+			pageOffset(pageNumber, kIndexPageSize), kIndexPageSize)
 	case "/tag":
-		blogList = list.New()
 		tagType := r.Form.Get("type")
-		if err == nil {
-			for iter := allBlogList.Front(); iter != nil; iter = iter.Next() {
-				v := iter.Value.(info.BlogInfo)
-				for _, tag := range v.BlogTagList {
-					if tag == tagType {
-						blogList.PushBack(v)
-					}
-				}
-			}
+		tagInfo, tagErr := model.ShareTagModel().FetchTagByName(tagType)
+		if tagErr != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, tagErr.Error())
+			return
+		}
+		if tagInfo == nil {
+			// 没有这个标签时显示一个空的列表页，状态码是404
+			w.WriteHeader(http.StatusNotFound)
+			listHeader = &listHeaderRender{tagType, "", 0}
+			page = buildPageRender("/tag?type="+url.QueryEscape(tagType), 1, kIndexPageSize, 0)
+			blogList = list.New()
+			break
 		}
+		listHeader = &listHeaderRender{tagInfo.TagName, tagInfo.TagDescription, tagInfo.TagBlogCount}
+		pageNumber := clampPage(parsePageNumber(r), kIndexPageSize, tagInfo.TagBlogCount)
+		page = buildPageRender("/tag?type="+url.QueryEscape(tagType), pageNumber, kIndexPageSize, tagInfo.TagBlogCount)
+		blogList, err = model.ShareBlogModel().FetchAllBlogByTag(tagType,
+			pageOffset(pageNumber, kIndexPageSize), kIndexPageSize)
 	case "/date":
 		t := r.Form.Get("time")
 		if t == "" {
@@ -119,17 +178,27 @@ func (i *IndexController) HandlerRequest(w http.ResponseWriter, r *http.Request)
 			month++
 		}
 		endTime := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC).Unix()
-		blogList, err = model.ShareBlogModel().FetchAllBlogByTime(beginTime, endTime)
+		count, countErr := model.ShareBlogModel().FetchBlogCountByTime(beginTime, endTime)
+		if countErr != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, countErr.Error())
+			return
+		}
+		pageNumber := clampPage(parsePageNumber(r), kIndexPageSize, count)
+		page = buildPageRender("/date?time="+url.QueryEscape(t), pageNumber, kIndexPageSize, count)
+		blogList, err = model.ShareBlogModel().FetchBlogListByTime(beginTime, endTime,
+			pageOffset(pageNumber, kIndexPageSize), kIndexPageSize)
 	}
 	if err == nil {
 		var topRender indexRender
-		topRender.Side = buildSideRender(allBlogList)
+		topRender.Side = buildSideRender()
 		for iter := blogList.Front(); iter != nil; iter = iter.Next() {
 			info := iter.Value.(info.BlogInfo)
 			blogRender := buildBlogElementRender(&info)
 			topRender.BlogList = append(topRender.BlogList, blogRender)
 		}
 		topRender.Host = buildHostRender()
+		topRender.Header = listHeader
+		topRender.Page = page
 		t.Execute(w, &topRender)
 	} else {
 		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
@@ -2,6 +2,8 @@ package controller
 
 import (
 	"controller/login"
+	"errors"
+	"fmt"
 	"framework"
 	"framework/response"
 	"framework/server"
@@ -30,8 +32,9 @@ func NewLoginController() *LoginController {
 	return ret
 }
 
+// 第三方登录的回调地址根据net.host生成
 func (l *LoginController) init() {
-
+	login.LoadProviders(buildHostRender().Host + "/login")
 }
 
 func (i *LoginController) Path() interface{} {
@@ -49,35 +52,63 @@ func (l *LoginController) writeLoginInfo(from string, userInfo *info.UserInfo) {
 	l.ResetSessionDuration()
 }
 
-func (l *LoginController) handleLoginInfo(w http.ResponseWriter, userInfo *info.UserInfo, err error) {
-	var render *loginRender = nil
+func (l *LoginController) renderLoginResult(w http.ResponseWriter, err error) {
+	render := &loginRender{Code: framework.ErrorOK, IsLoginSuccess: true}
 	if err != nil {
-		render = &loginRender{
-			Code:           framework.ErrorRunTimeError,
-			Msg:            err.Error(),
-			IsLoginSuccess: false,
-		}
-	} else {
-		err = model.ShareUserModel().Login(info.AccountTypeQQ, userInfo)
-		if err != nil {
-			render = &loginRender{
-				Code:           framework.ErrorRunTimeError,
-				Msg:            err.Error(),
-				IsLoginSuccess: false,
-			}
-		} else {
-			l.writeLoginInfo("qq", userInfo)
-			render = &loginRender{
-				Code:           framework.ErrorOK,
-				Msg:            "",
-				IsLoginSuccess: true,
-			}
-		}
+		render = &loginRender{Code: framework.ErrorRunTimeError, Msg: err.Error(), IsLoginSuccess: false}
 	}
 	t, err := template.ParseFiles("./src/view/html/login-result.html")
+	if err != nil {
+		fmt.Println("parse file error: ", err.Error())
+		return
+	}
 	t.Execute(w, render)
 }
 
+// 生成state和code_verifier记到会话里，然后跳转到第三方的授权页面
+func (l *LoginController) startLogin(w http.ResponseWriter, r *http.Request, provider *login.Provider) {
+	state, verifier, err := login.NewState()
+	if err == nil {
+		var authURL string
+		if authURL, err = provider.AuthCodeURL(state, verifier); err == nil {
+			l.WebSession.Set("oauth_provider", provider.Name)
+			l.WebSession.Set("oauth_state", state)
+			l.WebSession.Set("oauth_verifier", verifier)
+			http.Redirect(w, r, authURL, http.StatusFound)
+			return
+		}
+	}
+	l.renderLoginResult(w, err)
+}
+
+// 第三方回调，state只能用一次，不管成功与否都从会话里删掉
+func (l *LoginController) finishLogin(w http.ResponseWriter, r *http.Request, provider *login.Provider) {
+	expectProvider, _ := l.WebSession.Get("oauth_provider")
+	expectState, _ := l.WebSession.Get("oauth_state")
+	verifier, _ := l.WebSession.Get("oauth_verifier")
+	l.WebSession.Delete("oauth_provider")
+	l.WebSession.Delete("oauth_state")
+	l.WebSession.Delete("oauth_verifier")
+	state := r.Form.Get("state")
+	if expect, _ := expectState.(string); state == "" || state != expect || expectProvider != provider.Name {
+		l.renderLoginResult(w, login.ErrInvalidState)
+		return
+	}
+	if errorCode := r.Form.Get("error"); errorCode != "" {
+		l.renderLoginResult(w, errors.New(errorCode))
+		return
+	}
+	codeVerifier, _ := verifier.(string)
+	userInfo, err := provider.Login(r.Form.Get("code"), codeVerifier)
+	if err == nil {
+		err = model.ShareUserModel().Login(userInfo.UserAccountType, userInfo)
+	}
+	if err == nil {
+		l.writeLoginInfo(provider.Name, userInfo)
+	}
+	l.renderLoginResult(w, err)
+}
+
 func (l *LoginController) handleLogout(w http.ResponseWriter) {
 	status, err := l.WebSession.Get("status")
 	if err == nil {
@@ -97,22 +128,19 @@ func (l *LoginController) HandlerRequest(w http.ResponseWriter, r *http.Request)
 	r.ParseForm()
 	l.SessionController.HandlerRequest(l, w, r)
 	loginType := r.Form.Get("type")
-	switch loginType {
-	case "qq":
-		code := r.Form.Get("code")
-		if len(code) != 0 {
-			userInfo, err := login.GetQQLoginInstance().Login(code)
-			l.handleLoginInfo(w, userInfo, err)
-		}
-	case "weibo":
-		code := r.Form.Get("code")
-		if len(code) != 0 {
-			userInfo, err := login.GetWebLoginInstance().Login(code)
-			l.handleLoginInfo(w, userInfo, err)
-		}
-	case "logout":
+	if loginType == "logout" {
 		l.handleLogout(w)
-	default:
+		return
+	}
+	provider := login.GetProvider(loginType)
+	if provider == nil {
 		response.JsonResponseWithMsg(w, framework.ErrorRunTimeError, "unsupport login type")
+		return
+	}
+	// 带着code或者error的是第三方的回调，否则开始登录
+	if r.Form.Get("code") != "" || r.Form.Get("error") != "" {
+		l.finishLogin(w, r, provider)
+	} else {
+		l.startLogin(w, r, provider)
 	}
 }
@@ -0,0 +1,55 @@
+package login
+
+import (
+	"info"
+	"strconv"
+)
+
+const (
+	kGitHubAuthURL     = "https://github.com/login/oauth/authorize"
+	kGitHubTokenURL    = "https://github.com/login/oauth/access_token"
+	kGitHubUserInfoURL = "https://api.github.com/user"
+)
+
+type gitHubUserInfo struct {
+	Id        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+func NewGitHubProvider(clientId string, secret string, redirectURL string) *Provider {
+	return &Provider{
+		Name:        "github",
+		Title:       "GitHub",
+		AccountType: info.AccountTypeGitHub,
+		ClientID:    clientId,
+		Secret:      secret,
+		RedirectURL: redirectURL,
+		Scopes:      []string{"read:user"},
+		Endpoint:    Endpoint{AuthURL: kGitHubAuthURL, TokenURL: kGitHubTokenURL, UserInfoURL: kGitHubUserInfoURL},
+		PKCE:        true,
+		FetchUser:   fetchGitHubUser,
+	}
+}
+
+// 用户名可以改，open id用数字id；没有设置昵称时显示登录名
+func fetchGitHubUser(p *Provider, token *Token) (*info.UserInfo, error) {
+	var profile gitHubUserInfo
+	if err := p.getJSON(p.Endpoint.UserInfoURL, token, &profile); err != nil {
+		return nil, err
+	}
+	if profile.Id == 0 {
+		return nil, ErrInvalidProfile
+	}
+	userInfo := &info.UserInfo{
+		UserOpenID:     strconv.FormatInt(profile.Id, 10),
+		UserName:       profile.Name,
+		SmallFigureurl: profile.AvatarURL,
+		BigFigureurl:   profile.AvatarURL,
+	}
+	if userInfo.UserName == "" {
+		userInfo.UserName = profile.Login
+	}
+	return userInfo, nil
+}
@@ -0,0 +1,75 @@
+package login
+
+import (
+	"framework/base/config"
+	"sync"
+)
+
+/* 已经配置好的第三方登录，account.open下key不为空的才会启用，回调地址都是
+** <站点地址>/login?type=<名字>，站点地址由调用者根据net.host生成。
+ */
+
+var providerList []*Provider = nil
+var providerMap map[string]*Provider = make(map[string]*Provider)
+var providerMutex sync.RWMutex
+
+func configString(key string) string {
+	value, _ := config.GetDefaultConfigJsonReader().Get(key).(string)
+	return value
+}
+
+func Register(provider *Provider) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	if _, ok := providerMap[provider.Name]; !ok {
+		providerList = append(providerList, provider)
+	} else {
+		for i, p := range providerList {
+			if p.Name == provider.Name {
+				providerList[i] = provider
+			}
+		}
+	}
+	providerMap[provider.Name] = provider
+}
+
+// loginURL是登录回调的地址，例如https://windyx.com/login
+func LoadProviders(loginURL string) {
+	redirectURL := func(name string) string {
+		return loginURL + "?type=" + name
+	}
+	if key := configString("account.open.qq.key"); key != "" {
+		Register(NewQQProvider(key, configString("account.open.qq.secret"), redirectURL("qq")))
+	}
+	if key := configString("account.open.weibo.key"); key != "" {
+		Register(NewWeiboProvider(key, configString("account.open.weibo.secret"), redirectURL("weibo")))
+	}
+	if key := configString("account.open.weixin.key"); key != "" {
+		Register(NewWeixinProvider(key, configString("account.open.weixin.secret"), redirectURL("weixin")))
+	}
+	if key := configString("account.open.github.key"); key != "" {
+		Register(NewGitHubProvider(key, configString("account.open.github.secret"), redirectURL("github")))
+	}
+	issuer := configString("account.open.oidc.issuer")
+	if key := configString("account.open.oidc.key"); key != "" && issuer != "" {
+		title := configString("account.open.oidc.title")
+		if title == "" {
+			title = "OpenID"
+		}
+		Register(NewOIDCProvider(title, issuer, key, configString("account.open.oidc.secret"), redirectURL("oidc")))
+	}
+}
+
+// 没有配置时返回nil
+func GetProvider(name string) *Provider {
+	providerMutex.RLock()
+	defer providerMutex.RUnlock()
+	return providerMap[name]
+}
+
+// 按注册的顺序返回，用来显示登录按钮
+func Providers() []*Provider {
+	providerMutex.RLock()
+	defer providerMutex.RUnlock()
+	return append([]*Provider(nil), providerList...)
+}
@@ -0,0 +1,346 @@
+package login
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"info"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* OAuth2授权码登录的通用流程：
+** 1. AuthCodeURL生成跳转到第三方的链接，带上随机的state和PKCE的code_challenge，
+**    state和code_verifier由调用者保存在会话里；
+** 2. 第三方回调时先校验state，再用Exchange拿code和code_verifier换access token；
+** 3. 每个第三方的FetchUser用access token取用户信息，转换成info.UserInfo。
+** 所有请求都有超时，返回的json按结构体解析，不做不检查的类型断言。
+ */
+
+const (
+	kRequestTimeout = 10 * time.Second
+	// 响应最多读1MB
+	kMaxResponseSize = 1 << 20
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrInvalidState    = errors.New("invalid oauth state")
+	ErrNoAccessToken   = errors.New("no access token in response")
+	ErrInvalidProfile  = errors.New("invalid user profile")
+)
+
+type Endpoint struct {
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+}
+
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	ExpiresIn    int64
+	IDToken      string
+	// 微博在token里直接返回uid，微信返回openid
+	UID    string
+	OpenID string
+}
+
+// 有的第三方把id和错误码返回成数字，有的返回成字符串，统一按字符串处理
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*f = flexString(text)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*f = flexString(number.String())
+	return nil
+}
+
+type tokenResponse struct {
+	AccessToken  string     `json:"access_token"`
+	TokenType    string     `json:"token_type"`
+	RefreshToken string     `json:"refresh_token"`
+	ExpiresIn    flexString `json:"expires_in"`
+	IDToken      string     `json:"id_token"`
+	UID          flexString `json:"uid"`
+	OpenID       string     `json:"openid"`
+	Error        flexString `json:"error"`
+	// 有的第三方把错误描述放在error_description里
+	ErrorDescription string `json:"error_description"`
+	// 微信的错误码和描述
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+type Provider struct {
+	Name        string
+	Title       string
+	AccountType int
+	ClientID    string
+	Secret      string
+	RedirectURL string
+	Scopes      []string
+	Endpoint    Endpoint
+	// 第三方是否支持PKCE，不支持时不带code_challenge
+	PKCE bool
+	// 在授权链接上额外加的参数
+	AuthParams map[string]string
+	// 参数名和标准不一样时的对应关系，比如微信用appid代替client_id
+	ParamNames map[string]string
+	// 授权链接最后加上的#片段
+	AuthFragment string
+	// 换token的请求方法，默认POST，QQ只支持GET
+	TokenMethod string
+	Client      *http.Client
+	FetchUser   func(p *Provider, token *Token) (*info.UserInfo, error)
+	// 不为nil时在第一次使用之前调用，比如OIDC通过issuer发现各个接口的地址
+	Prepare func(p *Provider) error
+
+	prepareMutex sync.Mutex
+	prepared     bool
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: kRequestTimeout}
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// 每次登录生成新的state和code_verifier
+func NewState() (string, string, error) {
+	state, err := randomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return state, verifier, nil
+}
+
+// RFC 7636的S256
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Prepare失败之后下次使用时会重试
+func (p *Provider) prepare() error {
+	p.prepareMutex.Lock()
+	defer p.prepareMutex.Unlock()
+	if p.prepared || p.Prepare == nil {
+		return nil
+	}
+	if err := p.Prepare(p); err != nil {
+		return err
+	}
+	p.prepared = true
+	return nil
+}
+
+func (p *Provider) paramName(name string) string {
+	if value, ok := p.ParamNames[name]; ok {
+		return value
+	}
+	return name
+}
+
+func (p *Provider) AuthCodeURL(state string, verifier string) (string, error) {
+	if err := p.prepare(); err != nil {
+		return "", err
+	}
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set(p.paramName("client_id"), p.ClientID)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set("state", state)
+	if len(p.Scopes) > 0 {
+		values.Set("scope", strings.Join(p.Scopes, " "))
+	}
+	if p.PKCE {
+		values.Set("code_challenge", codeChallenge(verifier))
+		values.Set("code_challenge_method", "S256")
+	}
+	for key, value := range p.AuthParams {
+		values.Set(key, value)
+	}
+	separator := "?"
+	if strings.Contains(p.Endpoint.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.Endpoint.AuthURL + separator + values.Encode() + p.AuthFragment, nil
+}
+
+func (p *Provider) httpClient() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return newHTTPClient()
+}
+
+func readResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, kMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("http status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// QQ的部分接口返回jsonp格式：callback( {...} );
+func unwrapCallback(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if strings.HasPrefix(text, "callback(") {
+		text = strings.TrimSuffix(strings.TrimSpace(strings.TrimSuffix(text, ";")), ")")
+		text = strings.TrimSpace(strings.TrimPrefix(text, "callback("))
+	}
+	return text
+}
+
+// token接口一般返回json，QQ和没有带Accept头的GitHub返回a=1&b=2的表单格式，这里都兼容
+func parseToken(body []byte) (*Token, error) {
+	var response tokenResponse
+	text := unwrapCallback(body)
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), &response); err != nil {
+			return nil, err
+		}
+	} else {
+		values, err := url.ParseQuery(text)
+		if err != nil {
+			return nil, err
+		}
+		response.AccessToken = values.Get("access_token")
+		response.TokenType = values.Get("token_type")
+		response.RefreshToken = values.Get("refresh_token")
+		response.ExpiresIn = flexString(values.Get("expires_in"))
+		response.Error = flexString(values.Get("error"))
+		response.ErrorDescription = values.Get("error_description")
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("oauth error: %s %s", response.Error, response.ErrorDescription)
+	}
+	if response.ErrCode != 0 {
+		return nil, fmt.Errorf("oauth error %d: %s", response.ErrCode, response.ErrMsg)
+	}
+	if response.AccessToken == "" {
+		return nil, ErrNoAccessToken
+	}
+	expiresIn, _ := strconv.ParseInt(string(response.ExpiresIn), 10, 64)
+	return &Token{
+		AccessToken:  response.AccessToken,
+		TokenType:    response.TokenType,
+		RefreshToken: response.RefreshToken,
+		ExpiresIn:    expiresIn,
+		IDToken:      response.IDToken,
+		UID:          string(response.UID),
+		OpenID:       response.OpenID,
+	}, nil
+}
+
+// 用授权码换access token，client_secret放在表单里
+func (p *Provider) Exchange(code string, verifier string) (*Token, error) {
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set(p.paramName("client_id"), p.ClientID)
+	values.Set(p.paramName("client_secret"), p.Secret)
+	if p.PKCE {
+		values.Set("code_verifier", verifier)
+	}
+	var req *http.Request = nil
+	var err error
+	if p.TokenMethod == "GET" {
+		separator := "?"
+		if strings.Contains(p.Endpoint.TokenURL, "?") {
+			separator = "&"
+		}
+		req, err = http.NewRequest("GET", p.Endpoint.TokenURL+separator+values.Encode(), nil)
+	} else {
+		req, err = http.NewRequest("POST", p.Endpoint.TokenURL, strings.NewReader(values.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	return parseToken(body)
+}
+
+// GET一个json接口，token不为nil时带上Bearer头
+func (p *Provider) getJSON(rawURL string, token *Token, result interface{}) error {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != nil {
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+	resp, err := p.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(unwrapCallback(body)), result)
+}
+
+// 换token并取用户信息，返回的UserAccountType是这个第三方对应的类型
+func (p *Provider) Login(code string, verifier string) (*info.UserInfo, error) {
+	if err := p.prepare(); err != nil {
+		return nil, err
+	}
+	token, err := p.Exchange(code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	userInfo, err := p.FetchUser(p, token)
+	if err != nil {
+		return nil, err
+	}
+	if userInfo.UserOpenID == "" {
+		return nil, ErrInvalidProfile
+	}
+	userInfo.UserAccountType = p.AccountType
+	return userInfo, nil
+}
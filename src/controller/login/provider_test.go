@@ -0,0 +1,240 @@
+package login
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 本地的OAuth2服务，只认code为good-code的请求，校验client和PKCE
+type stubServer struct {
+	*httptest.Server
+	t         *testing.T
+	challenge string
+	// token接口按表单格式返回
+	formToken bool
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	s := &stubServer{t: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		s.challenge = r.URL.Query().Get("code_challenge")
+		target := r.URL.Query().Get("redirect_uri") + "&code=good-code&state=" + url.QueryEscape(r.URL.Query().Get("state"))
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_id") != "client" || r.Form.Get("client_secret") != "secret" ||
+			r.Form.Get("code") != "good-code" {
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "bad code"}`))
+			return
+		}
+		if s.challenge != "" && codeChallenge(r.Form.Get("code_verifier")) != s.challenge {
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "bad verifier"}`))
+			return
+		}
+		if s.formToken {
+			w.Write([]byte("access_token=form-token&expires_in=7776000&refresh_token=r"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "json-token", "token_type": "bearer", "uid": "42", "openid": "wx-openid"}`))
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer json-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": 1001, "login": "octocat", "name": "", "avatar_url": "https://example.com/a.png"}`))
+	})
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `callback( {"client_id":"client","openid":"qq-%s"} );`, r.URL.Query().Get("access_token"))
+	})
+	mux.HandleFunc("/qq_user", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("openid") != "qq-form-token" || r.URL.Query().Get("oauth_consumer_key") != "client" {
+			w.Write([]byte(`{"ret": 1002, "msg": "bad openid"}`))
+			return
+		}
+		w.Write([]byte(`{"ret": 0, "nickname": "小风", "gender": "男", "figureurl_1": "s.png", "figureurl_2": "b.png"}`))
+	})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer": "%s", "authorization_endpoint": "%s/authorize", "token_endpoint": "%s/token",
+			"userinfo_endpoint": "%s/userinfo"}`, s.URL, s.URL, s.URL, s.URL)
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer json-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"sub": "oidc-sub", "preferred_username": "reader", "picture": "p.png"}`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// 模拟浏览器走一遍授权：打开授权链接，从跳转地址里取出code和state
+func authorize(t *testing.T, p *Provider, state string, verifier string) (string, string) {
+	authURL, err := p.AuthCodeURL(state, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func Test_GitHubLoginWithPKCE(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+	p := NewGitHubProvider("client", "secret", "https://blog.example.com/login?type=github")
+	p.Endpoint = Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token", UserInfoURL: server.URL + "/user"}
+	state, verifier, err := NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, returnedState := authorize(t, p, state, verifier)
+	if returnedState != state {
+		t.Fatal("state not returned: ", returnedState)
+	}
+	if server.challenge == "" {
+		t.Fatal("no code_challenge in auth url")
+	}
+	if _, err = p.Login(code, "wrong-verifier"); err == nil || !strings.Contains(err.Error(), "bad verifier") {
+		t.Error("expect verifier error, got ", err)
+	}
+	userInfo, err := p.Login(code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userInfo.UserOpenID != "1001" || userInfo.UserName != "octocat" || userInfo.UserAccountType != p.AccountType {
+		t.Error("wrong user info: ", userInfo)
+	}
+	if _, err = p.Login("bad-code", verifier); err == nil {
+		t.Error("bad code should fail")
+	}
+}
+
+func Test_QQLogin(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+	server.formToken = true
+	oldURL := qqOpenIdURL
+	qqOpenIdURL = server.URL + "/me"
+	defer func() { qqOpenIdURL = oldURL }()
+	p := NewQQProvider("client", "secret", "https://blog.example.com/login?type=qq")
+	p.Endpoint = Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token", UserInfoURL: server.URL + "/qq_user"}
+	code, _ := authorize(t, p, "state", "")
+	if server.challenge != "" {
+		t.Error("qq does not support PKCE")
+	}
+	userInfo, err := p.Login(code, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userInfo.UserOpenID != "qq-form-token" || userInfo.UserName != "小风" || userInfo.BigFigureurl != "b.png" {
+		t.Error("wrong user info: ", userInfo)
+	}
+}
+
+func Test_WeiboAndWeixinUseTokenIds(t *testing.T) {
+	p := NewWeixinProvider("appid", "secret", "https://blog.example.com/login?type=weixin")
+	authURL, err := p.AuthCodeURL("s", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(authURL, "appid=appid") || strings.Contains(authURL, "client_id") ||
+		!strings.HasSuffix(authURL, "#wechat_redirect") {
+		t.Error("wrong weixin auth url: ", authURL)
+	}
+	if _, err = fetchWeiboUser(NewWeiboProvider("a", "b", "c"), &Token{AccessToken: "t"}); err != ErrInvalidProfile {
+		t.Error("weibo token without uid should fail")
+	}
+	if _, err = fetchWeixinUser(p, &Token{AccessToken: "t"}); err != ErrInvalidProfile {
+		t.Error("weixin token without openid should fail")
+	}
+}
+
+func Test_OIDCDiscovery(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+	p := NewOIDCProvider("SSO", server.URL+"/", "client", "secret", "https://blog.example.com/login?type=oidc")
+	state, verifier, _ := NewState()
+	code, _ := authorize(t, p, state, verifier)
+	userInfo, err := p.Login(code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userInfo.UserOpenID != "oidc-sub" || userInfo.UserName != "reader" {
+		t.Error("wrong user info: ", userInfo)
+	}
+
+	other := NewOIDCProvider("SSO", server.URL+"/other", "client", "secret", "x")
+	if _, err = other.AuthCodeURL("s", "v"); err == nil {
+		t.Error("issuer mismatch should fail")
+	}
+}
+
+func Test_ParseToken(t *testing.T) {
+	cases := []struct {
+		body   string
+		token  string
+		hasErr bool
+	}{
+		{`{"access_token": "a"}`, "a", false},
+		{"access_token=b&expires_in=10", "b", false},
+		{`callback( {"error": 100019, "error_description": "code used"} );`, "", true},
+		{`{"access_token": "c", "uid": 12345, "expires_in": "3600"}`, "c", false},
+		{`{"errcode": 40029, "errmsg": "invalid code"}`, "", true},
+		{`{"error": "invalid_grant"}`, "", true},
+		{`{}`, "", true},
+	}
+	for _, c := range cases {
+		token, err := parseToken([]byte(c.body))
+		if c.hasErr {
+			if err == nil {
+				t.Error("expect error for ", c.body)
+			}
+			continue
+		}
+		if err != nil || token.AccessToken != c.token {
+			t.Error("wrong token for ", c.body, ": ", err)
+		}
+	}
+	token, err := parseToken([]byte(`{"access_token": "c", "uid": 12345, "expires_in": "3600"}`))
+	if err != nil || token.UID != "12345" || token.ExpiresIn != 3600 {
+		t.Error("numeric uid should be accepted: ", token, err)
+	}
+	_, err = parseToken([]byte(`callback( {"error": 100019, "error_description": "code used"} );`))
+	if err == nil || !strings.Contains(err.Error(), "100019") {
+		t.Error("qq numeric error should be reported: ", err)
+	}
+}
+
+func Test_RequestTimeout(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+	p := NewGitHubProvider("client", "secret", "x")
+	p.Endpoint.TokenURL = server.URL + "/slow"
+	p.Client = &http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := p.Exchange("good-code", "v"); err == nil {
+		t.Error("expect timeout")
+	}
+}
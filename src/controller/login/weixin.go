@@ -0,0 +1,71 @@
+package login
+
+import (
+	"fmt"
+	"info"
+	"net/url"
+)
+
+// 微信网站应用扫码登录，参数名和标准OAuth2不一样，token里直接带着openid
+const (
+	kWeixinAuthURL     = "https://open.weixin.qq.com/connect/qrconnect"
+	kWeixinTokenURL    = "https://api.weixin.qq.com/sns/oauth2/access_token"
+	kWeixinUserInfoURL = "https://api.weixin.qq.com/sns/userinfo"
+)
+
+type weixinUserInfo struct {
+	OpenId     string `json:"openid"`
+	Nickname   string `json:"nickname"`
+	Sex        int    `json:"sex"`
+	HeadImgURL string `json:"headimgurl"`
+	ErrCode    int    `json:"errcode"`
+	ErrMsg     string `json:"errmsg"`
+}
+
+func NewWeixinProvider(appId string, secret string, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "weixin",
+		Title:        "微信",
+		AccountType:  info.AccountTypeWeixin,
+		ClientID:     appId,
+		Secret:       secret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"snsapi_login"},
+		Endpoint:     Endpoint{AuthURL: kWeixinAuthURL, TokenURL: kWeixinTokenURL, UserInfoURL: kWeixinUserInfoURL},
+		ParamNames:   map[string]string{"client_id": "appid", "client_secret": "secret"},
+		AuthFragment: "#wechat_redirect",
+		TokenMethod:  "GET",
+		FetchUser:    fetchWeixinUser,
+	}
+}
+
+func fetchWeixinUser(p *Provider, token *Token) (*info.UserInfo, error) {
+	if token.OpenID == "" {
+		return nil, ErrInvalidProfile
+	}
+	values := url.Values{}
+	values.Set("access_token", token.AccessToken)
+	values.Set("openid", token.OpenID)
+	var profile weixinUserInfo
+	if err := p.getJSON(p.Endpoint.UserInfoURL+"?"+values.Encode(), nil, &profile); err != nil {
+		return nil, err
+	}
+	if profile.ErrCode != 0 {
+		return nil, fmt.Errorf("weixin user info error %d: %s", profile.ErrCode, profile.ErrMsg)
+	}
+	// 微信的性别1为男性，2为女性
+	sex := ""
+	switch profile.Sex {
+	case 1:
+		sex = "男"
+	case 2:
+		sex = "女"
+	}
+	return &info.UserInfo{
+		UserOpenID:     token.OpenID,
+		UserName:       profile.Nickname,
+		Sex:            sex,
+		SmallFigureurl: profile.HeadImgURL,
+		BigFigureurl:   profile.HeadImgURL,
+	}, nil
+}
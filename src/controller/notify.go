@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"blog/notify"
+	"encoding/json"
+	"fmt"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+	"time"
+)
+
+const (
+	kNotificationPageSize = 20
+	// 推送连接的心跳间隔，防止被中间的代理断开
+	kNotifyKeepAliveInterval = 30 * time.Second
+)
+
+func notificationToData(notification *info.NotificationInfo, userMap map[int64]*info.UserInfo) map[string]interface{} {
+	actor := map[string]interface{}{"id": notification.ActorID, "name": "", "pic": ""}
+	if userInfo, ok := userMap[notification.ActorID]; ok {
+		actor["name"] = userInfo.UserName
+		actor["pic"] = userInfo.SmallFigureurl
+	}
+	target, url := commentTarget(notification.CommentType, notification.TypeID)
+	return map[string]interface{}{
+		"id":         notification.NotificationID,
+		"type":       notification.Type,
+		"comment_id": notification.CommentID,
+		"target":     target,
+		"target_id":  notification.TypeID,
+		"url":        url,
+		"content":    notification.Content,
+		"time":       notification.Time,
+		"read":       notification.ReadAt > 0,
+		"actor":      actor,
+	}
+}
+
+func notificationListToData(notificationList []*info.NotificationInfo) []interface{} {
+	var actorIdList []int64 = nil
+	for _, notification := range notificationList {
+		actorIdList = append(actorIdList, notification.ActorID)
+	}
+	userMap, err := model.ShareUserModel().FetchUserInfoMap(actorIdList)
+	if err != nil {
+		userMap = map[int64]*info.UserInfo{}
+	}
+	var retList []interface{} = []interface{}{}
+	for _, notification := range notificationList {
+		retList = append(retList, notificationToData(notification, userMap))
+	}
+	return retList
+}
+
+// 页面上显示的未读通知数，没有登录或者出错时为0
+func unreadCount(userId int64) int {
+	if userId <= 0 {
+		return 0
+	}
+	count, err := model.ShareNotificationModel().FetchUnreadCount(userId)
+	if err != nil {
+		fmt.Println("fetch unread count error: ", err)
+		return 0
+	}
+	return count
+}
+
+/* 通知收件箱，需要登录：
+** {"type": "notifications", "page": 1}，返回{"total": 总数, "unread": 未读数, "list": [...]}
+** {"type": "unreadCount"}
+** {"type": "markRead", "ids": [1, 2]}，不传ids时全部标记为已读，返回剩下的未读数
+ */
+func (a *APIController) handleNotifyAction(w http.ResponseWriter, inf map[string]interface{}, action string) {
+	userId := a.LoginUserId()
+	if userId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "account not login")
+		return
+	}
+	switch action {
+	case "notifications":
+		page, _ := parseIntField(inf, "page")
+		if page < 1 {
+			page = 1
+		}
+		total, err := model.ShareNotificationModel().FetchNotificationCount(userId)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		notificationList, err := model.ShareNotificationModel().FetchNotificationList(userId,
+			pageOffset(page, kNotificationPageSize), kNotificationPageSize)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+			"total":  total,
+			"unread": unreadCount(userId),
+			"list":   notificationListToData(notificationList),
+		})
+		return
+	case "markRead":
+		var idList []int = nil
+		if ids, ok := inf["ids"].([]interface{}); ok {
+			for _, id := range ids {
+				if v, ok := id.(float64); ok {
+					idList = append(idList, int(v))
+				}
+			}
+		}
+		if _, err := model.ShareNotificationModel().MarkRead(userId, idList); err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"unread": unreadCount(userId),
+	})
+}
+
+type NotifyStreamController struct {
+	server.SessionController
+}
+
+func NewNotifyStreamController() *NotifyStreamController {
+	return &NotifyStreamController{}
+}
+
+func (n *NotifyStreamController) Path() interface{} {
+	return "/notify/stream"
+}
+
+func (n *NotifyStreamController) SessionPath() string {
+	return "/"
+}
+
+/* 通知的实时推送，使用Server-Sent Events，页面打开时用EventSource连上来。
+** 每条新通知是一个notification事件，data和收件箱接口里的一条通知格式相同。
+ */
+func (n *NotifyStreamController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	n.SessionController.HandlerRequest(n, w, r)
+	userId := n.LoginUserId()
+	if userId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "account not login")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		response.JsonResponseWithMsg(w, framework.ErrorRunTimeError, "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	ch, cancel := notify.Subscribe(userId)
+	defer cancel()
+	fmt.Fprintf(w, "event: unread\ndata: %d\n\n", unreadCount(userId))
+	flusher.Flush()
+	ticker := time.NewTicker(kNotifyKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case notification, ok := <-ch:
+			if !ok {
+				return
+			}
+			content, err := json.Marshal(notificationListToData([]*info.NotificationInfo{notification})[0])
+			if err != nil {
+				fmt.Println("marshal notification error: ", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: notification\ndata: %s\n\n", content)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
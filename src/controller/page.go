@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 首页每页显示的博客数
+	kIndexPageSize = 10
+	// 博客页每页显示的评论数
+	kCommentPageSize = 20
+	// High玩每页显示的插件数
+	kPluginPageSize = 10
+	// 当前页前后各显示几个页码
+	kPageNumberWindow = 2
+)
+
+type pageNumberRender struct {
+	Number   int
+	URL      string
+	Current  bool
+	Ellipsis bool
+}
+
+type pageRender struct {
+	Page      int
+	PageCount int
+	Total     int
+	HasPrev   bool
+	HasNext   bool
+	PrevURL   string
+	NextURL   string
+	Pages     []*pageNumberRender
+}
+
+func parsePageNumber(r *http.Request) int {
+	return parsePageParam(r, "page")
+}
+
+func parsePageParam(r *http.Request, name string) int {
+	page, err := strconv.Atoi(r.Form.Get(name))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// baseURL为不带page参数的链接，例如 /tag?type=Golang
+func buildPageRender(baseURL string, page int, pageSize int, total int) *pageRender {
+	return buildPageRenderWithParam(baseURL, "page", page, pageSize, total)
+}
+
+// 总页数，没有数据时也算一页
+func pageCountOf(pageSize int, total int) int {
+	pageCount := (total + pageSize - 1) / pageSize
+	if pageCount == 0 {
+		pageCount = 1
+	}
+	return pageCount
+}
+
+// 把页码限制在[1, 总页数]之内，知道总数时在计算offset之前调用
+func clampPage(page int, pageSize int, total int) int {
+	if page < 1 {
+		return 1
+	}
+	if pageCount := pageCountOf(pageSize, total); page > pageCount {
+		return pageCount
+	}
+	return page
+}
+
+// 同一个页面有多个分页时(比如博客页的评论)，用不同的参数名区分
+func buildPageRenderWithParam(baseURL string, param string, page int, pageSize int, total int) *pageRender {
+	pageCount := pageCountOf(pageSize, total)
+	page = clampPage(page, pageSize, total)
+	pageURL := func(p int) string {
+		if strings.Contains(baseURL, "?") {
+			return fmt.Sprintf("%s&%s=%d", baseURL, param, p)
+		}
+		return fmt.Sprintf("%s?%s=%d", baseURL, param, p)
+	}
+	render := &pageRender{Page: page, PageCount: pageCount, Total: total}
+	if page > 1 {
+		render.HasPrev = true
+		render.PrevURL = pageURL(page - 1)
+	}
+	if page < pageCount {
+		render.HasNext = true
+		render.NextURL = pageURL(page + 1)
+	}
+	// 首页、尾页以及当前页附近的页码，中间跳过的部分用省略号表示
+	last := 0
+	for p := 1; p <= pageCount; p++ {
+		if p != 1 && p != pageCount && (p < page-kPageNumberWindow || p > page+kPageNumberWindow) {
+			continue
+		}
+		if last != 0 && p != last+1 {
+			render.Pages = append(render.Pages, &pageNumberRender{Ellipsis: true})
+		}
+		render.Pages = append(render.Pages, &pageNumberRender{Number: p, URL: pageURL(p), Current: p == page})
+		last = p
+	}
+	return render
+}
+
+// 页码转换为数据库的offset，页码太大时不会溢出，查出来是空的
+func pageOffset(page int, pageSize int) int {
+	if page < 1 || pageSize < 1 {
+		return 0
+	}
+	if page-1 > math.MaxInt32/pageSize {
+		return math.MaxInt32 / pageSize * pageSize
+	}
+	return (page - 1) * pageSize
+}
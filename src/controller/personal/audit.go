@@ -0,0 +1,303 @@
+package personal
+
+import (
+	"blog/audit"
+	"blog/trash"
+	"fmt"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	kAuditDefaultLimit = 50
+	kAuditMaxLimit     = 200
+	// 评论内容在摘要里最多保留的字数
+	kAuditContentLength = 200
+)
+
+// 审计日志里博客的摘要，blogInfo为nil时返回nil
+func blogSummary(blogInfo *info.BlogInfo) interface{} {
+	if blogInfo == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"uuid":       blogInfo.BlogUUID,
+		"title":      blogInfo.BlogTitle,
+		"sort":       blogInfo.BlogSortType,
+		"tags":       blogInfo.BlogTagList,
+		"status":     blogInfo.BlogStatus,
+		"publish_at": blogInfo.BlogPublishAt,
+	}
+}
+
+// 上传博客的日志，after是写入之后的博客
+func recordBlogUpload(actor *audit.Actor, action string, uuid string, before interface{}, err error) {
+	blogInfo, _ := model.ShareBlogModel().FetchBlogByUUID(uuid)
+	var blogId int64 = 0
+	if blogInfo != nil {
+		blogId = int64(blogInfo.BlogID)
+	}
+	actor.Record(action, audit.TargetBlog, blogId, before, blogSummary(blogInfo), err)
+}
+
+func pluginInfoSummary(pluginInfo *info.PluginInfo) interface{} {
+	if pluginInfo == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"uuid":    pluginInfo.PluginUUID,
+		"name":    pluginInfo.PluginName,
+		"version": pluginInfo.PluginVersion,
+		"type":    pluginInfo.PluginType,
+	}
+}
+
+func pluginSummary(pluginId int) interface{} {
+	if pluginId <= 0 {
+		return nil
+	}
+	pluginInfo, _ := model.SharePluginModel().FetchPluginByPluginID(pluginId)
+	return pluginInfoSummary(pluginInfo)
+}
+
+func commentSummary(commentInfo *info.CommentInfo) interface{} {
+	if commentInfo == nil {
+		return nil
+	}
+	content := commentInfo.Content
+	if utf8.RuneCountInString(content) > kAuditContentLength {
+		content = string([]rune(content)[:kAuditContentLength])
+	}
+	return map[string]interface{}{
+		"type":    commentInfo.Type,
+		"type_id": commentInfo.TypeID,
+		"user_id": commentInfo.UserID,
+		"status":  commentInfo.Status,
+		"content": content,
+	}
+}
+
+func categorySummary(categoryInfo *info.CategoryInfo) interface{} {
+	if categoryInfo == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"name":        categoryInfo.CategoryName,
+		"slug":        categoryInfo.CategorySlug,
+		"description": categoryInfo.CategoryDescription,
+		"parent":      categoryInfo.CategoryParentID,
+		"order":       categoryInfo.CategoryOrder,
+	}
+}
+
+func tagSummary(tagInfo *info.TagInfo) interface{} {
+	if tagInfo == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"name":        tagInfo.TagName,
+		"description": tagInfo.TagDescription,
+		"count":       tagInfo.TagBlogCount,
+	}
+}
+
+func roleSummary(roleInfo *info.RoleInfo) interface{} {
+	if roleInfo == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"role":         roleInfo.Role,
+		"banned_until": roleInfo.BannedUntil,
+	}
+}
+
+// 请求的参数作为操作之后的摘要，去掉和action重复的type
+func paramSummary(m map[string]interface{}) map[string]interface{} {
+	summary := make(map[string]interface{})
+	for key, value := range m {
+		if key != "type" {
+			summary[key] = value
+		}
+	}
+	return summary
+}
+
+// 删除、恢复、彻底删除的对象，回收站里的也能查到
+func trashTargetSummary(kind string, id int) interface{} {
+	switch kind {
+	case trash.KindBlog:
+		blogInfo, _ := model.ShareBlogModel().FetchBlogByBlogID(id)
+		if blogInfo == nil {
+			blogInfo, _ = model.ShareBlogModel().FetchTrashBlogByBlogID(id)
+		}
+		return blogSummary(blogInfo)
+	case trash.KindComment:
+		commentInfo, _ := model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Blog, id)
+		if commentInfo == nil {
+			commentInfo, _ = model.ShareCommentModel().FetchCommentByCommentId(info.CommentType_Plugin, id)
+		}
+		if commentInfo == nil {
+			commentInfo, _ = model.ShareCommentModel().FetchTrashCommentByCommentId(id)
+		}
+		return commentSummary(commentInfo)
+	case trash.KindPlugin:
+		pluginInfo, _ := model.SharePluginModel().FetchPluginByPluginID(id)
+		if pluginInfo == nil {
+			pluginInfo, _ = model.SharePluginModel().FetchTrashPluginByPluginID(id)
+		}
+		return pluginInfoSummary(pluginInfo)
+	}
+	return nil
+}
+
+type PersonalAuditController struct {
+	server.SessionController
+}
+
+func NewPersonalAuditController() *PersonalAuditController {
+	return &PersonalAuditController{}
+}
+
+func (p *PersonalAuditController) Path() interface{} {
+	return "/personal/audit"
+}
+
+func (p *PersonalAuditController) SessionPath() string {
+	return "/"
+}
+
+func auditFilterFromJson(m map[string]interface{}) *info.AuditFilter {
+	filter := &info.AuditFilter{}
+	filter.ActorType, _ = m["actor_type"].(string)
+	filter.Action, _ = m["action"].(string)
+	filter.TargetType, _ = m["target_type"].(string)
+	filter.IP, _ = m["ip"].(string)
+	if v, ok := m["actor_id"].(float64); ok {
+		filter.ActorID = int64(v)
+	}
+	if v, ok := m["target_id"].(float64); ok {
+		filter.TargetID = int64(v)
+	}
+	if v, ok := m["since"].(float64); ok {
+		filter.Since = int64(v)
+	}
+	if v, ok := m["until"].(float64); ok {
+		filter.Until = int64(v)
+	}
+	return filter
+}
+
+func auditFilterFromForm(form url.Values) *info.AuditFilter {
+	parseInt := func(name string) int64 {
+		value, _ := strconv.ParseInt(form.Get(name), 10, 64)
+		return value
+	}
+	return &info.AuditFilter{
+		ActorType:  form.Get("actor_type"),
+		ActorID:    parseInt("actor_id"),
+		Action:     form.Get("action"),
+		TargetType: form.Get("target_type"),
+		TargetID:   parseInt("target_id"),
+		IP:         form.Get("ip"),
+		Since:      parseInt("since"),
+		Until:      parseInt("until"),
+	}
+}
+
+func auditInfoToData(auditInfo *info.AuditInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          auditInfo.ID,
+		"time":        auditInfo.Time,
+		"actor_type":  auditInfo.ActorType,
+		"actor_id":    auditInfo.ActorID,
+		"actor_name":  auditInfo.ActorName,
+		"ip":          auditInfo.IP,
+		"user_agent":  auditInfo.UserAgent,
+		"action":      auditInfo.Action,
+		"target_type": auditInfo.TargetType,
+		"target_id":   auditInfo.TargetID,
+		"before":      auditInfo.Before,
+		"after":       auditInfo.After,
+		"result":      auditInfo.Result,
+	}
+}
+
+func (p *PersonalAuditController) listAudit(w http.ResponseWriter, m map[string]interface{}) {
+	page := parseIntValue(m, "page", 1)
+	limit := parseIntValue(m, "limit", kAuditDefaultLimit)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > kAuditMaxLimit {
+		limit = kAuditDefaultLimit
+	}
+	auditList, total, err := audit.Query(auditFilterFromJson(m), (page-1)*limit, limit)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var retList []interface{} = []interface{}{}
+	for _, auditInfo := range auditList {
+		retList = append(retList, auditInfoToData(auditInfo))
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"total": total,
+		"page":  page,
+		"limit": limit,
+		"list":  retList,
+	})
+}
+
+func (p *PersonalAuditController) exportAudit(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.csv",
+		time.Now().Format("20060102150405")))
+	// 已经开始写文件，出错时只能打印出来
+	if err := audit.Export(w, auditFilterFromForm(r.Form)); err != nil {
+		fmt.Println("export audit error: ", err)
+	}
+}
+
+/* 审计日志，只有用主人密码登录的会话可以查看，令牌不能用。
+** POST查询，json格式如下，条件都是可选的：
+** {"type": "list", "actor_type": "token", "actor_id": 1, "action": "blog.", "target_type": "blog",
+**     "target_id": 1, "ip": "1.2.3.4", "since": 1490000000, "until": 1500000000, "page": 1, "limit": 50}
+**   actor_type可以是owner、token、user、anonymous，action以.结尾时按前缀匹配，since和until是unix时间
+** GET /personal/audit?action=blog.&since=1490000000 按同样的条件导出csv
+ */
+func (p *PersonalAuditController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthSession(&p.SessionController) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+	if r.Method == "GET" {
+		p.exportAudit(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	if actionType, _ := m["type"].(string); actionType != "list" {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+		return
+	}
+	p.listAudit(w, m)
+}
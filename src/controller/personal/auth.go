@@ -1,17 +1,19 @@
 package personal
 
 import (
-	"crypto/md5"
-	"encoding/hex"
-	"encoding/json"
+	"blog/audit"
+	"blog/owner"
 	"framework"
-	"framework/base/config"
 	"framework/response"
 	"framework/server"
-	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// 密码通过之后等待两步验证的时间
+const kAuthPendingTime = 5 * time.Minute
+
 type PersonalAuthController struct {
 	server.SessionController
 }
@@ -28,6 +30,48 @@ func (p *PersonalAuthController) SessionPath() string {
 	return "/"
 }
 
+// 主人登录和两步验证的错误，锁定时带上解锁的时间
+func ownerAuthError(w http.ResponseWriter, err error) {
+	switch e := err.(type) {
+	case *owner.LockedError:
+		response.JsonResponseWithData(w, framework.ErrorAccountTooFrequent, e.Error(), map[string]interface{}{
+			"locked_until": e.Until,
+		})
+		return
+	}
+	switch err {
+	case owner.ErrNoCredential, owner.ErrWrongPassword, owner.ErrInvalidCode:
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, err.Error())
+	case owner.ErrTOTPEnabled, owner.ErrTOTPNotEnabled, owner.ErrNoPendingSecret:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+	}
+}
+
+func (p *PersonalAuthController) login() {
+	p.WebSession.Delete("auth_pending")
+	p.WebSession.Set("status", "auth")
+	p.ResetSessionDuration()
+}
+
+// 密码已经通过，并且还没有超时
+func (p *PersonalAuthController) isPending() bool {
+	value, err := p.WebSession.Get("auth_pending")
+	if err != nil {
+		return false
+	}
+	text, _ := value.(string)
+	pendingTime, err := strconv.ParseInt(text, 10, 64)
+	return err == nil && time.Now().Unix()-pendingTime < int64(kAuthPendingTime/time.Second)
+}
+
+/* 主人登录，json格式如下：
+** {"username": "用户名", "password": "md5(用户名+密码)"}，
+**   开启了两步验证时返回ErrorAccountNeedTOTP，需要在5分钟内提交第二步
+** {"type": "totp", "code": "应用里的6位数字或者一个恢复码"}
+** 连续失败太多次时返回ErrorAccountTooFrequent，data里的locked_until是解锁的时间
+ */
 func (p *PersonalAuthController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		response.JsonResponse(w, framework.ErrorMethodError)
@@ -35,46 +79,58 @@ func (p *PersonalAuthController) HandlerRequest(w http.ResponseWriter, r *http.R
 	}
 	p.SessionController.HandlerRequest(p, w, r)
 
-	if status, err := p.WebSession.Get("status"); err == nil && status == "auth" {
+	if isAuthSession(&p.SessionController) {
 		response.JsonResponse(w, framework.ErrorOK)
 		return
 	}
 
-	result, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
+	m, err := readJsonBody(r)
 	if err != nil {
 		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
 		return
 	}
-	var f interface{}
-	json.Unmarshal(result, &f)
-	if m, ok := f.(map[string]interface{}); ok {
-		var userName, password string
-		if userName, ok = m["username"].(string); !ok {
-			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no username")
+	if actionType, _ := m["type"].(string); actionType == "totp" {
+		if !p.isPending() {
+			response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "password not verified")
 			return
 		}
-		if password, ok = m["password"].(string); !ok {
-			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no password")
+		code, _ := m["code"].(string)
+		if err = owner.CheckSecondFactor(code); err != nil {
+			auditActor(&p.SessionController, r).Record("owner.login_totp", audit.TargetOwner, 0, nil, nil, err)
+			ownerAuthError(w, err)
 			return
 		}
-		defaultConfig := config.GetDefaultConfigJsonReader()
-		defaultUserName := defaultConfig.Get("account.owner.authUserName").(string)
-		defaultPassword := defaultConfig.Get("account.owner.authPassword").(string)
-
-		sign := func(password string) string {
-			md5Ctx := md5.New()
-			md5Ctx.Write([]byte(password))
-			cipherStr := md5Ctx.Sum(nil)
-			return hex.EncodeToString(cipherStr)
-		}
+		p.login()
+		auditActor(&p.SessionController, r).Record("owner.login_totp", audit.TargetOwner, 0, nil, nil, nil)
+		response.JsonResponse(w, framework.ErrorOK)
+		return
+	}
 
-		if userName == defaultUserName && password == sign(defaultUserName+defaultPassword) {
-			p.WebSession.Set("status", "auth")
-			p.ResetSessionDuration()
-			response.JsonResponse(w, framework.ErrorOK)
-		} else {
-			response.JsonResponse(w, framework.ErrorAccountAuthError)
-		}
+	var userName, password string
+	var ok bool
+	if userName, ok = m["username"].(string); !ok {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no username")
+		return
+	}
+	if password, ok = m["password"].(string); !ok {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no password")
+		return
+	}
+	needTOTP, err := owner.CheckPassword(userName, password)
+	// 登录成功之前操作者是anonymous，登录成功之后是owner
+	attempt := map[string]interface{}{"username": userName, "need_totp": needTOTP}
+	if err != nil {
+		auditActor(&p.SessionController, r).Record("owner.login", audit.TargetOwner, 0, nil, attempt, err)
+		ownerAuthError(w, err)
+		return
+	}
+	if needTOTP {
+		auditActor(&p.SessionController, r).Record("owner.login", audit.TargetOwner, 0, nil, attempt, nil)
+		p.WebSession.Set("auth_pending", strconv.FormatInt(time.Now().Unix(), 10))
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNeedTOTP, "totp required")
+		return
 	}
+	p.login()
+	auditActor(&p.SessionController, r).Record("owner.login", audit.TargetOwner, 0, nil, attempt, nil)
+	response.JsonResponse(w, framework.ErrorOK)
 }
@@ -0,0 +1,122 @@
+package personal
+
+import (
+	"blog/audit"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+)
+
+type PersonalCategoryController struct {
+	server.SessionController
+}
+
+func NewPersonalCategoryController() *PersonalCategoryController {
+	return &PersonalCategoryController{}
+}
+
+func (p *PersonalCategoryController) Path() interface{} {
+	return "/personal/category"
+}
+
+func (p *PersonalCategoryController) SessionPath() string {
+	return "/"
+}
+
+func categoryTreeToJson(categoryList []*info.CategoryInfo) []interface{} {
+	var ret []interface{} = []interface{}{}
+	for _, category := range categoryList {
+		ret = append(ret, map[string]interface{}{
+			"id":          category.CategoryID,
+			"name":        category.CategoryName,
+			"slug":        category.CategorySlug,
+			"description": category.CategoryDescription,
+			"parent":      category.CategoryParentID,
+			"order":       category.CategoryOrder,
+			"count":       category.CategoryBlogCount,
+			"total":       category.CategoryTotalCount,
+			"children":    categoryTreeToJson(category.Children),
+		})
+	}
+	return ret
+}
+
+/* 分类管理，json格式如下：
+** {"type": "list"}
+** {"type": "create", "name": "xx", "slug": "xx", "description": "xx", "parent": 0, "order": 0}
+** {"type": "rename", "id": 1, "name": "xx", "slug": "xx", "description": "xx", "order": 0}
+** {"type": "move", "id": 1, "parent": 2}
+** {"type": "delete", "id": 1, "reassign": 2}
+** parent为0表示顶级分类，reassign为0表示文章变为未分类
+ */
+func (p *PersonalCategoryController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthorized(&p.SessionController, r, info.TokenScope_Publish) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	actionType, _ := m["type"].(string)
+	name, _ := m["name"].(string)
+	slug, _ := m["slug"].(string)
+	description, _ := m["description"].(string)
+	categoryId := parseIntValue(m, "id", -1)
+	switch actionType {
+	case "list":
+		categoryList, err := model.ShareCategoryModel().FetchAllCategory()
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "",
+			categoryTreeToJson(model.BuildCategoryTree(categoryList)))
+		return
+	case "create":
+		newId, err := model.ShareCategoryModel().CreateCategory(name, slug, description,
+			parseIntValue(m, "parent", info.CategoryRootID), parseIntValue(m, "order", 0))
+		auditActor(&p.SessionController, r).Record("category.create", audit.TargetCategory, int64(newId), nil,
+			paramSummary(m), err)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{"id": newId})
+		return
+	}
+	// 分类不存在时由下面的操作返回错误
+	categoryInfo, _ := model.ShareCategoryModel().FetchCategoryByID(categoryId)
+	switch actionType {
+	case "rename":
+		err = model.ShareCategoryModel().UpdateCategory(categoryId, name, slug, description,
+			parseIntValue(m, "order", -1))
+	case "move":
+		err = model.ShareCategoryModel().MoveCategory(categoryId,
+			parseIntValue(m, "parent", info.CategoryRootID))
+	case "delete":
+		err = model.ShareCategoryModel().DeleteCategory(categoryId,
+			parseIntValue(m, "reassign", info.CategoryRootID))
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+		return
+	}
+	auditActor(&p.SessionController, r).Record("category."+actionType, audit.TargetCategory, int64(categoryId),
+		categorySummary(categoryInfo), paramSummary(m), err)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	response.JsonResponse(w, framework.ErrorOK)
+}
@@ -1,19 +1,13 @@
 package personal
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
+	"blog/moderation"
+	"blog/trash"
 	"framework"
-	"framework/base/config"
 	"framework/response"
 	"framework/server"
-	"io/ioutil"
-	"model"
-	"net/http"
-	"os"
-	"path/filepath"
 	"info"
+	"net/http"
 )
 
 type PersonalDeleteController struct {
@@ -32,6 +26,12 @@ func (p *PersonalDeleteController) SessionPath() string {
 	return "/"
 }
 
+/* 删除，json格式如下：
+** {"id": 1}，删除博客
+** {"kind": "comment", "id": 1}，kind可以是blog、comment、plugin
+** 删除只是放入回收站，可以通过/personal/trash恢复，
+** 有回复的评论不放入回收站，只清空内容显示为已删除，保证楼层完整
+ */
 func (p *PersonalDeleteController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		response.JsonResponse(w, framework.ErrorMethodError)
@@ -39,53 +39,44 @@ func (p *PersonalDeleteController) HandlerRequest(w http.ResponseWriter, r *http
 	}
 	p.SessionController.HandlerRequest(p, w, r)
 
-	if status, err := p.WebSession.Get("status"); err == nil && status == "auth" {
-		response.JsonResponse(w, framework.ErrorOK)
+	// 删除评论是审核工具，admin和moderator也可以用，读请求之前先确认至少有其中一种权限
+	canDelete := isAuthorized(&p.SessionController, r, info.TokenScope_Delete)
+	if !canDelete && !hasPermission(&p.SessionController, info.Permission_Moderate) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
 		return
 	}
-
-	result, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
+	m, err := readJsonBody(r)
 	if err != nil {
 		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
 		return
 	}
-	var f interface{}
-	json.Unmarshal(result, &f)
-	if m, ok := f.(map[string]interface{}); ok {
-		if bid, ok := m["id"].(float64); ok {
-			blogId := int(bid)
-			p.deleteBlog(blogId)
-			return
-		}
+	kind, ok := m["kind"].(string)
+	if !ok {
+		kind = trash.KindBlog
 	}
-	response.JsonResponseWithMsg(w, framework.ErrorParamError, "no username")
-}
-
-func (p *PersonalDeleteController) deleteBlog(blogId int) error {
-	// 1. 删除db，包括blog，comment
-	fmt.Println("deleteBlog: ", blogId)
-	isExist, err := model.ShareBlogModel().BlogIsExistByBlogID(blogId)
-	if err != nil {
-		return err
+	if !trash.IsValidKind(kind) {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport kind")
+		return
 	}
-	if isExist {
-		blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
-		if err != nil {
-			return err
-		}
-		err = model.ShareBlogModel().DeleteBlog(blogId)
-		if err != nil {
-			return err
-		}
-		err = model.ShareCommentModel().DeleteAllBlogComment(info.CommentType_Blog, blogId)
-		if err != nil {
-			return err
-		}
-		// 2. 删除本地文件, raw文件暂时不删
-		blogPath := config.GetDefaultConfigJsonReader().Get("blog.storage.file.blog").(string)
-		blogPath = filepath.Join(blogPath, blogInfo.BlogUUID)
-		return os.RemoveAll(blogPath)
+	if !canDelete && kind != trash.KindComment {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+	id := parseIntValue(m, "id", 0)
+	if id <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	before := trashTargetSummary(kind, id)
+	if kind == trash.KindComment {
+		err = moderation.Remove(id)
+	} else {
+		err = trash.Trash(kind, id)
+	}
+	auditActor(&p.SessionController, r).Record(kind+".delete", kind, int64(id), before, nil, err)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
 	}
-	return errors.New("no such blog")
+	response.JsonResponse(w, framework.ErrorOK)
 }
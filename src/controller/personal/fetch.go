@@ -1,17 +1,21 @@
 package personal
 
 import (
-	"encoding/json"
-	"fmt"
+	"blog/publish"
+	"container/list"
 	"framework"
 	"framework/response"
 	"framework/server"
 	"info"
-	"io/ioutil"
 	"model"
 	"net/http"
 )
 
+const (
+	kFetchDefaultLimit = 20
+	kFetchMaxLimit     = 100
+)
+
 type PersonalFetchController struct {
 	server.SessionController
 }
@@ -28,6 +32,162 @@ func (p *PersonalFetchController) SessionPath() string {
 	return "/"
 }
 
+// 分页参数，cursor大于0时使用游标分页，否则按page分页
+type fetchPageParam struct {
+	page   int
+	limit  int
+	cursor int
+}
+
+func parseFetchPageParam(m map[string]interface{}) *fetchPageParam {
+	param := &fetchPageParam{}
+	param.page = parseIntValue(m, "page", 1)
+	if param.page < 1 {
+		param.page = 1
+	}
+	param.limit = parseIntValue(m, "limit", kFetchDefaultLimit)
+	if param.limit <= 0 || param.limit > kFetchMaxLimit {
+		param.limit = kFetchDefaultLimit
+	}
+	param.cursor = parseIntValue(m, "cursor", 0)
+	return param
+}
+
+func (f *fetchPageParam) offset() int {
+	return (f.page - 1) * f.limit
+}
+
+// 列表满一页时用最后一条的id作为下一页的游标，否则返回0表示没有更多了
+func (f *fetchPageParam) buildResult(total int, retList []interface{}, lastId int) map[string]interface{} {
+	nextCursor := 0
+	if len(retList) == f.limit {
+		nextCursor = lastId
+	}
+	result := map[string]interface{}{
+		"total":       total,
+		"limit":       f.limit,
+		"next_cursor": nextCursor,
+		"list":        retList,
+	}
+	if f.cursor <= 0 {
+		result["page"] = f.page
+	}
+	return result
+}
+
+func (p *PersonalFetchController) fetchBlog(w http.ResponseWriter, param *fetchPageParam) {
+	total, err := model.ShareBlogModel().FetchOwnerBlogCount()
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var blogList *list.List = nil
+	if param.cursor > 0 {
+		blogList, err = model.ShareBlogModel().FetchOwnerBlogListBefore(param.cursor, param.limit)
+	} else {
+		blogList, err = model.ShareBlogModel().FetchOwnerBlogList(param.offset(), param.limit)
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var retBlogList []interface{} = []interface{}{}
+	lastId := 0
+	for iter := blogList.Front(); iter != nil; iter = iter.Next() {
+		blogInfo := iter.Value.(info.BlogInfo)
+		retBlogList = append(retBlogList, map[string]interface{}{
+			"id":         blogInfo.BlogID,
+			"name":       blogInfo.BlogTitle,
+			"time":       blogInfo.BlogTime,
+			"sort":       blogInfo.BlogSortType,
+			"tag":        blogInfo.BlogTagList,
+			"status":     blogInfo.BlogStatus,
+			"publish_at": blogInfo.BlogPublishAt,
+			"preview":    publish.PreviewURL(&blogInfo),
+		})
+		lastId = blogInfo.BlogID
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", param.buildResult(total, retBlogList, lastId))
+}
+
+func (p *PersonalFetchController) fetchComment(w http.ResponseWriter, commentType int, typeId int,
+	param *fetchPageParam) {
+	total, err := model.ShareCommentModel().FetchCommentCount(commentType, typeId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var commentList *list.List = nil
+	if param.cursor > 0 {
+		commentList, err = model.ShareCommentModel().FetchCommentListBefore(commentType, typeId,
+			param.cursor, param.limit, 0)
+	} else {
+		commentList, err = model.ShareCommentModel().FetchCommentListByBlogId(commentType, typeId,
+			param.offset(), param.limit, 0)
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var retCommentList []interface{} = []interface{}{}
+	lastId := 0
+	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+		commentInfo := iter.Value.(info.CommentInfo)
+		retCommentList = append(retCommentList, map[string]interface{}{
+			"id":      commentInfo.CommentID,
+			"parent":  commentInfo.ParentCommentID,
+			"user_id": commentInfo.UserID,
+			"content": commentInfo.Content,
+			"time":    commentInfo.Time,
+			"praise":  commentInfo.Praise,
+			"dissent": commentInfo.Dissent,
+		})
+		lastId = commentInfo.CommentID
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", param.buildResult(total, retCommentList, lastId))
+}
+
+func (p *PersonalFetchController) fetchPlugin(w http.ResponseWriter, param *fetchPageParam) {
+	total, err := model.SharePluginModel().FetchPluginCount()
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var pluginList *list.List = nil
+	if param.cursor > 0 {
+		pluginList, err = model.SharePluginModel().FetchPluginListBefore(param.cursor, param.limit)
+	} else {
+		pluginList, err = model.SharePluginModel().FetchPluginList(param.offset(), param.limit)
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var retPluginList []interface{} = []interface{}{}
+	lastId := 0
+	for iter := pluginList.Front(); iter != nil; iter = iter.Next() {
+		pluginInfo := iter.Value.(info.PluginInfo)
+		retPluginList = append(retPluginList, map[string]interface{}{
+			"id":      pluginInfo.PluginID,
+			"name":    pluginInfo.PluginName,
+			"type":    pluginInfo.PluginType,
+			"version": pluginInfo.PluginVersion,
+			"time":    pluginInfo.PluginTime,
+			"visit":   pluginInfo.PluginVisitCount,
+		})
+		lastId = pluginInfo.PluginID
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", param.buildResult(total, retPluginList, lastId))
+}
+
+/* 列表查询，json格式如下：
+** {"type": "blog", "page": 1, "limit": 20}
+** {"type": "blog", "cursor": 100, "limit": 20}
+** {"type": "comment", "blog_id": 1, "page": 1, "limit": 20}
+** {"type": "plugin", "page": 1, "limit": 20}
+** 返回 {"total": 总数, "page": 页码, "limit": 每页数量, "next_cursor": 下一页游标, "list": [...]}
+** next_cursor为0表示没有更多了
+ */
 func (p *PersonalFetchController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		response.JsonResponse(w, framework.ErrorMethodError)
@@ -35,50 +195,35 @@ func (p *PersonalFetchController) HandlerRequest(w http.ResponseWriter, r *http.
 	}
 	p.SessionController.HandlerRequest(p, w, r)
 
-	if status, err := p.WebSession.Get("status"); err != nil || status != "auth" {
-		fmt.Println("err: ", err.Error(), "\tstatus: ", status)
+	if !isAuthorized(&p.SessionController, r, info.TokenScope_Read) {
 		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
 		return
 	}
 
-	result, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
+	m, err := readJsonBody(r)
 	if err != nil {
 		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
 		return
 	}
-	var f interface{}
-	json.Unmarshal(result, &f)
-	if m, ok := f.(map[string]interface{}); ok {
-		var fetchType string
-		if fetchType, ok = m["type"].(string); !ok {
-			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no username")
+	fetchType, ok := m["type"].(string)
+	if !ok {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no type")
+		return
+	}
+	param := parseFetchPageParam(m)
+	switch fetchType {
+	case "blog":
+		p.fetchBlog(w, param)
+	case "comment":
+		blogId := parseIntValue(m, "blog_id", 0)
+		if blogId <= 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no blog_id")
 			return
 		}
-		switch fetchType {
-		case "blog":
-			blogList, err := model.ShareBlogModel().FetchAllBlog()
-			if err != nil {
-				response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
-				return
-			}
-			var retBlgoList []interface{}
-			for iter := blogList.Front(); iter != nil; iter = iter.Next() {
-				blogInfo := iter.Value.(info.BlogInfo)
-				retBlogInfo := map[string]interface{}{
-					"id":   blogInfo.BlogID,
-					"name": blogInfo.BlogTitle,
-					"time": blogInfo.BlogTime,
-					"sort": blogInfo.BlogSortType,
-					"tag":  blogInfo.BlogTagList,
-				}
-				retBlgoList = append(retBlgoList, retBlogInfo)
-			}
-			response.JsonResponseWithData(w, framework.ErrorOK, "", retBlgoList)
-		default:
-			response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
-		}
-	} else {
-		response.JsonResponseWithMsg(w, framework.ErrorParamError, "param error")
+		p.fetchComment(w, info.CommentType_Blog, blogId, param)
+	case "plugin":
+		p.fetchPlugin(w, param)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
 	}
 }
@@ -1,6 +1,11 @@
 package personal
 
 import (
+	"blog/audit"
+	"blog/publish"
+	"blog/revision"
+	"blog/search"
+	"errors"
 	"fmt"
 	"framework"
 	"framework/base/archive"
@@ -8,6 +13,7 @@ import (
 	"framework/base/json"
 	"framework/response"
 	"framework/server"
+	"info"
 	"io"
 	"model"
 	"net/http"
@@ -103,6 +109,7 @@ func (f *FileController) checkFolder(path string) {
 ** 1. raw, 原始zip文件，包括所有的未经处理了的文件，服务端存储raw文件，用来供客户端下载恢复。
 ** 2. html, 经过处理的主要html文件。
 ** 3. meta信息, {"title": "xx", "tag": ["tag1", "tag2"], "sort": "xxx"}。
+**    可选的"status"为draft、scheduled或published(默认)，scheduled时需要"publish_at"，见publish.ParsePublishAt。
 ** 4. res, html中所需要的所有资源文件。
 ** 文件目录格式如下
 **	raw:
@@ -148,18 +155,51 @@ func (f *FileController) handlerBlogUploadRequest(w http.ResponseWriter, r *http
 	tag := blogMetaInfoReader.Get("tag").(string)
 	tagList := strings.Split(tag, "||")
 	sort := blogMetaInfoReader.Get("sort").(string)
+	status, _ := blogMetaInfoReader.Get("status").(string)
+	if status != "" && !publish.IsValidStatus(status) {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, publish.ErrInvalidStatus.Error())
+		return
+	}
+	publishAt, err := publish.ParsePublishAt(blogMetaInfoReader.Get("publish_at"))
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
 	isExist, err := model.ShareBlogModel().BlogIsExistByUUID(uuid)
 	if err != nil {
 		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
 		fmt.Println("insert uuid error: ", err.Error())
 		return
 	}
+	actor := auditActor(&f.SessionController, r)
+	action := "blog.upload"
+	var before interface{} = nil
+	if isExist {
+		action = "blog.update"
+		if blogInfo, err := model.ShareBlogModel().FetchBlogByUUID(uuid); err == nil {
+			before = blogSummary(blogInfo)
+		}
+	}
+	record := func(err error) {
+		recordBlogUpload(actor, action, uuid, before, err)
+	}
 	// 7. archive to path
 	rawRootPath := config.GetDefaultConfigJsonReader().Get("storage.file.raw").(string)
 	f.checkFolder(rawRootPath)
 	blogRootPath := config.GetDefaultConfigJsonReader().Get("storage.file.blog").(string)
 	blogRootPath = filepath.Join(blogRootPath, uuid)
 	f.checkFolder(blogRootPath)
+	// 覆盖之前先保存没有版本记录的旧博客，再清掉上一版的文件
+	if isExist {
+		if err = revision.EnsureBaseRevision(uuid); err != nil {
+			fmt.Println("save base revision error: ", err.Error())
+		}
+		if err = revision.ClearCurrent(uuid); err != nil {
+			record(err)
+			response.JsonResponseWithMsg(w, framework.ErrorRunTimeError, err.Error())
+			return
+		}
+	}
 
 	rawZipPath := filepath.Join(rawRootPath, uuid+".zip")
 	os.Rename(filepath.Join(saveTmpPath, rawZipName), rawZipPath)
@@ -179,6 +219,7 @@ func (f *FileController) handlerBlogUploadRequest(w http.ResponseWriter, r *http
 	// archive res zip to folder
 	err = archive.UnZip(resZipPath)
 	if err != nil {
+		record(err)
 		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
 		fmt.Println("unzip error: ", err.Error())
 		return
@@ -193,6 +234,21 @@ func (f *FileController) handlerBlogUploadRequest(w http.ResponseWriter, r *http
 		fmt.Println("insert blog")
 		model.ShareBlogModel().InsertBlog(uuid, title, sort, tagList)
 	}
+	// 设置发布状态，草稿和定时发布的博客不会出现在公开页面
+	if err = publish.SetStatusByUUID(uuid, status, publishAt); err != nil {
+		record(err)
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	record(nil)
+	// 保存本次上传的版本
+	if _, err = revision.Snapshot(uuid, ""); err != nil {
+		fmt.Println("save revision error: ", err.Error())
+	}
+	// 更新搜索索引
+	if err = search.IndexBlogByUUID(uuid); err != nil {
+		fmt.Println("index blog error: ", err.Error())
+	}
 	response.JsonResponse(w, framework.ErrorOK)
 }
 
@@ -207,12 +263,12 @@ func (f *FileController) handlerPluginUploadRequest(w http.ResponseWriter, r *ht
 	rawZipName := f.savePostFile(r, "raw", saveTmpPath)
 	rawZipFilePath := filepath.Join(saveTmpPath, rawZipName)
 
+	actor := auditActor(&f.SessionController, r)
 	completeChan := make(chan bool)
-	err := plugin.SharePluginMgrInstance().AddNewPlugin(rawZipFilePath,
+	// 编译在另一个goroutine里，开始之后才知道插件id
+	pluginIdChan := make(chan int, 1)
+	pluginId, stopped, err := plugin.SharePluginMgrInstance().AddNewPlugin(rawZipFilePath,
 		func(info string, err string, isComplete bool) {
-			if isComplete {
-				completeChan <- true
-			}
 			if info != "" {
 				fmt.Println("info: ", info)
 				w.Write([]byte(info))
@@ -221,18 +277,46 @@ func (f *FileController) handlerPluginUploadRequest(w http.ResponseWriter, r *ht
 				fmt.Println("err: ", err)
 				w.Write([]byte(err))
 			}
+			if isComplete {
+				var buildErr error = nil
+				if err != "" {
+					buildErr = errors.New(err)
+				}
+				actor.Record("plugin.build", audit.TargetPlugin, int64(<-pluginIdChan), nil, nil, buildErr)
+				completeChan <- true
+			}
 		})
+	if stopped {
+		actor.Record("plugin.stop", audit.TargetPlugin, int64(pluginId), "running", "stopped", nil)
+	}
+	actor.Record("plugin.install", audit.TargetPlugin, int64(pluginId), nil, pluginSummary(pluginId), err)
 	if err != nil {
 		fmt.Println("add plugin error: ", err)
 		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
 		return
 	}
+	pluginIdChan <- pluginId
 	<-completeChan
 }
 
+// 上传和下载博客、上传插件需要的令牌scope
+func fileRequestScope(r *http.Request) string {
+	if r.Method == "GET" {
+		return info.TokenScope_Read
+	}
+	if r.URL.Path == "/personal/plugin" {
+		return info.TokenScope_Plugins
+	}
+	return info.TokenScope_Publish
+}
+
 func (f *FileController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
 	f.SessionController.HandlerRequest(f, w, r)
 	fmt.Println("FileController.HandlerRequest")
+	if !isAuthorized(&f.SessionController, r, fileRequestScope(r)) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
 	switch r.Method {
 	case "POST":
 		if r.URL.Path == "/personal/blog" {
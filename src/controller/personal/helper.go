@@ -0,0 +1,137 @@
+package personal
+
+import (
+	"blog/apitoken"
+	"blog/audit"
+	"blog/permission"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"framework/server"
+	"info"
+	"io/ioutil"
+	"model"
+	"net/http"
+	"strings"
+)
+
+// 是否已经通过/personal/auth登录
+func isAuthSession(s *server.SessionController) bool {
+	status, err := s.WebSession.Get("status")
+	return err == nil && status == "auth"
+}
+
+// Authorization: Bearer <令牌>，没有带令牌时返回空
+func bearerToken(r *http.Request) string {
+	value := r.Header.Get("Authorization")
+	if len(value) < 7 || !strings.EqualFold(value[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(value[7:])
+}
+
+// 用主人密码登录的会话，或者带了有scope的API令牌
+func isAuthorized(s *server.SessionController, r *http.Request, scope string) bool {
+	if isAuthSession(s) {
+		return true
+	}
+	token := bearerToken(r)
+	if token == "" {
+		return false
+	}
+	ok, err := apitoken.Authorize(token, scope)
+	if err != nil {
+		fmt.Println("authorize token error: ", err)
+		return false
+	}
+	return ok
+}
+
+// 审计日志里的操作者：主人的会话、API令牌或者登录的admin、moderator
+func auditActor(s *server.SessionController, r *http.Request) *audit.Actor {
+	actor := &audit.Actor{Type: audit.ActorAnonymous, IP: server.ClientIP(r), UserAgent: r.UserAgent()}
+	if isAuthSession(s) {
+		actor.Type = audit.ActorOwner
+		return actor
+	}
+	if token := bearerToken(r); token != "" {
+		if tokenInfo, err := apitoken.Lookup(token); err == nil && tokenInfo != nil {
+			actor.Type = audit.ActorToken
+			actor.ID = tokenInfo.ID
+			actor.Name = tokenInfo.Name
+			return actor
+		}
+	}
+	if userId := s.LoginUserId(); userId > 0 {
+		actor.Type = audit.ActorUser
+		actor.ID = userId
+		if userInfo, err := model.ShareUserModel().GetUserInfoById(userId); err == nil && userInfo != nil {
+			actor.Name = userInfo.UserName
+		}
+	}
+	return actor
+}
+
+// 用主人密码登录的会话是owner，没有登录的是commenter
+func sessionRole(s *server.SessionController) string {
+	if isAuthSession(s) {
+		return info.Role_Owner
+	}
+	role, err := permission.Role(s.LoginUserId())
+	if err != nil {
+		return info.Role_Commenter
+	}
+	return role
+}
+
+// 管理接口的权限检查，主人密码登录的会话有所有权限
+func hasPermission(s *server.SessionController, permission string) bool {
+	return info.RoleHasPermission(sessionRole(s), permission)
+}
+
+func readJsonBody(r *http.Request) (map[string]interface{}, error) {
+	result, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var f interface{}
+	if err = json.Unmarshal(result, &f); err != nil {
+		return nil, err
+	}
+	if m, ok := f.(map[string]interface{}); ok {
+		return m, nil
+	}
+	return nil, errors.New("param error")
+}
+
+func parseStringList(value interface{}) []string {
+	var ret []string = nil
+	if l, ok := value.([]interface{}); ok {
+		for _, v := range l {
+			if s, ok := v.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+	}
+	return ret
+}
+
+func parseIntValue(m map[string]interface{}, name string, defaultValue int) int {
+	if v, ok := m[name].(float64); ok {
+		return int(v)
+	}
+	return defaultValue
+}
+
+func parseIntList(value interface{}) []int {
+	var ret []int = nil
+	if l, ok := value.([]interface{}); ok {
+		for _, v := range l {
+			if f, ok := v.(float64); ok && f > 0 {
+				ret = append(ret, int(f))
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,239 @@
+package personal
+
+import (
+	"blog/audit"
+	"blog/moderation"
+	"container/list"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+)
+
+const (
+	kDefaultModerationPageSize = 20
+	kMaxModerationPageSize     = 100
+)
+
+type PersonalModerationController struct {
+	server.SessionController
+}
+
+func NewPersonalModerationController() *PersonalModerationController {
+	return &PersonalModerationController{}
+}
+
+func (p *PersonalModerationController) Path() interface{} {
+	return "/personal/moderation"
+}
+
+func (p *PersonalModerationController) SessionPath() string {
+	return "/"
+}
+
+func (p *PersonalModerationController) listComment(w http.ResponseWriter, m map[string]interface{}) {
+	status, _ := m["status"].(string)
+	if status == "" {
+		status = info.CommentStatus_Pending
+	}
+	if !info.IsCommentStatus(status) {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport status")
+		return
+	}
+	page := parseIntValue(m, "page", 1)
+	limit := parseIntValue(m, "limit", kDefaultModerationPageSize)
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > kMaxModerationPageSize {
+		limit = kDefaultModerationPageSize
+	}
+	total, err := model.ShareCommentModel().FetchCommentCountByStatus(status)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	commentList, err := model.ShareCommentModel().FetchCommentListByStatus(status, (page-1)*limit, limit)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var retList []interface{} = []interface{}{}
+	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+		commentInfo := iter.Value.(info.CommentInfo)
+		retList = append(retList, map[string]interface{}{
+			"id":        commentInfo.CommentID,
+			"type":      commentInfo.Type,
+			"type_id":   commentInfo.TypeID,
+			"parent":    commentInfo.ParentCommentID,
+			"user_id":   commentInfo.UserID,
+			"content":   commentInfo.Content,
+			"time":      commentInfo.Time,
+			"status":    commentInfo.Status,
+			"edited_at": commentInfo.EditedAt,
+			"removed":   commentInfo.IsRemoved(),
+		})
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"total": total,
+		"page":  page,
+		"list":  retList,
+	})
+}
+
+func (p *PersonalModerationController) listHistory(w http.ResponseWriter, commentId int) {
+	if commentId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	historyList, err := model.ShareCommentHistoryModel().FetchCommentHistory(commentId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var retList []interface{} = []interface{}{}
+	for _, history := range historyList {
+		retList = append(retList, map[string]interface{}{
+			"id":      history.HistoryID,
+			"content": history.Content,
+			"time":    history.Time,
+		})
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", retList)
+}
+
+func settingToData(setting *info.CommentSettingInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"type":             setting.Type,
+		"type_id":          setting.TypeID,
+		"closed":           setting.Closed,
+		"require_login":    setting.RequireLogin,
+		"require_approval": setting.RequireApproval,
+	}
+}
+
+func (p *PersonalModerationController) handleSetting(w http.ResponseWriter, r *http.Request,
+	m map[string]interface{}, update bool) {
+	commentType := parseIntValue(m, "comment_type", info.CommentType_Blog)
+	typeId := parseIntValue(m, "type_id", 0)
+	if (commentType != info.CommentType_Blog && commentType != info.CommentType_Plugin) || typeId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no comment_type or type_id")
+		return
+	}
+	setting, err := model.ShareCommentSettingModel().FetchCommentSetting(commentType, typeId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	if update {
+		before := settingToData(setting)
+		// 没有传的字段保持原来的设置
+		if v, ok := m["closed"].(bool); ok {
+			setting.Closed = v
+		}
+		if v, ok := m["require_login"].(bool); ok {
+			setting.RequireLogin = v
+		}
+		if v, ok := m["require_approval"].(bool); ok {
+			setting.RequireApproval = v
+		}
+		err = model.ShareCommentSettingModel().SetCommentSetting(setting)
+		targetType := audit.TargetBlog
+		if commentType == info.CommentType_Plugin {
+			targetType = audit.TargetPlugin
+		}
+		auditActor(&p.SessionController, r).Record("comment.set_setting", targetType, int64(typeId), before,
+			settingToData(setting), err)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", settingToData(setting))
+}
+
+// 每条评论记一条日志，before是原来的状态
+func (p *PersonalModerationController) recordStatus(r *http.Request, actionType string, commentList *list.List,
+	status string, err error) {
+	if commentList == nil {
+		return
+	}
+	actor := auditActor(&p.SessionController, r)
+	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+		commentInfo := iter.Value.(info.CommentInfo)
+		actor.Record("comment."+actionType, audit.TargetComment, int64(commentInfo.CommentID),
+			commentSummary(&commentInfo), map[string]interface{}{"status": status}, err)
+	}
+}
+
+/* 评论审核和每篇博客(插件)的评论设置，json格式如下：
+** {"type": "list", "status": "pending", "page": 1, "limit": 20}，status默认是pending
+** {"type": "approve", "ids": [1, 2]}，批量通过，同时作为正常评论训练分类器
+** {"type": "reject", "ids": [1, 2]}，批量拒绝
+** {"type": "spam", "ids": [1, 2]}，批量标记为垃圾评论，同时作为垃圾评论训练分类器
+** {"type": "history", "id": 1}，评论的编辑历史
+** {"type": "setting", "comment_type": 0, "type_id": 1}，comment_type 0是博客，1是插件
+** {"type": "set_setting", "comment_type": 0, "type_id": 1, "closed": false, "require_login": true,
+**     "require_approval": true}
+ */
+func (p *PersonalModerationController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	// 除了主人，admin、moderator以及有moderate的令牌也可以审核
+	if !hasPermission(&p.SessionController, info.Permission_Moderate) &&
+		!isAuthorized(&p.SessionController, r, info.TokenScope_Moderate) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	actionType, _ := m["type"].(string)
+	var status string
+	switch actionType {
+	case "list":
+		p.listComment(w, m)
+		return
+	case "setting":
+		p.handleSetting(w, r, m, false)
+		return
+	case "set_setting":
+		p.handleSetting(w, r, m, true)
+		return
+	case "history":
+		p.listHistory(w, parseIntValue(m, "id", 0))
+		return
+	case "approve":
+		status = info.CommentStatus_Approved
+	case "reject":
+		status = info.CommentStatus_Rejected
+	case "spam":
+		status = info.CommentStatus_Spam
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+		return
+	}
+	idList := parseIntList(m["ids"])
+	if len(idList) == 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no ids")
+		return
+	}
+	// 改状态之前的评论，给审计日志用
+	commentList, _ := model.ShareCommentModel().FetchAnyCommentListByIdList(idList)
+	count, err := moderation.SetStatus(idList, status)
+	p.recordStatus(r, actionType, commentList, status, err)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{"count": count})
+}
@@ -0,0 +1,111 @@
+package personal
+
+import (
+	"blog/audit"
+	"blog/publish"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+)
+
+type PersonalPublishController struct {
+	server.SessionController
+}
+
+func NewPersonalPublishController() *PersonalPublishController {
+	return &PersonalPublishController{}
+}
+
+func (p *PersonalPublishController) Path() interface{} {
+	return "/personal/publish"
+}
+
+func (p *PersonalPublishController) SessionPath() string {
+	return "/"
+}
+
+func (p *PersonalPublishController) responsePreview(w http.ResponseWriter, blogId int) {
+	blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	if blogInfo == nil {
+		response.JsonResponseWithMsg(w, framework.ErrorBlogNotExist, "no such blog")
+		return
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"id":         blogInfo.BlogID,
+		"status":     blogInfo.BlogStatus,
+		"publish_at": blogInfo.BlogPublishAt,
+		"preview":    publish.PreviewURL(blogInfo),
+	})
+}
+
+/* 博客发布状态，json格式如下：
+** {"type": "publish", "id": 1}，立即发布
+** {"type": "draft", "id": 1}，改回草稿
+** {"type": "schedule", "id": 1, "publish_at": "2017-04-01 08:00"}，也可以是unix时间戳
+** {"type": "preview", "id": 1}，返回当前状态和预览链接
+** {"type": "reset_preview", "id": 1}，重新生成预览链接，旧的链接失效
+ */
+func (p *PersonalPublishController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthorized(&p.SessionController, r, info.TokenScope_Publish) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	blogId := parseIntValue(m, "id", 0)
+	if blogId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	actionType, _ := m["type"].(string)
+	before, _ := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+	switch actionType {
+	case "publish":
+		err = publish.Publish(blogId)
+	case "draft":
+		err = publish.SetStatus(blogId, info.BlogStatus_Draft, 0)
+	case "schedule":
+		var publishAt int64
+		publishAt, err = publish.ParsePublishAt(m["publish_at"])
+		if err == nil && publishAt <= 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no publish_at")
+			return
+		}
+		if err == nil {
+			err = publish.SetStatus(blogId, info.BlogStatus_Scheduled, publishAt)
+		}
+	case "preview":
+	case "reset_preview":
+		_, err = model.ShareBlogModel().ResetBlogPreviewKey(blogId)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+		return
+	}
+	if actionType != "preview" {
+		after, _ := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+		auditActor(&p.SessionController, r).Record("blog."+actionType, audit.TargetBlog, int64(blogId),
+			blogSummary(before), blogSummary(after), err)
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	p.responsePreview(w, blogId)
+}
@@ -0,0 +1,136 @@
+package personal
+
+import (
+	"blog/audit"
+	"blog/revision"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+)
+
+type PersonalRevisionController struct {
+	server.SessionController
+}
+
+func NewPersonalRevisionController() *PersonalRevisionController {
+	return &PersonalRevisionController{}
+}
+
+func (p *PersonalRevisionController) Path() interface{} {
+	return "/personal/revision"
+}
+
+func (p *PersonalRevisionController) SessionPath() string {
+	return "/"
+}
+
+func (p *PersonalRevisionController) listRevision(w http.ResponseWriter, blogId int) {
+	revisionList, err := revision.List(blogId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var retList []interface{} = []interface{}{}
+	for _, revisionInfo := range revisionList {
+		var tagList []interface{} = []interface{}{}
+		for _, tag := range revisionInfo.TagList {
+			tagList = append(tagList, tag)
+		}
+		retList = append(retList, map[string]interface{}{
+			"revision": revisionInfo.Revision,
+			"title":    revisionInfo.Title,
+			"sort":     revisionInfo.SortType,
+			"tag":      tagList,
+			"time":     revisionInfo.Time,
+			"note":     revisionInfo.Note,
+		})
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", retList)
+}
+
+func (p *PersonalRevisionController) diffRevision(w http.ResponseWriter, blogId int, from int, to int) {
+	lines, unified, err := revision.Diff(blogId, from, to)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	var lineList []interface{} = []interface{}{}
+	for _, line := range lines {
+		lineList = append(lineList, map[string]interface{}{
+			"op":   line.Op.String(),
+			"text": line.Text,
+			"old":  line.OldNumber,
+			"new":  line.NewNumber,
+		})
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"unified": unified,
+		"lines":   lineList,
+	})
+}
+
+/* 博客历史版本，json格式如下：
+** {"type": "list", "id": 1}
+** {"type": "diff", "id": 1, "from": 1, "to": 2}，返回逐行结果和unified格式的文本
+** {"type": "rollback", "id": 1, "revision": 1}，回滚后生成一个新版本，返回新版本号
+ */
+func (p *PersonalRevisionController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthorized(&p.SessionController, r, info.TokenScope_Publish) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	blogId := parseIntValue(m, "id", 0)
+	if blogId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	actionType, _ := m["type"].(string)
+	switch actionType {
+	case "list":
+		p.listRevision(w, blogId)
+	case "diff":
+		from := parseIntValue(m, "from", 0)
+		to := parseIntValue(m, "to", 0)
+		if from <= 0 || to <= 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no from or to")
+			return
+		}
+		p.diffRevision(w, blogId, from, to)
+	case "rollback":
+		target := parseIntValue(m, "revision", 0)
+		if target <= 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no revision")
+			return
+		}
+		before, _ := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+		newRevision, err := revision.Rollback(blogId, target)
+		after, _ := model.ShareBlogModel().FetchBlogByBlogID(blogId)
+		auditActor(&p.SessionController, r).Record("blog.rollback", audit.TargetBlog, int64(blogId),
+			blogSummary(before), map[string]interface{}{"revision": target, "new_revision": newRevision,
+				"blog": blogSummary(after)}, err)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+			return
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+			"revision": newRevision,
+		})
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+	}
+}
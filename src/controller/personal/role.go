@@ -0,0 +1,159 @@
+package personal
+
+import (
+	"blog/audit"
+	"blog/permission"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+	"time"
+)
+
+type PersonalRoleController struct {
+	server.SessionController
+}
+
+func NewPersonalRoleController() *PersonalRoleController {
+	return &PersonalRoleController{}
+}
+
+func (p *PersonalRoleController) Path() interface{} {
+	return "/personal/role"
+}
+
+func (p *PersonalRoleController) SessionPath() string {
+	return "/"
+}
+
+// 管理员和被封禁的用户，带上昵称和头像
+func (p *PersonalRoleController) listRole(w http.ResponseWriter) {
+	roleInfoList, err := model.ShareUserModel().FetchRoleInfoList([]string{info.Role_Admin, info.Role_Moderator,
+		info.Role_Banned})
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var userIdList []int64 = nil
+	for _, roleInfo := range roleInfoList {
+		userIdList = append(userIdList, roleInfo.UserID)
+	}
+	userMap, err := model.ShareUserModel().FetchUserInfoMap(userIdList)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	now := time.Now().Unix()
+	var retList []interface{} = []interface{}{}
+	for _, roleInfo := range roleInfoList {
+		role := roleInfo.EffectiveRole(now)
+		if role == info.Role_Commenter {
+			continue
+		}
+		data := map[string]interface{}{
+			"user_id":      roleInfo.UserID,
+			"role":         role,
+			"banned_until": roleInfo.BannedUntil,
+			"name":         "",
+			"pic":          "",
+		}
+		if userInfo, ok := userMap[roleInfo.UserID]; ok {
+			data["name"] = userInfo.UserName
+			data["pic"] = userInfo.SmallFigureurl
+		}
+		retList = append(retList, data)
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", retList)
+}
+
+func permissionErrorCode(err error) int {
+	switch err {
+	case permission.ErrPermissionDenied:
+		return framework.ErrorAccountAuthError
+	case permission.ErrNoSuchUser, permission.ErrInvalidRole:
+		return framework.ErrorParamError
+	}
+	return framework.ErrorSQLError
+}
+
+/* 用户角色管理，只认会话里的角色，API令牌不能用，json格式如下：
+** {"type": "list"}，列出admin、moderator和被封禁的用户
+** {"type": "role", "user_id": 1}，查询用户的角色
+** {"type": "promote", "user_id": 1, "role": "moderator"}，只有主人可以，role可以是admin、moderator
+** {"type": "demote", "user_id": 1}，降回commenter，只有主人可以
+** {"type": "ban", "user_id": 1, "hours": 24}，主人和admin可以封禁比自己角色低的用户，hours为0表示永久
+** {"type": "unban", "user_id": 1}
+ */
+func (p *PersonalRoleController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	actorRole := sessionRole(&p.SessionController)
+	if !info.RoleHasPermission(actorRole, info.Permission_Ban) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	actionType, _ := m["type"].(string)
+	if actionType == "list" {
+		p.listRole(w)
+		return
+	}
+	userId := int64(parseIntValue(m, "user_id", 0))
+	if userId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no user_id")
+		return
+	}
+	switch actionType {
+	case "role":
+		roleInfo, err := permission.FetchRole(userId)
+		if err != nil {
+			response.JsonResponseWithMsg(w, permissionErrorCode(err), err.Error())
+			return
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+			"user_id":      userId,
+			"role":         roleInfo.Role,
+			"banned_until": roleInfo.BannedUntil,
+		})
+		return
+	}
+	before, _ := permission.FetchRole(userId)
+	switch actionType {
+	case "promote":
+		role, _ := m["role"].(string)
+		err = permission.SetRole(actorRole, userId, role)
+	case "demote":
+		err = permission.SetRole(actorRole, userId, info.Role_Commenter)
+	case "ban":
+		hours := parseIntValue(m, "hours", 0)
+		if hours < 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "invalid hours")
+			return
+		}
+		err = permission.Ban(actorRole, userId, time.Duration(hours)*time.Hour)
+	case "unban":
+		err = permission.Unban(actorRole, userId)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+		return
+	}
+	after, _ := permission.FetchRole(userId)
+	auditActor(&p.SessionController, r).Record("user."+actionType, audit.TargetUser, userId, roleSummary(before),
+		roleSummary(after), err)
+	if err != nil {
+		response.JsonResponseWithMsg(w, permissionErrorCode(err), err.Error())
+		return
+	}
+	response.JsonResponse(w, framework.ErrorOK)
+}
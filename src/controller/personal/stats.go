@@ -0,0 +1,293 @@
+package personal
+
+import (
+	"blog/audit"
+	"blog/visit"
+	"fmt"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"html/template"
+	"info"
+	"model"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	kDefaultStatsDays = 30
+	kMaxStatsDays     = 365
+	kStatsTopCount    = 10
+	kStatsSourceCount = 20
+)
+
+type PersonalStatsController struct {
+	server.SessionController
+}
+
+func NewPersonalStatsController() *PersonalStatsController {
+	return &PersonalStatsController{}
+}
+
+func (p *PersonalStatsController) Path() interface{} {
+	return "/personal/stats"
+}
+
+func (p *PersonalStatsController) SessionPath() string {
+	return "/"
+}
+
+// 最近days天，包括今天
+func statsDayRange(days int) (time.Time, int, int) {
+	if days <= 0 {
+		days = kDefaultStatsDays
+	}
+	if days > kMaxStatsDays {
+		days = kMaxStatsDays
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	begin := today.AddDate(0, 0, 1-days)
+	return begin, visit.DayOf(begin), visit.DayOf(today)
+}
+
+func sourceListToData(sourceList []*info.VisitSourceInfo) []interface{} {
+	var retList []interface{} = []interface{}{}
+	for _, source := range sourceList {
+		retList = append(retList, map[string]interface{}{
+			"value": source.Value,
+			"count": source.Count,
+		})
+	}
+	return retList
+}
+
+func statToData(stat *info.VisitStatInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"day":       stat.Day,
+		"page_view": stat.PageView,
+		"visitor":   stat.Visitor,
+		"entry":     stat.Entry,
+	}
+}
+
+// 访问量最多的博客或者插件，带上标题
+func topTargetsData(targetType string, beginDay int, endDay int, orderBy string) ([]interface{}, error) {
+	statList, err := model.ShareVisitModel().FetchTopVisitTargets(targetType, beginDay, endDay, orderBy,
+		kStatsTopCount)
+	if err != nil {
+		return nil, err
+	}
+	var retList []interface{} = []interface{}{}
+	for _, stat := range statList {
+		data := statToData(stat)
+		delete(data, "day")
+		data["id"] = stat.TargetID
+		data["title"] = ""
+		if targetType == info.VisitTarget_Blog {
+			if blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(stat.TargetID); err == nil && blogInfo != nil {
+				data["title"] = blogInfo.BlogTitle
+			}
+		} else if pluginInfo, err := model.SharePluginModel().FetchPluginByPluginID(stat.TargetID); err == nil &&
+			pluginInfo != nil {
+			data["title"] = pluginInfo.PluginName
+		}
+		retList = append(retList, data)
+	}
+	return retList, nil
+}
+
+/* 每天的访问量、评论数和投票数，没有数据的日期补0。
+** targetType为空时统计全站，评论和投票只在统计全站时返回。
+ */
+func dailyData(targetType string, targetId int, begin time.Time, beginDay int,
+	endDay int) ([]interface{}, error) {
+	var dayMap map[int]map[string]interface{} = make(map[int]map[string]interface{})
+	var retList []interface{} = []interface{}{}
+	for t := begin; visit.DayOf(t) <= endDay; t = t.AddDate(0, 0, 1) {
+		data := statToData(&info.VisitStatInfo{Day: visit.DayOf(t)})
+		if targetType == "" {
+			data["comment"] = 0
+			data["praise"] = 0
+			data["dissent"] = 0
+		}
+		dayMap[visit.DayOf(t)] = data
+		retList = append(retList, data)
+	}
+	var statList []*info.VisitStatInfo
+	var err error
+	if targetId > 0 {
+		statList, err = model.ShareVisitModel().FetchVisitStatList(targetType, targetId, beginDay, endDay)
+	} else {
+		statList, err = model.ShareVisitModel().FetchDailyVisitTotal(targetType, 0, beginDay, endDay)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, stat := range statList {
+		if data, ok := dayMap[stat.Day]; ok {
+			data["page_view"] = stat.PageView
+			data["visitor"] = stat.Visitor
+			data["entry"] = stat.Entry
+		}
+	}
+	if targetType != "" {
+		return retList, nil
+	}
+	endTime := begin.AddDate(0, 0, len(retList)).Unix()
+	commentList, err := model.ShareCommentModel().FetchDailyCommentCount(begin.Unix(), endTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range commentList {
+		if data, ok := dayMap[count.Day]; ok {
+			data["comment"] = count.Count
+		}
+	}
+	voteList, err := model.ShareVoteModel().FetchDailyVoteCount(begin.Unix(), endTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range voteList {
+		if data, ok := dayMap[count.Day]; ok {
+			data["praise"] = count.Up
+			data["dissent"] = count.Down
+		}
+	}
+	return retList, nil
+}
+
+func sourcesData(targetType string, targetId int, beginDay int, endDay int) (map[string]interface{}, error) {
+	referrerList, err := model.ShareVisitModel().FetchTopVisitSources(info.VisitSource_Referrer, targetType,
+		targetId, beginDay, endDay, kStatsSourceCount)
+	if err != nil {
+		return nil, err
+	}
+	termList, err := model.ShareVisitModel().FetchTopVisitSources(info.VisitSource_Term, targetType,
+		targetId, beginDay, endDay, kStatsSourceCount)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"referrer": sourceListToData(referrerList),
+		"term":     sourceListToData(termList),
+	}, nil
+}
+
+// 全站概况
+func overviewData(days int) (map[string]interface{}, error) {
+	begin, beginDay, endDay := statsDayRange(days)
+	daily, err := dailyData("", 0, begin, beginDay, endDay)
+	if err != nil {
+		return nil, err
+	}
+	data, err := sourcesData("", 0, beginDay, endDay)
+	if err != nil {
+		return nil, err
+	}
+	data["days"] = len(daily)
+	data["daily"] = daily
+	for key, value := range map[string][]string{
+		"top_blog":   []string{info.VisitTarget_Blog, "page_view"},
+		"top_entry":  []string{info.VisitTarget_Blog, "entry"},
+		"top_plugin": []string{info.VisitTarget_Plugin, "page_view"},
+	} {
+		if data[key], err = topTargetsData(value[0], beginDay, endDay, value[1]); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// 某篇博客或者某个插件的访问趋势和来源
+func targetData(targetType string, targetId int, days int) (map[string]interface{}, error) {
+	begin, beginDay, endDay := statsDayRange(days)
+	daily, err := dailyData(targetType, targetId, begin, beginDay, endDay)
+	if err != nil {
+		return nil, err
+	}
+	data, err := sourcesData(targetType, targetId, beginDay, endDay)
+	if err != nil {
+		return nil, err
+	}
+	data["days"] = len(daily)
+	data["daily"] = daily
+	return data, nil
+}
+
+/* 访问统计，只有主人可以看。
+** GET /personal/stats?days=30，统计页面；
+** POST json格式如下：
+** {"type": "overview", "days": 30}，全站每天的访问、评论、投票，热门博客、入口页、来源和搜索词
+** {"type": "target", "target": "blog", "id": 1, "days": 30}，某篇博客(插件)每天的访问和来源
+** {"type": "rollup"}，立即汇总访问来源，不等定时任务
+ */
+func (p *PersonalStatsController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthorized(&p.SessionController, r, info.TokenScope_Read) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	if r.Method == "GET" {
+		days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+		data, err := overviewData(days)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		t, err := template.ParseFiles("./src/view/html/stats.html")
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorRenderError, err.Error())
+			return
+		}
+		if err = t.Execute(w, data); err != nil {
+			fmt.Println("execute error: ", err)
+		}
+		return
+	}
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	days := parseIntValue(m, "days", kDefaultStatsDays)
+	var data map[string]interface{}
+	actionType, _ := m["type"].(string)
+	switch actionType {
+	case "overview":
+		data, err = overviewData(days)
+	case "target":
+		targetType, _ := m["target"].(string)
+		if targetType != info.VisitTarget_Blog && targetType != info.VisitTarget_Plugin {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport target")
+			return
+		}
+		targetId := parseIntValue(m, "id", 0)
+		if targetId <= 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+			return
+		}
+		data, err = targetData(targetType, targetId, days)
+	case "rollup":
+		var count int
+		count, err = visit.Rollup()
+		data = map[string]interface{}{"count": count}
+		auditActor(&p.SessionController, r).Record("stats.rollup", audit.TargetStats, 0, nil, data, err)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+		return
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", data)
+}
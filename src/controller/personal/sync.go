@@ -1,12 +1,15 @@
 package personal
 
 import (
+	"blog/publish"
+	"blog/revision"
 	"encoding/json"
 	"fmt"
 	"framework"
 	"framework/base/archive"
 	"framework/base/config"
 	"framework/response"
+	"framework/server"
 	"info"
 	"io/ioutil"
 	"model"
@@ -21,6 +24,7 @@ type BlogMap struct {
 }
 
 type SyncController struct {
+	server.SessionController
 }
 
 func NewSyncController() *SyncController {
@@ -31,8 +35,12 @@ func (s *SyncController) Path() interface{} {
 	return "/personal/sync"
 }
 
+func (s *SyncController) SessionPath() string {
+	return "/"
+}
+
 func (s *SyncController) listAllBlog(w http.ResponseWriter) {
-	blogList, err := model.ShareBlogModel().FetchAllBlog()
+	blogList, err := model.ShareBlogModel().FetchAllOwnerBlog()
 	if err != nil {
 		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
 	}
@@ -66,37 +74,88 @@ func (s *SyncController) uploadBlog(w http.ResponseWriter, r *http.Request) {
 	tag := r.MultipartForm.Value["tag"][0]
 	tagList := strings.Split(tag, "||")
 	imgContent := r.MultipartForm.Value["img"][0]
+	// 可选的发布状态和发布时间，和/personal/blog上传的meta信息一致
+	var status, publishTime string
+	if v := r.MultipartForm.Value["status"]; len(v) > 0 {
+		status = v[0]
+	}
+	if v := r.MultipartForm.Value["publish_at"]; len(v) > 0 {
+		publishTime = v[0]
+	}
+	if status != "" && !publish.IsValidStatus(status) {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, publish.ErrInvalidStatus.Error())
+		return
+	}
+	publishAt, err := publish.ParsePublishAt(publishTime)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
 
-	blogStorageFilePath := config.GetDefaultConfigJsonReader().Get("blog.storage.file.blog").(string)
+	blogStorageFilePath := config.GetDefaultConfigJsonReader().Get("storage.file.blog").(string)
 	imgStorageFilePath := config.GetDefaultConfigJsonReader().Get("blog.storage.file.img").(string)
 
 	blogStorageFilePath = filepath.Join(blogStorageFilePath, uuid)
 	fmt.Println("blogStorageFilePath: ", blogStorageFilePath)
-	// unarchive
-	archive.ArchiveBufferUnderPath(fileContent, blogStorageFilePath)
-
-	archive.ArchiveBufferToPath(imgContent, imgStorageFilePath)
-	// insert blog
 	isExist, err := model.ShareBlogModel().BlogIsExistByUUID(uuid)
-	if err == nil {
-		if !isExist {
-			if model.ShareBlogModel().InsertBlog(uuid, title, sort, tagList) == nil {
-				response.JsonResponse(w, framework.ErrorOK)
-				return
-			}
-		} else {
-			response.JsonResponse(w, framework.ErrorBlogExist)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	actor := auditActor(&s.SessionController, r)
+	action := "blog.upload"
+	var before interface{} = nil
+	// 和/personal/blog一样，覆盖之前先保存旧版本，再清掉上一版的文件
+	if isExist {
+		action = "blog.update"
+		if blogInfo, err := model.ShareBlogModel().FetchBlogByUUID(uuid); err == nil {
+			before = blogSummary(blogInfo)
+		}
+		if err = revision.EnsureBaseRevision(uuid); err != nil {
+			fmt.Println("save base revision error: ", err.Error())
+		}
+		if err = revision.ClearCurrent(uuid); err != nil {
+			recordBlogUpload(actor, action, uuid, before, err)
+			response.JsonResponseWithMsg(w, framework.ErrorRunTimeError, err.Error())
 			return
 		}
 	}
-	response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+	// unarchive
+	if err = archive.ArchiveBufferUnderPath(fileContent, blogStorageFilePath); err == nil {
+		err = archive.ArchiveBufferToPath(imgContent, imgStorageFilePath)
+	}
+	if err != nil {
+		recordBlogUpload(actor, action, uuid, before, err)
+		response.JsonResponseWithMsg(w, framework.ErrorRunTimeError, err.Error())
+		return
+	}
+	if isExist {
+		err = model.ShareBlogModel().UpdateBlog(uuid, title, sort, tagList)
+	} else {
+		err = model.ShareBlogModel().InsertBlog(uuid, title, sort, tagList)
+	}
+	if err == nil {
+		err = publish.SetStatusByUUID(uuid, status, publishAt)
+	}
+	recordBlogUpload(actor, action, uuid, before, err)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	// 保存本次上传的版本
+	if _, err = revision.Snapshot(uuid, ""); err != nil {
+		fmt.Println("save revision error: ", err.Error())
+	}
+	response.JsonResponse(w, framework.ErrorOK)
 }
 
+// 列表需要read，上传需要publish
 func (s *SyncController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		response.JsonResponse(w, framework.ErrorMethodError)
 		return
 	}
+	s.SessionController.HandlerRequest(s, w, r)
 	contentType := r.Header.Get("Content-Type")
 	if strings.Index(contentType, "application/json") != -1 {
 		// post json
@@ -110,12 +169,16 @@ func (s *SyncController) HandlerRequest(w http.ResponseWriter, r *http.Request)
 		json.Unmarshal(result, &f)
 		switch f.(type) {
 		case map[string]interface{}:
-			info := f.(map[string]interface{})
-			if api, ok := info["type"]; ok {
+			param := f.(map[string]interface{})
+			if api, ok := param["type"]; ok {
 				switch api.(type) {
 				case string:
 					switch api.(string) {
 					case "list":
+						if !isAuthorized(&s.SessionController, r, info.TokenScope_Read) {
+							response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+							return
+						}
 						s.listAllBlog(w)
 						return
 					}
@@ -125,7 +188,12 @@ func (s *SyncController) HandlerRequest(w http.ResponseWriter, r *http.Request)
 	} else if strings.Index(contentType, "multipart/form-data") != -1 {
 		// port form data
 		fmt.Println("upload Blog")
+		if !isAuthorized(&s.SessionController, r, info.TokenScope_Publish) {
+			response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+			return
+		}
 		s.uploadBlog(w, r)
+		return
 	}
 	response.JsonResponse(w, framework.ErrorParamError)
 }
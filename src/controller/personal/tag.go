@@ -0,0 +1,128 @@
+package personal
+
+import (
+	"blog/audit"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+)
+
+type PersonalTagController struct {
+	server.SessionController
+}
+
+func NewPersonalTagController() *PersonalTagController {
+	return &PersonalTagController{}
+}
+
+func (p *PersonalTagController) Path() interface{} {
+	return "/personal/tag"
+}
+
+func (p *PersonalTagController) SessionPath() string {
+	return "/"
+}
+
+func (p *PersonalTagController) listAllTag(w http.ResponseWriter) {
+	tagList, err := model.ShareTagModel().FetchAllTag()
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	var retTagList []interface{} = []interface{}{}
+	for _, tag := range tagList {
+		retTagList = append(retTagList, map[string]interface{}{
+			"id":          tag.TagID,
+			"name":        tag.TagName,
+			"description": tag.TagDescription,
+			"time":        tag.TagTime,
+			"count":       tag.TagBlogCount,
+		})
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", retTagList)
+}
+
+/* 标签管理，json格式如下：
+** {"type": "list"}
+** {"type": "rename", "name": "old", "newName": "new"}
+** {"type": "merge", "from": ["tag1", "tag2"], "to": "tag"}
+** {"type": "delete", "name": "tag"}
+** {"type": "describe", "name": "tag", "description": "xxx"}
+ */
+func (p *PersonalTagController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthorized(&p.SessionController, r, info.TokenScope_Publish) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	actionType, _ := m["type"].(string)
+	name, _ := m["name"].(string)
+	if actionType == "list" {
+		p.listAllTag(w)
+		return
+	}
+	// 合并时对象是合并到的标签
+	targetName := name
+	if actionType == "merge" {
+		targetName, _ = m["to"].(string)
+	}
+	tagInfo, _ := model.ShareTagModel().FetchTagByName(targetName)
+	switch actionType {
+	case "rename":
+		newName, _ := m["newName"].(string)
+		if name == "" || newName == "" {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no name")
+			return
+		}
+		err = model.ShareTagModel().RenameTag(name, newName)
+	case "merge":
+		from := parseStringList(m["from"])
+		to, _ := m["to"].(string)
+		if len(from) == 0 || to == "" {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no from or to")
+			return
+		}
+		err = model.ShareTagModel().MergeTag(from, to)
+	case "delete":
+		if name == "" {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no name")
+			return
+		}
+		err = model.ShareTagModel().DeleteTag(name)
+	case "describe":
+		description, _ := m["description"].(string)
+		if name == "" {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no name")
+			return
+		}
+		err = model.ShareTagModel().UpdateTagDescription(name, description)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+		return
+	}
+	var tagId int64 = 0
+	if tagInfo != nil {
+		tagId = int64(tagInfo.TagID)
+	}
+	auditActor(&p.SessionController, r).Record("tag."+actionType, audit.TargetTag, tagId, tagSummary(tagInfo),
+		paramSummary(m), err)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	response.JsonResponse(w, framework.ErrorOK)
+}
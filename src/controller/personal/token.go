@@ -0,0 +1,132 @@
+package personal
+
+import (
+	"blog/apitoken"
+	"blog/audit"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"net/http"
+	"time"
+)
+
+type PersonalTokenController struct {
+	server.SessionController
+}
+
+func NewPersonalTokenController() *PersonalTokenController {
+	return &PersonalTokenController{}
+}
+
+func (p *PersonalTokenController) Path() interface{} {
+	return "/personal/token"
+}
+
+func (p *PersonalTokenController) SessionPath() string {
+	return "/"
+}
+
+func tokenInfoToData(tokenInfo *info.APITokenInfo) map[string]interface{} {
+	scopes := tokenInfo.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return map[string]interface{}{
+		"id":          tokenInfo.ID,
+		"name":        tokenInfo.Name,
+		"prefix":      tokenInfo.Prefix,
+		"scopes":      scopes,
+		"create_time": tokenInfo.CreateTime,
+		"expire_at":   tokenInfo.ExpireAt,
+		"last_used":   tokenInfo.LastUsed,
+		"revoked_at":  tokenInfo.RevokedAt,
+	}
+}
+
+func apiTokenErrorCode(err error) int {
+	switch err {
+	case apitoken.ErrInvalidName, apitoken.ErrInvalidScope, apitoken.ErrNoSuchToken:
+		return framework.ErrorParamError
+	}
+	return framework.ErrorSQLError
+}
+
+/* API令牌管理，只有用主人密码登录的会话可以用，令牌本身不能签发令牌，json格式如下：
+** {"type": "list"}，所有令牌，包括已经撤销的
+** {"type": "create", "name": "桌面客户端", "scopes": ["read", "publish"], "days": 90}，
+**   scopes可以是read、publish、delete、plugins、moderate，days为0表示不过期，返回的token只显示这一次
+** {"type": "revoke", "id": 1}
+** 调用其他/personal接口时带上 Authorization: Bearer <token>
+ */
+func (p *PersonalTokenController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthSession(&p.SessionController) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	actionType, _ := m["type"].(string)
+	switch actionType {
+	case "list":
+		tokenList, err := apitoken.List()
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		var retList []interface{} = []interface{}{}
+		for _, tokenInfo := range tokenList {
+			retList = append(retList, tokenInfoToData(tokenInfo))
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", retList)
+	case "create":
+		name, _ := m["name"].(string)
+		days := parseIntValue(m, "days", 0)
+		if days < 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "invalid days")
+			return
+		}
+		token, tokenInfo, err := apitoken.Issue(name, parseStringList(m["scopes"]),
+			time.Duration(days)*24*time.Hour)
+		// 明文令牌不能进日志
+		var tokenId int64 = 0
+		var after interface{} = paramSummary(m)
+		if tokenInfo != nil {
+			tokenId = tokenInfo.ID
+			after = tokenInfoToData(tokenInfo)
+		}
+		auditActor(&p.SessionController, r).Record("token.issue", audit.TargetToken, tokenId, nil, after, err)
+		if err != nil {
+			response.JsonResponseWithMsg(w, apiTokenErrorCode(err), err.Error())
+			return
+		}
+		data := tokenInfoToData(tokenInfo)
+		data["token"] = token
+		response.JsonResponseWithData(w, framework.ErrorOK, "", data)
+	case "revoke":
+		id := parseIntValue(m, "id", 0)
+		if id <= 0 {
+			response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+			return
+		}
+		err = apitoken.Revoke(int64(id))
+		auditActor(&p.SessionController, r).Record("token.revoke", audit.TargetToken, int64(id), nil, nil, err)
+		if err != nil {
+			response.JsonResponseWithMsg(w, apiTokenErrorCode(err), err.Error())
+			return
+		}
+		response.JsonResponse(w, framework.ErrorOK)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+	}
+}
@@ -0,0 +1,108 @@
+package personal
+
+import (
+	"blog/audit"
+	"blog/owner"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"net/http"
+)
+
+type PersonalTOTPController struct {
+	server.SessionController
+}
+
+func NewPersonalTOTPController() *PersonalTOTPController {
+	return &PersonalTOTPController{}
+}
+
+func (p *PersonalTOTPController) Path() interface{} {
+	return "/personal/totp"
+}
+
+func (p *PersonalTOTPController) SessionPath() string {
+	return "/"
+}
+
+/* 两步验证设置，只有用主人密码登录的会话可以用，json格式如下：
+** {"type": "status"}，返回是否开启以及剩下的恢复码个数
+** {"type": "setup"}，生成新的密钥，返回secret和uri，uri是otpauth://链接，画成二维码给应用扫描
+** {"type": "enable", "code": "123456"}，用应用里的code确认开启，返回recovery_codes，只显示这一次
+** {"type": "disable", "code": "code或者恢复码"}
+** {"type": "recoveryCodes", "code": "code或者恢复码"}，重新生成恢复码，原来的全部作废
+ */
+func (p *PersonalTOTPController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthSession(&p.SessionController) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	actionType, _ := m["type"].(string)
+	code, _ := m["code"].(string)
+	actor := auditActor(&p.SessionController, r)
+	switch actionType {
+	case "status":
+		enabled, count, err := owner.TOTPStatus()
+		if err != nil {
+			ownerAuthError(w, err)
+			return
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+			"enabled":        enabled,
+			"recovery_count": count,
+		})
+	case "setup":
+		secret, uri, err := owner.SetupTOTP()
+		actor.Record("owner.totp_setup", audit.TargetOwner, 0, nil, nil, err)
+		if err != nil {
+			ownerAuthError(w, err)
+			return
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+			"secret": secret,
+			"uri":    uri,
+		})
+	case "enable", "recoveryCodes":
+		var codeList []string
+		if actionType == "enable" {
+			codeList, err = owner.EnableTOTP(code)
+		} else {
+			codeList, err = owner.RegenerateRecoveryCodes(code)
+		}
+		// 恢复码和密钥都不能进日志
+		if actionType == "enable" {
+			actor.Record("owner.totp_enable", audit.TargetOwner, 0, nil, nil, err)
+		} else {
+			actor.Record("owner.recovery_codes", audit.TargetOwner, 0, nil, nil, err)
+		}
+		if err != nil {
+			ownerAuthError(w, err)
+			return
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+			"recovery_codes": codeList,
+		})
+	case "disable":
+		err = owner.DisableTOTP(code)
+		actor.Record("owner.totp_disable", audit.TargetOwner, 0, nil, nil, err)
+		if err != nil {
+			ownerAuthError(w, err)
+			return
+		}
+		response.JsonResponse(w, framework.ErrorOK)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+	}
+}
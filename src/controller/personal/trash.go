@@ -0,0 +1,128 @@
+package personal
+
+import (
+	"blog/trash"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+)
+
+type PersonalTrashController struct {
+	server.SessionController
+}
+
+func NewPersonalTrashController() *PersonalTrashController {
+	return &PersonalTrashController{}
+}
+
+func (p *PersonalTrashController) Path() interface{} {
+	return "/personal/trash"
+}
+
+func (p *PersonalTrashController) SessionPath() string {
+	return "/"
+}
+
+func (p *PersonalTrashController) listTrash(w http.ResponseWriter) {
+	var retList []interface{} = []interface{}{}
+	blogList, err := model.ShareBlogModel().FetchTrashBlogList()
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	for iter := blogList.Front(); iter != nil; iter = iter.Next() {
+		blogInfo := iter.Value.(info.BlogInfo)
+		retList = append(retList, map[string]interface{}{
+			"kind":       trash.KindBlog,
+			"id":         blogInfo.BlogID,
+			"name":       blogInfo.BlogTitle,
+			"deleted_at": blogInfo.BlogDeletedAt,
+		})
+	}
+	commentList, err := model.ShareCommentModel().FetchTrashCommentList()
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
+		commentInfo := iter.Value.(info.CommentInfo)
+		retList = append(retList, map[string]interface{}{
+			"kind":       trash.KindComment,
+			"id":         commentInfo.CommentID,
+			"name":       commentInfo.Content,
+			"type":       commentInfo.Type,
+			"type_id":    commentInfo.TypeID,
+			"deleted_at": commentInfo.DeletedAt,
+		})
+	}
+	pluginList, err := model.SharePluginModel().FetchTrashPluginList()
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	for iter := pluginList.Front(); iter != nil; iter = iter.Next() {
+		pluginInfo := iter.Value.(info.PluginInfo)
+		retList = append(retList, map[string]interface{}{
+			"kind":       trash.KindPlugin,
+			"id":         pluginInfo.PluginID,
+			"name":       pluginInfo.PluginName,
+			"deleted_at": pluginInfo.PluginDeletedAt,
+		})
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", retList)
+}
+
+/* 回收站，json格式如下：
+** {"type": "list"}
+** {"type": "restore", "kind": "blog", "id": 1}
+** {"type": "purge", "kind": "blog", "id": 1}，立即彻底删除
+** kind可以是blog、comment、plugin
+ */
+func (p *PersonalTrashController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		response.JsonResponse(w, framework.ErrorMethodError)
+		return
+	}
+	p.SessionController.HandlerRequest(p, w, r)
+
+	if !isAuthorized(&p.SessionController, r, info.TokenScope_Delete) {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountAuthError, "not auth")
+		return
+	}
+
+	m, err := readJsonBody(r)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	actionType, _ := m["type"].(string)
+	if actionType == "list" {
+		p.listTrash(w)
+		return
+	}
+	kind, _ := m["kind"].(string)
+	id := parseIntValue(m, "id", 0)
+	if !trash.IsValidKind(kind) || id <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "invalid kind or id")
+		return
+	}
+	before := trashTargetSummary(kind, id)
+	switch actionType {
+	case "restore":
+		err = trash.Restore(kind, id)
+	case "purge":
+		err = trash.Purge(kind, id)
+	default:
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "unsupport type")
+		return
+	}
+	auditActor(&p.SessionController, r).Record(kind+"."+actionType, kind, int64(id), before, nil, err)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	response.JsonResponse(w, framework.ErrorOK)
+}
@@ -26,6 +26,7 @@ type playRender struct {
 type pluginListRender struct {
 	PluginList []*playRender
 	Host       *hostRender
+	Page       *pageRender
 }
 
 type PlayController struct {
@@ -66,13 +67,21 @@ func (a *PlayController) readRes(w http.ResponseWriter, path string) {
 
 func (a *PlayController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path == "/play" {
+		r.ParseForm()
 		playRenderList := &pluginListRender{}
-		allPlugins, err := model.SharePluginModel().FetchAllPlugin()
+		pageNumber := parsePageNumber(r)
+		count, err := model.SharePluginModel().FetchPluginCount()
+		if err != nil {
+			fmt.Println("get plugin count failed: ", err)
+		}
+		pageNumber = clampPage(pageNumber, kPluginPageSize, count)
+		playRenderList.Page = buildPageRender("/play", pageNumber, kPluginPageSize, count)
+		plugins, err := model.SharePluginModel().FetchPluginList(pageOffset(pageNumber, kPluginPageSize), kPluginPageSize)
 		if err != nil {
 			fmt.Println("get plugin failed")
 		} else {
 			pluginRootPath := config.GetDefaultConfigJsonReader().GetString("storage.file.plugin")
-			for iter := allPlugins.Front(); iter != nil; iter = iter.Next() {
+			for iter := plugins.Front(); iter != nil; iter = iter.Next() {
 				info := iter.Value.(info.PluginInfo)
 				pluginInfoPath := filepath.Join(pluginRootPath, info.PluginUUID, "plugin.info")
 				description := json.NewJsonReaderFromFile(pluginInfoPath).GetString("description")
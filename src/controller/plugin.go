@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"blog/visit"
+	"blog/vote"
+	"controller/login"
 	"fmt"
 	"framework"
 	"framework/base/config"
@@ -27,6 +30,12 @@ type pluginRender struct {
 	DisplayTime              string
 	User                     userRender
 	IsHtml                   bool
+	PluginVote               int
+	RatingCount              int
+	RatingAverage            string
+	MyRating                 int
+	MyReview                 string
+	Reviews                  []*ratingRender
 }
 
 type PluginController struct {
@@ -45,8 +54,8 @@ func (p *PluginController) SessionPath() string {
 	return "/"
 }
 
-func (p *PluginController) fetchCommentContent(blogId int) (string, error) {
-	commentList, err := model.ShareCommentModel().FetchAllCommentByBlogId(info.CommentType_Blog, blogId)
+func (p *PluginController) fetchCommentContent(blogId int, voter string, viewerId int64) (string, error) {
+	commentList, err := model.ShareCommentModel().FetchAllCommentByBlogId(info.CommentType_Blog, blogId, viewerId)
 	if err != nil {
 		return "", err
 	}
@@ -56,14 +65,41 @@ func (p *PluginController) fetchCommentContent(blogId int) (string, error) {
 		info := iter.Value.(info.CommentInfo)
 		commentTree[info.CommentID] = &info
 	}
+	// 父评论可能没有通过审核，补齐时会被当成顶级评论
+	if err = fillParentComments(info.CommentType_Blog, commentTree, viewerId); err != nil {
+		return "", err
+	}
+	voteMap := vote.VoteMap(info.VoteTarget_Comment, commentTreeIdList(commentTree), voter)
 	var rawComment string = ""
 	for iter := commentList.Front(); iter != nil; iter = iter.Next() {
 		info := iter.Value.(info.CommentInfo)
-		rawComment += buildOneCommentFromCommentTree(&commentTree, &info)
+		rawComment += buildOneCommentFromCommentTree(&commentTree, commentTree[info.CommentID], voteMap)
 	}
 	return rawComment, nil
 }
 
+func (p *PluginController) fillVoteAndRating(render *pluginRender, voter string) {
+	pluginId := render.PluginID
+	render.PluginVote = vote.VoteMap(info.VoteTarget_Plugin, []int{pluginId}, voter)[pluginId]
+	summary, err := model.ShareRatingModel().FetchRatingSummary(pluginId)
+	if err != nil {
+		fmt.Println("fetch rating summary error: ", err)
+	} else {
+		render.RatingCount = summary.Count
+		render.RatingAverage = strconv.FormatFloat(summary.Average, 'f', 1, 64)
+	}
+	if rating, err := model.ShareRatingModel().FetchRating(pluginId, voter); err == nil && rating != nil {
+		render.MyRating = rating.Stars
+		render.MyReview = rating.Review
+	}
+	ratingList, err := model.ShareRatingModel().FetchRatingList(pluginId, 0, kRatingPageSize)
+	if err != nil {
+		fmt.Println("fetch rating list error: ", err)
+		return
+	}
+	render.Reviews = buildRatingRenderList(ratingList)
+}
+
 func (p *PluginController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	if strings.HasPrefix(r.URL.Path, "/plugin/") {
@@ -98,7 +134,8 @@ func (p *PluginController) HandlerRequest(w http.ResponseWriter, r *http.Request
 
 		render.Host = buildHostRender()
 
-		content, err := p.fetchCommentContent(id)
+		voter := sessionVoter(&p.SessionController, r)
+		content, err := p.fetchCommentContent(id, voter, p.LoginUserId())
 		if err != nil {
 			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
 			return
@@ -110,11 +147,13 @@ func (p *PluginController) HandlerRequest(w http.ResponseWriter, r *http.Request
 		peopleCount, err := model.ShareCommentModel().FetchCommentPeopleCount(
 			info.CommentType_Plugin, pluginInfo.PluginID)
 		render.PluginCommentPeopleCount = strconv.Itoa(peopleCount)
-		render.PluginVisitCount = strconv.Itoa(0)
+		visit.Hit(info.VisitTarget_Plugin, id, r, p.WebSession.SessionID())
+		render.PluginVisitCount = strconv.Itoa(pluginInfo.PluginVisitCount + visit.Pending(info.VisitTarget_Plugin, id))
 		render.PluginCommentContent = template.HTML(content)
 		render.Author = config.GetDefaultConfigJsonReader().Get("account.owner.name").(string)
 		render.DisplayTime = FormatRealTime(pluginInfo.PluginTime)
 		render.IsHtml = pluginInfo.PluginType == info.PluginType_H5
+		p.fillVoteAndRating(&render, voter)
 		v, err := p.SessionController.WebSession.Get("status")
 		if err == nil {
 			if v.(string) == "login" {
@@ -127,6 +166,7 @@ func (p *PluginController) HandlerRequest(w http.ResponseWriter, r *http.Request
 						render.User.NickName = userInfo.UserName
 						render.User.Pic = userInfo.SmallFigureurl
 						render.User.UserID = uid.(string)
+						render.User.UnreadCount = unreadCount(int64(userId))
 					} else {
 						render.User.IsLogin = false
 					}
@@ -139,6 +179,7 @@ func (p *PluginController) HandlerRequest(w http.ResponseWriter, r *http.Request
 		} else {
 			render.User.IsLogin = false
 		}
+		render.User.LoginProviders = login.Providers()
 		err = t.Execute(w, render)
 		if err != nil {
 			fmt.Println("execute error: ", err)
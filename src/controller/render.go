@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"container/list"
 	"framework/base/config"
 	"info"
 	"model"
@@ -43,7 +42,18 @@ func (r rankList) Less(blog1, blog2 int) bool {
 	return r[blog1].Hot > r[blog2].Hot
 }
 
+// 侧边栏热门博客的数量
+const kHotBlogCount = 6
+
+type categoryRender struct {
+	Name     string
+	Slug     string
+	Count    int
+	Children []*categoryRender
+}
+
 type sideRender struct {
+	CategoryTree    []*categoryRender
 	BlogTagList     []*tagRender
 	BlogTimeList    []*timeRender
 	BlogHotBlogList rankList
@@ -74,23 +84,53 @@ func buildHostRender() *hostRender {
 	return staticHostRender
 }
 
-func buildSideRender(blogList *list.List) *sideRender {
+func buildCategoryRenderList(categoryList []*info.CategoryInfo) []*categoryRender {
+	var renderList []*categoryRender = nil
+	for _, category := range categoryList {
+		if category.CategoryTotalCount == 0 {
+			continue
+		}
+		renderList = append(renderList, &categoryRender{
+			Name:     category.CategoryName,
+			Slug:     category.CategorySlug,
+			Count:    category.CategoryTotalCount,
+			Children: buildCategoryRenderList(category.Children),
+		})
+	}
+	return renderList
+}
+
+// 侧边栏只查最新的几篇和按月份聚合的时间，不用把所有博客都读出来
+func buildSideRender() *sideRender {
 	var topRender sideRender
-	var tagMap map[string]int = make(map[string]int)
 	var timeMap map[string]int64 = make(map[string]int64)
-	for iter := blogList.Front(); iter != nil; iter = iter.Next() {
-		inf := iter.Value.(info.BlogInfo)
-		commentCount, _ := model.ShareCommentModel().FetchCommentCount(info.CommentType_Blog, inf.BlogID)
-		rank := &rankRender{ID: inf.BlogID, Title: inf.BlogTitle, Hot: inf.BlogVisitCount + commentCount*5}
-		topRender.BlogHotBlogList = append(topRender.BlogHotBlogList, rank)
-		for tag := range inf.BlogTagList {
-			tagMap[inf.BlogTagList[tag]]++
+	latestList, err := model.ShareBlogModel().FetchBlogList(0, kHotBlogCount)
+	if err != nil {
+		fmt.Println("fetch blog error: ", err)
+	} else {
+		for iter := latestList.Front(); iter != nil; iter = iter.Next() {
+			inf := iter.Value.(info.BlogInfo)
+			commentCount, _ := model.ShareCommentModel().FetchCommentCount(info.CommentType_Blog, inf.BlogID)
+			rank := &rankRender{ID: inf.BlogID, Title: inf.BlogTitle, Hot: inf.BlogVisitCount + commentCount*5}
+			topRender.BlogHotBlogList = append(topRender.BlogHotBlogList, rank)
 		}
-		timeMap[time.Unix(inf.BlogTime, 0).Format("2006年01月")] = inf.BlogTime
+	}
+	monthList, err := model.ShareBlogModel().FetchBlogMonthList()
+	if err != nil {
+		fmt.Println("fetch blog month error: ", err)
+	}
+	for _, blogTime := range monthList {
+		timeMap[time.Unix(blogTime, 0).Format("2006年01月")] = blogTime
 	}
 	var tagList []*tagRender = nil
-	for k, v := range tagMap {
-		tagList = append(tagList, &tagRender{k, v})
+	allTagList, err := model.ShareTagModel().FetchAllTag()
+	if err != nil {
+		fmt.Println("fetch tag error: ", err)
+	}
+	for _, tag := range allTagList {
+		if tag.TagBlogCount > 0 {
+			tagList = append(tagList, &tagRender{tag.TagName, tag.TagBlogCount})
+		}
 	}
 	var blogTimeList BlogTimeList = nil
 	for k, v := range timeMap {
@@ -104,10 +144,12 @@ func buildSideRender(blogList *list.List) *sideRender {
 			renderTime.Year(), int(renderTime.Month())})
 	}
 	topRender.BlogTagList = tagList
-	topRender.BlogTimeList = blogTimeStringList
-	if len(topRender.BlogHotBlogList) > 6 {
-		topRender.BlogHotBlogList = topRender.BlogHotBlogList[:6]
+	allCategoryList, err := model.ShareCategoryModel().FetchAllCategory()
+	if err != nil {
+		fmt.Println("fetch category error: ", err)
 	}
+	topRender.CategoryTree = buildCategoryRenderList(model.BuildCategoryTree(allCategoryList))
+	topRender.BlogTimeList = blogTimeStringList
 	sort.Sort(topRender.BlogHotBlogList)
 	for i, rank := range topRender.BlogHotBlogList {
 		rank.Index = i + 1
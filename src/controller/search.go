@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"blog/search"
+	"framework"
+	"framework/response"
+	"html/template"
+	"log"
+	"model"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 输入提示最多返回的条数
+const kSuggestLimit = 8
+
+type SearchController struct {
+}
+
+func NewSearchController() *SearchController {
+	return &SearchController{}
+}
+
+func (s *SearchController) Path() interface{} {
+	return []string{"/search", "/search/suggest"}
+}
+
+func (s *SearchController) handlerSearchRequest(w http.ResponseWriter, r *http.Request) {
+	t, err := template.ParseFiles("./src/view/html/index.html")
+	if err != nil {
+		log.Println(err)
+	}
+	query := strings.TrimSpace(r.Form.Get("q"))
+	pageNumber := parsePageNumber(r)
+	results, total := search.ShareSearchIndex().Search(query, pageOffset(pageNumber, kIndexPageSize), kIndexPageSize)
+	var topRender indexRender
+	for _, result := range results {
+		blogInfo, err := model.ShareBlogModel().FetchBlogByBlogID(result.BlogID)
+		if err != nil || blogInfo == nil || !blogInfo.IsPublished() {
+			continue
+		}
+		blogRender := buildBlogElementRender(blogInfo)
+		blogRender.BlogSnippet = template.HTML(result.Snippet)
+		topRender.BlogList = append(topRender.BlogList, blogRender)
+	}
+	topRender.Side = buildSideRender()
+	topRender.Host = buildHostRender()
+	topRender.Header = &listHeaderRender{"搜索: " + query, "", total}
+	topRender.Page = buildPageRender("/search?q="+url.QueryEscape(query), pageNumber, kIndexPageSize, total)
+	topRender.SearchQuery = query
+	t.Execute(w, &topRender)
+}
+
+// 输入提示，返回 [{"id": 1, "title": "xx"}]
+func (s *SearchController) handlerSuggestRequest(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.Form.Get("limit"))
+	if err != nil || limit <= 0 || limit > kSuggestLimit {
+		limit = kSuggestLimit
+	}
+	var retList []interface{} = []interface{}{}
+	for _, result := range search.ShareSearchIndex().Suggest(r.Form.Get("q"), limit) {
+		retList = append(retList, map[string]interface{}{
+			"id":    result.BlogID,
+			"title": result.Title,
+		})
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", retList)
+}
+
+func (s *SearchController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	switch r.URL.Path {
+	case "/search":
+		s.handlerSearchRequest(w, r)
+	case "/search/suggest":
+		s.handlerSuggestRequest(w, r)
+	}
+}
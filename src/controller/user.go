@@ -0,0 +1,291 @@
+package controller
+
+import (
+	"blog/markup"
+	"blog/permission"
+	"fmt"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"html/template"
+	"info"
+	"model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const kUserCommentPageSize = 20
+
+type userCommentRender struct {
+	Title   string
+	URL     string
+	Content template.HTML
+	Time    string
+}
+
+type userProfileRender struct {
+	Host        *hostRender
+	UserID      int64
+	Name        string
+	Pic         string
+	AccountType string
+	JoinTime    string
+	Website     string
+	IsSelf      bool
+	// 主人设置了隐藏主页或者评论记录，当前读者看不到
+	ProfileHidden  bool
+	CommentsHidden bool
+	CommentCount   int
+	Comments       []*userCommentRender
+	Page           *pageRender
+}
+
+// 用户主页需要的信息，canSeeAll表示可以无视隐私设置：用户自己以及版主以上的角色
+type userProfile struct {
+	userInfo  *info.UserInfo
+	privacy   *info.PrivacyInfo
+	canSeeAll bool
+}
+
+// 用户不存在时返回nil，viewerId为0表示没有登录
+func fetchUserProfile(userId int64, viewerId int64) (*userProfile, error) {
+	userInfo, err := model.ShareUserModel().GetUserInfoById(userId)
+	if err != nil || userInfo == nil {
+		return nil, err
+	}
+	privacy, err := model.ShareUserModel().FetchPrivacy(userId)
+	if err != nil || privacy == nil {
+		return nil, err
+	}
+	profile := &userProfile{userInfo: userInfo, privacy: privacy, canSeeAll: viewerId > 0 && viewerId == userId}
+	if !profile.canSeeAll && viewerId > 0 {
+		if profile.canSeeAll, err = permission.Can(viewerId, info.Permission_Moderate); err != nil {
+			return nil, err
+		}
+	}
+	return profile, nil
+}
+
+func (p *userProfile) profileVisible() bool {
+	return p.canSeeAll || !p.privacy.HideProfile
+}
+
+func (p *userProfile) commentsVisible() bool {
+	return p.profileVisible() && (p.canSeeAll || !p.privacy.HideComments)
+}
+
+func accountTypeName(accountType int) string {
+	switch accountType {
+	case info.AccountTypeQQ:
+		return "qq"
+	case info.AccountTypeWeibo:
+		return "weibo"
+	case info.AccountTypeGuest:
+		return "guest"
+	case info.AccountTypeLocal:
+		return "local"
+	case info.AccountTypeGitHub:
+		return "github"
+	case info.AccountTypeOIDC:
+		return "oidc"
+	case info.AccountTypeWeixin:
+		return "weixin"
+	}
+	return ""
+}
+
+// 评论所在的页面，返回blog或者plugin以及对应的链接
+func commentTarget(commentType int, typeId int) (string, string) {
+	if commentType == info.CommentType_Plugin {
+		return "plugin", fmt.Sprintf("/plugin?id=%d", typeId)
+	}
+	return "blog", fmt.Sprintf("/blog?id=%d", typeId)
+}
+
+// 用户主页上一页评论和评论总数
+func fetchUserCommentPage(userId int64, page int) ([]*info.UserCommentInfo, int, error) {
+	total, err := model.ShareCommentModel().FetchUserCommentCount(userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	commentList, err := model.ShareCommentModel().FetchUserCommentList(userId,
+		pageOffset(page, kUserCommentPageSize), kUserCommentPageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return commentList, total, nil
+}
+
+type UserController struct {
+	server.SessionController
+}
+
+func NewUserController() *UserController {
+	return &UserController{}
+}
+
+func (u *UserController) Path() (interface{}, bool) {
+	return "/user", true
+}
+
+func (u *UserController) SessionPath() string {
+	return "/"
+}
+
+// /user/{id}?page=2，用户的公开主页
+func (u *UserController) HandlerRequest(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	userId, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/user/"), 10, 64)
+	if err != nil || userId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "invalid user id")
+		return
+	}
+	u.SessionController.HandlerRequest(u, w, r)
+	viewerId := u.LoginUserId()
+	profile, err := fetchUserProfile(userId, viewerId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	if profile == nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no such user")
+		return
+	}
+	render := userProfileRender{Host: buildHostRender(), UserID: userId, IsSelf: viewerId == userId}
+	render.ProfileHidden = !profile.profileVisible()
+	render.CommentsHidden = !profile.commentsVisible()
+	if !render.ProfileHidden {
+		render.Name = profile.userInfo.UserName
+		render.Pic = profile.userInfo.SmallFigureurl
+		render.AccountType = accountTypeName(profile.userInfo.UserAccountType)
+		render.JoinTime = FormatRealTime(profile.userInfo.RegisterTime)
+		render.Website = profile.userInfo.Website
+	}
+	if !render.CommentsHidden {
+		page := parsePageNumber(r)
+		commentList, total, err := fetchUserCommentPage(userId, page)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		for _, comment := range commentList {
+			_, url := commentTarget(comment.Type, comment.TypeID)
+			render.Comments = append(render.Comments, &userCommentRender{
+				Title:   comment.Title,
+				URL:     url,
+				Content: template.HTML(markup.CommentHTML(&comment.CommentInfo)),
+				Time:    FormatTime(comment.Time),
+			})
+		}
+		render.CommentCount = total
+		render.Page = buildPageRender(fmt.Sprintf("/user/%d", userId), page, kUserCommentPageSize, total)
+	}
+	t, err := template.ParseFiles("./src/view/html/user.html")
+	if err != nil {
+		fmt.Println("parse file error: ", err.Error())
+		return
+	}
+	t.Execute(w, render)
+}
+
+/* 用户主页和隐私设置，json格式如下：
+** {"type": "profile", "id": 1, "page": 1}，隐藏的部分不返回
+** {"type": "privacy"}，查询自己的隐私设置，需要登录
+** {"type": "setPrivacy", "hide_profile": 1, "hide_comments": 0}，需要登录
+ */
+func (a *APIController) handleProfileAction(w http.ResponseWriter, inf map[string]interface{}, action string) {
+	viewerId := a.LoginUserId()
+	if action == "profile" {
+		a.handleProfileRequest(w, inf, viewerId)
+		return
+	}
+	if viewerId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "account not login")
+		return
+	}
+	privacy, err := model.ShareUserModel().FetchPrivacy(viewerId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	if privacy == nil {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "no such user")
+		return
+	}
+	if action == "setPrivacy" {
+		if value, ok := parseIntField(inf, "hide_profile"); ok {
+			privacy.HideProfile = value != 0
+		}
+		if value, ok := parseIntField(inf, "hide_comments"); ok {
+			privacy.HideComments = value != 0
+		}
+		if err = model.ShareUserModel().SetPrivacy(viewerId, privacy); err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"hide_profile":  privacy.HideProfile,
+		"hide_comments": privacy.HideComments,
+	})
+}
+
+func (a *APIController) handleProfileRequest(w http.ResponseWriter, inf map[string]interface{}, viewerId int64) {
+	userId, _ := parseIntField(inf, "id")
+	if userId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	profile, err := fetchUserProfile(int64(userId), viewerId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	if profile == nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no such user")
+		return
+	}
+	data := map[string]interface{}{
+		"id":              userId,
+		"profile_hidden":  !profile.profileVisible(),
+		"comments_hidden": !profile.commentsVisible(),
+	}
+	if profile.profileVisible() {
+		data["name"] = profile.userInfo.UserName
+		data["pic"] = profile.userInfo.SmallFigureurl
+		data["account_type"] = accountTypeName(profile.userInfo.UserAccountType)
+		data["join_time"] = profile.userInfo.RegisterTime
+		data["website"] = profile.userInfo.Website
+	}
+	if profile.commentsVisible() {
+		page, _ := parseIntField(inf, "page")
+		if page < 1 {
+			page = 1
+		}
+		commentList, total, err := fetchUserCommentPage(int64(userId), page)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		var retList []interface{} = []interface{}{}
+		for _, comment := range commentList {
+			target, url := commentTarget(comment.Type, comment.TypeID)
+			retList = append(retList, map[string]interface{}{
+				"id":        comment.CommentID,
+				"content":   comment.Content,
+				"html":      markup.CommentHTML(&comment.CommentInfo),
+				"time":      comment.Time,
+				"target":    target,
+				"target_id": comment.TypeID,
+				"title":     comment.Title,
+				"url":       url,
+			})
+		}
+		data["page"] = page
+		data["page_size"] = kUserCommentPageSize
+		data["total"] = total
+		data["comments"] = retList
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", data)
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"blog/permission"
+	"blog/vote"
+	"framework"
+	"framework/response"
+	"framework/server"
+	"info"
+	"model"
+	"net/http"
+	"strconv"
+)
+
+const kRatingPageSize = 10
+
+type ratingRender struct {
+	UserName string
+	Pic      string
+	Stars    int
+	Review   string
+	Time     string
+}
+
+func sessionVoter(s *server.SessionController, r *http.Request) string {
+	return vote.Voter(s.LoginUserId(), r)
+}
+
+// 被封禁的用户不能投票和评分，出错时已经写好了返回
+func checkVotePermission(w http.ResponseWriter, userId int64) bool {
+	if userId <= 0 {
+		return true
+	}
+	err := permission.Check(userId, info.Permission_Vote)
+	if err == permission.ErrBanned || err == permission.ErrPermissionDenied {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountBanned, err.Error())
+		return false
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return false
+	}
+	return true
+}
+
+func parseIntField(inf map[string]interface{}, name string) (int, bool) {
+	if v, ok := inf[name].(float64); ok {
+		return int(v), true
+	}
+	return 0, false
+}
+
+func buildRatingRenderList(ratingList []*info.RatingInfo) []*ratingRender {
+	var renderList []*ratingRender = nil
+	for _, rating := range ratingList {
+		render := &ratingRender{Stars: rating.Stars, Review: rating.Review, Time: FormatTime(rating.Time)}
+		if userInfo, err := model.ShareUserModel().GetUserInfoById(rating.UserID); err == nil && userInfo != nil {
+			render.UserName = userInfo.UserName
+			render.Pic = userInfo.SmallFigureurl
+		}
+		renderList = append(renderList, render)
+	}
+	return renderList
+}
+
+func voteCountData(count *info.VoteCountInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"praise":  count.Praise,
+		"dissent": count.Dissent,
+		"vote":    count.Vote,
+	}
+}
+
+/* 投票，匿名用户也可以投：
+** {"type": "vote", "target": "blog", "id": 1, "value": 1}，value为1表示顶，-1表示踩
+** {"type": "unvote", "target": "comment", "id": 1}
+** {"type": "voteState", "target": "comment", "ids": [1, 2, 3]}，返回当前用户的投票
+ */
+func (a *APIController) handleVoteAction(w http.ResponseWriter, r *http.Request, inf map[string]interface{},
+	action string) {
+	target, _ := inf["target"].(string)
+	voter := sessionVoter(&a.SessionController, r)
+	if action == "voteState" {
+		var idList []int = nil
+		if ids, ok := inf["ids"].([]interface{}); ok {
+			for _, id := range ids {
+				if v, ok := id.(float64); ok {
+					idList = append(idList, int(v))
+				}
+			}
+		}
+		var data map[string]interface{} = make(map[string]interface{})
+		for id, value := range vote.VoteMap(target, idList, voter) {
+			data[strconv.Itoa(id)] = value
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", data)
+		return
+	}
+	id, ok := parseIntField(inf, "id")
+	if !ok {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	if !checkVotePermission(w, a.LoginUserId()) {
+		return
+	}
+	var count *info.VoteCountInfo
+	var err error
+	if action == "vote" {
+		value, _ := parseIntField(inf, "value")
+		count, err = vote.Vote(target, id, voter, value)
+	} else {
+		count, err = vote.Unvote(target, id, voter)
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", voteCountData(count))
+}
+
+/* 插件评分，需要登录：
+** {"type": "rate", "id": 1, "stars": 5, "review": "好玩"}
+** {"type": "unrate", "id": 1}
+** {"type": "ratings", "id": 1, "page": 1}，返回评分汇总和短评列表，不需要登录
+ */
+func (a *APIController) handleRatingAction(w http.ResponseWriter, r *http.Request, inf map[string]interface{},
+	action string) {
+	pluginId, ok := parseIntField(inf, "id")
+	if !ok {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, "no id")
+		return
+	}
+	if action == "ratings" {
+		page, _ := parseIntField(inf, "page")
+		if page < 1 {
+			page = 1
+		}
+		summary, err := model.ShareRatingModel().FetchRatingSummary(pluginId)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		ratingList, err := model.ShareRatingModel().FetchRatingList(pluginId,
+			pageOffset(page, kRatingPageSize), kRatingPageSize)
+		if err != nil {
+			response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+			return
+		}
+		var retList []interface{} = []interface{}{}
+		for _, render := range buildRatingRenderList(ratingList) {
+			retList = append(retList, map[string]interface{}{
+				"name":   render.UserName,
+				"pic":    render.Pic,
+				"stars":  render.Stars,
+				"review": render.Review,
+				"time":   render.Time,
+			})
+		}
+		response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+			"count":   summary.Count,
+			"average": summary.Average,
+			"list":    retList,
+		})
+		return
+	}
+	userId := a.LoginUserId()
+	if userId <= 0 {
+		response.JsonResponseWithMsg(w, framework.ErrorAccountNotLogin, "account not login")
+		return
+	}
+	if !checkVotePermission(w, userId) {
+		return
+	}
+	voter := vote.Voter(userId, r)
+	var err error
+	if action == "rate" {
+		stars, _ := parseIntField(inf, "stars")
+		review, _ := inf["review"].(string)
+		err = vote.Rate(pluginId, voter, userId, stars, review)
+	} else {
+		err = vote.Unrate(pluginId, voter)
+	}
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorParamError, err.Error())
+		return
+	}
+	summary, err := model.ShareRatingModel().FetchRatingSummary(pluginId)
+	if err != nil {
+		response.JsonResponseWithMsg(w, framework.ErrorSQLError, err.Error())
+		return
+	}
+	response.JsonResponseWithData(w, framework.ErrorOK, "", map[string]interface{}{
+		"count":   summary.Count,
+		"average": summary.Average,
+	})
+}
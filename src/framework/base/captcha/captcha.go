@@ -0,0 +1,150 @@
+package captcha
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/* 算术验证码：随机出一道简单的加减乘法题，把算式画成图片，答案保存在服务端。
+** 图片用内置的5x7点阵字体绘制，每个字符随机偏移、随机颜色，再加上干扰线和噪点，
+** 不依赖任何字体文件和第三方库。
+ */
+
+type Challenge struct {
+	// 图片上显示的算式，例如"3+5=?"
+	Question string
+	Answer   string
+}
+
+const (
+	kGlyphWidth  = 5
+	kGlyphHeight = 7
+	// 点阵放大的倍数
+	kScale = 3
+)
+
+// 每个字符7行，每行5个点，#表示有颜色
+var glyphs = map[rune][kGlyphHeight]string{
+	'0': {" ### ", "#   #", "#  ##", "# # #", "##  #", "#   #", " ### "},
+	'1': {"  #  ", " ##  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'2': {" ### ", "#   #", "    #", "   # ", "  #  ", " #   ", "#####"},
+	'3': {"#####", "   # ", "  #  ", "   # ", "    #", "#   #", " ### "},
+	'4': {"   # ", "  ## ", " # # ", "#  # ", "#####", "   # ", "   # "},
+	'5': {"#####", "#    ", "#### ", "    #", "    #", "#   #", " ### "},
+	'6': {"  ## ", " #   ", "#    ", "#### ", "#   #", "#   #", " ### "},
+	'7': {"#####", "    #", "   # ", "  #  ", " #   ", " #   ", " #   "},
+	'8': {" ### ", "#   #", "#   #", " ### ", "#   #", "#   #", " ### "},
+	'9': {" ### ", "#   #", "#   #", " ####", "    #", "   # ", " ##  "},
+	'+': {"     ", "  #  ", "  #  ", "#####", "  #  ", "  #  ", "     "},
+	'-': {"     ", "     ", "     ", "#####", "     ", "     ", "     "},
+	'x': {"     ", "#   #", " # # ", "  #  ", " # # ", "#   #", "     "},
+	'=': {"     ", "     ", "#####", "     ", "#####", "     ", "     "},
+	'?': {" ### ", "#   #", "    #", "   # ", "  #  ", "     ", "  #  "},
+}
+
+var (
+	randomLock sync.Mutex
+	random     = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func randomInt(n int) int {
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return random.Intn(n)
+}
+
+// 减法保证结果不是负数，乘法只出一位数乘一位数
+func NewArithmetic() Challenge {
+	var a, b, answer int
+	var op string
+	switch randomInt(3) {
+	case 0:
+		a, b = randomInt(50)+1, randomInt(50)+1
+		op, answer = "+", a+b
+	case 1:
+		a, b = randomInt(50)+10, randomInt(10)+1
+		op, answer = "-", a-b
+	default:
+		a, b = randomInt(9)+1, randomInt(9)+1
+		op, answer = "x", a*b
+	}
+	return Challenge{
+		Question: strconv.Itoa(a) + op + strconv.Itoa(b) + "=?",
+		Answer:   strconv.Itoa(answer),
+	}
+}
+
+func randomColor(min int, max int) color.RGBA {
+	channel := func() uint8 {
+		return uint8(min + randomInt(max-min))
+	}
+	return color.RGBA{channel(), channel(), channel(), 0xFF}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func drawLine(img *image.RGBA, x0 int, y0 int, x1 int, y1 int, c color.RGBA) {
+	steps := abs(x1 - x0)
+	if abs(y1-y0) > steps {
+		steps = abs(y1 - y0)
+	}
+	if steps == 0 {
+		img.SetRGBA(x0, y0, c)
+		return
+	}
+	for i := 0; i <= steps; i++ {
+		img.SetRGBA(x0+(x1-x0)*i/steps, y0+(y1-y0)*i/steps, c)
+	}
+}
+
+// 不认识的字符留空
+func Image(text string) *image.RGBA {
+	const padding = 6
+	advance := (kGlyphWidth + 1) * kScale
+	width := padding*2 + advance*len(text)
+	height := padding*2 + kGlyphHeight*kScale
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	background := randomColor(0xE8, 0xFF)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, background)
+		}
+	}
+	for index, r := range []rune(text) {
+		glyph, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+		c := randomColor(0x10, 0x90)
+		offsetX := padding + index*advance + randomInt(3) - 1
+		offsetY := padding + randomInt(5) - 2
+		for row, line := range glyph {
+			for column, dot := range line {
+				if dot != '#' {
+					continue
+				}
+				for dy := 0; dy < kScale; dy++ {
+					for dx := 0; dx < kScale; dx++ {
+						img.SetRGBA(offsetX+column*kScale+dx, offsetY+row*kScale+dy, c)
+					}
+				}
+			}
+		}
+	}
+	for i := 0; i < 3; i++ {
+		drawLine(img, randomInt(width), randomInt(height), randomInt(width), randomInt(height), randomColor(0x60, 0xC0))
+	}
+	for i := 0; i < width*height/30; i++ {
+		img.SetRGBA(randomInt(width), randomInt(height), randomColor(0x40, 0xE0))
+	}
+	return img
+}
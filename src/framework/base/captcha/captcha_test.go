@@ -0,0 +1,51 @@
+package captcha
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func Test_NewArithmetic(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		challenge := NewArithmetic()
+		question := strings.TrimSuffix(challenge.Question, "=?")
+		var a, b, expect int
+		for _, op := range []string{"+", "-", "x"} {
+			if parts := strings.SplitN(question, op, 2); len(parts) == 2 {
+				a, _ = strconv.Atoi(parts[0])
+				b, _ = strconv.Atoi(parts[1])
+				switch op {
+				case "+":
+					expect = a + b
+				case "-":
+					expect = a - b
+				case "x":
+					expect = a * b
+				}
+				break
+			}
+		}
+		if strconv.Itoa(expect) != challenge.Answer || expect < 0 {
+			t.Error("question ", challenge.Question, " got answer ", challenge.Answer)
+		}
+	}
+}
+
+func Test_ImageSize(t *testing.T) {
+	img := Image("12+3=?")
+	bounds := img.Bounds()
+	if bounds.Dx() != 12+6*(kGlyphWidth+1)*kScale || bounds.Dy() != 12+kGlyphHeight*kScale {
+		t.Error("unexpected image size ", bounds)
+	}
+}
+
+func Test_GlyphShape(t *testing.T) {
+	for r, glyph := range glyphs {
+		for _, line := range glyph {
+			if len(line) != kGlyphWidth {
+				t.Error("glyph ", string(r), " has a line of width ", len(line))
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+/* 按行比较两段文本，使用Myers算法求最短编辑脚本。
+** 结果可以直接给前端逐行展示，也可以用Unified转成类似`diff -u`的格式。
+ */
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+type Line struct {
+	Op   Op
+	Text string
+	// 行号从1开始，新增的行没有旧行号，删除的行没有新行号，为0
+	OldNumber int
+	NewNumber int
+}
+
+func (o Op) String() string {
+	switch o {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	}
+	return " "
+}
+
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// 比较两段文本
+func Text(oldText string, newText string) []Line {
+	return Lines(SplitLines(oldText), SplitLines(newText))
+}
+
+func Lines(a []string, b []string) []Line {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int = nil
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	// 从终点回溯出编辑路径
+	var reversed []Line = nil
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Line{Equal, a[x-1], x, y})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, Line{Insert, b[y-1], 0, y})
+			} else {
+				reversed = append(reversed, Line{Delete, a[x-1], x, 0})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	var lines []Line = make([]Line, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		lines = append(lines, reversed[i])
+	}
+	return lines
+}
+
+func HasChange(lines []Line) bool {
+	for _, line := range lines {
+		if line.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// 转成unified格式，context为每处修改前后保留的相同行数
+func Unified(lines []Line, oldName string, newName string, context int) string {
+	if !HasChange(lines) {
+		return ""
+	}
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(lines); {
+		// 找到下一处修改
+		for start < len(lines) && lines[start].Op == Equal {
+			start++
+		}
+		if start >= len(lines) {
+			break
+		}
+		begin := start - context
+		if begin < 0 {
+			begin = 0
+		}
+		// 两处修改之间相同的行不超过2*context时合并成一个hunk
+		end := start
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].Op == Equal {
+				next++
+			}
+			if next < len(lines) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			break
+		}
+		stop := end + context
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+		oldStart, oldCount, newStart, newCount := 0, 0, 0, 0
+		for _, line := range lines[begin:stop] {
+			if line.Op != Insert {
+				if oldStart == 0 {
+					oldStart = line.OldNumber
+				}
+				oldCount++
+			}
+			if line.Op != Delete {
+				if newStart == 0 {
+					newStart = line.NewNumber
+				}
+				newCount++
+			}
+		}
+		fmt.Fprintf(&buffer, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, line := range lines[begin:stop] {
+			buffer.WriteString(line.Op.String())
+			buffer.WriteString(line.Text)
+			buffer.WriteString("\n")
+		}
+		start = stop
+	}
+	return buffer.String()
+}
@@ -0,0 +1,78 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func opString(lines []Line) string {
+	var ops []string = nil
+	for _, line := range lines {
+		ops = append(ops, line.Op.String()+line.Text)
+	}
+	return strings.Join(ops, "|")
+}
+
+func Test_Equal(t *testing.T) {
+	lines := Text("a\nb\nc", "a\nb\nc")
+	if HasChange(lines) || len(lines) != 3 {
+		t.Error("expect no change: ", opString(lines))
+	}
+	if Unified(lines, "a", "b", 3) != "" {
+		t.Error("expect empty unified diff")
+	}
+}
+
+func Test_InsertDelete(t *testing.T) {
+	lines := Text("a\nb\nc", "a\nc\nd")
+	if s := opString(lines); s != " a|-b| c|+d" {
+		t.Error("unexpected diff: ", s)
+	}
+}
+
+func Test_Empty(t *testing.T) {
+	if s := opString(Text("", "a\nb")); s != "+a|+b" {
+		t.Error("unexpected diff: ", s)
+	}
+	if s := opString(Text("a\nb", "")); s != "-a|-b" {
+		t.Error("unexpected diff: ", s)
+	}
+	if len(Text("", "")) != 0 {
+		t.Error("expect empty diff")
+	}
+}
+
+func Test_LineNumber(t *testing.T) {
+	lines := Text("a\nb\nc", "x\na\nc")
+	for _, line := range lines {
+		switch line.Text {
+		case "x":
+			if line.OldNumber != 0 || line.NewNumber != 1 {
+				t.Error("wrong number: ", line)
+			}
+		case "c":
+			if line.OldNumber != 3 || line.NewNumber != 3 {
+				t.Error("wrong number: ", line)
+			}
+		}
+	}
+}
+
+func Test_Unified(t *testing.T) {
+	oldText := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10"
+	newText := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10"
+	unified := Unified(Text(oldText, newText), "old", "new", 2)
+	expect := "--- old\n+++ new\n@@ -3,5 +3,5 @@\n 3\n 4\n-5\n+five\n 6\n 7\n"
+	if unified != expect {
+		t.Error("unexpected unified diff:\n", unified)
+	}
+}
+
+func Test_UnifiedHunks(t *testing.T) {
+	oldText := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10"
+	newText := "one\n2\n3\n4\n5\n6\n7\n8\n9\nten"
+	unified := Unified(Text(oldText, newText), "old", "new", 1)
+	if strings.Count(unified, "@@ -") != 2 {
+		t.Error("expect two hunks:\n", unified)
+	}
+}
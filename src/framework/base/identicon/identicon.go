@@ -0,0 +1,43 @@
+package identicon
+
+import (
+	"crypto/md5"
+	"image"
+	"image/color"
+)
+
+/* 根据种子生成头像：对种子做md5，前15位决定5x5格子左边三列是否着色(右边两列对称)，
+** 最后几个字节决定颜色，同一个种子总是生成同样的头像。
+ */
+
+const kGrid = 5
+
+func Generate(seed string, size int) *image.RGBA {
+	sum := md5.Sum([]byte(seed))
+	foreground := color.RGBA{sum[13]/2 + 0x40, sum[14]/2 + 0x40, sum[15]/2 + 0x40, 0xFF}
+	background := color.RGBA{0xF0, 0xF0, 0xF0, 0xFF}
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	// 四周留半格的空白
+	cell := size / (kGrid + 1)
+	margin := (size - cell*kGrid) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetRGBA(x, y, background)
+		}
+	}
+	for row := 0; row < kGrid; row++ {
+		for column := 0; column < (kGrid+1)/2; column++ {
+			if sum[row*3+column]%2 == 0 {
+				continue
+			}
+			for _, c := range []int{column, kGrid - 1 - column} {
+				for dy := 0; dy < cell; dy++ {
+					for dx := 0; dx < cell; dx++ {
+						img.SetRGBA(margin+c*cell+dx, margin+row*cell+dy, foreground)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,27 @@
+package identicon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_GenerateStable(t *testing.T) {
+	if !reflect.DeepEqual(Generate("guest", 48).Pix, Generate("guest", 48).Pix) {
+		t.Error("same seed should generate the same image")
+	}
+	if reflect.DeepEqual(Generate("guest", 48).Pix, Generate("other", 48).Pix) {
+		t.Error("different seeds should generate different images")
+	}
+}
+
+func Test_GenerateSymmetric(t *testing.T) {
+	const size = 60
+	img := Generate("symmetric", size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if img.RGBAAt(x, y) != img.RGBAAt(size-1-x, y) {
+				t.Fatal("not symmetric at ", x, ", ", y)
+			}
+		}
+	}
+}
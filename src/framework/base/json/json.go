@@ -41,7 +41,11 @@ func valueToString(v interface{}) string {
 	case float64:
 		return fmt.Sprintf("%.8f", v.(float64))
 	case string:
-		return fmt.Sprintf(`"%s"`, v.(string))
+		return quoteString(v.(string))
+	case bool:
+		return strconv.FormatBool(v.(bool))
+	case nil:
+		return "null"
 	//list
 	case []interface{}:
 		return interfaceListToString(v.([]interface{}))
@@ -101,10 +105,18 @@ func valueToString(v interface{}) string {
 	}
 }
 
+func quoteString(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return `""`
+	}
+	return string(b)
+}
+
 func stringListToString(l []string) string {
 	ret := "["
 	for i, v := range l {
-		ret += fmt.Sprintf(`"%s"`, v)
+		ret += quoteString(v)
 		if i != len(l)-1 {
 			ret += ","
 		}
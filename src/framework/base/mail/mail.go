@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* 发送邮件，Sender可以替换：
+** 1. LogSender只把邮件打印出来，开发时使用；
+** 2. FileSender把每封邮件写成目录下的一个.eml文件；
+** 3. SMTPSender通过SMTP服务器真正发出去。
+ */
+
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// 邮件的原始内容，正文按utf-8纯文本发送
+func (m *Message) Bytes() []byte {
+	var lines []string = []string{
+		"From: " + m.From,
+		"To: " + m.To,
+		"Subject: " + encodeHeader(m.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		strings.Replace(m.Body, "\n", "\r\n", -1),
+	}
+	return []byte(strings.Join(lines, "\r\n"))
+}
+
+// 标题里有非ASCII字符时按RFC 2047编码
+func encodeHeader(value string) string {
+	for _, c := range value {
+		if c >= 0x80 || c < 0x20 {
+			return fmt.Sprintf("=?utf-8?q?%s?=", qEncode(value))
+		}
+	}
+	return value
+}
+
+func qEncode(value string) string {
+	var buf []byte = nil
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == ' ':
+			buf = append(buf, '_')
+		case c >= 0x80 || c < 0x20 || c == '=' || c == '?' || c == '_':
+			buf = append(buf, []byte(fmt.Sprintf("=%02X", c))...)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
+
+type LogSender struct {
+}
+
+func (l *LogSender) Send(msg *Message) error {
+	fmt.Printf("mail to %s: %s\n%s\n", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type FileSender struct {
+	Dir string
+	// 同一纳秒内发送多封邮件时避免文件名重复
+	mutex sync.Mutex
+	count int
+}
+
+func NewFileSender(dir string) *FileSender {
+	return &FileSender{Dir: dir}
+}
+
+func (f *FileSender) Send(msg *Message) error {
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	f.count++
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), f.count)
+	f.mutex.Unlock()
+	return ioutil.WriteFile(filepath.Join(f.Dir, name), msg.Bytes(), 0644)
+}
+
+type SMTPSender struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+}
+
+func NewSMTPSender(host string, port int, user string, password string) *SMTPSender {
+	return &SMTPSender{Host: host, Port: port, User: user, Password: password}
+}
+
+func (s *SMTPSender) Send(msg *Message) error {
+	var auth smtp.Auth = nil
+	if s.User != "" {
+		auth = smtp.PlainAuth("", s.User, s.Password, s.Host)
+	}
+	return smtp.SendMail(fmt.Sprintf("%s:%d", s.Host, s.Port), auth, msg.From, []string{msg.To}, msg.Bytes())
+}
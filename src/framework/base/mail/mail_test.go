@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_MessageBytes(t *testing.T) {
+	msg := &Message{From: "a@example.com", To: "b@example.com", Subject: "重置密码", Body: "line1\nline2"}
+	raw := string(msg.Bytes())
+	if !strings.Contains(raw, "Subject: =?utf-8?q?=E9=87=8D=E7=BD=AE=E5=AF=86=E7=A0=81?=\r\n") {
+		t.Error("subject not encoded: ", raw)
+	}
+	if !strings.HasSuffix(raw, "\r\n\r\nline1\r\nline2") {
+		t.Error("wrong body: ", raw)
+	}
+	plain := &Message{Subject: "hello world"}
+	if !strings.Contains(string(plain.Bytes()), "Subject: hello world\r\n") {
+		t.Error("ascii subject should not be encoded")
+	}
+}
+
+func Test_FileSender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sender := NewFileSender(dir)
+	for i := 0; i < 2; i++ {
+		if err = sender.Send(&Message{To: "b@example.com", Subject: "test", Body: "body"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatal("expect 2 mails, got ", len(files))
+	}
+	content, _ := ioutil.ReadFile(dir + "/" + files[0].Name())
+	if !strings.Contains(string(content), "To: b@example.com") {
+		t.Error("wrong mail content: ", string(content))
+	}
+}
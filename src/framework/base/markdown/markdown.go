@@ -0,0 +1,281 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/* 评论用的Markdown子集：
+** 1. 块：```围起来的代码块、>开头的引用、-*+或者数字开头的列表，其余按空行分成段落，段内换行保留；
+** 2. 行内：`代码`、**粗体**、*斜体*、[文字](地址)、直接写出来的http(s)地址、@昵称；
+** 3. 所有文字都先转义，不支持任何原始HTML，生成的结果最后再经过一遍Sanitize。
+ */
+
+type Options struct {
+	// 返回@name要链接到的地址，返回空字符串时按普通文字输出，为nil时不处理@
+	MentionURL func(name string) string
+}
+
+const (
+	// 引用最多嵌套几层，再多的按普通文字处理
+	kMaxQuoteDepth = 3
+)
+
+var (
+	fenceRegexp       = regexp.MustCompile("^\\s*```\\s*([A-Za-z0-9_+-]*)\\s*$")
+	unorderedRegexp   = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedRegexp     = regexp.MustCompile(`^\s*\d{1,9}[.)]\s+(.*)$`)
+	quoteRegexp       = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	mentionNameRegexp = regexp.MustCompile(`^@([^\s@,，:：。!！?？()\[\]<>"'*` + "`" + `]+)`)
+	autolinkRegexp    = regexp.MustCompile(`^https?://[^\s<>"'` + "`" + `]+`)
+)
+
+func Render(text string, options *Options) string {
+	if options == nil {
+		options = &Options{}
+	}
+	r := &renderer{options: options}
+	r.blocks(splitLines(text), 0)
+	return Sanitize(r.buf.String())
+}
+
+// 正文里@到的昵称，和Render识别的规则一致，代码里的@不算
+func Mentions(text string) []string {
+	var nameList []string = nil
+	var seen map[string]bool = make(map[string]bool)
+	r := &renderer{options: &Options{MentionURL: func(name string) string {
+		if !seen[name] {
+			seen[name] = true
+			nameList = append(nameList, name)
+		}
+		return ""
+	}}}
+	r.blocks(splitLines(text), 0)
+	return nameList
+}
+
+// 统一换行符，去掉XML里不允许出现的控制字符
+func splitLines(text string) []string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.Map(func(r rune) rune {
+		if r == '\r' {
+			return '\n'
+		}
+		if (r < 0x20 && r != '\n' && r != '\t') || r == 0xFFFE || r == 0xFFFF || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.Split(text, "\n")
+}
+
+type renderer struct {
+	options *Options
+	buf     bytes.Buffer
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// 不是普通段落的行，段落遇到它们就结束
+func startsBlock(line string) bool {
+	return fenceRegexp.MatchString(line) || quoteRegexp.MatchString(line) ||
+		unorderedRegexp.MatchString(line) || orderedRegexp.MatchString(line)
+}
+
+func (r *renderer) blocks(lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRegexp.MatchString(line):
+			i = r.fence(lines, i)
+		case depth < kMaxQuoteDepth && quoteRegexp.MatchString(line):
+			var inner []string = nil
+			for ; i < len(lines) && quoteRegexp.MatchString(lines[i]); i++ {
+				inner = append(inner, quoteRegexp.FindStringSubmatch(lines[i])[1])
+			}
+			r.buf.WriteString("<blockquote>")
+			r.blocks(inner, depth+1)
+			r.buf.WriteString("</blockquote>")
+		case unorderedRegexp.MatchString(line):
+			i = r.list(lines, i, unorderedRegexp, "ul")
+		case orderedRegexp.MatchString(line):
+			i = r.list(lines, i, orderedRegexp, "ol")
+		default:
+			var paragraph []string = []string{line}
+			for i++; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+				paragraph = append(paragraph, lines[i])
+			}
+			r.buf.WriteString("<p>")
+			for index, text := range paragraph {
+				if index > 0 {
+					r.buf.WriteString("<br />")
+				}
+				r.inline(strings.TrimSpace(text), true)
+			}
+			r.buf.WriteString("</p>")
+		}
+	}
+}
+
+// 没有闭合的代码块一直到结尾
+func (r *renderer) fence(lines []string, i int) int {
+	lang := fenceRegexp.FindStringSubmatch(lines[i])[1]
+	var code []string = nil
+	for i++; i < len(lines) && !fenceRegexp.MatchString(lines[i]); i++ {
+		code = append(code, lines[i])
+	}
+	if lang != "" {
+		r.buf.WriteString(`<pre><code class="language-` + strings.ToLower(lang) + `">`)
+	} else {
+		r.buf.WriteString("<pre><code>")
+	}
+	r.buf.WriteString(html.EscapeString(strings.Join(code, "\n")))
+	r.buf.WriteString("</code></pre>")
+	return i + 1
+}
+
+// 紧跟在列表项后面的普通行接到这一项里
+func (r *renderer) list(lines []string, i int, itemRegexp *regexp.Regexp, tag string) int {
+	var items [][]string = nil
+	for i < len(lines) {
+		line := lines[i]
+		if match := itemRegexp.FindStringSubmatch(line); match != nil {
+			items = append(items, []string{match[1]})
+		} else if !isBlank(line) && !startsBlock(line) {
+			items[len(items)-1] = append(items[len(items)-1], line)
+		} else {
+			break
+		}
+		i++
+	}
+	r.buf.WriteString("<" + tag + ">")
+	for _, item := range items {
+		r.buf.WriteString("<li>")
+		for index, text := range item {
+			if index > 0 {
+				r.buf.WriteString("<br />")
+			}
+			r.inline(strings.TrimSpace(text), true)
+		}
+		r.buf.WriteString("</li>")
+	}
+	r.buf.WriteString("</" + tag + ">")
+	return i
+}
+
+// 允许的链接：http、https、mailto和站内的绝对路径
+func IsSafeURL(url string) bool {
+	lower := strings.ToLower(strings.TrimSpace(url))
+	if strings.HasPrefix(lower, "//") {
+		return false
+	}
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") ||
+		strings.HasPrefix(lower, "mailto:") || strings.HasPrefix(lower, "/")
+}
+
+func isWordBefore(text string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(text[:i])
+	return unicode.IsLetter(last) || unicode.IsDigit(last) || last == '_'
+}
+
+func (r *renderer) link(href string, text string, class string) {
+	r.buf.WriteString(`<a href="` + html.EscapeString(href) + `"`)
+	if class != "" {
+		r.buf.WriteString(` class="` + class + `"`)
+	}
+	r.buf.WriteString(` rel="nofollow">`)
+	r.buf.WriteString(text)
+	r.buf.WriteString("</a>")
+}
+
+// 把一段行内文字的结果写到单独的buffer里，用于链接文字和粗体斜体
+func (r *renderer) sub(text string, links bool) string {
+	sub := &renderer{options: r.options}
+	sub.inline(text, links)
+	return sub.buf.String()
+}
+
+// links为false时不再生成链接，避免链接套链接
+func (r *renderer) inline(text string, links bool) {
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				r.buf.WriteString("<code>" + html.EscapeString(rest[1:end+1]) + "</code>")
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				r.buf.WriteString("<strong>" + r.sub(rest[2:end+2], links) + "</strong>")
+				i += end + 4
+				continue
+			}
+		case rest[0] == '*':
+			if end := strings.IndexByte(rest[1:], '*'); end > 0 && rest[1] != ' ' {
+				r.buf.WriteString("<em>" + r.sub(rest[1:end+1], links) + "</em>")
+				i += end + 2
+				continue
+			}
+		case links && rest[0] == '[':
+			if label, href, length, ok := parseLink(rest); ok {
+				if IsSafeURL(href) {
+					r.link(href, r.sub(label, false), "")
+				} else {
+					r.buf.WriteString(r.sub(label, false))
+				}
+				i += length
+				continue
+			}
+		case links && rest[0] == 'h' && !isWordBefore(text, i):
+			if url := autolinkRegexp.FindString(rest); url != "" {
+				url = strings.TrimRight(url, ".,;:!?)]")
+				r.link(url, html.EscapeString(url), "")
+				i += len(url)
+				continue
+			}
+		case links && rest[0] == '@' && r.options.MentionURL != nil && !isWordBefore(text, i):
+			if match := mentionNameRegexp.FindStringSubmatch(rest); match != nil {
+				if href := r.options.MentionURL(match[1]); href != "" && IsSafeURL(href) {
+					r.link(href, html.EscapeString(match[0]), "mention")
+				} else {
+					r.buf.WriteString(html.EscapeString(match[0]))
+				}
+				i += len(match[0])
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		r.buf.WriteString(html.EscapeString(rest[:size]))
+		i += size
+	}
+}
+
+// [文字](地址)，返回整个链接在原文里的长度
+func parseLink(text string) (string, string, int, bool) {
+	closeLabel := strings.Index(text, "](")
+	if closeLabel <= 0 {
+		return "", "", 0, false
+	}
+	closeHref := strings.IndexByte(text[closeLabel+2:], ')')
+	if closeHref <= 0 {
+		return "", "", 0, false
+	}
+	href := strings.TrimSpace(text[closeLabel+2 : closeLabel+2+closeHref])
+	if strings.ContainsAny(href, " \t") {
+		return "", "", 0, false
+	}
+	return text[1:closeLabel], href, closeLabel + 3 + closeHref, true
+}
@@ -0,0 +1,83 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mentionOptions() *Options {
+	return &Options{MentionURL: func(name string) string {
+		if name == "小明" {
+			return "/user/3"
+		}
+		return ""
+	}}
+}
+
+func expectRender(t *testing.T, text string, expect string) {
+	if got := Render(text, mentionOptions()); got != expect {
+		t.Error("render ", text, " expect ", expect, " got ", got)
+	}
+}
+
+func Test_RenderParagraph(t *testing.T) {
+	expectRender(t, "hello\nworld\n\nnext", "<p>hello<br />world</p><p>next</p>")
+}
+
+func Test_RenderEscapeHTML(t *testing.T) {
+	expectRender(t, "<script>alert(1)</script> & <b>x</b>",
+		"<p>&lt;script&gt;alert(1)&lt;/script&gt; &amp; &lt;b&gt;x&lt;/b&gt;</p>")
+}
+
+func Test_RenderInline(t *testing.T) {
+	expectRender(t, "**bold** *em* `a<b`", "<p><strong>bold</strong> <em>em</em> <code>a&lt;b</code></p>")
+	expectRender(t, "2 * 3 * 4", "<p>2 * 3 * 4</p>")
+}
+
+func Test_RenderFence(t *testing.T) {
+	expectRender(t, "```go\nif a < b {\n}\n```\nafter",
+		"<pre><code class=\"language-go\">if a &lt; b {\n}</code></pre><p>after</p>")
+}
+
+func Test_RenderLink(t *testing.T) {
+	expectRender(t, "[blog](https://example.com/a?b=1&c=2)",
+		"<p><a href=\"https://example.com/a?b=1&amp;c=2\" rel=\"nofollow\">blog</a></p>")
+	expectRender(t, "see http://example.com.", "<p>see <a href=\"http://example.com\" rel=\"nofollow\">http://example.com</a>.</p>")
+	expectRender(t, "[x](javascript:alert(1))", "<p>x)</p>")
+	expectRender(t, "[x](//evil.com)", "<p>x</p>")
+}
+
+func Test_RenderQuoteAndList(t *testing.T) {
+	expectRender(t, "> quote\n> **b**\n\n- a\n- b\n1. c", "<blockquote><p>quote<br /><strong>b</strong></p></blockquote>"+
+		"<ul><li>a</li><li>b</li></ul><ol><li>c</li></ol>")
+}
+
+func Test_RenderMention(t *testing.T) {
+	expectRender(t, "@小明 你好 @小红 a@小明",
+		"<p><a href=\"/user/3\" class=\"mention\" rel=\"nofollow\">@小明</a> 你好 @小红 a@小明</p>")
+}
+
+func Test_Mentions(t *testing.T) {
+	names := Mentions("@a 和 @b，`@c` @a")
+	expect := []string{"a", "b"}
+	if !reflect.DeepEqual(names, expect) {
+		t.Error("expect ", expect, " got ", names)
+	}
+}
+
+func Test_Sanitize(t *testing.T) {
+	cases := map[string]string{
+		"<p onclick=\"x()\">a</p>":                     "<p>a</p>",
+		"<a href=\"javascript:alert(1)\">a</a>":        "<a rel=\"nofollow\">a</a>",
+		"<div><script>alert(1)</script>b</div>":        "b",
+		"<img src=\"x\" onerror=\"alert(1)\">":         "",
+		"<code class=\"x onload\">a</code>":            "<code>a</code>",
+		"a</p><p>b":                                    "a&lt;/p&gt;&lt;p&gt;b",
+		"<a href=\"/user/1\" rel=\"opener\">a</a><br>": "<a href=\"/user/1\" rel=\"nofollow\">a</a><br />",
+	}
+	for fragment, expect := range cases {
+		if got := Sanitize(fragment); got != expect {
+			t.Error("sanitize ", fragment, " expect ", expect, " got ", got)
+		}
+	}
+}
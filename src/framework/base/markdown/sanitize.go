@@ -0,0 +1,143 @@
+package markdown
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+/* 白名单过滤：只保留下面列出的标签和属性，其余标签去掉只留文字，script和style连内容一起去掉。
+** 链接只允许IsSafeURL的地址并且统一加上rel="nofollow"，class只允许小写字母数字和减号。
+** 解析失败时把整段当作文字转义输出。
+ */
+
+var allowedTags = map[string][]string{
+	"p":          nil,
+	"br":         nil,
+	"strong":     nil,
+	"em":         nil,
+	"code":       {"class"},
+	"pre":        nil,
+	"blockquote": nil,
+	"ul":         nil,
+	"ol":         nil,
+	"li":         nil,
+	"a":          {"href", "class"},
+}
+
+var droppedTags = map[string]bool{
+	"script": true,
+	"style":  true,
+}
+
+var classRegexp = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+const kSanitizeRoot = "sanitize-root"
+
+func allowedAttr(tag string, attr xml.Attr) bool {
+	if attr.Name.Space != "" {
+		return false
+	}
+	name := strings.ToLower(attr.Name.Local)
+	found := false
+	for _, allowed := range allowedTags[tag] {
+		if allowed == name {
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+	switch name {
+	case "href":
+		return IsSafeURL(attr.Value)
+	case "class":
+		return classRegexp.MatchString(attr.Value)
+	}
+	return true
+}
+
+func Sanitize(fragment string) string {
+	decoder := xml.NewDecoder(strings.NewReader("<" + kSanitizeRoot + ">" + fragment + "</" + kSanitizeRoot + ">"))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	var buf bytes.Buffer
+	// 每一层打开的标签，不在白名单里的记成空字符串
+	var stack []string = nil
+	// 在script、style里面的层数
+	dropping := 0
+	closed := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err != io.EOF || len(stack) != 0 {
+				return html.EscapeString(fragment)
+			}
+			break
+		}
+		// 根节点已经关闭说明片段里有多余的结束标签
+		if closed {
+			return html.EscapeString(fragment)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			tag := strings.ToLower(t.Name.Local)
+			if t.Name.Space != "" {
+				tag = ""
+			}
+			if tag == kSanitizeRoot && len(stack) == 0 {
+				stack = append(stack, kSanitizeRoot)
+				continue
+			}
+			if droppedTags[tag] || dropping > 0 {
+				dropping++
+				stack = append(stack, "")
+				continue
+			}
+			if _, ok := allowedTags[tag]; !ok {
+				stack = append(stack, "")
+				continue
+			}
+			stack = append(stack, tag)
+			buf.WriteString("<" + tag)
+			for _, attr := range t.Attr {
+				if allowedAttr(tag, attr) {
+					buf.WriteString(" " + strings.ToLower(attr.Name.Local) + `="` + html.EscapeString(attr.Value) + `"`)
+				}
+			}
+			if tag == "a" {
+				buf.WriteString(` rel="nofollow"`)
+			}
+			if tag == "br" {
+				buf.WriteString(" />")
+			} else {
+				buf.WriteString(">")
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return html.EscapeString(fragment)
+			}
+			tag := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if dropping > 0 {
+				dropping--
+				continue
+			}
+			if len(stack) == 0 {
+				closed = true
+			}
+			if tag != "" && tag != kSanitizeRoot && tag != "br" {
+				buf.WriteString("</" + tag + ">")
+			}
+		case xml.CharData:
+			if dropping == 0 {
+				buf.WriteString(html.EscapeString(string(t)))
+			}
+		}
+	}
+	return buf.String()
+}
@@ -1,134 +1,267 @@
 package schedule
 
 import (
-	"container/list"
-	"fmt"
+	"errors"
 	"sync"
 	"time"
 )
 
+/* 定时任务，时间单位都是秒：
+** NewScheduleAtTime在某个unix时间点执行一次；
+** NewScheduleAtDelay延迟t秒执行，Repeat时每隔t秒执行；
+** NewScheduleAtSecond/Minute/Hour/Day/Month/Year按对应的周期执行，t是周期内的偏移，
+** 例如NewScheduleAtDay(f, nil, 3*3600, Repeat)表示每天凌晨3点(本地时间)执行。
+** 任务函数里把*stop设为true可以停止之后的执行。
+ */
+
 const (
 	Once   = 0x0
 	Repeat = 0x1
-	time   = 0x1 << 2
-	delay  = 0x1 << 3
-	second = 0x1 << 4
-	minute = 0x1 << 5
-	hour   = 0x1 << 6
-	day    = 0x1 << 7
-	month  = 0x1 << 8
-	year   = 0x1 << 9
 )
 
+const (
+	kindTime = iota
+	kindDelay
+	kindSecond
+	kindMinute
+	kindHour
+	kindDay
+	kindMonth
+	kindYear
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
 type ScheduleFunc func(param interface{}, stop *bool)
-type schedule struct {
-	scheduleFunc func(param interface{})
+
+type Schedule struct {
+	scheduleFunc ScheduleFunc
 	param        interface{}
-	time         int64
-	runType      int64
+	t            int64
+	kind         int
+	isRepeat     bool
+	lock         sync.Mutex
+	timer        *time.Timer
+	isStopped    bool
+	mgr          *scheduleMgr
+}
+
+func newSchedule(f ScheduleFunc, param interface{}, t int64, kind int, runType int) *Schedule {
+	return &Schedule{scheduleFunc: f, param: param, t: t, kind: kind, isRepeat: runType&Repeat != 0}
+}
+
+func NewScheduleAtTime(f ScheduleFunc, param interface{}, t int64) *Schedule {
+	return newSchedule(f, param, t, kindTime, Once)
+}
+
+func NewScheduleAtDelay(f ScheduleFunc, param interface{}, t int64, runType int) *Schedule {
+	return newSchedule(f, param, t, kindDelay, runType)
 }
 
-func NewScheduleAtDelay(f ScheduleFunc, param interface{}, t int64, runType int) *schedule {
-	return &schedule{f, param, t, runType | time}
+func NewScheduleAtSecond(f ScheduleFunc, param interface{}, t int64, runType int) *Schedule {
+	return newSchedule(f, param, t, kindSecond, runType)
 }
 
-func NewScheduleAtTime(f ScheduleFunc, param interface{}, t int64) *schedule {
-	return &schedule{f, param, t, Once | delay}
+func NewScheduleAtMinute(f ScheduleFunc, param interface{}, t int64, runType int) *Schedule {
+	return newSchedule(f, param, t, kindMinute, runType)
 }
 
-func NewScheduleAtSecond(f ScheduleFunc, param interface{}, t int64, runType int) *schedule {
-	return &schedule{f, param, t, runType | second}
+func NewScheduleAtHour(f ScheduleFunc, param interface{}, t int64, runType int) *Schedule {
+	return newSchedule(f, param, t, kindHour, runType)
 }
 
-func NewScheduleAtMinute(f ScheduleFunc, param interface{}, t int64, runType int) *schedule {
-	return &schedule{f, param, t, runType | minute}
+func NewScheduleAtDay(f ScheduleFunc, param interface{}, t int64, runType int) *Schedule {
+	return newSchedule(f, param, t, kindDay, runType)
 }
 
-func NewScheduleAtHour(f ScheduleFunc, param interface{}, t int64, runType int) *schedule {
-	return &schedule{f, param, t, runType | hour}
+func NewScheduleAtMonth(f ScheduleFunc, param interface{}, t int64, runType int) *Schedule {
+	return newSchedule(f, param, t, kindMonth, runType)
 }
 
-func NewScheduleAtDay(f ScheduleFunc, param interface{}, t int64, runType int) *schedule {
-	return &schedule{f, param, t, runType | day}
+func NewScheduleAtYear(f ScheduleFunc, param interface{}, t int64, runType int) *Schedule {
+	return newSchedule(f, param, t, kindYear, runType)
 }
 
-func NewScheduleAtMonth(f ScheduleFunc, param interface{}, t int64, runType int) *schedule {
-	return &schedule{f, param, t, runType | month}
+// 周期内偏移的上限，月和年按最短的长度算
+func (s *Schedule) maxOffset() int64 {
+	switch s.kind {
+	case kindSecond:
+		return 1
+	case kindMinute:
+		return 60
+	case kindHour:
+		return 3600
+	case kindDay:
+		return 24 * 3600
+	case kindMonth:
+		return 28 * 24 * 3600
+	case kindYear:
+		return 365 * 24 * 3600
+	}
+	return 0
+}
+
+func (s *Schedule) validate() error {
+	if s.scheduleFunc == nil {
+		return ErrInvalidSchedule
+	}
+	switch s.kind {
+	case kindTime:
+		return nil
+	case kindDelay:
+		if s.t <= 0 {
+			return ErrInvalidSchedule
+		}
+		return nil
+	}
+	if s.t < 0 || s.t >= s.maxOffset() {
+		return ErrInvalidSchedule
+	}
+	return nil
 }
 
-func NewScheduleAtYear(f ScheduleFunc, param interface{}, t int64, runType int) *schedule {
-	return &schedule{f, param, t, runType | year}
+// 当前周期的开始时间，next为true时返回下一个周期的开始时间
+func (s *Schedule) periodStart(now time.Time, next bool) time.Time {
+	step := 0
+	if next {
+		step = 1
+	}
+	year, month, day := now.Date()
+	hour, minute, second := now.Clock()
+	loc := now.Location()
+	switch s.kind {
+	case kindSecond:
+		return time.Date(year, month, day, hour, minute, second+step, 0, loc)
+	case kindMinute:
+		return time.Date(year, month, day, hour, minute+step, 0, 0, loc)
+	case kindHour:
+		return time.Date(year, month, day, hour+step, 0, 0, 0, loc)
+	case kindDay:
+		return time.Date(year, month, day+step, 0, 0, 0, 0, loc)
+	case kindMonth:
+		return time.Date(year, month+time.Month(step), 1, 0, 0, 0, 0, loc)
+	}
+	return time.Date(year+step, time.January, 1, 0, 0, 0, 0, loc)
+}
+
+// 计算now之后的下一次执行时间
+func (s *Schedule) nextTime(now time.Time) time.Time {
+	offset := time.Duration(s.t) * time.Second
+	switch s.kind {
+	case kindTime:
+		return time.Unix(s.t, 0)
+	case kindDelay:
+		return now.Add(offset)
+	}
+	next := s.periodStart(now, false).Add(offset)
+	if !next.After(now) {
+		next = s.periodStart(now, true).Add(offset)
+	}
+	return next
+}
+
+func (s *Schedule) start(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.isStopped {
+		return
+	}
+	delay := s.nextTime(now).Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	s.timer = time.AfterFunc(delay, s.fire)
+}
+
+func (s *Schedule) fire() {
+	stop := false
+	s.scheduleFunc(s.param, &stop)
+	if s.isRepeat && !stop && s.kind != kindTime {
+		s.start(time.Now())
+		return
+	}
+	s.Stop()
+}
+
+// 停止之后不会再执行，已经在执行的不受影响
+func (s *Schedule) Stop() {
+	s.lock.Lock()
+	s.isStopped = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	mgr := s.mgr
+	s.lock.Unlock()
+	if mgr != nil {
+		mgr.remove(s)
+	}
 }
 
 type scheduleMgr struct {
-	scheduleList *list.List
+	lock         sync.Mutex
+	scheduleList map[*Schedule]bool
+	isRunning    bool
 }
 
 var scheduleOnce sync.Once
 var scheduleMgrInstance *scheduleMgr = nil
 
+func newScheduleMgr() *scheduleMgr {
+	return &scheduleMgr{scheduleList: make(map[*Schedule]bool)}
+}
+
 func GetScheduleMgrInstance() *scheduleMgr {
 	scheduleOnce.Do(func() {
-		scheduleMgr = &scheduleMgr{}
+		scheduleMgrInstance = newScheduleMgr()
 	})
-	return scheduleMgr
+	return scheduleMgrInstance
 }
 
-func (s *scheduleMgr) RegisterSchedule(work ScheduleWork) {
-	if s.scheduleList == nil {
-		s.scheduleList = list.New()
+// Run之后注册的任务立即开始计时
+func (s *scheduleMgr) RegisterSchedule(work *Schedule) error {
+	if err := work.validate(); err != nil {
+		return err
+	}
+	work.lock.Lock()
+	work.mgr = s
+	work.lock.Unlock()
+	s.lock.Lock()
+	s.scheduleList[work] = true
+	isRunning := s.isRunning
+	s.lock.Unlock()
+	if isRunning {
+		work.start(time.Now())
 	}
-	s.scheduleList.PushBack(work)
+	return nil
 }
 
-func (s *scheduleMgr) runSchedule(schdule ScheduleWork, t int64, runType int) {
-	isRepeat := bool(runType & Repeat)
-	var nextTime int64 = 0
-	switch runType {
-	case delay:
-		nextTime = t
-	case time:
-		currentTime := time.Now().Unix()
-		if t <= currentTime {
-			panic("error")
-		}
-		nextTime = (t - currentTime)
-	case second:
-		if t >= time.Second {
-			panic("error")
-		}
-		nextTime = (time.Now().Unix()/time.Second)*time.Second + t
-	case minute:
-		if t >= time.Minute {
-			panic("error")
-		}
-		nextTime = (time.Now().Unix()/time.Minute)*time.Minute + t
-	case hour:
-		if t >= time.Hour {
-			panic("hour")
-		}
-		nextTime = (time.Now().Unix()/time.Hour)*time.Hour + t
-		// case month:
-		// 	if t >= time.Month {
-		// 		panic("hour")
-		// 	}
-		// 	nextTime = (time.Now().Unix()/time.Month)*time.Month + t
-		// case year:
-		// 	if t >= time.Ye {
-		// 		panic("hour")
-		// 	}
-		// 	nextTime = (time.Now().Unix()/time.Hour)*time.Hour + t
-	}
-	timer := time.NewTimer(t)
-	go func() {
-		<-timer.C
-		schdule()
-	}()
+func (s *scheduleMgr) remove(work *Schedule) {
+	s.lock.Lock()
+	delete(s.scheduleList, work)
+	s.lock.Unlock()
+}
+
+// 当前还没有结束的任务数
+func (s *scheduleMgr) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.scheduleList)
 }
 
 func (s *scheduleMgr) Run() {
-	for iter := s.scheduleList.Front(); iter != nil; iter = iter.Next() {
-		schedule := iter.Value.(ScheduleWork)
-		s.runSchedule(schdule)
+	s.lock.Lock()
+	if s.isRunning {
+		s.lock.Unlock()
+		return
+	}
+	s.isRunning = true
+	var workList []*Schedule = nil
+	for work := range s.scheduleList {
+		workList = append(workList, work)
+	}
+	s.lock.Unlock()
+	now := time.Now()
+	for _, work := range workList {
+		work.start(now)
 	}
 }
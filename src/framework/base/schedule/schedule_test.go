@@ -0,0 +1,97 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func noop(param interface{}, stop *bool) {}
+
+func Test_NextTime(t *testing.T) {
+	now := time.Date(2017, time.March, 31, 10, 20, 30, 0, time.Local)
+	cases := []struct {
+		s      *Schedule
+		expect time.Time
+	}{
+		{NewScheduleAtDelay(noop, nil, 5, Once), now.Add(5 * time.Second)},
+		{NewScheduleAtTime(noop, nil, now.Unix()+100), now.Add(100 * time.Second)},
+		{NewScheduleAtMinute(noop, nil, 40, Repeat), time.Date(2017, time.March, 31, 10, 20, 40, 0, time.Local)},
+		{NewScheduleAtMinute(noop, nil, 10, Repeat), time.Date(2017, time.March, 31, 10, 21, 10, 0, time.Local)},
+		{NewScheduleAtHour(noop, nil, 30*60, Repeat), time.Date(2017, time.March, 31, 10, 30, 0, 0, time.Local)},
+		{NewScheduleAtDay(noop, nil, 3*3600, Repeat), time.Date(2017, time.April, 1, 3, 0, 0, 0, time.Local)},
+		{NewScheduleAtMonth(noop, nil, 0, Repeat), time.Date(2017, time.April, 1, 0, 0, 0, 0, time.Local)},
+		{NewScheduleAtYear(noop, nil, 0, Repeat), time.Date(2018, time.January, 1, 0, 0, 0, 0, time.Local)},
+	}
+	for i, c := range cases {
+		if next := c.s.nextTime(now); !next.Equal(c.expect) {
+			t.Error("case ", i, " expect ", c.expect, " got ", next)
+		}
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	mgr := newScheduleMgr()
+	if mgr.RegisterSchedule(NewScheduleAtMinute(noop, nil, 60, Repeat)) == nil {
+		t.Error("expect offset error")
+	}
+	if mgr.RegisterSchedule(NewScheduleAtDelay(noop, nil, 0, Once)) == nil {
+		t.Error("expect delay error")
+	}
+	if mgr.RegisterSchedule(NewScheduleAtDelay(nil, nil, 1, Once)) == nil {
+		t.Error("expect nil func error")
+	}
+}
+
+func Test_RunOnce(t *testing.T) {
+	mgr := newScheduleMgr()
+	done := make(chan interface{}, 1)
+	mgr.Run()
+	mgr.RegisterSchedule(NewScheduleAtTime(func(param interface{}, stop *bool) {
+		done <- param
+	}, "publish", time.Now().Unix()))
+	select {
+	case param := <-done:
+		if param.(string) != "publish" {
+			t.Error("unexpected param: ", param)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("schedule not fired")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if mgr.Len() != 0 {
+		t.Error("finished schedule should be removed")
+	}
+}
+
+func Test_RepeatStop(t *testing.T) {
+	mgr := newScheduleMgr()
+	count := make(chan int, 10)
+	index := 0
+	mgr.RegisterSchedule(NewScheduleAtDelay(func(param interface{}, stop *bool) {
+		index++
+		count <- index
+		if index == 2 {
+			*stop = true
+		}
+	}, nil, 1, Repeat))
+	mgr.Run()
+	timeout := time.After(4 * time.Second)
+	for i := 1; i <= 2; i++ {
+		select {
+		case n := <-count:
+			if n != i {
+				t.Error("unexpected count: ", n)
+			}
+		case <-timeout:
+			t.Fatal("schedule not fired")
+		}
+	}
+	select {
+	case <-count:
+		t.Error("schedule should be stopped")
+	case <-time.After(1500 * time.Millisecond):
+	}
+	if mgr.Len() != 0 {
+		t.Error("stopped schedule should be removed")
+	}
+}
@@ -0,0 +1,137 @@
+package scrypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+/* scrypt密钥派生函数(RFC 7914)，用来保存密码：
+** 先用PBKDF2-HMAC-SHA256把密码展开成p个块，每块用ROMix混合(需要128*r*N字节内存)，
+** 再用PBKDF2把混合的结果压缩成需要的长度。N越大越慢、越占内存，暴力破解的代价越高。
+ */
+
+var ErrInvalidParams = errors.New("scrypt: invalid parameters")
+
+// PBKDF2-HMAC-SHA256
+func pbkdf2(password []byte, salt []byte, iterations int, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte = nil
+	var counter [4]byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], block)
+		prf.Write(counter[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// Salsa20/8核心，结果异或回b
+func salsa208(b *[16]uint32) {
+	x := *b
+	for i := 0; i < 8; i += 2 {
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+	for i := range b {
+		b[i] += x[i]
+	}
+}
+
+// BlockMix：b有2r个64字节的块，结果写到y，偶数块放前半部分，奇数块放后半部分
+func blockMix(b []uint32, y []uint32, r int) {
+	var x [16]uint32
+	copy(x[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		for j := range x {
+			x[j] ^= b[i*16+j]
+		}
+		salsa208(&x)
+		offset := (i/2)*16 + (i%2)*r*16
+		copy(y[offset:], x[:])
+	}
+}
+
+func roMix(block []byte, r int, n int) {
+	words := 32 * r
+	x := make([]uint32, words)
+	y := make([]uint32, words)
+	v := make([]uint32, words*n)
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(block[i*4:])
+	}
+	for i := 0; i < n; i++ {
+		copy(v[i*words:], x)
+		blockMix(x, y, r)
+		x, y = y, x
+	}
+	for i := 0; i < n; i++ {
+		j := int(x[(2*r-1)*16] & uint32(n-1))
+		for k := range x {
+			x[k] ^= v[j*words+k]
+		}
+		blockMix(x, y, r)
+		x, y = y, x
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(block[i*4:], x[i])
+	}
+}
+
+// n必须是大于1的2的幂，r*p要小于2^30
+func Key(password []byte, salt []byte, n int, r int, p int, keyLen int) ([]byte, error) {
+	if n <= 1 || n&(n-1) != 0 || r <= 0 || p <= 0 || keyLen <= 0 || uint64(r)*uint64(p) >= 1<<30 ||
+		r > (1<<31-1)/128/p || n > (1<<31-1)/128/r {
+		return nil, ErrInvalidParams
+	}
+	b := pbkdf2(password, salt, 1, p*128*r)
+	for i := 0; i < p; i++ {
+		roMix(b[i*128*r:(i+1)*128*r], r, n)
+	}
+	return pbkdf2(password, b, 1, keyLen), nil
+}
@@ -0,0 +1,53 @@
+package scrypt
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// RFC 7914里的测试向量，最后一组需要1GB内存，这里跳过
+func Test_KeyVectors(t *testing.T) {
+	cases := []struct {
+		password string
+		salt     string
+		n, r, p  int
+		expect   string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442" +
+			"fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162" +
+			"2eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2" +
+			"d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+	}
+	for _, c := range cases {
+		key, err := Key([]byte(c.password), []byte(c.salt), c.n, c.r, c.p, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(key) != c.expect {
+			t.Error("wrong key for ", c.password, ": ", hex.EncodeToString(key))
+		}
+	}
+}
+
+func Test_PBKDF2(t *testing.T) {
+	// RFC 7914第11节的PBKDF2-HMAC-SHA256测试向量
+	key := pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)
+	expect := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+		"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(key) != expect {
+		t.Error("wrong pbkdf2 key: ", hex.EncodeToString(key))
+	}
+}
+
+func Test_KeyInvalidParams(t *testing.T) {
+	for _, n := range []int{0, 1, 3, 1000} {
+		if _, err := Key([]byte("a"), []byte("b"), n, 8, 1, 32); err != ErrInvalidParams {
+			t.Error("expect invalid params for n = ", n)
+		}
+	}
+	if _, err := Key([]byte("a"), []byte("b"), 16, 0, 1, 32); err != ErrInvalidParams {
+		t.Error("expect invalid params for r = 0")
+	}
+}
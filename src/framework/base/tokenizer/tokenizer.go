@@ -0,0 +1,115 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+/* 简单的中英文混合分词：
+** 1. 英文、数字按连续的字母数字切成单词，统一转成小写。
+** 2. 中日韩文字没有分隔符，按字切成n-gram，建索引时同时输出单字和相邻两个字，
+**    查询时只输出相邻两个字(单独一个字时输出单字)，这样"博客"能匹配"个人博客系统"。
+** Start/End是token在原始字符串里的字节偏移，用来做高亮。
+ */
+
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+type runeInfo struct {
+	r     rune
+	start int
+	end   int
+}
+
+// 全角字母数字转半角，再转小写
+func normalizeRune(r rune) rune {
+	if r >= 0xFF01 && r <= 0xFF5E {
+		r -= 0xFEE0
+	}
+	return unicode.ToLower(r)
+}
+
+func IsCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !IsCJK(r)
+}
+
+func tokenize(text string, unigram bool) []Token {
+	var tokens []Token = nil
+	var word []runeInfo = nil
+	var cjk []runeInfo = nil
+	flushWord := func() {
+		if len(word) > 0 {
+			var term []rune = make([]rune, 0, len(word))
+			for _, info := range word {
+				term = append(term, info.r)
+			}
+			tokens = append(tokens, Token{string(term), word[0].start, word[len(word)-1].end})
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			tokens = append(tokens, Token{string(cjk[0].r), cjk[0].start, cjk[0].end})
+		} else {
+			for i := 0; i < len(cjk); i++ {
+				if unigram {
+					tokens = append(tokens, Token{string(cjk[i].r), cjk[i].start, cjk[i].end})
+				}
+				if i+1 < len(cjk) {
+					tokens = append(tokens, Token{string([]rune{cjk[i].r, cjk[i+1].r}), cjk[i].start, cjk[i+1].end})
+				}
+			}
+		}
+		cjk = cjk[:0]
+	}
+	for offset := 0; offset < len(text); {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		info := runeInfo{normalizeRune(r), offset, offset + size}
+		offset += size
+		switch {
+		case IsCJK(info.r):
+			flushWord()
+			cjk = append(cjk, info)
+		case isWordRune(info.r):
+			flushCJK()
+			word = append(word, info)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// 建索引用，中文同时输出单字和二元组
+func Tokenize(text string) []Token {
+	return tokenize(text, true)
+}
+
+// 查询用，中文只输出二元组
+func TokenizeQuery(text string) []Token {
+	return tokenize(text, false)
+}
+
+// 只需要词，不需要位置时使用，去掉重复的词并保持顺序
+func Terms(tokens []Token) []string {
+	var terms []string = nil
+	var seen map[string]bool = make(map[string]bool)
+	for _, token := range tokens {
+		if !seen[token.Term] {
+			seen[token.Term] = true
+			terms = append(terms, token.Term)
+		}
+	}
+	return terms
+}
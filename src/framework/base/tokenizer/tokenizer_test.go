@@ -0,0 +1,65 @@
+package tokenizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func termsOf(tokens []Token) []string {
+	var terms []string = nil
+	for _, token := range tokens {
+		terms = append(terms, token.Term)
+	}
+	return terms
+}
+
+func Test_TokenizeEnglish(t *testing.T) {
+	terms := termsOf(Tokenize("Hello, Golang 1.7!"))
+	expect := []string{"hello", "golang", "1", "7"}
+	if !reflect.DeepEqual(terms, expect) {
+		t.Error("expect ", expect, " got ", terms)
+	}
+}
+
+func Test_TokenizeChinese(t *testing.T) {
+	terms := termsOf(Tokenize("博客系统"))
+	expect := []string{"博", "博客", "客", "客系", "系", "系统", "统"}
+	if !reflect.DeepEqual(terms, expect) {
+		t.Error("expect ", expect, " got ", terms)
+	}
+}
+
+func Test_TokenizeQuery(t *testing.T) {
+	terms := termsOf(TokenizeQuery("Go语言 树"))
+	expect := []string{"go", "语言", "树"}
+	if !reflect.DeepEqual(terms, expect) {
+		t.Error("expect ", expect, " got ", terms)
+	}
+}
+
+func Test_TokenizeFullWidth(t *testing.T) {
+	terms := termsOf(Tokenize("ＧＯ"))
+	if len(terms) != 1 || terms[0] != "go" {
+		t.Error("full width not normalized: ", terms)
+	}
+}
+
+func Test_TokenOffset(t *testing.T) {
+	text := "学习Golang"
+	tokens := Tokenize(text)
+	for _, token := range tokens {
+		if token.Term == "golang" && text[token.Start:token.End] != "Golang" {
+			t.Error("wrong offset: ", token)
+		}
+		if token.Term == "学习" && text[token.Start:token.End] != "学习" {
+			t.Error("wrong offset: ", token)
+		}
+	}
+}
+
+func Test_Terms(t *testing.T) {
+	terms := Terms(Tokenize("go Go GO"))
+	if len(terms) != 1 || terms[0] != "go" {
+		t.Error("terms not unique: ", terms)
+	}
+}
@@ -0,0 +1,112 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/* 基于时间的一次性密码(RFC 6238)，和Google Authenticator等应用兼容：
+** 密钥用base32编码，每30秒一个6位数字，算法是以时间步为计数器的HOTP(RFC 4226，HMAC-SHA1)。
+** URI生成otpauth://格式的链接，客户端把它画成二维码给应用扫描。
+ */
+
+const (
+	Digits = 6
+	Period = 30
+	// 密钥长度，RFC 4226推荐160位
+	kSecretSize = 20
+)
+
+var ErrInvalidSecret = errors.New("totp: invalid secret")
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// 随机生成base32编码的密钥
+func GenerateSecret() (string, error) {
+	buf := make([]byte, kSecretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(buf), nil
+}
+
+// 应用里显示的密钥可能带空格、小写或者补位的=
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	key, err := secretEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+func hotp(key []byte, counter uint64, digits int) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(buf[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// t所在的时间步
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(Step(t)), Digits), nil
+}
+
+/* 校验code，允许前后skew个时间步的误差，用来容忍手机和服务器的时钟偏差。
+** 通过时返回匹配的时间步，调用者记下用过的时间步，防止同一个code被重复使用。
+ */
+func Validate(secret string, code string, t time.Time, skew int) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	step := Step(t)
+	for i := -skew; i <= skew; i++ {
+		expect := hotp(key, uint64(step+int64(i)), Digits)
+		if subtle.ConstantTimeCompare([]byte(expect), []byte(code)) == 1 {
+			return step + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// otpauth://totp/issuer:account?secret=xxx&issuer=xxx
+func URI(issuer string, account string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(Digits))
+	values.Set("period", fmt.Sprint(Period))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
@@ -0,0 +1,94 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 4226附录D的HOTP测试向量
+func Test_HOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	expect := []string{"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489"}
+	for i, code := range expect {
+		if value := hotp(key, uint64(i), 6); value != code {
+			t.Error("wrong hotp for counter ", i, ": ", value)
+		}
+	}
+}
+
+// RFC 6238附录B里SHA1的测试向量，8位数字
+func Test_TOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	cases := []struct {
+		time   int64
+		expect string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		if value := hotp(key, uint64(Step(time.Unix(c.time, 0))), 8); value != c.expect {
+			t.Error("wrong totp at ", c.time, ": ", value)
+		}
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1500000000, 0)
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, ok := Validate(secret, code, now, 1)
+	if !ok || step != Step(now) {
+		t.Error("current code should be valid")
+	}
+	// 小写、带空格的密钥也能用
+	if _, ok := Validate(strings.ToLower(secret[:4])+" "+secret[4:], code, now, 1); !ok {
+		t.Error("secret should be normalized")
+	}
+	if _, ok := Validate(secret, code, now.Add(Period*time.Second), 1); !ok {
+		t.Error("previous step should be accepted with skew 1")
+	}
+	if _, ok := Validate(secret, code, now.Add(2*Period*time.Second), 1); ok {
+		t.Error("code two steps ago should be rejected")
+	}
+	if _, ok := Validate(secret, code, now.Add(Period*time.Second), 0); ok {
+		t.Error("previous step should be rejected without skew")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Error("short code should be rejected")
+	}
+	if _, ok := Validate("not base32!", code, now, 1); ok {
+		t.Error("invalid secret should be rejected")
+	}
+}
+
+func Test_URI(t *testing.T) {
+	uri := URI("风的博客", "sjjwind", "JBSWY3DPEHPK3PXP")
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Error("wrong uri: ", uri)
+	}
+	if parsed.Path != "/风的博客:sjjwind" {
+		t.Error("wrong label: ", parsed.Path)
+	}
+	query := parsed.Query()
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "风的博客" || query.Get("digits") != "6" {
+		t.Error("wrong query: ", parsed.RawQuery)
+	}
+}
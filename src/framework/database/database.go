@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	"strings"
 )
 
 const (
@@ -56,3 +57,55 @@ func (this *Database) DoesTableExist(tableName string) bool {
 	}
 	return false
 }
+
+func (this *Database) DoesColumnExist(tableName string, columnName string) bool {
+	rows, err := this.DB.Query("select * from `INFORMATION_SCHEMA`.`COLUMNS` where table_name = ? and column_name = ? and TABLE_SCHEMA = ?",
+		tableName, columnName, kDatabaseName)
+	if err == nil {
+		defer rows.Close()
+		if rows.Next() {
+			return true
+		}
+	}
+	return false
+}
+
+// 老表升级时补充新加的列，definition例如 "int(32) NOT NULL DEFAULT '0'"
+func (this *Database) AddColumnIfNotExist(tableName string, columnName string, definition string) error {
+	if this.DoesColumnExist(tableName, columnName) {
+		return nil
+	}
+	_, err := this.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", tableName, columnName, definition))
+	return err
+}
+
+func (this *Database) DoesIndexExist(tableName string, indexName string) bool {
+	rows, err := this.DB.Query("select * from `INFORMATION_SCHEMA`.`STATISTICS` where table_name = ? and index_name = ? and TABLE_SCHEMA = ?",
+		tableName, indexName, kDatabaseName)
+	if err == nil {
+		defer rows.Close()
+		if rows.Next() {
+			return true
+		}
+	}
+	return false
+}
+
+// 老表升级时补充新加的索引，definition例如 "UNIQUE KEY name (type, open_id)"，其中的名字要和indexName一致
+func (this *Database) AddIndexIfNotExist(tableName string, indexName string, definition string) error {
+	if this.DoesIndexExist(tableName, indexName) {
+		return nil
+	}
+	_, err := this.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD %s", tableName, definition))
+	return err
+}
+
+// 是不是违反了唯一索引indexName的错误(mysql的1062)，不同版本的mysql在索引名前面可能带表名
+func IsDuplicateKey(err error, indexName string) bool {
+	if err == nil {
+		return false
+	}
+	message := err.Error()
+	return strings.Contains(message, "1062") && (strings.HasSuffix(message, "'"+indexName+"'") ||
+		strings.HasSuffix(message, "."+indexName+"'"))
+}
@@ -0,0 +1,273 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/* 表的导出和导入，用于备份。
+** 导出格式是json lines：第一行是表头，包含建表语句和列名，之后每一行是一条记录。
+** 所有的值都按原始字节做base64导出，NULL导出为null，导入时交给mysql转换类型。
+** 老版本的导出没有encoding，值是原样的字符串。
+ */
+
+const (
+	kEncodingBase64 = "base64"
+	// 导入时的临时表以及替换下来的旧表
+	kStagingSuffix  = "_restore"
+	kReplacedSuffix = "_restore_old"
+)
+
+type tableHeader struct {
+	Table    string   `json:"table"`
+	Create   string   `json:"create"`
+	Columns  []string `json:"columns"`
+	Encoding string   `json:"encoding,omitempty"`
+}
+
+func queryTableList(query func(string, ...interface{}) (*sql.Rows, error)) ([]string, error) {
+	rows, err := query("select table_name from `INFORMATION_SCHEMA`.`TABLES` where TABLE_SCHEMA = ? order by table_name",
+		kDatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tableList []string = nil
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tableList = append(tableList, name)
+	}
+	return tableList, rows.Err()
+}
+
+// 数据库里所有的表
+func (this *Database) TableList() ([]string, error) {
+	return queryTableList(this.DB.Query)
+}
+
+/* 导出用的快照，所有的表在同一个连接的同一个事务里读，
+** START TRANSACTION WITH CONSISTENT SNAPSHOT保证导出过程中的写入不会让表之间对不上。
+ */
+type Snapshot struct {
+	conn *sql.Conn
+	ctx  context.Context
+}
+
+func (this *Database) BeginSnapshot() (*Snapshot, error) {
+	ctx := context.Background()
+	conn, err := this.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Snapshot{conn: conn, ctx: ctx}, nil
+}
+
+func (s *Snapshot) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.conn.QueryContext(s.ctx, query, args...)
+}
+
+func (s *Snapshot) TableList() ([]string, error) {
+	return queryTableList(s.query)
+}
+
+func (s *Snapshot) DumpTable(tableName string, w io.Writer) error {
+	var name, create string
+	err := s.conn.QueryRowContext(s.ctx, fmt.Sprintf("SHOW CREATE TABLE `%s`", tableName)).Scan(&name, &create)
+	if err != nil {
+		return err
+	}
+	rows, err := s.query(fmt.Sprintf("select * from `%s`", tableName))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	header := &tableHeader{Table: tableName, Create: create, Columns: columns, Encoding: kEncodingBase64}
+	if err = encoder.Encode(header); err != nil {
+		return err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]*string, len(columns))
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, value := range values {
+			if value == nil {
+				record[i] = nil
+			} else {
+				s := base64.StdEncoding.EncodeToString(value)
+				record[i] = &s
+			}
+		}
+		if err = encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// 只读事务，结束时回滚
+func (s *Snapshot) Close() error {
+	_, err := s.conn.ExecContext(s.ctx, "ROLLBACK")
+	if closeErr := s.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func stagingTable(tableName string) string {
+	return tableName + kStagingSuffix
+}
+
+/* 把导出的数据导入到<表名>_restore，不会改动原来的表。
+** 表头里的表名必须是tableName，建表语句只能建这张表，检查通过之前不会执行任何DDL。
+ */
+func (this *Database) StageTable(r io.Reader, tableName string) error {
+	decoder := json.NewDecoder(r)
+	var header tableHeader
+	if err := decoder.Decode(&header); err != nil {
+		return err
+	}
+	if header.Table != tableName || len(header.Columns) == 0 {
+		return fmt.Errorf("table header mismatch: %s", header.Table)
+	}
+	if header.Encoding != "" && header.Encoding != kEncodingBase64 {
+		return fmt.Errorf("unsupport encoding: %s", header.Encoding)
+	}
+	createPrefix := fmt.Sprintf("CREATE TABLE `%s` ", tableName)
+	if !strings.HasPrefix(header.Create, createPrefix) {
+		return errors.New("invalid create statement")
+	}
+	staging := stagingTable(tableName)
+	create := fmt.Sprintf("CREATE TABLE `%s` ", staging) + header.Create[len(createPrefix):]
+	if _, err := this.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS `%s`", staging)); err != nil {
+		return err
+	}
+	if _, err := this.DB.Exec(create); err != nil {
+		return err
+	}
+	tx, err := this.DB.Begin()
+	if err == nil {
+		if err = insertRecords(tx, staging, &header, decoder); err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}
+	if err != nil {
+		this.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS `%s`", staging))
+		return err
+	}
+	return nil
+}
+
+func insertRecords(tx *sql.Tx, staging string, header *tableHeader, decoder *json.Decoder) error {
+	columns := ""
+	placeholder := ""
+	for i, column := range header.Columns {
+		if i > 0 {
+			columns += ", "
+			placeholder += ", "
+		}
+		columns += "`" + strings.Replace(column, "`", "``", -1) + "`"
+		placeholder += "?"
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf("insert into `%s`(%s) values(%s)", staging, columns, placeholder))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	args := make([]interface{}, len(header.Columns))
+	for {
+		var record []*string
+		err = decoder.Decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) != len(header.Columns) {
+			return fmt.Errorf("table %s: column count mismatch", header.Table)
+		}
+		for i, value := range record {
+			if value == nil {
+				args[i] = nil
+			} else if header.Encoding == kEncodingBase64 {
+				if args[i], err = base64.StdEncoding.DecodeString(*value); err != nil {
+					return err
+				}
+			} else {
+				args[i] = *value
+			}
+		}
+		if _, err = stmt.Exec(args...); err != nil {
+			return err
+		}
+	}
+}
+
+// 导入失败时删掉已经建好的临时表
+func (this *Database) DropStagedTables(tableList []string) {
+	for _, tableName := range tableList {
+		if _, err := this.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS `%s`", stagingTable(tableName))); err != nil {
+			fmt.Println("drop staging table error: ", err)
+		}
+	}
+}
+
+/* 用一条RENAME TABLE把所有临时表换成正式的表，mysql保证这一条语句是原子的，
+** 要么全部替换，要么都不变。替换下来的旧表最后删掉。
+ */
+func (this *Database) SwapStagedTables(tableList []string) error {
+	var renameList, replacedList []string
+	for _, tableName := range tableList {
+		replaced := tableName + kReplacedSuffix
+		if _, err := this.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS `%s`", replaced)); err != nil {
+			return err
+		}
+		if this.DoesTableExist(tableName) {
+			renameList = append(renameList, fmt.Sprintf("`%s` TO `%s`", tableName, replaced))
+			replacedList = append(replacedList, replaced)
+		}
+		renameList = append(renameList, fmt.Sprintf("`%s` TO `%s`", stagingTable(tableName), tableName))
+	}
+	if len(renameList) == 0 {
+		return nil
+	}
+	if _, err := this.DB.Exec("RENAME TABLE " + strings.Join(renameList, ", ")); err != nil {
+		return err
+	}
+	for _, replaced := range replacedList {
+		if _, err := this.DB.Exec(fmt.Sprintf("DROP TABLE IF EXISTS `%s`", replaced)); err != nil {
+			fmt.Println("drop replaced table error: ", err)
+		}
+	}
+	return nil
+}
@@ -12,6 +12,8 @@ const (
 	// blog
 	ErrorBlogExist = 1000
 	ErrorEmptyBlog = 1001
+	// 博客不存在或者还没有发布
+	ErrorBlogNotExist = 1002
 
 	// plugin
 	ErrorPluginNotExist   = 2000
@@ -24,9 +26,30 @@ const (
 	ErrorRunTimeError = 3000
 
 	// account
-	ErrorAccountNotLogin  = 4000
+	ErrorAccountNotLogin = 4000
+	// 被封禁的用户不能评论和投票
+	ErrorAccountBanned = 4001
+	// 注册时用户名或者邮箱已经被使用
+	ErrorAccountExist = 4002
+	// 用户名或者密码错误
+	ErrorAccountPasswordError = 4003
+	// 找回密码的令牌无效或者已经过期
+	ErrorAccountTokenError = 4004
+	// 操作太频繁
+	ErrorAccountTooFrequent = 4005
+	// 主人密码正确，还需要两步验证的code
+	ErrorAccountNeedTOTP  = 4006
 	ErrorAccountAuthError = 5005
 
 	// file
 	ErrorFileNotExist = 5000
+
+	// comment
+	ErrorCommentNotExist = 6000
+	// 博客(插件)已经关闭评论
+	ErrorCommentClosed = 6001
+	// 超过了可以编辑的时间
+	ErrorCommentEditExpired = 6002
+	// 游客评论的验证码不对或者已经过期
+	ErrorCaptchaError = 6003
 )
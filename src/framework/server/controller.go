@@ -8,6 +8,7 @@ import (
 	"framework/server/session/redis"
 	"golang.org/x/net/websocket"
 	"net/http"
+	"strconv"
 )
 
 // session两天过期
@@ -83,6 +84,24 @@ func (s *SessionController) HandlerRequest(controller SessionControllerInterface
 	}
 }
 
+// 通过第三方帐号或者本地帐号登录的用户id，没有登录返回0
+func (s *SessionController) LoginUserId() int64 {
+	status, err := s.WebSession.Get("status")
+	if err != nil || status != "login" {
+		return 0
+	}
+	uid, err := s.WebSession.Get("id")
+	if err != nil {
+		return 0
+	}
+	text, _ := uid.(string)
+	userId, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return userId
+}
+
 func (s *SessionController) GetSessionMgr() *session.SessoinMgr {
 	if sessionMgrInstance == nil {
 		sessionMgrInstance = session.NewSessionManager(s.newSessionStorage())
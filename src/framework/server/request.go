@@ -0,0 +1,73 @@
+package server
+
+import (
+	"framework/base/config"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 配置里的可信反向代理，可以是ip或者cidr，比如["127.0.0.1", "10.0.0.0/8"]
+func trustedProxies() []*net.IPNet {
+	var ret []*net.IPNet = nil
+	proxyList, _ := config.GetDefaultConfigJsonReader().Get("net.trusted_proxies").([]interface{})
+	for _, proxy := range proxyList {
+		text, ok := proxy.(string)
+		if !ok {
+			continue
+		}
+		text = strings.TrimSpace(text)
+		// 单个地址当成/32或者/128
+		if !strings.Contains(text, "/") {
+			if strings.Contains(text, ":") {
+				text += "/128"
+			} else {
+				text += "/32"
+			}
+		}
+		if _, ipNet, err := net.ParseCIDR(text); err == nil {
+			ret = append(ret, ipNet)
+		}
+	}
+	return ret
+}
+
+func isTrustedProxy(ip net.IP, proxyList []*net.IPNet) bool {
+	for _, proxy := range proxyList {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/* 对端是可信代理时才看X-Forwarded-For，从右往左跳过可信代理，取第一个不可信的地址，
+** 客户端自己填的地址都在左边，伪造不了。地址不合法时停在上一跳。
+ */
+func clientIP(remoteAddr string, forwardedList []string, proxyList []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	var hopList []string = nil
+	for _, forwarded := range forwardedList {
+		hopList = append(hopList, strings.Split(forwarded, ",")...)
+	}
+	for i := len(hopList) - 1; i >= 0 && isTrustedProxy(ip, proxyList); i-- {
+		hop := net.ParseIP(strings.TrimSpace(hopList[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+	}
+	return ip.String()
+}
+
+// 客户端的ip，总是合法的ip地址或者空字符串，部署在反向代理后面时需要配置net.trusted_proxies
+func ClientIP(r *http.Request) string {
+	return clientIP(r.RemoteAddr, r.Header["X-Forwarded-For"], trustedProxies())
+}
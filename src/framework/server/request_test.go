@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+func Test_ClientIP(t *testing.T) {
+	_, local, _ := net.ParseCIDR("127.0.0.1/32")
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+	proxyList := []*net.IPNet{local, private}
+	cases := []struct {
+		remoteAddr    string
+		forwardedList []string
+		proxyList     []*net.IPNet
+		expect        string
+	}{
+		{"1.2.3.4:5678", nil, proxyList, "1.2.3.4"},
+		// 不是可信代理时忽略X-Forwarded-For
+		{"1.2.3.4:5678", []string{"5.6.7.8"}, proxyList, "1.2.3.4"},
+		{"127.0.0.1:5678", []string{"5.6.7.8"}, nil, "127.0.0.1"},
+		// 取最右边不可信的一跳，客户端伪造的在左边
+		{"127.0.0.1:5678", []string{"9.9.9.9, 5.6.7.8, 10.0.0.2"}, proxyList, "5.6.7.8"},
+		{"127.0.0.1:5678", []string{"9.9.9.9", "5.6.7.8"}, proxyList, "5.6.7.8"},
+		// 不合法的地址停在上一跳
+		{"127.0.0.1:5678", []string{"=HYPERLINK(\"x\")"}, proxyList, "127.0.0.1"},
+		{"127.0.0.1:5678", []string{"5.6.7.8, junk, 10.0.0.2"}, proxyList, "10.0.0.2"},
+		{"[::1]:5678", nil, proxyList, "::1"},
+		{"bad", nil, proxyList, ""},
+	}
+	for _, c := range cases {
+		if ip := clientIP(c.remoteAddr, c.forwardedList, c.proxyList); ip != c.expect {
+			t.Error(c.remoteAddr, c.forwardedList, " expect ", c.expect, " got ", ip)
+		}
+	}
+}
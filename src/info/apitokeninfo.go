@@ -0,0 +1,54 @@
+package info
+
+// 主人签发的API令牌可以授予的权限
+const (
+	// 列表查询、下载、统计
+	TokenScope_Read = "read"
+	// 上传和同步博客，管理分类、标签、发布状态和版本
+	TokenScope_Publish = "publish"
+	// 删除以及回收站
+	TokenScope_Delete = "delete"
+	// 上传插件
+	TokenScope_Plugins = "plugins"
+	// 审核评论和修改评论设置
+	TokenScope_Moderate = "moderate"
+)
+
+var tokenScopes = []string{TokenScope_Read, TokenScope_Publish, TokenScope_Delete, TokenScope_Plugins,
+	TokenScope_Moderate}
+
+func IsTokenScope(scope string) bool {
+	for _, s := range tokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type APITokenInfo struct {
+	ID     int64
+	Name   string
+	Scopes []string
+	// 令牌的前几个字符，列表里用来区分不同的令牌
+	Prefix     string
+	CreateTime int64
+	// 0表示不过期
+	ExpireAt  int64
+	LastUsed  int64
+	RevokedAt int64
+}
+
+func (a *APITokenInfo) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// 没有撤销也没有过期
+func (a *APITokenInfo) IsValid(now int64) bool {
+	return a.RevokedAt == 0 && (a.ExpireAt == 0 || a.ExpireAt > now)
+}
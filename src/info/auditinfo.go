@@ -0,0 +1,34 @@
+package info
+
+// 审计日志的一条记录，Before和After是操作前后的摘要(json)，Result为ok或者错误信息
+type AuditInfo struct {
+	ID        int64
+	Time      int64
+	ActorType string
+	ActorID   int64
+	ActorName string
+	IP        string
+	UserAgent string
+	Action    string
+	// 比如blog、comment、plugin，TargetID为0表示没有具体的对象
+	TargetType string
+	TargetID   int64
+	Before     string
+	After      string
+	Result     string
+}
+
+// 审计日志的查询条件，空字符串和0表示不限制
+type AuditFilter struct {
+	ActorType string
+	ActorID   int64
+	// 以.结尾时按前缀匹配，比如blog.匹配所有博客的操作
+	Action     string
+	TargetType string
+	TargetID   int64
+	IP         string
+	Since      int64
+	Until      int64
+	// 只返回id比它小的记录，用来翻页
+	BeforeID int64
+}
@@ -1,5 +1,12 @@
 package info
 
+// 博客的发布状态，草稿和定时发布的博客只有主人可以通过预览链接看到
+const (
+	BlogStatus_Published = "published"
+	BlogStatus_Draft     = "draft"
+	BlogStatus_Scheduled = "scheduled"
+)
+
 type BlogInfo struct {
 	BlogID           int
 	BlogUUID         string
@@ -10,4 +17,13 @@ type BlogInfo struct {
 	BlogVisitCount   int
 	BlogPraiseCount  int
 	BlogDissentCount int
+	BlogCategoryID   int
+	BlogDeletedAt    int64
+	BlogStatus       string
+	BlogPublishAt    int64
+	BlogPreviewKey   string
+}
+
+func (b *BlogInfo) IsPublished() bool {
+	return b.BlogStatus == BlogStatus_Published
 }
@@ -0,0 +1,19 @@
+package info
+
+// 顶级分类的parent id
+const CategoryRootID = 0
+
+type CategoryInfo struct {
+	CategoryID          int
+	CategoryName        string
+	CategorySlug        string
+	CategoryDescription string
+	CategoryParentID    int
+	CategoryOrder       int
+	CategoryTime        int64
+	// 直接挂在该分类下的文章数
+	CategoryBlogCount int
+	// 包括所有子分类在内的文章数，只在分类树中有效
+	CategoryTotalCount int
+	Children           []*CategoryInfo
+}
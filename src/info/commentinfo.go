@@ -5,6 +5,20 @@ const (
 	CommentType_Plugin = 1
 )
 
+// 评论的审核状态，只有approved的评论对所有人可见，pending的评论只有作者自己能看到
+const (
+	CommentStatus_Pending  = "pending"
+	CommentStatus_Approved = "approved"
+	CommentStatus_Rejected = "rejected"
+	CommentStatus_Spam     = "spam"
+)
+
+// 评论列表的排序方式
+const (
+	CommentSort_Time  = "time"
+	CommentSort_Votes = "votes"
+)
+
 type CommentInfo struct {
 	CommentID       int
 	Type            int
@@ -12,8 +26,63 @@ type CommentInfo struct {
 	UserID          int64
 	ParentCommentID int
 	Content         string
-	Time            int64
-	Praise          int
-	Dissent         int
-	Address         string
+	// Markdown渲染之后的HTML，老的评论为空，显示时再补上
+	ContentHTML string
+	Time        int64
+	Praise      int
+	Dissent     int
+	Address     string
+	DeletedAt   int64
+	Status      string
+	// 最后一次编辑的时间，没有编辑过时为0
+	EditedAt int64
+	// 作者或者主人删除了有回复的评论时只清空内容，保留位置
+	RemovedAt int64
+}
+
+func (c *CommentInfo) IsRemoved() bool {
+	return c.RemovedAt > 0
+}
+
+func (c *CommentInfo) IsPending() bool {
+	return c.Status == CommentStatus_Pending
+}
+
+// userId为0表示没有登录
+func (c *CommentInfo) IsVisibleTo(userId int64) bool {
+	if c.Status == CommentStatus_Approved {
+		return true
+	}
+	return c.Status == CommentStatus_Pending && userId > 0 && c.UserID == userId
+}
+
+func IsCommentStatus(status string) bool {
+	switch status {
+	case CommentStatus_Pending, CommentStatus_Approved, CommentStatus_Rejected, CommentStatus_Spam:
+		return true
+	}
+	return false
+}
+
+// 每篇博客(或插件)的评论设置，没有设置时全部为false
+type CommentSettingInfo struct {
+	Type            int
+	TypeID          int
+	Closed          bool
+	RequireLogin    bool
+	RequireApproval bool
+}
+
+// 评论被编辑之前的内容
+type CommentHistoryInfo struct {
+	HistoryID int
+	CommentID int
+	Content   string
+	Time      int64
+}
+
+// 用户主页上的评论，Title是所在博客的标题或者插件的名字
+type UserCommentInfo struct {
+	CommentInfo
+	Title string
 }
@@ -0,0 +1,25 @@
+package info
+
+// 通知的类型
+const (
+	// 有人回复了你的评论
+	NotifyType_Reply = "reply"
+	// 有人在评论里@了你
+	NotifyType_Mention = "mention"
+	// 主人在你评论过的博客(插件)下发表了评论
+	NotifyType_OwnerReply = "owner_reply"
+)
+
+type NotificationInfo struct {
+	NotificationID int
+	UserID         int64
+	Type           string
+	ActorID        int64
+	CommentID      int
+	CommentType    int
+	TypeID         int
+	Content        string
+	Time           int64
+	// 没有读过时为0
+	ReadAt int64
+}
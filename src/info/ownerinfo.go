@@ -0,0 +1,19 @@
+package info
+
+// 主人的登录凭据，只有一行
+type OwnerAuthInfo struct {
+	UserName string
+	// scrypt摘要，格式见blog/account
+	PasswordHash string
+	// base32编码的TOTP密钥，TOTPEnabled为false时是还没确认的新密钥
+	TOTPSecret  string
+	TOTPEnabled bool
+	// 最近一次用过的TOTP时间步，同一个code不能用两次
+	TOTPStep    int64
+	FailedCount int
+	LockedUntil int64
+}
+
+func (o *OwnerAuthInfo) IsLocked(now int64) bool {
+	return o.LockedUntil > now
+}
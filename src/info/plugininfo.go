@@ -27,4 +27,5 @@ type PluginInfo struct {
 	PluginVisitCount   int
 	PluginPraiseCount  int
 	PluginDissentCount int
+	PluginDeletedAt    int64
 }
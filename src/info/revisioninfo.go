@@ -0,0 +1,13 @@
+package info
+
+type RevisionInfo struct {
+	RevisionID int
+	BlogID     int
+	Revision   int
+	Title      string
+	SortType   string
+	CategoryID int
+	TagList    []string
+	Time       int64
+	Note       string
+}
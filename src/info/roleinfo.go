@@ -0,0 +1,71 @@
+package info
+
+// 用户的角色，保存在user表里，新用户都是commenter
+const (
+	Role_Owner     = "owner"
+	Role_Admin     = "admin"
+	Role_Moderator = "moderator"
+	Role_Commenter = "commenter"
+	Role_Banned    = "banned"
+)
+
+// 角色可以做的事情
+const (
+	Permission_Comment  = "comment"
+	Permission_Vote     = "vote"
+	Permission_Moderate = "moderate"
+	// 封禁和解封用户
+	Permission_Ban = "ban"
+	// 提升和降低其他用户的角色
+	Permission_ManageRole = "manage_role"
+)
+
+var rolePermissions = map[string][]string{
+	Role_Owner:     {Permission_Comment, Permission_Vote, Permission_Moderate, Permission_Ban, Permission_ManageRole},
+	Role_Admin:     {Permission_Comment, Permission_Vote, Permission_Moderate, Permission_Ban},
+	Role_Moderator: {Permission_Comment, Permission_Vote, Permission_Moderate},
+	Role_Commenter: {Permission_Comment, Permission_Vote},
+	Role_Banned:    nil,
+}
+
+// 角色从高到低的顺序，只能管理比自己低的用户
+var roleRanks = map[string]int{
+	Role_Owner:     4,
+	Role_Admin:     3,
+	Role_Moderator: 2,
+	Role_Commenter: 1,
+	Role_Banned:    0,
+}
+
+func IsRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+func RoleHasPermission(role string, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func RoleRank(role string) int {
+	return roleRanks[role]
+}
+
+type RoleInfo struct {
+	UserID int64
+	Role   string
+	// 封禁到什么时候，0表示永久，只对banned有效
+	BannedUntil int64
+}
+
+// 封禁到期之后自动恢复成commenter
+func (r *RoleInfo) EffectiveRole(now int64) string {
+	if r.Role == Role_Banned && r.BannedUntil > 0 && r.BannedUntil <= now {
+		return Role_Commenter
+	}
+	return r.Role
+}
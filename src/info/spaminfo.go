@@ -0,0 +1,13 @@
+package info
+
+const (
+	SpamLabel_Spam = "spam"
+	SpamLabel_Ham  = "ham"
+)
+
+// 某个特征在训练过的垃圾评论和正常评论里出现的次数
+type SpamTokenInfo struct {
+	Token string
+	Spam  int
+	Ham   int
+}
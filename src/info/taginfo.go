@@ -0,0 +1,9 @@
+package info
+
+type TagInfo struct {
+	TagID          int
+	TagName        string
+	TagDescription string
+	TagTime        int64
+	TagBlogCount   int
+}
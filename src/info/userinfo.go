@@ -3,6 +3,14 @@ package info
 const (
 	AccountTypeQQ    = iota
 	AccountTypeWeibo = iota
+	// 没有登录、填写昵称发表评论的游客
+	AccountTypeGuest = iota
+	// 用户名和密码注册的本站帐号
+	AccountTypeLocal  = iota
+	AccountTypeGitHub = iota
+	// 通过配置的OpenID Connect服务登录
+	AccountTypeOIDC   = iota
+	AccountTypeWeixin = iota
 )
 
 type UserInfo struct {
@@ -16,4 +24,21 @@ type UserInfo struct {
 	LastLoginTime   int64
 	RegisterTime    int64
 	CurrentIP       string
+	// 游客和本站帐号填写的邮箱和网址，邮箱不对外显示
+	Email   string
+	Website string
+}
+
+func (u *UserInfo) IsGuest() bool {
+	return u.UserAccountType == AccountTypeGuest
+}
+
+func (u *UserInfo) IsLocal() bool {
+	return u.UserAccountType == AccountTypeLocal
+}
+
+// 用户主页的隐私设置，隐藏之后只有自己和版主以上的角色能看到
+type PrivacyInfo struct {
+	HideProfile  bool
+	HideComments bool
 }
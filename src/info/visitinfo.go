@@ -0,0 +1,54 @@
+package info
+
+// 统计访问量的对象
+const (
+	VisitTarget_Blog   = "blog"
+	VisitTarget_Plugin = "plugin"
+)
+
+// 某个对象某一天的访问量，Day的格式为20170401
+type VisitStatInfo struct {
+	TargetType string
+	TargetID   int
+	Day        int
+	// 浏览次数，同一个人刷新也会计数，爬虫除外
+	PageView int
+	// 独立访客数，同一个人一天只计一次
+	Visitor int
+	// 从站外或者直接打开进入的次数，即作为入口页的次数
+	Entry int
+	// 写入时这一批访问的访客标识，按visit_visitor表去重之后才是新增的Visitor
+	VisitorList []string
+}
+
+// 访问来源的种类
+const (
+	VisitSource_Referrer = "referrer"
+	VisitSource_Term     = "term"
+)
+
+// 直接打开，没有Referer
+const VisitReferrer_Direct = "(direct)"
+
+// 一次页面访问的原始记录，定时汇总到每日统计之后删除
+type VisitHitInfo struct {
+	TargetType string
+	TargetID   int
+	Day        int
+	Time       int64
+	// 来源域名，站内跳转为空
+	Referrer string
+	// 从搜索引擎来时的搜索词
+	Term  string
+	Entry bool
+}
+
+type VisitSourceInfo struct {
+	Value string
+	Count int
+}
+
+type DailyCountInfo struct {
+	Day   int
+	Count int
+}
@@ -0,0 +1,43 @@
+package info
+
+// 可以投票的对象
+const (
+	VoteTarget_Blog    = "blog"
+	VoteTarget_Comment = "comment"
+	VoteTarget_Plugin  = "plugin"
+)
+
+// 顶为1，踩为-1，没有投票为0
+const (
+	Vote_None = 0
+	Vote_Up   = 1
+	Vote_Down = -1
+)
+
+type VoteCountInfo struct {
+	Praise  int
+	Dissent int
+	// 当前用户的投票
+	Vote int
+}
+
+type DailyVoteInfo struct {
+	Day  int
+	Up   int
+	Down int
+}
+
+type RatingInfo struct {
+	RatingID int
+	PluginID int
+	Voter    string
+	UserID   int64
+	Stars    int
+	Review   string
+	Time     int64
+}
+
+type RatingSummaryInfo struct {
+	Count   int
+	Average float64
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"os"
 	"startup"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(startup.RunCommand(os.Args[1:]))
+	}
 	startup.StartServer()
 }
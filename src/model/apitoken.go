@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"framework/database"
+	"info"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kAPITokenTableName  = "api_token"
+	kAPITokenId         = "id"
+	kAPITokenName       = "name"
+	kAPITokenToken      = "token"
+	kAPITokenPrefix     = "prefix"
+	kAPITokenScopes     = "scopes"
+	kAPITokenCreateTime = "create_time"
+	kAPITokenExpireAt   = "expire_at"
+	kAPITokenLastUsed   = "last_used"
+	kAPITokenRevokedAt  = "revoked_at"
+)
+
+type apiTokenModel struct {
+}
+
+var apiTokenModelInstance *apiTokenModel = nil
+
+var apiTokenOnce sync.Once
+
+func ShareAPITokenModel() *apiTokenModel {
+	apiTokenOnce.Do(func() {
+		apiTokenModelInstance = &apiTokenModel{}
+	})
+	return apiTokenModelInstance
+}
+
+// 主人签发的API令牌，只保存令牌的sha256，scopes用逗号分隔
+func (a *apiTokenModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kAPITokenTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+		%s varchar(64) NOT NULL,
+		%s char(64) NOT NULL,
+		%s varchar(16) NOT NULL,
+		%s varchar(128) NOT NULL,
+		%s int(64) NOT NULL,
+		%s int(64) NOT NULL DEFAULT '0',
+		%s int(64) NOT NULL DEFAULT '0',
+		%s int(64) NOT NULL DEFAULT '0',
+		PRIMARY KEY (%s),
+		UNIQUE KEY (%s)
+	) CHARSET=utf8;`, kAPITokenTableName, kAPITokenId, kAPITokenName, kAPITokenToken, kAPITokenPrefix,
+		kAPITokenScopes, kAPITokenCreateTime, kAPITokenExpireAt, kAPITokenLastUsed, kAPITokenRevokedAt,
+		kAPITokenId, kAPITokenToken)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func apiTokenSelectColumns() string {
+	return strings.Join([]string{kAPITokenId, kAPITokenName, kAPITokenPrefix, kAPITokenScopes,
+		kAPITokenCreateTime, kAPITokenExpireAt, kAPITokenLastUsed, kAPITokenRevokedAt}, ", ")
+}
+
+func scanAPIToken(scanner rowScanner) (*info.APITokenInfo, error) {
+	tokenInfo := &info.APITokenInfo{}
+	var scopes string
+	if err := scanner.Scan(&tokenInfo.ID, &tokenInfo.Name, &tokenInfo.Prefix, &scopes, &tokenInfo.CreateTime,
+		&tokenInfo.ExpireAt, &tokenInfo.LastUsed, &tokenInfo.RevokedAt); err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		tokenInfo.Scopes = strings.Split(scopes, ",")
+	}
+	return tokenInfo, nil
+}
+
+func (a *apiTokenModel) AddToken(tokenInfo *info.APITokenInfo, tokenHash string) (int64, error) {
+	sql := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?)", kAPITokenTableName,
+		kAPITokenName, kAPITokenToken, kAPITokenPrefix, kAPITokenScopes, kAPITokenCreateTime, kAPITokenExpireAt)
+	result, err := database.DatabaseInstance().DB.Exec(sql, tokenInfo.Name, tokenHash, tokenInfo.Prefix,
+		strings.Join(tokenInfo.Scopes, ","), tokenInfo.CreateTime, tokenInfo.ExpireAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// 令牌不存在时返回nil，撤销和过期的也会返回，由调用者判断
+func (a *apiTokenModel) FetchTokenByHash(tokenHash string) (*info.APITokenInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ?", apiTokenSelectColumns(), kAPITokenTableName,
+		kAPITokenToken)
+	rows, err := database.DatabaseInstance().DB.Query(sql, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return scanAPIToken(rows)
+}
+
+// 所有令牌，新签发的在前面
+func (a *apiTokenModel) FetchTokenList() ([]*info.APITokenInfo, error) {
+	sql := fmt.Sprintf("select %s from %s order by %s desc", apiTokenSelectColumns(), kAPITokenTableName,
+		kAPITokenId)
+	rows, err := database.DatabaseInstance().DB.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tokenList []*info.APITokenInfo = nil
+	for rows.Next() {
+		tokenInfo, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokenList = append(tokenList, tokenInfo)
+	}
+	return tokenList, rows.Err()
+}
+
+// 撤销一个还没撤销的令牌，令牌不存在或者已经撤销时返回false
+func (a *apiTokenModel) RevokeToken(id int64) (bool, error) {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ? and %s = 0", kAPITokenTableName,
+		kAPITokenRevokedAt, kAPITokenId, kAPITokenRevokedAt)
+	result, err := database.DatabaseInstance().DB.Exec(sql, time.Now().Unix(), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+func (a *apiTokenModel) UpdateLastUsed(id int64, lastUsed int64) error {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ?", kAPITokenTableName, kAPITokenLastUsed, kAPITokenId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, lastUsed, id)
+	return err
+}
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"fmt"
+	"framework/database"
+	"info"
+	"strings"
+	"sync"
+)
+
+const (
+	kAuditTableName  = "audit_log"
+	kAuditId         = "id"
+	kAuditTime       = "time"
+	kAuditActorType  = "actor_type"
+	kAuditActorId    = "actor_id"
+	kAuditActorName  = "actor_name"
+	kAuditIP         = "ip"
+	kAuditUserAgent  = "user_agent"
+	kAuditAction     = "action"
+	kAuditTargetType = "target_type"
+	kAuditTargetId   = "target_id"
+	kAuditBefore     = "before_summary"
+	kAuditAfter      = "after_summary"
+	kAuditResult     = "result"
+)
+
+type auditModel struct {
+}
+
+var auditModelInstance *auditModel = nil
+
+var auditOnce sync.Once
+
+func ShareAuditModel() *auditModel {
+	auditOnce.Do(func() {
+		auditModelInstance = &auditModel{}
+	})
+	return auditModelInstance
+}
+
+// 审计日志只追加，这里不提供修改和删除的方法，回收站的定时清理也不会动它
+func (a *auditModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kAuditTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s bigint(64) unsigned NOT NULL AUTO_INCREMENT,
+		%s int(64) NOT NULL,
+		%s varchar(16) NOT NULL,
+		%s bigint(64) NOT NULL DEFAULT '0',
+		%s varchar(256) NOT NULL DEFAULT '',
+		%s varchar(64) NOT NULL DEFAULT '',
+		%s varchar(512) NOT NULL DEFAULT '',
+		%s varchar(64) NOT NULL,
+		%s varchar(32) NOT NULL DEFAULT '',
+		%s bigint(64) NOT NULL DEFAULT '0',
+		%s text NOT NULL,
+		%s text NOT NULL,
+		%s varchar(512) NOT NULL DEFAULT '',
+		PRIMARY KEY (%s),
+		KEY (%s),
+		KEY (%s),
+		KEY (%s, %s)
+	) CHARSET=utf8;`, kAuditTableName, kAuditId, kAuditTime, kAuditActorType, kAuditActorId, kAuditActorName,
+		kAuditIP, kAuditUserAgent, kAuditAction, kAuditTargetType, kAuditTargetId, kAuditBefore, kAuditAfter,
+		kAuditResult, kAuditId, kAuditTime, kAuditAction, kAuditTargetType, kAuditTargetId)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func (a *auditModel) AddAudit(auditInfo *info.AuditInfo) error {
+	sql := fmt.Sprintf(`insert into %s(%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
+		values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, kAuditTableName, kAuditTime, kAuditActorType, kAuditActorId,
+		kAuditActorName, kAuditIP, kAuditUserAgent, kAuditAction, kAuditTargetType, kAuditTargetId, kAuditBefore,
+		kAuditAfter, kAuditResult)
+	_, err := database.DatabaseInstance().DB.Exec(sql, auditInfo.Time, auditInfo.ActorType, auditInfo.ActorID,
+		auditInfo.ActorName, auditInfo.IP, auditInfo.UserAgent, auditInfo.Action, auditInfo.TargetType,
+		auditInfo.TargetID, auditInfo.Before, auditInfo.After, auditInfo.Result)
+	return err
+}
+
+// 把查询条件转成where子句
+func auditCondition(filter *info.AuditFilter) (string, []interface{}) {
+	var conditionList []string = nil
+	var args []interface{} = nil
+	add := func(condition string, arg interface{}) {
+		conditionList = append(conditionList, condition)
+		args = append(args, arg)
+	}
+	if filter.ActorType != "" {
+		add(kAuditActorType+" = ?", filter.ActorType)
+	}
+	if filter.ActorID > 0 {
+		add(kAuditActorId+" = ?", filter.ActorID)
+	}
+	if strings.HasSuffix(filter.Action, ".") {
+		add(kAuditAction+" like ?", strings.Replace(filter.Action, "_", "\\_", -1)+"%")
+	} else if filter.Action != "" {
+		add(kAuditAction+" = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		add(kAuditTargetType+" = ?", filter.TargetType)
+	}
+	if filter.TargetID > 0 {
+		add(kAuditTargetId+" = ?", filter.TargetID)
+	}
+	if filter.IP != "" {
+		add(kAuditIP+" = ?", filter.IP)
+	}
+	if filter.Since > 0 {
+		add(kAuditTime+" >= ?", filter.Since)
+	}
+	if filter.Until > 0 {
+		add(kAuditTime+" < ?", filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		add(kAuditId+" < ?", filter.BeforeID)
+	}
+	if len(conditionList) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(conditionList, " and "), args
+}
+
+// 按时间倒序，新的在前面
+func (a *auditModel) FetchAuditList(filter *info.AuditFilter, offset int, limit int) ([]*info.AuditInfo, error) {
+	condition, args := auditCondition(filter)
+	sql := fmt.Sprintf("select %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s from %s where %s order by %s desc limit ?, ?",
+		kAuditId, kAuditTime, kAuditActorType, kAuditActorId, kAuditActorName, kAuditIP, kAuditUserAgent,
+		kAuditAction, kAuditTargetType, kAuditTargetId, kAuditBefore, kAuditAfter, kAuditResult, kAuditTableName,
+		condition, kAuditId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, append(args, offset, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var auditList []*info.AuditInfo = nil
+	for rows.Next() {
+		auditInfo := &info.AuditInfo{}
+		if err = rows.Scan(&auditInfo.ID, &auditInfo.Time, &auditInfo.ActorType, &auditInfo.ActorID,
+			&auditInfo.ActorName, &auditInfo.IP, &auditInfo.UserAgent, &auditInfo.Action, &auditInfo.TargetType,
+			&auditInfo.TargetID, &auditInfo.Before, &auditInfo.After, &auditInfo.Result); err != nil {
+			return nil, err
+		}
+		auditList = append(auditList, auditInfo)
+	}
+	return auditList, rows.Err()
+}
+
+func (a *auditModel) FetchAuditCount(filter *info.AuditFilter) (int, error) {
+	condition, args := auditCondition(filter)
+	sql := fmt.Sprintf("select count(*) from %s where %s", kAuditTableName, condition)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, args...).Scan(&count)
+	return count, err
+}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"container/list"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"framework/database"
 	"info"
@@ -24,6 +26,11 @@ const (
 	kBlogVisitCount   = "visit"
 	kBlogPraiseCount  = "praise"
 	kBlogDissentCount = "dissent"
+	kBlogCategoryId   = "category_id"
+	kBlogDeletedAt    = "deleted_at"
+	kBlogStatus       = "status"
+	kBlogPublishAt    = "publish_at"
+	kBlogPreviewKey   = "preview_key"
 )
 
 var blogModelInstance *blogModel = nil
@@ -37,9 +44,97 @@ func ShareBlogModel() *blogModel {
 	return blogModelInstance
 }
 
+// 查询blog时使用的列，顺序要和scanBlogInfo保持一致
+func blogSelectColumns(alias string) string {
+	columns := []string{kBlogId, kBlogUUID, kBlogTitle, kBlogSortType, kBlogTag,
+		kBlogTime, kBlogVisitCount, kBlogPraiseCount, kBlogDissentCount, kBlogCategoryId, kBlogDeletedAt,
+		kBlogStatus, kBlogPublishAt, kBlogPreviewKey}
+	if alias != "" {
+		for i := range columns {
+			columns[i] = alias + "." + columns[i]
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+// 公开页面能看到的博客：不在回收站里并且已经发布
+func blogVisibleCondition(alias string) string {
+	prefix := ""
+	if alias != "" {
+		prefix = alias + "."
+	}
+	return fmt.Sprintf("%s%s = 0 and %s%s = '%s'", prefix, kBlogDeletedAt, prefix, kBlogStatus,
+		info.BlogStatus_Published)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBlogInfo(rows rowScanner) (*info.BlogInfo, error) {
+	var blog info.BlogInfo
+	var tag string
+	err := rows.Scan(&blog.BlogID, &blog.BlogUUID, &blog.BlogTitle,
+		&blog.BlogSortType, &tag, &blog.BlogTime, &blog.BlogVisitCount,
+		&blog.BlogPraiseCount, &blog.BlogDissentCount, &blog.BlogCategoryID, &blog.BlogDeletedAt,
+		&blog.BlogStatus, &blog.BlogPublishAt, &blog.BlogPreviewKey)
+	if err != nil {
+		return nil, err
+	}
+	blog.BlogTagList = splitBlogTag(tag)
+	return &blog, nil
+}
+
+// 生成 in (?, ?, ?) 需要的占位符以及参数
+func inPlaceholder(idList []int) (string, []interface{}) {
+	var placeholderList []string = nil
+	var args []interface{} = nil
+	for _, id := range idList {
+		placeholderList = append(placeholderList, "?")
+		args = append(args, id)
+	}
+	return strings.Join(placeholderList, ", "), args
+}
+
+func splitBlogTag(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	return strings.Split(tag, "||")
+}
+
+func (b *blogModel) queryBlogList(sql string, args ...interface{}) (*list.List, error) {
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blogList *list.List = list.New()
+	for rows.Next() {
+		blog, err := scanBlogInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		blogList.PushBack(*blog)
+	}
+	return blogList, rows.Err()
+}
+
+func (b *blogModel) queryBlog(sql string, args ...interface{}) (*info.BlogInfo, error) {
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return scanBlogInfo(rows)
+	}
+	return nil, rows.Err()
+}
+
 func (c *blogModel) CreateTable() error {
 	if database.DatabaseInstance().DoesTableExist(kBlogTableName) {
-		return nil
+		return c.upgradeTable()
 	}
 	sql := fmt.Sprintf(`
 	CREATE TABLE %s (
@@ -52,35 +147,136 @@ func (c *blogModel) CreateTable() error {
 		%s int(32) DEFAULT '0',
 		%s int(32) DEFAULT '0',
 		%s int(32) DEFAULT '0',
-		PRIMARY KEY (%s)
+		%s int(32) NOT NULL DEFAULT '0',
+		%s int(64) NOT NULL DEFAULT '0',
+		%s varchar(16) NOT NULL DEFAULT '%s',
+		%s int(64) NOT NULL DEFAULT '0',
+		%s varchar(64) NOT NULL DEFAULT '',
+		PRIMARY KEY (%s),
+		KEY (%s),
+		KEY (%s, %s)
 	) CHARSET=utf8;`, kBlogTableName, kBlogId,
 		kBlogUUID, kBlogTitle, kBlogSortType, kBlogTag, kBlogTime, kBlogVisitCount,
-		kBlogPraiseCount, kBlogDissentCount, kBlogId)
+		kBlogPraiseCount, kBlogDissentCount, kBlogCategoryId, kBlogDeletedAt,
+		kBlogStatus, info.BlogStatus_Published, kBlogPublishAt, kBlogPreviewKey,
+		kBlogId, kBlogCategoryId, kBlogStatus, kBlogPublishAt)
 	_, err := database.DatabaseInstance().DB.Exec(sql)
 	return err
 }
 
+// 给老版本的blog表补上新增的列
+func (c *blogModel) upgradeTable() error {
+	err := database.DatabaseInstance().AddColumnIfNotExist(kBlogTableName, kBlogCategoryId,
+		"int(32) NOT NULL DEFAULT '0'")
+	if err != nil {
+		return err
+	}
+	err = database.DatabaseInstance().AddColumnIfNotExist(kBlogTableName, kBlogDeletedAt,
+		"int(64) NOT NULL DEFAULT '0'")
+	if err != nil {
+		return err
+	}
+	// 老博客都是已经发布的
+	err = database.DatabaseInstance().AddColumnIfNotExist(kBlogTableName, kBlogStatus,
+		fmt.Sprintf("varchar(16) NOT NULL DEFAULT '%s'", info.BlogStatus_Published))
+	if err != nil {
+		return err
+	}
+	err = database.DatabaseInstance().AddColumnIfNotExist(kBlogTableName, kBlogPublishAt,
+		"int(64) NOT NULL DEFAULT '0'")
+	if err != nil {
+		return err
+	}
+	return database.DatabaseInstance().AddColumnIfNotExist(kBlogTableName, kBlogPreviewKey,
+		"varchar(64) NOT NULL DEFAULT ''")
+}
+
 func (b *blogModel) InsertBlog(uuid string, title string, sortType string, tagList []string) error {
 	currentTime := time.Now().Unix()
 	tag := strings.Join(tagList, "||")
-	sql := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s) values(?, ?, ?, ?, ?)",
-		kBlogTableName, kBlogUUID, kBlogTitle, kBlogSortType, kBlogTag, kBlogTime)
+	categoryId, err := ShareCategoryModel().FetchOrCreateCategoryByName(sortType)
+	if err != nil {
+		return err
+	}
+	sql := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?)",
+		kBlogTableName, kBlogUUID, kBlogTitle, kBlogSortType, kBlogTag, kBlogTime, kBlogCategoryId)
 	stat, err := database.DatabaseInstance().DB.Prepare(sql)
 	if err == nil {
 		defer stat.Close()
-		_, err := stat.Exec(uuid, title, sortType, tag, currentTime)
-		return err
+		result, err := stat.Exec(uuid, title, sortType, tag, currentTime, categoryId)
+		if err != nil {
+			return err
+		}
+		blogId, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		return ShareTagModel().SetBlogTags(int(blogId), tagList)
 	}
 	return err
 }
 
+/* 重新上传时保留原来的分类，分类的改名、移动和删除都通过分类接口，不会被blog.info里的sort改回去，
+** 只有还没有分类的博客才按sort找分类
+ */
 func (b *blogModel) UpdateBlog(uuid string, title string, sortType string, tagList []string) error {
 	currentTime := time.Now().Unix()
 	tag := strings.Join(tagList, "||")
-	sql := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ?, %s = ? where %s = ?",
-		kBlogTableName, kBlogTitle, kBlogSortType, kBlogTag, kBlogTime, kBlogUUID)
-	_, err := database.DatabaseInstance().DB.Exec(sql, title, sortType, tag, currentTime, uuid)
-	return err
+	// 回收站里的博客也要找到
+	query := fmt.Sprintf("select %s, %s, %s from %s where %s = ?",
+		kBlogId, kBlogCategoryId, kBlogSortType, kBlogTableName, kBlogUUID)
+	rows, err := database.DatabaseInstance().DB.Query(query, uuid)
+	if err != nil {
+		return err
+	}
+	var blogId, categoryId int
+	var currentSortType string
+	exist := rows.Next()
+	if exist {
+		err = rows.Scan(&blogId, &categoryId, &currentSortType)
+	}
+	rows.Close()
+	if err != nil || !exist {
+		return err
+	}
+	if categoryId == info.CategoryRootID {
+		if categoryId, err = ShareCategoryModel().FetchOrCreateCategoryByName(sortType); err != nil {
+			return err
+		}
+	} else {
+		sortType = currentSortType
+	}
+	// 回收站里的博客重新上传时顺便恢复
+	sql := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ?, %s = ?, %s = ?, %s = 0 where %s = ?",
+		kBlogTableName, kBlogTitle, kBlogSortType, kBlogTag, kBlogTime, kBlogCategoryId, kBlogDeletedAt, kBlogId)
+	_, err = database.DatabaseInstance().DB.Exec(sql, title, sortType, tag, currentTime, categoryId, blogId)
+	if err != nil {
+		return err
+	}
+	return ShareTagModel().SetBlogTags(blogId, tagList)
+}
+
+/* 回滚到历史版本，分类按版本里记录的category_id写回，不走UpdateBlog保留当前分类的逻辑。
+** 那个分类已经删掉时按分类名找或者新建
+ */
+func (b *blogModel) RollbackBlog(blogId int, title string, categoryId int, sortType string, tagList []string) error {
+	category, err := ShareCategoryModel().FetchCategoryByID(categoryId)
+	if err != nil {
+		return err
+	}
+	if category != nil {
+		sortType = category.CategoryName
+	} else if categoryId, err = ShareCategoryModel().FetchOrCreateCategoryByName(sortType); err != nil {
+		return err
+	}
+	sql := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ?, %s = ?, %s = ? where %s = ?",
+		kBlogTableName, kBlogTitle, kBlogSortType, kBlogTag, kBlogTime, kBlogCategoryId, kBlogId)
+	_, err = database.DatabaseInstance().DB.Exec(sql, title, sortType, strings.Join(tagList, "||"),
+		time.Now().Unix(), categoryId, blogId)
+	if err != nil {
+		return err
+	}
+	return ShareTagModel().SetBlogTags(blogId, tagList)
 }
 
 func (b *blogModel) BlogIsExistByUUID(uuid string) (bool, error) {
@@ -108,51 +304,104 @@ func (b *blogModel) BlogIsExistByBlogID(blogId int) (bool, error) {
 }
 
 func (b *blogModel) FetchAllBlog() (*list.List, error) {
-	sql := fmt.Sprintf("select * from %s order by %s desc", kBlogTableName, kBlogId)
+	sql := fmt.Sprintf("select %s from %s where %s order by %s desc",
+		blogSelectColumns(""), kBlogTableName, blogVisibleCondition(""), kBlogId)
+	blogList, err := b.queryBlogList(sql)
+	if err != nil {
+		fmt.Println(err)
+	}
+	return blogList, err
+}
+
+// 按页查询，offset/limit由调用方根据页码计算
+func (b *blogModel) FetchBlogList(offset int, limit int) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s order by %s desc limit ?, ?",
+		blogSelectColumns(""), kBlogTableName, blogVisibleCondition(""), kBlogId)
+	return b.queryBlogList(sql, offset, limit)
+}
+
+// 游标分页，返回id小于cursor的limit篇博客，cursor<=0表示从最新的开始
+func (b *blogModel) FetchBlogListBefore(cursor int, limit int) (*list.List, error) {
+	if cursor <= 0 {
+		return b.FetchBlogList(0, limit)
+	}
+	sql := fmt.Sprintf("select %s from %s where %s < ? and %s order by %s desc limit ?",
+		blogSelectColumns(""), kBlogTableName, kBlogId, blogVisibleCondition(""), kBlogId)
+	return b.queryBlogList(sql, cursor, limit)
+}
+
+func (b *blogModel) FetchBlogCount() (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s", kBlogTableName, blogVisibleCondition(""))
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql).Scan(&count)
+	return count, err
+}
+
+// 有博客的月份，每个月返回其中最新一篇的时间，用于侧边栏的归档
+func (b *blogModel) FetchBlogMonthList() ([]int64, error) {
+	sql := fmt.Sprintf("select max(%s) from %s where %s group by from_unixtime(%s, '%%Y%%m')",
+		kBlogTime, kBlogTableName, blogVisibleCondition(""), kBlogTime)
 	rows, err := database.DatabaseInstance().DB.Query(sql)
-	if err == nil {
-		defer rows.Close()
-		var blogList *list.List = list.New()
-		for rows.Next() {
-			var blog info.BlogInfo
-			var tag string
-			err = rows.Scan(&blog.BlogID, &blog.BlogUUID, &blog.BlogTitle,
-				&blog.BlogSortType, &tag, &blog.BlogTime, &blog.BlogVisitCount,
-				&blog.BlogPraiseCount, &blog.BlogDissentCount)
-			if err == nil {
-				blog.BlogTagList = strings.Split(tag, "||")
-				blogList.PushBack(blog)
-			}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var timeList []int64 = nil
+	for rows.Next() {
+		var blogTime int64
+		if err = rows.Scan(&blogTime); err != nil {
+			return nil, err
 		}
-		return blogList, err
+		timeList = append(timeList, blogTime)
 	}
-	fmt.Println(err)
-	return nil, err
+	return timeList, rows.Err()
 }
 
-func (b *blogModel) FetchBlogByBlogID(blogID int) (*info.BlogInfo, error) {
-	sql := fmt.Sprintf("select* from %s where %s = ?", kBlogTableName, kBlogId)
-	rows, err := database.DatabaseInstance().DB.Query(sql, blogID)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var blog info.BlogInfo
-			var tag string
-			err = rows.Scan(&blog.BlogID, &blog.BlogUUID, &blog.BlogTitle,
-				&blog.BlogSortType, &tag, &blog.BlogTime, &blog.BlogVisitCount,
-				&blog.BlogPraiseCount, &blog.BlogDissentCount)
-			if err == nil {
-				blog.BlogTagList = strings.Split(tag, "||")
-				return &blog, nil
-			}
-			break
-		}
+// 主人管理博客时使用，包括草稿和定时发布的博客
+func (b *blogModel) FetchOwnerBlogList(offset int, limit int) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = 0 order by %s desc limit ?, ?",
+		blogSelectColumns(""), kBlogTableName, kBlogDeletedAt, kBlogId)
+	return b.queryBlogList(sql, offset, limit)
+}
+
+func (b *blogModel) FetchOwnerBlogListBefore(cursor int, limit int) (*list.List, error) {
+	if cursor <= 0 {
+		return b.FetchOwnerBlogList(0, limit)
 	}
-	return nil, err
+	sql := fmt.Sprintf("select %s from %s where %s < ? and %s = 0 order by %s desc limit ?",
+		blogSelectColumns(""), kBlogTableName, kBlogId, kBlogDeletedAt, kBlogId)
+	return b.queryBlogList(sql, cursor, limit)
+}
+
+func (b *blogModel) FetchOwnerBlogCount() (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = 0", kBlogTableName, kBlogDeletedAt)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql).Scan(&count)
+	return count, err
+}
+
+func (b *blogModel) FetchAllOwnerBlog() (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = 0 order by %s desc",
+		blogSelectColumns(""), kBlogTableName, kBlogDeletedAt, kBlogId)
+	return b.queryBlogList(sql)
+}
+
+func (b *blogModel) FetchBlogByBlogID(blogID int) (*info.BlogInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = 0",
+		blogSelectColumns(""), kBlogTableName, kBlogId, kBlogDeletedAt)
+	return b.queryBlog(sql, blogID)
+}
+
+// 回收站里的博客，恢复和彻底删除时使用
+func (b *blogModel) FetchTrashBlogByBlogID(blogID int) (*info.BlogInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s > 0",
+		blogSelectColumns(""), kBlogTableName, kBlogId, kBlogDeletedAt)
+	return b.queryBlog(sql, blogID)
 }
 
 func (b *blogModel) GetBlogUUIDByBlogID(blogID int) (string, error) {
-	sql := fmt.Sprintf("select %s from %s where %s = ?", kBlogUUID, kBlogTableName, kBlogId)
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = 0",
+		kBlogUUID, kBlogTableName, kBlogId, kBlogDeletedAt)
 	rows, err := database.DatabaseInstance().DB.Query(sql, blogID)
 	if err == nil {
 		defer rows.Close()
@@ -169,28 +418,13 @@ func (b *blogModel) GetBlogUUIDByBlogID(blogID int) (string, error) {
 }
 
 func (b *blogModel) FetchBlogByUUID(uuid string) (*info.BlogInfo, error) {
-	sql := fmt.Sprintf("select* from %s where %s = ?", kBlogTableName, kBlogUUID)
-	rows, err := database.DatabaseInstance().DB.Query(sql, uuid)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var blog info.BlogInfo
-			var tag string
-			err = rows.Scan(&blog.BlogID, &blog.BlogUUID, &blog.BlogTitle,
-				&blog.BlogSortType, &tag, &blog.BlogTime, &blog.BlogVisitCount,
-				&blog.BlogPraiseCount, &blog.BlogDissentCount)
-			if err == nil {
-				blog.BlogTagList = strings.Split(tag, "||")
-				return &blog, nil
-			}
-			break
-		}
-	}
-	return nil, err
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = 0",
+		blogSelectColumns(""), kBlogTableName, kBlogUUID, kBlogDeletedAt)
+	return b.queryBlog(sql, uuid)
 }
 
 func (b *blogModel) FetchAllSortType() ([]string, error) {
-	sql := fmt.Sprintf("select %s from %s distinct", kBlogSortType, kBlogTableName)
+	sql := fmt.Sprintf("select distinct %s from %s", kBlogSortType, kBlogTableName)
 	rows, err := database.DatabaseInstance().DB.Query(sql)
 	if err == nil {
 		defer rows.Close()
@@ -208,58 +442,146 @@ func (b *blogModel) FetchAllSortType() ([]string, error) {
 }
 
 func (b *blogModel) FetchAllBlogBySortType(sortType string) (*list.List, error) {
-	sql := fmt.Sprintf("select * from %s where %s = ? order by %s desc",
-		kBlogTableName, kBlogSortType, kBlogId)
-	rows, err := database.DatabaseInstance().DB.Query(sql, sortType)
-	if err == nil {
-		defer rows.Close()
-		var blogList *list.List = list.New()
-		for rows.Next() {
-			var blog info.BlogInfo
-			var tag string
-			err = rows.Scan(&blog.BlogID, &blog.BlogUUID, &blog.BlogTitle,
-				&blog.BlogSortType, &tag, &blog.BlogTime, &blog.BlogVisitCount,
-				&blog.BlogPraiseCount, &blog.BlogDissentCount)
-			if err == nil {
-				blog.BlogTagList = strings.Split(tag, "||")
-				blogList.PushBack(blog)
-			}
-		}
-		return blogList, err
-	}
-	return nil, err
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s order by %s desc",
+		blogSelectColumns(""), kBlogTableName, kBlogSortType, blogVisibleCondition(""), kBlogId)
+	return b.queryBlogList(sql, sortType)
 }
 
 func (b *blogModel) FetchAllBlogByTime(beginTime int64, endTime int64) (*list.List, error) {
-	sql := fmt.Sprintf("select * from %s where %s >= ? and %s <= ? order by %s desc", kBlogTableName, kBlogTime, kBlogTime, kBlogId)
-	rows, err := database.DatabaseInstance().DB.Query(sql, beginTime, endTime)
-	if err == nil {
-		defer rows.Close()
-		var blogList *list.List = list.New()
-		for rows.Next() {
-			var blog info.BlogInfo
-			var tag string
-			err = rows.Scan(&blog.BlogID, &blog.BlogUUID, &blog.BlogTitle,
-				&blog.BlogSortType, &tag, &blog.BlogTime, &blog.BlogVisitCount,
-				&blog.BlogPraiseCount, &blog.BlogDissentCount)
-			if err == nil {
-				blog.BlogTagList = strings.Split(tag, "||")
-				blogList.PushBack(blog)
-			}
-		}
-		return blogList, err
+	sql := fmt.Sprintf("select %s from %s where %s >= ? and %s <= ? and %s order by %s desc",
+		blogSelectColumns(""), kBlogTableName, kBlogTime, kBlogTime, blogVisibleCondition(""), kBlogId)
+	return b.queryBlogList(sql, beginTime, endTime)
+}
+
+func (b *blogModel) FetchBlogListByTime(beginTime int64, endTime int64, offset int, limit int) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s >= ? and %s <= ? and %s order by %s desc limit ?, ?",
+		blogSelectColumns(""), kBlogTableName, kBlogTime, kBlogTime, blogVisibleCondition(""), kBlogId)
+	return b.queryBlogList(sql, beginTime, endTime, offset, limit)
+}
+
+func (b *blogModel) FetchBlogCountByTime(beginTime int64, endTime int64) (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s >= ? and %s <= ? and %s",
+		kBlogTableName, kBlogTime, kBlogTime, blogVisibleCondition(""))
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, beginTime, endTime).Scan(&count)
+	return count, err
+}
+
+// 通过blog_tag关联表按标签查询，offset/limit用于分页
+func (b *blogModel) FetchAllBlogByTag(tagName string, offset int, limit int) (*list.List, error) {
+	sql := fmt.Sprintf(`select %s from %s b
+		inner join %s bt on bt.%s = b.%s
+		inner join %s t on t.%s = bt.%s
+		where t.%s = ? and %s order by b.%s desc limit ?, ?`,
+		blogSelectColumns("b"), kBlogTableName,
+		kBlogTagTableName, kBlogTagBlogId, kBlogId,
+		kTagTableName, kTagId, kBlogTagTagId,
+		kTagName, blogVisibleCondition("b"), kBlogId)
+	return b.queryBlogList(sql, tagName, offset, limit)
+}
+
+// 查询若干分类下的所有博客，分类id一般是某个分类以及它的全部子分类
+func (b *blogModel) FetchAllBlogByCategory(categoryIdList []int, offset int, limit int) (*list.List, error) {
+	if len(categoryIdList) == 0 {
+		return list.New(), nil
 	}
-	return nil, err
+	placeholder, args := inPlaceholder(categoryIdList)
+	sql := fmt.Sprintf("select %s from %s where %s in (%s) and %s order by %s desc limit ?, ?",
+		blogSelectColumns(""), kBlogTableName, kBlogCategoryId, placeholder, blogVisibleCondition(""), kBlogId)
+	args = append(args, offset, limit)
+	return b.queryBlogList(sql, args...)
+}
+
+func (b *blogModel) FetchBlogCountByCategory(categoryIdList []int) (int, error) {
+	if len(categoryIdList) == 0 {
+		return 0, nil
+	}
+	placeholder, args := inPlaceholder(categoryIdList)
+	sql := fmt.Sprintf("select count(*) from %s where %s in (%s) and %s",
+		kBlogTableName, kBlogCategoryId, placeholder, blogVisibleCondition(""))
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, args...).Scan(&count)
+	return count, err
 }
 
-func (b *blogModel) AddVisitCount(blogId int) error {
-	sql := fmt.Sprintf("update %s set visit = visit + 1 where %s = ?", kBlogTableName, kBlogId)
+// 放入回收站，只是标记删除时间
+func (b *blogModel) TrashBlog(blogId int) error {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ? and %s = 0",
+		kBlogTableName, kBlogDeletedAt, kBlogId, kBlogDeletedAt)
+	_, err := database.DatabaseInstance().DB.Exec(sql, time.Now().Unix(), blogId)
+	return err
+}
+
+func (b *blogModel) RestoreBlog(blogId int) error {
+	sql := fmt.Sprintf("update %s set %s = 0 where %s = ?", kBlogTableName, kBlogDeletedAt, kBlogId)
 	_, err := database.DatabaseInstance().DB.Exec(sql, blogId)
 	return err
 }
 
+func (b *blogModel) FetchTrashBlogList() (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s > 0 order by %s desc",
+		blogSelectColumns(""), kBlogTableName, kBlogDeletedAt, kBlogDeletedAt)
+	return b.queryBlogList(sql)
+}
+
+// 回收站里放入时间早于beforeTime的博客，用于定时清理
+func (b *blogModel) FetchExpiredTrashBlogList(beforeTime int64) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s > 0 and %s < ?",
+		blogSelectColumns(""), kBlogTableName, kBlogDeletedAt, kBlogDeletedAt)
+	return b.queryBlogList(sql, beforeTime)
+}
+
+// 彻底删除
 func (b *blogModel) DeleteBlog(blogId int) error {
 	sql := fmt.Sprintf("delete from %s where %s = ?", kBlogTableName, kBlogId)
 	_, err := database.DatabaseInstance().DB.Exec(sql, blogId)
+	if err != nil {
+		return err
+	}
+	return ShareTagModel().DeleteBlogTags(blogId)
+}
+
+// 修改发布状态，草稿和定时发布的博客没有预览key时生成一个
+func (b *blogModel) UpdateBlogStatus(blogId int, status string, publishAt int64) error {
+	sql := fmt.Sprintf("update %s set %s = ?, %s = ? where %s = ?",
+		kBlogTableName, kBlogStatus, kBlogPublishAt, kBlogId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, status, publishAt, blogId)
+	if err != nil || status == info.BlogStatus_Published {
+		return err
+	}
+	sql = fmt.Sprintf("update %s set %s = ? where %s = ? and %s = ''",
+		kBlogTableName, kBlogPreviewKey, kBlogId, kBlogPreviewKey)
+	_, err = database.DatabaseInstance().DB.Exec(sql, newPreviewKey(), blogId)
 	return err
 }
+
+// 发布博客，发布时间记为实际发布的时间
+func (b *blogModel) PublishBlog(blogId int, publishTime int64) error {
+	sql := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ? where %s = ?",
+		kBlogTableName, kBlogStatus, kBlogTime, kBlogPublishAt, kBlogId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, info.BlogStatus_Published, publishTime, publishTime, blogId)
+	return err
+}
+
+// 重新生成预览key，之前分享出去的预览链接失效
+func (b *blogModel) ResetBlogPreviewKey(blogId int) (string, error) {
+	key := newPreviewKey()
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ?", kBlogTableName, kBlogPreviewKey, kBlogId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, key, blogId)
+	return key, err
+}
+
+// 定时发布的博客，按发布时间排序
+func (b *blogModel) FetchScheduledBlogList() (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = 0 order by %s",
+		blogSelectColumns(""), kBlogTableName, kBlogStatus, kBlogDeletedAt, kBlogPublishAt)
+	return b.queryBlogList(sql, info.BlogStatus_Scheduled)
+}
+
+func newPreviewKey() string {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buffer)
+}
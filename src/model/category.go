@@ -0,0 +1,438 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"framework/database"
+	"info"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type categoryModel struct {
+}
+
+const (
+	kCategoryTableName   = "category"
+	kCategoryId          = "id"
+	kCategoryName        = "name"
+	kCategorySlug        = "slug"
+	kCategoryDescription = "description"
+	kCategoryParentId    = "parent_id"
+	kCategoryOrder       = "sort_order"
+	kCategoryTime        = "time"
+)
+
+var categoryModelInstance *categoryModel = nil
+
+var categoryOnce sync.Once
+
+func ShareCategoryModel() *categoryModel {
+	categoryOnce.Do(func() {
+		categoryModelInstance = &categoryModel{}
+	})
+	return categoryModelInstance
+}
+
+func (c *categoryModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kCategoryTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+		%s varchar(128) NOT NULL,
+		%s varchar(128) NOT NULL,
+		%s varchar(1024) DEFAULT '',
+		%s int(32) NOT NULL DEFAULT '0',
+		%s int(32) NOT NULL DEFAULT '0',
+		%s int(64) NOT NULL,
+		PRIMARY KEY (%s),
+		UNIQUE KEY (%s),
+		UNIQUE KEY (%s, %s)
+	) CHARSET=utf8;`, kCategoryTableName, kCategoryId,
+		kCategoryName, kCategorySlug, kCategoryDescription, kCategoryParentId,
+		kCategoryOrder, kCategoryTime, kCategoryId, kCategorySlug, kCategoryParentId, kCategoryName)
+	if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+		return err
+	}
+	return c.migrateFromBlogSort()
+}
+
+// 老版本的分类是blog.sort里的自由文本，建表时把每个不同的sort转成一个顶级分类
+func (c *categoryModel) migrateFromBlogSort() error {
+	sortTypeList, err := ShareBlogModel().FetchAllSortType()
+	if err != nil {
+		return err
+	}
+	update := fmt.Sprintf("update %s set %s = ? where %s = ?", kBlogTableName, kBlogCategoryId, kBlogSortType)
+	for _, sortType := range sortTypeList {
+		categoryId, err := c.FetchOrCreateCategoryByName(sortType)
+		if err != nil {
+			return err
+		}
+		if _, err = database.DatabaseInstance().DB.Exec(update, categoryId, sortType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func categorySelectColumns() string {
+	return fmt.Sprintf("c.%s, c.%s, c.%s, c.%s, c.%s, c.%s, c.%s, count(b.%s)",
+		kCategoryId, kCategoryName, kCategorySlug, kCategoryDescription,
+		kCategoryParentId, kCategoryOrder, kCategoryTime, kBlogId)
+}
+
+func (c *categoryModel) queryCategoryList(where string, args ...interface{}) ([]*info.CategoryInfo, error) {
+	sql := fmt.Sprintf(`select %s from %s c left join %s b on b.%s = c.%s and %s %s
+		group by c.%s order by c.%s, c.%s, c.%s`,
+		categorySelectColumns(), kCategoryTableName, kBlogTableName, kBlogCategoryId, kCategoryId,
+		blogVisibleCondition("b"), where, kCategoryId, kCategoryParentId, kCategoryOrder, kCategoryId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var categoryList []*info.CategoryInfo = nil
+	for rows.Next() {
+		var category info.CategoryInfo
+		err = rows.Scan(&category.CategoryID, &category.CategoryName, &category.CategorySlug,
+			&category.CategoryDescription, &category.CategoryParentID, &category.CategoryOrder,
+			&category.CategoryTime, &category.CategoryBlogCount)
+		if err != nil {
+			return nil, err
+		}
+		categoryList = append(categoryList, &category)
+	}
+	return categoryList, rows.Err()
+}
+
+func (c *categoryModel) queryCategory(where string, args ...interface{}) (*info.CategoryInfo, error) {
+	categoryList, err := c.queryCategoryList(where, args...)
+	if err != nil || len(categoryList) == 0 {
+		return nil, err
+	}
+	return categoryList[0], nil
+}
+
+func (c *categoryModel) FetchAllCategory() ([]*info.CategoryInfo, error) {
+	return c.queryCategoryList("")
+}
+
+func (c *categoryModel) FetchCategoryByID(categoryId int) (*info.CategoryInfo, error) {
+	return c.queryCategory(fmt.Sprintf("where c.%s = ?", kCategoryId), categoryId)
+}
+
+func (c *categoryModel) FetchCategoryBySlug(slug string) (*info.CategoryInfo, error) {
+	return c.queryCategory(fmt.Sprintf("where c.%s = ?", kCategorySlug), slug)
+}
+
+// 不同父分类下可以有同名的分类，顶级分类优先，然后按父分类、排序和id
+func (c *categoryModel) FetchCategoryByName(name string) (*info.CategoryInfo, error) {
+	return c.queryCategory(fmt.Sprintf("where c.%s = ?", kCategoryName), name)
+}
+
+func (c *categoryModel) fetchChildByName(parentId int, name string) (*info.CategoryInfo, error) {
+	return c.queryCategory(fmt.Sprintf("where c.%s = ? and c.%s = ?", kCategoryParentId, kCategoryName),
+		parentId, name)
+}
+
+// 同一个父分类下名字不能重复
+func (c *categoryModel) checkSiblingName(parentId int, name string, exceptId int) error {
+	category, err := c.fetchChildByName(parentId, name)
+	if err != nil {
+		return err
+	}
+	if category != nil && category.CategoryID != exceptId {
+		return errors.New("category name already exists under the parent")
+	}
+	return nil
+}
+
+// 把平铺的分类列表组装成树，同时计算包含子分类的文章总数
+func BuildCategoryTree(categoryList []*info.CategoryInfo) []*info.CategoryInfo {
+	var categoryMap map[int]*info.CategoryInfo = make(map[int]*info.CategoryInfo)
+	for _, category := range categoryList {
+		category.Children = nil
+		categoryMap[category.CategoryID] = category
+	}
+	var roots []*info.CategoryInfo = nil
+	for _, category := range categoryList {
+		if parent, ok := categoryMap[category.CategoryParentID]; ok {
+			parent.Children = append(parent.Children, category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+	var countTotal func(category *info.CategoryInfo) int
+	countTotal = func(category *info.CategoryInfo) int {
+		category.CategoryTotalCount = category.CategoryBlogCount
+		for _, child := range category.Children {
+			category.CategoryTotalCount += countTotal(child)
+		}
+		return category.CategoryTotalCount
+	}
+	for _, root := range roots {
+		countTotal(root)
+	}
+	return roots
+}
+
+// 返回categoryId以及它所有子孙分类的id
+func (c *categoryModel) FetchDescendantCategoryIds(categoryId int) ([]int, error) {
+	categoryList, err := c.FetchAllCategory()
+	if err != nil {
+		return nil, err
+	}
+	return descendantCategoryIds(categoryList, categoryId), nil
+}
+
+func descendantCategoryIds(categoryList []*info.CategoryInfo, categoryId int) []int {
+	var childrenMap map[int][]int = make(map[int][]int)
+	for _, category := range categoryList {
+		childrenMap[category.CategoryParentID] = append(childrenMap[category.CategoryParentID], category.CategoryID)
+	}
+	var idList []int = []int{categoryId}
+	for i := 0; i < len(idList); i++ {
+		idList = append(idList, childrenMap[idList[i]]...)
+	}
+	return idList
+}
+
+// 由名字生成slug，例如 "C++" -> "cpp"，"Golang 入门" -> "golang-入门"
+func makeCategorySlug(name string) string {
+	var slug []rune = nil
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			slug = append(slug, r)
+		case r == '+':
+			slug = append(slug, 'p')
+		case r == '#':
+			slug = append(slug, 's', 'h', 'a', 'r', 'p')
+		default:
+			if len(slug) > 0 && slug[len(slug)-1] != '-' {
+				slug = append(slug, '-')
+			}
+		}
+	}
+	return strings.Trim(string(slug), "-")
+}
+
+func (c *categoryModel) uniqueSlug(slug string, exceptId int) (string, error) {
+	if slug == "" {
+		slug = "category"
+	}
+	query := fmt.Sprintf("select %s from %s where %s = ?", kCategoryId, kCategoryTableName, kCategorySlug)
+	candidate := slug
+	for i := 2; ; i++ {
+		var categoryId int
+		err := database.DatabaseInstance().DB.QueryRow(query, candidate).Scan(&categoryId)
+		if err == sql.ErrNoRows || (err == nil && categoryId == exceptId) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s-%d", slug, i)
+	}
+}
+
+// 上传博客时根据blog.info里的sort找到同名的顶级分类，不存在就新建一个
+func (c *categoryModel) FetchOrCreateCategoryByName(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return info.CategoryRootID, nil
+	}
+	category, err := c.fetchChildByName(info.CategoryRootID, name)
+	if err != nil {
+		return 0, err
+	}
+	if category != nil {
+		return category.CategoryID, nil
+	}
+	categoryId, err := c.CreateCategory(name, "", "", info.CategoryRootID, 0)
+	if err != nil {
+		// 同时上传的另一篇博客可能已经建好了
+		if category, _ = c.fetchChildByName(info.CategoryRootID, name); category != nil {
+			return category.CategoryID, nil
+		}
+	}
+	return categoryId, err
+}
+
+func (c *categoryModel) CreateCategory(name string, slug string, description string,
+	parentId int, order int) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, errors.New("category name must not be empty")
+	}
+	if parentId != info.CategoryRootID {
+		parent, err := c.FetchCategoryByID(parentId)
+		if err != nil {
+			return 0, err
+		}
+		if parent == nil {
+			return 0, errors.New("no such parent category")
+		}
+	}
+	if err := c.checkSiblingName(parentId, name, 0); err != nil {
+		return 0, err
+	}
+	if slug == "" {
+		slug = makeCategorySlug(name)
+	}
+	slug, err := c.uniqueSlug(slug, 0)
+	if err != nil {
+		return 0, err
+	}
+	sql := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?)",
+		kCategoryTableName, kCategoryName, kCategorySlug, kCategoryDescription,
+		kCategoryParentId, kCategoryOrder, kCategoryTime)
+	result, err := database.DatabaseInstance().DB.Exec(sql, name, slug, description,
+		parentId, order, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	insertId, err := result.LastInsertId()
+	return int(insertId), err
+}
+
+// 修改名字、slug、描述以及排序(小于0表示不修改)，同时同步更新blog.sort
+func (c *categoryModel) UpdateCategory(categoryId int, name string, slug string,
+	description string, order int) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("category name must not be empty")
+	}
+	category, err := c.FetchCategoryByID(categoryId)
+	if err != nil {
+		return err
+	}
+	if category == nil {
+		return errors.New("no such category")
+	}
+	if slug == "" {
+		slug = category.CategorySlug
+	}
+	if order < 0 {
+		order = category.CategoryOrder
+	}
+	if err = c.checkSiblingName(category.CategoryParentID, name, categoryId); err != nil {
+		return err
+	}
+	slug, err = c.uniqueSlug(slug, categoryId)
+	if err != nil {
+		return err
+	}
+	tx, err := database.DatabaseInstance().DB.Begin()
+	if err != nil {
+		return err
+	}
+	update := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ?, %s = ? where %s = ?",
+		kCategoryTableName, kCategoryName, kCategorySlug, kCategoryDescription, kCategoryOrder, kCategoryId)
+	if _, err = tx.Exec(update, name, slug, description, order, categoryId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	updateBlog := fmt.Sprintf("update %s set %s = ? where %s = ?", kBlogTableName, kBlogSortType, kBlogCategoryId)
+	if _, err = tx.Exec(updateBlog, name, categoryId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// 移动到新的父分类下，不能移动到自己或者自己的子孙分类下
+func (c *categoryModel) MoveCategory(categoryId int, parentId int) error {
+	categoryList, err := c.FetchAllCategory()
+	if err != nil {
+		return err
+	}
+	var exist, parentExist bool = false, parentId == info.CategoryRootID
+	var name string
+	for _, category := range categoryList {
+		if category.CategoryID == categoryId {
+			exist = true
+			name = category.CategoryName
+		}
+		if category.CategoryID == parentId {
+			parentExist = true
+		}
+	}
+	if !exist || !parentExist {
+		return errors.New("no such category")
+	}
+	for _, id := range descendantCategoryIds(categoryList, categoryId) {
+		if id == parentId {
+			return errors.New("can not move category under itself")
+		}
+	}
+	if err = c.checkSiblingName(parentId, name, categoryId); err != nil {
+		return err
+	}
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ?", kCategoryTableName, kCategoryParentId, kCategoryId)
+	_, err = database.DatabaseInstance().DB.Exec(sql, parentId, categoryId)
+	return err
+}
+
+// 删除分类，文章转移到reassignId下，子分类挂到被删除分类的父分类下
+func (c *categoryModel) DeleteCategory(categoryId int, reassignId int) error {
+	category, err := c.FetchCategoryByID(categoryId)
+	if err != nil {
+		return err
+	}
+	if category == nil {
+		return errors.New("no such category")
+	}
+	if reassignId == categoryId {
+		return errors.New("can not reassign to the deleted category")
+	}
+	var reassignName string = ""
+	if reassignId != info.CategoryRootID {
+		reassign, err := c.FetchCategoryByID(reassignId)
+		if err != nil {
+			return err
+		}
+		if reassign == nil {
+			return errors.New("no such reassign category")
+		}
+		reassignName = reassign.CategoryName
+	}
+	// 子分类挂到上一级之后不能和那里的分类重名
+	childList, err := c.queryCategoryList(fmt.Sprintf("where c.%s = ?", kCategoryParentId), categoryId)
+	if err != nil {
+		return err
+	}
+	for _, child := range childList {
+		if err = c.checkSiblingName(category.CategoryParentID, child.CategoryName, child.CategoryID); err != nil {
+			return err
+		}
+	}
+	tx, err := database.DatabaseInstance().DB.Begin()
+	if err != nil {
+		return err
+	}
+	moveBlog := fmt.Sprintf("update %s set %s = ?, %s = ? where %s = ?",
+		kBlogTableName, kBlogCategoryId, kBlogSortType, kBlogCategoryId)
+	if _, err = tx.Exec(moveBlog, reassignId, reassignName, categoryId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	moveChildren := fmt.Sprintf("update %s set %s = ? where %s = ?",
+		kCategoryTableName, kCategoryParentId, kCategoryParentId)
+	if _, err = tx.Exec(moveChildren, category.CategoryParentID, categoryId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	remove := fmt.Sprintf("delete from %s where %s = ?", kCategoryTableName, kCategoryId)
+	if _, err = tx.Exec(remove, categoryId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
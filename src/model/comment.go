@@ -2,9 +2,11 @@ package model
 
 import (
 	"container/list"
+	"database/sql"
 	"fmt"
 	"framework/database"
 	"info"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,10 +19,15 @@ const (
 	kCommentParentId  = "parent_id"
 	kCommentUserId    = "user_id"
 	kCommentContent   = "content"
+	kCommentHTML      = "content_html"
 	kCommentTime      = "time"
 	kCommentPraise    = "praise"
 	kCommentDissent   = "dissent"
 	kCommentAddress   = "address"
+	kCommentDeletedAt = "deleted_at"
+	kCommentStatus    = "status"
+	kCommentEditedAt  = "edited_at"
+	kCommentRemovedAt = "removed_at"
 )
 
 type commentModel struct {
@@ -39,7 +46,7 @@ func ShareCommentModel() *commentModel {
 
 func (c *commentModel) CreateTable() error {
 	if database.DatabaseInstance().DoesTableExist(kCommentTableName) {
-		return nil
+		return c.upgradeTable()
 	}
 	sql := fmt.Sprintf(`
 	CREATE TABLE %s (
@@ -49,26 +56,60 @@ func (c *commentModel) CreateTable() error {
 		%s int(32) NOT NULL DEFAULT '-1',
 		%s int(32) NOT NULL,
 		%s varchar(1024) NOT NULL,
+		%s text NOT NULL,
 		%s int(64) NULL DEFAULT '0',
 		%s int(32) NULL DEFAULT '0',
 		%s int(32) NULL DEFAULT '0',
 		%s varchar(1024) DEFAULT '',
-		PRIMARY KEY (%s)
+		%s int(64) NOT NULL DEFAULT '0',
+		%s varchar(16) NOT NULL DEFAULT '%s',
+		%s int(64) NOT NULL DEFAULT '0',
+		%s int(64) NOT NULL DEFAULT '0',
+		PRIMARY KEY (%s),
+		KEY (%s)
 	) CHARSET=utf8;`, kCommentTableName, kCommentId, kCommentType,
-		kCommentTypeId, kCommentParentId, kCommentUserId, kCommentContent, kCommentTime,
-		kCommentPraise, kCommentDissent, kCommentAddress, kCommentId)
+		kCommentTypeId, kCommentParentId, kCommentUserId, kCommentContent, kCommentHTML, kCommentTime,
+		kCommentPraise, kCommentDissent, kCommentAddress, kCommentDeletedAt, kCommentStatus,
+		info.CommentStatus_Approved, kCommentEditedAt, kCommentRemovedAt, kCommentId, kCommentStatus)
 	_, err := database.DatabaseInstance().DB.Exec(sql)
 	return err
 }
 
-func (c *commentModel) AddComment(commentType int, userId int, blogId int, commentId int, commentContent string) (int, error) {
-	sql := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?)",
+// 给老版本的comment表补上新增的列
+func (c *commentModel) upgradeTable() error {
+	err := database.DatabaseInstance().AddColumnIfNotExist(kCommentTableName, kCommentDeletedAt,
+		"int(64) NOT NULL DEFAULT '0'")
+	if err != nil {
+		return err
+	}
+	// 老的评论都是直接发布的，当作已经审核通过
+	err = database.DatabaseInstance().AddColumnIfNotExist(kCommentTableName, kCommentStatus,
+		fmt.Sprintf("varchar(16) NOT NULL DEFAULT '%s'", info.CommentStatus_Approved))
+	if err != nil {
+		return err
+	}
+	for _, column := range []string{kCommentEditedAt, kCommentRemovedAt} {
+		err = database.DatabaseInstance().AddColumnIfNotExist(kCommentTableName, column, "int(64) NOT NULL DEFAULT '0'")
+		if err != nil {
+			return err
+		}
+	}
+	// 老的评论渲染之后的内容为空，显示的时候再补上
+	return database.DatabaseInstance().AddColumnIfNotExist(kCommentTableName, kCommentHTML, "text NOT NULL")
+}
+
+// contentHTML是commentContent渲染之后的结果，见blog/markup
+// status是审核规则给出的状态，见blog/moderation
+func (c *commentModel) AddComment(commentType int, userId int, blogId int, commentId int, commentContent string,
+	contentHTML string, status string) (int, error) {
+	sql := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?, ?, ?)",
 		kCommentTableName, kCommentType, kCommentUserId, kCommentTypeId, kCommentParentId,
-		kCommentContent, kCommentTime)
+		kCommentContent, kCommentHTML, kCommentTime, kCommentStatus)
 	stat, err := database.DatabaseInstance().DB.Prepare(sql)
 	if err == nil {
 		defer stat.Close()
-		result, err := stat.Exec(commentType, userId, blogId, commentId, commentContent, time.Now().Unix())
+		result, err := stat.Exec(commentType, userId, blogId, commentId, commentContent, contentHTML,
+			time.Now().Unix(), status)
 		if err == nil {
 			insertId, err := result.LastInsertId()
 			fmt.Println("insert id: ", insertId)
@@ -78,56 +119,146 @@ func (c *commentModel) AddComment(commentType int, userId int, blogId int, comme
 	return 0, err
 }
 
+// 彻底删除一篇文章(或插件)下的所有评论
 func (c *commentModel) DeleteAllBlogComment(commentType int, blogId int) error {
-	sql := fmt.Sprintf("delete from %s where %s = ? and %s = ?", kCommentTableName, kCommentType, kCommentId)
+	sql := fmt.Sprintf("delete from %s where %s = ? and %s = ?", kCommentTableName, kCommentType, kCommentTypeId)
 	_, err := database.DatabaseInstance().DB.Exec(sql, commentType, blogId)
 	return err
 }
 
-func (c *commentModel) FetchCommentByCommentId(commentType int, commentId int) (*info.CommentInfo, error) {
-	sql := fmt.Sprintf("select * from %s where %s = ? and %s = ?", kCommentTableName, kCommentType, kCommentId)
-	fmt.Println("sql: ", sql)
-	fmt.Println("type: ", commentType)
-	fmt.Println("commentId: ", commentId)
-	rows, err := database.DatabaseInstance().DB.Query(sql, commentType, commentId)
-	if err == nil {
-		defer rows.Close()
-		if rows.Next() {
-			var commentInfo info.CommentInfo
-			err = rows.Scan(&commentInfo.CommentID, &commentInfo.Type, &commentInfo.TypeID, &commentInfo.ParentCommentID,
-				&commentInfo.UserID, &commentInfo.Content, &commentInfo.Time,
-				&commentInfo.Praise, &commentInfo.Dissent, &commentInfo.Address)
-			return &commentInfo, nil
+func commentSelectColumns(alias string) string {
+	columns := []string{kCommentId, kCommentType, kCommentTypeId, kCommentParentId, kCommentUserId,
+		kCommentContent, kCommentHTML, kCommentTime, kCommentPraise, kCommentDissent, kCommentAddress, kCommentDeletedAt,
+		kCommentStatus, kCommentEditedAt, kCommentRemovedAt}
+	if alias != "" {
+		for i := range columns {
+			columns[i] = alias + "." + columns[i]
 		}
 	}
-	return nil, err
+	return strings.Join(columns, ", ")
 }
 
-func (c *commentModel) FetchAllCommentByBlogId(commentType int, blogId int) (*list.List, error) {
-	sql := fmt.Sprintf("select * from %s where %s = ? and %s = ? order by %s desc", kCommentTableName,
-		kCommentType, kCommentTypeId, kCommentId)
-	rows, err := database.DatabaseInstance().DB.Query(sql, commentType, blogId)
-	var blogList *list.List = list.New()
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var commentInfo info.CommentInfo
-			err = rows.Scan(&commentInfo.CommentID, &commentInfo.Type, &commentInfo.TypeID, &commentInfo.ParentCommentID,
-				&commentInfo.UserID, &commentInfo.Content, &commentInfo.Time,
-				&commentInfo.Praise, &commentInfo.Dissent, &commentInfo.Address)
-			if err == nil {
-				blogList.PushBack(commentInfo)
-			} else {
-				return nil, err
-			}
+// 对viewerId可见的评论：审核通过的，加上他自己还在等待审核的，viewerId为0表示没有登录
+func commentVisibleCondition(viewerId int64) string {
+	condition := fmt.Sprintf("%s = '%s'", kCommentStatus, info.CommentStatus_Approved)
+	if viewerId > 0 {
+		condition = fmt.Sprintf("(%s or (%s = '%s' and %s = %d))", condition, kCommentStatus,
+			info.CommentStatus_Pending, kCommentUserId, viewerId)
+	}
+	return condition
+}
+
+func scanCommentInfo(rows rowScanner) (*info.CommentInfo, error) {
+	var commentInfo info.CommentInfo
+	err := rows.Scan(&commentInfo.CommentID, &commentInfo.Type, &commentInfo.TypeID, &commentInfo.ParentCommentID,
+		&commentInfo.UserID, &commentInfo.Content, &commentInfo.ContentHTML, &commentInfo.Time,
+		&commentInfo.Praise, &commentInfo.Dissent, &commentInfo.Address, &commentInfo.DeletedAt,
+		&commentInfo.Status, &commentInfo.EditedAt, &commentInfo.RemovedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &commentInfo, nil
+}
+
+func (c *commentModel) queryCommentList(sql string, args ...interface{}) (*list.List, error) {
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var commentList *list.List = list.New()
+	for rows.Next() {
+		commentInfo, err := scanCommentInfo(rows)
+		if err != nil {
+			return nil, err
 		}
+		commentList.PushBack(*commentInfo)
 	}
-	return blogList, err
+	return commentList, rows.Err()
 }
 
+func (c *commentModel) FetchCommentByCommentId(commentType int, commentId int) (*info.CommentInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = ? and %s = 0",
+		commentSelectColumns(""), kCommentTableName, kCommentType, kCommentId, kCommentDeletedAt)
+	rows, err := database.DatabaseInstance().DB.Query(sql, commentType, commentId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return scanCommentInfo(rows)
+	}
+	return nil, rows.Err()
+}
+
+// viewerId见commentVisibleCondition，下面几个查询相同
+func (c *commentModel) FetchAllCommentByBlogId(commentType int, blogId int, viewerId int64) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = ? and %s = 0 and %s order by %s desc",
+		commentSelectColumns(""), kCommentTableName, kCommentType, kCommentTypeId, kCommentDeletedAt,
+		commentVisibleCondition(viewerId), kCommentId)
+	return c.queryCommentList(sql, commentType, blogId)
+}
+
+// 按页查询某篇文章(或插件)的评论，最新的在前
+func (c *commentModel) FetchCommentListByBlogId(commentType int, blogId int, offset int, limit int,
+	viewerId int64) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = ? and %s = 0 and %s order by %s desc limit ?, ?",
+		commentSelectColumns(""), kCommentTableName, kCommentType, kCommentTypeId, kCommentDeletedAt,
+		commentVisibleCondition(viewerId), kCommentId)
+	return c.queryCommentList(sql, commentType, blogId, offset, limit)
+}
+
+// 游标分页，返回id小于cursor的limit条评论，cursor<=0表示从最新的开始
+func (c *commentModel) FetchCommentListBefore(commentType int, blogId int, cursor int, limit int,
+	viewerId int64) (*list.List, error) {
+	if cursor <= 0 {
+		return c.FetchCommentListByBlogId(commentType, blogId, 0, limit, viewerId)
+	}
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = ? and %s < ? and %s = 0 and %s order by %s desc limit ?",
+		commentSelectColumns(""), kCommentTableName, kCommentType, kCommentTypeId, kCommentId,
+		kCommentDeletedAt, commentVisibleCondition(viewerId), kCommentId)
+	return c.queryCommentList(sql, commentType, blogId, cursor, limit)
+}
+
+// 分页后被引用的父评论可能不在当前页，用这个接口把它们补齐
+func (c *commentModel) FetchCommentListByIdList(commentType int, commentIdList []int,
+	viewerId int64) (*list.List, error) {
+	if len(commentIdList) == 0 {
+		return list.New(), nil
+	}
+	placeholder, args := inPlaceholder(commentIdList)
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s in (%s) and %s = 0 and %s",
+		commentSelectColumns(""), kCommentTableName, kCommentType, kCommentId, placeholder, kCommentDeletedAt,
+		commentVisibleCondition(viewerId))
+	return c.queryCommentList(sql, append([]interface{}{commentType}, args...)...)
+}
+
+// 按时间或者顶踩的差排序，都是从高到低
+func (c *commentModel) FetchSortedCommentList(commentType int, typeId int, sort string, offset int, limit int,
+	viewerId int64) (*list.List, error) {
+	orderBy := fmt.Sprintf("%s desc", kCommentId)
+	if sort == info.CommentSort_Votes {
+		orderBy = fmt.Sprintf("%s - %s desc, %s desc", kCommentPraise, kCommentDissent, kCommentId)
+	}
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = ? and %s = 0 and %s order by %s limit ?, ?",
+		commentSelectColumns(""), kCommentTableName, kCommentType, kCommentTypeId, kCommentDeletedAt,
+		commentVisibleCondition(viewerId), orderBy)
+	return c.queryCommentList(sql, commentType, typeId, offset, limit)
+}
+
+// 对viewerId可见的评论数，和上面的列表对应
+func (c *commentModel) FetchVisibleCommentCount(commentType int, typeId int, viewerId int64) (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s = ? and %s = 0 and %s",
+		kCommentTableName, kCommentType, kCommentTypeId, kCommentDeletedAt, commentVisibleCondition(viewerId))
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, commentType, typeId).Scan(&count)
+	return count, err
+}
+
+// 评论数和评论人数只统计审核通过的评论
 func (b *commentModel) FetchCommentCount(commentType int, typeId int) (int, error) {
-	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s = ?",
-		kCommentTableName, kCommentType, kCommentTypeId)
+	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s = ? and %s = 0 and %s",
+		kCommentTableName, kCommentType, kCommentTypeId, kCommentDeletedAt, commentVisibleCondition(0))
 	rows, err := database.DatabaseInstance().DB.Query(sql, commentType, typeId)
 	if err == nil {
 		defer rows.Close()
@@ -143,8 +274,9 @@ func (b *commentModel) FetchCommentCount(commentType int, typeId int) (int, erro
 }
 
 func (b *commentModel) FetchCommentPeopleCount(commentType int, typeId int) (int, error) {
-	sql := fmt.Sprintf("select count(distinct(%s)) from %s where %s = ? and %s = ?",
-		kCommentUserId, kCommentTableName, kCommentType, kCommentTypeId)
+	sql := fmt.Sprintf("select count(distinct(%s)) from %s where %s = ? and %s = ? and %s = 0 and %s",
+		kCommentUserId, kCommentTableName, kCommentType, kCommentTypeId, kCommentDeletedAt,
+		commentVisibleCondition(0))
 	rows, err := database.DatabaseInstance().DB.Query(sql, commentType, typeId)
 	if err == nil {
 		defer rows.Close()
@@ -158,3 +290,277 @@ func (b *commentModel) FetchCommentPeopleCount(commentType int, typeId int) (int
 	}
 	return 0, err
 }
+
+// 放入回收站，只是标记删除时间
+func (c *commentModel) TrashComment(commentId int) error {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ? and %s = 0",
+		kCommentTableName, kCommentDeletedAt, kCommentId, kCommentDeletedAt)
+	_, err := database.DatabaseInstance().DB.Exec(sql, time.Now().Unix(), commentId)
+	return err
+}
+
+func (c *commentModel) RestoreComment(commentId int) error {
+	sql := fmt.Sprintf("update %s set %s = 0 where %s = ?", kCommentTableName, kCommentDeletedAt, kCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentId)
+	return err
+}
+
+func (c *commentModel) FetchTrashCommentByCommentId(commentId int) (*info.CommentInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s > 0",
+		commentSelectColumns(""), kCommentTableName, kCommentId, kCommentDeletedAt)
+	commentList, err := c.queryCommentList(sql, commentId)
+	if err != nil || commentList.Len() == 0 {
+		return nil, err
+	}
+	commentInfo := commentList.Front().Value.(info.CommentInfo)
+	return &commentInfo, nil
+}
+
+func (c *commentModel) FetchTrashCommentList() (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s > 0 order by %s desc",
+		commentSelectColumns(""), kCommentTableName, kCommentDeletedAt, kCommentDeletedAt)
+	return c.queryCommentList(sql)
+}
+
+// 回收站里放入时间早于beforeTime的评论，用于定时清理
+func (c *commentModel) FetchExpiredTrashCommentList(beforeTime int64) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s > 0 and %s < ?",
+		commentSelectColumns(""), kCommentTableName, kCommentDeletedAt, kCommentDeletedAt)
+	return c.queryCommentList(sql, beforeTime)
+}
+
+// 彻底删除
+func (c *commentModel) DeleteComment(commentId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ?", kCommentTableName, kCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentId)
+	return err
+}
+
+// [beginTime, endTime)之间每天新增的评论数，不含回收站里的
+func (c *commentModel) FetchDailyCommentCount(beginTime int64, endTime int64) ([]*info.DailyCountInfo, error) {
+	sql := fmt.Sprintf(`select from_unixtime(%s, '%%Y%%m%%d') d, count(*) from %s
+		where %s >= ? and %s < ? and %s = 0 group by d order by d`,
+		kCommentTime, kCommentTableName, kCommentTime, kCommentTime, kCommentDeletedAt)
+	rows, err := database.DatabaseInstance().DB.Query(sql, beginTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var countList []*info.DailyCountInfo = nil
+	for rows.Next() {
+		var count info.DailyCountInfo
+		if err = rows.Scan(&count.Day, &count.Count); err != nil {
+			return nil, err
+		}
+		countList = append(countList, &count)
+	}
+	return countList, rows.Err()
+}
+
+// 审核队列，按状态查询所有博客和插件下的评论，最早的在前
+func (c *commentModel) FetchCommentListByStatus(status string, offset int, limit int) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = 0 order by %s limit ?, ?",
+		commentSelectColumns(""), kCommentTableName, kCommentStatus, kCommentDeletedAt, kCommentId)
+	return c.queryCommentList(sql, status, offset, limit)
+}
+
+func (c *commentModel) FetchCommentCountByStatus(status string) (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s = 0",
+		kCommentTableName, kCommentStatus, kCommentDeletedAt)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, status).Scan(&count)
+	return count, err
+}
+
+// 批量修改审核状态，返回实际修改的条数
+func (c *commentModel) SetCommentStatus(commentIdList []int, status string) (int, error) {
+	if len(commentIdList) == 0 {
+		return 0, nil
+	}
+	placeholder, args := inPlaceholder(commentIdList)
+	sql := fmt.Sprintf("update %s set %s = ? where %s in (%s)",
+		kCommentTableName, kCommentStatus, kCommentId, placeholder)
+	result, err := database.DatabaseInstance().DB.Exec(sql, append([]interface{}{status}, args...)...)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// 用户是否有过审核通过的评论，用来判断是不是第一次评论
+func (c *commentModel) HasApprovedComment(userId int64) (bool, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s = ?",
+		kCommentTableName, kCommentUserId, kCommentStatus)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, userId, info.CommentStatus_Approved).Scan(&count)
+	return count > 0, err
+}
+
+// 按id查询，不管在哪篇博客(插件)下、是什么审核状态，审核时使用
+func (c *commentModel) FetchAnyCommentListByIdList(commentIdList []int) (*list.List, error) {
+	if len(commentIdList) == 0 {
+		return list.New(), nil
+	}
+	placeholder, args := inPlaceholder(commentIdList)
+	sql := fmt.Sprintf("select %s from %s where %s in (%s)",
+		commentSelectColumns(""), kCommentTableName, kCommentId, placeholder)
+	return c.queryCommentList(sql, args...)
+}
+
+// 用户各个审核状态的评论数，包括回收站里的
+func (c *commentModel) FetchUserCommentStatusCount(userId int64) (map[string]int, error) {
+	sql := fmt.Sprintf("select %s, count(*) from %s where %s = ? group by %s",
+		kCommentStatus, kCommentTableName, kCommentUserId, kCommentStatus)
+	rows, err := database.DatabaseInstance().DB.Query(sql, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var countMap map[string]int = make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err = rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		countMap[status] = count
+	}
+	return countMap, rows.Err()
+}
+
+// 有没有还没放入回收站的回复，有回复的评论删除时只能清空内容
+func (c *commentModel) HasReply(commentId int) (bool, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s = 0",
+		kCommentTableName, kCommentParentId, kCommentDeletedAt)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, commentId).Scan(&count)
+	return count > 0, err
+}
+
+/* 修改评论内容，修改之前的内容保存到comment_history，返回修改之后的状态。
+** needReview为true时改回pending，否则保持原来的状态，编辑不会让评论直接通过审核。
+** 只有approved和pending的评论可以修改，被拒绝和标记为垃圾的返回空字符串。
+ */
+func (c *commentModel) EditComment(commentId int, content string, contentHTML string,
+	needReview bool) (string, error) {
+	var status string
+	err := runInTransaction(func(tx *sql.Tx) error {
+		query := fmt.Sprintf("select %s, %s from %s where %s = ? for update",
+			kCommentContent, kCommentStatus, kCommentTableName, kCommentId)
+		var oldContent, oldStatus string
+		if err := tx.QueryRow(query, commentId).Scan(&oldContent, &oldStatus); err != nil {
+			return err
+		}
+		if oldStatus != info.CommentStatus_Approved && oldStatus != info.CommentStatus_Pending {
+			return nil
+		}
+		status = oldStatus
+		if needReview {
+			status = info.CommentStatus_Pending
+		}
+		now := time.Now().Unix()
+		history := fmt.Sprintf("insert into %s(%s, %s, %s) values(?, ?, ?)",
+			kCommentHistoryTableName, kCommentHistoryCommentId, kCommentHistoryContent, kCommentHistoryTime)
+		if _, err := tx.Exec(history, commentId, oldContent, now); err != nil {
+			return err
+		}
+		update := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ?, %s = ? where %s = ?",
+			kCommentTableName, kCommentContent, kCommentHTML, kCommentStatus, kCommentEditedAt, kCommentId)
+		_, err := tx.Exec(update, content, contentHTML, status, now, commentId)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// 清空内容留下占位，回复仍然挂在它下面
+func (c *commentModel) RemoveComment(commentId int) error {
+	sql := fmt.Sprintf("update %s set %s = '', %s = '', %s = ? where %s = ?",
+		kCommentTableName, kCommentContent, kCommentHTML, kCommentRemovedAt, kCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, time.Now().Unix(), commentId)
+	return err
+}
+
+// 补上老评论渲染之后的内容
+func (c *commentModel) SetCommentHTML(commentId int, contentHTML string) error {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ?", kCommentTableName, kCommentHTML, kCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, contentHTML, commentId)
+	return err
+}
+
+// 在某篇博客(插件)下发表过审核通过的评论的用户
+func (c *commentModel) FetchCommenterIdList(commentType int, typeId int) ([]int64, error) {
+	sql := fmt.Sprintf("select distinct %s from %s where %s = ? and %s = ? and %s = 0 and %s",
+		kCommentUserId, kCommentTableName, kCommentType, kCommentTypeId, kCommentDeletedAt,
+		commentVisibleCondition(0))
+	rows, err := database.DatabaseInstance().DB.Query(sql, commentType, typeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var userIdList []int64 = nil
+	for rows.Next() {
+		var userId int64
+		if err = rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIdList = append(userIdList, userId)
+	}
+	return userIdList, rows.Err()
+}
+
+// 用户主页上公开的评论条件：审核通过、没有删除，并且所在的博客(插件)还能公开访问
+func userCommentCondition() string {
+	return fmt.Sprintf(`c.%s = ? and c.%s = 0 and c.%s = 0 and c.%s = '%s' and
+		((c.%s = %d and %s) or (c.%s = %d and p.%s = 0))`,
+		kCommentUserId, kCommentDeletedAt, kCommentRemovedAt, kCommentStatus, info.CommentStatus_Approved,
+		kCommentType, info.CommentType_Blog, blogVisibleCondition("b"), kCommentType, info.CommentType_Plugin,
+		kPluginDeletedAt)
+}
+
+func userCommentJoin() string {
+	return fmt.Sprintf("%s c left join %s b on c.%s = %d and b.%s = c.%s left join %s p on c.%s = %d and p.%s = c.%s",
+		kCommentTableName, kBlogTableName, kCommentType, info.CommentType_Blog, kBlogId, kCommentTypeId,
+		kPluginTableName, kCommentType, info.CommentType_Plugin, kPluginId, kCommentTypeId)
+}
+
+// 扫描评论之后再扫描额外的列
+type extraColumnScanner struct {
+	rows  rowScanner
+	extra []interface{}
+}
+
+func (e extraColumnScanner) Scan(dest ...interface{}) error {
+	return e.rows.Scan(append(dest, e.extra...)...)
+}
+
+// 用户公开的评论，按时间倒序，带上所在博客的标题或者插件的名字
+func (c *commentModel) FetchUserCommentList(userId int64, offset int, limit int) ([]*info.UserCommentInfo, error) {
+	query := fmt.Sprintf("select %s, coalesce(b.%s, p.%s, '') from %s where %s order by c.%s desc limit ?, ?",
+		commentSelectColumns("c"), kBlogTitle, kPluginName, userCommentJoin(), userCommentCondition(), kCommentId)
+	rows, err := database.DatabaseInstance().DB.Query(query, userId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var commentList []*info.UserCommentInfo = nil
+	for rows.Next() {
+		var title string
+		commentInfo, err := scanCommentInfo(extraColumnScanner{rows: rows, extra: []interface{}{&title}})
+		if err != nil {
+			return nil, err
+		}
+		commentList = append(commentList, &info.UserCommentInfo{CommentInfo: *commentInfo, Title: title})
+	}
+	return commentList, rows.Err()
+}
+
+func (c *commentModel) FetchUserCommentCount(userId int64) (int, error) {
+	query := fmt.Sprintf("select count(*) from %s where %s", userCommentJoin(), userCommentCondition())
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(query, userId).Scan(&count)
+	return count, err
+}
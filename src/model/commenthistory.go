@@ -0,0 +1,85 @@
+package model
+
+import (
+	"fmt"
+	"framework/database"
+	"info"
+	"sync"
+)
+
+const (
+	kCommentHistoryTableName = "comment_history"
+	kCommentHistoryId        = "id"
+	kCommentHistoryCommentId = "comment_id"
+	kCommentHistoryContent   = "content"
+	kCommentHistoryTime      = "time"
+)
+
+type commentHistoryModel struct {
+}
+
+var commentHistoryModelInstance *commentHistoryModel = nil
+
+var commentHistoryOnce sync.Once
+
+func ShareCommentHistoryModel() *commentHistoryModel {
+	commentHistoryOnce.Do(func() {
+		commentHistoryModelInstance = &commentHistoryModel{}
+	})
+	return commentHistoryModelInstance
+}
+
+// 评论的编辑历史，每次编辑保存一条修改之前的内容，写入见commentModel.EditComment
+func (c *commentHistoryModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kCommentHistoryTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+		%s int(32) unsigned NOT NULL,
+		%s varchar(1024) NOT NULL,
+		%s int(64) NOT NULL,
+		PRIMARY KEY (%s),
+		KEY (%s)
+	) CHARSET=utf8;`, kCommentHistoryTableName, kCommentHistoryId, kCommentHistoryCommentId,
+		kCommentHistoryContent, kCommentHistoryTime, kCommentHistoryId, kCommentHistoryCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+// 某条评论的编辑历史，新的在前
+func (c *commentHistoryModel) FetchCommentHistory(commentId int) ([]*info.CommentHistoryInfo, error) {
+	sql := fmt.Sprintf("select %s, %s, %s, %s from %s where %s = ? order by %s desc",
+		kCommentHistoryId, kCommentHistoryCommentId, kCommentHistoryContent, kCommentHistoryTime,
+		kCommentHistoryTableName, kCommentHistoryCommentId, kCommentHistoryId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, commentId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var historyList []*info.CommentHistoryInfo = nil
+	for rows.Next() {
+		var history info.CommentHistoryInfo
+		if err = rows.Scan(&history.HistoryID, &history.CommentID, &history.Content, &history.Time); err != nil {
+			return nil, err
+		}
+		historyList = append(historyList, &history)
+	}
+	return historyList, rows.Err()
+}
+
+func (c *commentHistoryModel) DeleteCommentHistory(commentId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ?", kCommentHistoryTableName, kCommentHistoryCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentId)
+	return err
+}
+
+func (c *commentHistoryModel) DeleteCommentHistoryByTypeId(commentType int, typeId int) error {
+	sql := fmt.Sprintf(`delete h from %s h inner join %s c on c.%s = h.%s
+		where c.%s = ? and c.%s = ?`,
+		kCommentHistoryTableName, kCommentTableName, kCommentId, kCommentHistoryCommentId,
+		kCommentType, kCommentTypeId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentType, typeId)
+	return err
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"fmt"
+	"framework/database"
+	"info"
+	"sync"
+)
+
+const (
+	kCommentSettingTableName       = "comment_setting"
+	kCommentSettingType            = "type"
+	kCommentSettingTypeId          = "type_id"
+	kCommentSettingClosed          = "closed"
+	kCommentSettingRequireLogin    = "require_login"
+	kCommentSettingRequireApproval = "require_approval"
+)
+
+type commentSettingModel struct {
+}
+
+var commentSettingModelInstance *commentSettingModel = nil
+
+var commentSettingOnce sync.Once
+
+func ShareCommentSettingModel() *commentSettingModel {
+	commentSettingOnce.Do(func() {
+		commentSettingModelInstance = &commentSettingModel{}
+	})
+	return commentSettingModelInstance
+}
+
+// 每篇博客(或插件)的评论设置，没有记录时使用默认设置
+func (c *commentSettingModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kCommentSettingTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) NOT NULL,
+		%s int(32) NOT NULL,
+		%s tinyint(4) NOT NULL DEFAULT '0',
+		%s tinyint(4) NOT NULL DEFAULT '0',
+		%s tinyint(4) NOT NULL DEFAULT '0',
+		PRIMARY KEY (%s, %s)
+	) CHARSET=utf8;`, kCommentSettingTableName, kCommentSettingType, kCommentSettingTypeId,
+		kCommentSettingClosed, kCommentSettingRequireLogin, kCommentSettingRequireApproval,
+		kCommentSettingType, kCommentSettingTypeId)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func (c *commentSettingModel) FetchCommentSetting(commentType int, typeId int) (*info.CommentSettingInfo, error) {
+	sql := fmt.Sprintf("select %s, %s, %s from %s where %s = ? and %s = ?",
+		kCommentSettingClosed, kCommentSettingRequireLogin, kCommentSettingRequireApproval,
+		kCommentSettingTableName, kCommentSettingType, kCommentSettingTypeId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, commentType, typeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	setting := &info.CommentSettingInfo{Type: commentType, TypeID: typeId}
+	if rows.Next() {
+		var closed, requireLogin, requireApproval int
+		if err = rows.Scan(&closed, &requireLogin, &requireApproval); err != nil {
+			return nil, err
+		}
+		setting.Closed = closed != 0
+		setting.RequireLogin = requireLogin != 0
+		setting.RequireApproval = requireApproval != 0
+	}
+	return setting, rows.Err()
+}
+
+func (c *commentSettingModel) SetCommentSetting(setting *info.CommentSettingInfo) error {
+	sql := fmt.Sprintf(`insert into %s(%s, %s, %s, %s, %s) values(?, ?, ?, ?, ?)
+		on duplicate key update %s = values(%s), %s = values(%s), %s = values(%s)`,
+		kCommentSettingTableName, kCommentSettingType, kCommentSettingTypeId,
+		kCommentSettingClosed, kCommentSettingRequireLogin, kCommentSettingRequireApproval,
+		kCommentSettingClosed, kCommentSettingClosed, kCommentSettingRequireLogin, kCommentSettingRequireLogin,
+		kCommentSettingRequireApproval, kCommentSettingRequireApproval)
+	_, err := database.DatabaseInstance().DB.Exec(sql, setting.Type, setting.TypeID, boolToInt(setting.Closed),
+		boolToInt(setting.RequireLogin), boolToInt(setting.RequireApproval))
+	return err
+}
+
+// 博客(或插件)被彻底删除时调用
+func (c *commentSettingModel) DeleteCommentSetting(commentType int, typeId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ? and %s = ?",
+		kCommentSettingTableName, kCommentSettingType, kCommentSettingTypeId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentType, typeId)
+	return err
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"fmt"
+	"framework/database"
+	"sync"
+	"time"
+)
+
+const (
+	kLoginFailureTableName = "login_failure"
+	kLoginFailureId        = "id"
+	kLoginFailureAccount   = "account"
+	kLoginFailureIP        = "ip"
+	kLoginFailureTime      = "time"
+	// 超过这个时间的记录没有用了，写入时顺便删掉
+	kLoginFailureKeepTime = 24 * 60 * 60
+)
+
+type loginFailureModel struct {
+}
+
+var loginFailureModelInstance *loginFailureModel = nil
+
+var loginFailureOnce sync.Once
+
+func ShareLoginFailureModel() *loginFailureModel {
+	loginFailureOnce.Do(func() {
+		loginFailureModelInstance = &loginFailureModel{}
+	})
+	return loginFailureModelInstance
+}
+
+// 本站帐号登录失败的记录，按帐号和ip限制尝试的次数
+func (l *loginFailureModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kLoginFailureTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(64) unsigned NOT NULL AUTO_INCREMENT,
+		%s varchar(255) NOT NULL,
+		%s varchar(64) NOT NULL,
+		%s int(64) NOT NULL,
+		PRIMARY KEY (%s),
+		KEY (%s, %s),
+		KEY (%s, %s)
+	) CHARSET=utf8;`, kLoginFailureTableName, kLoginFailureId, kLoginFailureAccount, kLoginFailureIP,
+		kLoginFailureTime, kLoginFailureId, kLoginFailureAccount, kLoginFailureTime, kLoginFailureIP,
+		kLoginFailureTime)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func (l *loginFailureModel) AddLoginFailure(account string, ip string) error {
+	now := time.Now().Unix()
+	sql := fmt.Sprintf("delete from %s where %s < ?", kLoginFailureTableName, kLoginFailureTime)
+	if _, err := database.DatabaseInstance().DB.Exec(sql, now-kLoginFailureKeepTime); err != nil {
+		return err
+	}
+	sql = fmt.Sprintf("insert into %s(%s, %s, %s) values(?, ?, ?)", kLoginFailureTableName, kLoginFailureAccount,
+		kLoginFailureIP, kLoginFailureTime)
+	_, err := database.DatabaseInstance().DB.Exec(sql, account, ip, now)
+	return err
+}
+
+// since之后这个帐号和这个ip各自失败的次数，ip为空时不统计ip
+func (l *loginFailureModel) FetchRecentCount(account string, ip string, since int64) (int, int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s >= ?", kLoginFailureTableName,
+		kLoginFailureAccount, kLoginFailureTime)
+	var accountCount, ipCount int
+	err := database.DatabaseInstance().DB.QueryRow(sql, account, since).Scan(&accountCount)
+	if err != nil || ip == "" {
+		return accountCount, 0, err
+	}
+	sql = fmt.Sprintf("select count(*) from %s where %s = ? and %s >= ?", kLoginFailureTableName,
+		kLoginFailureIP, kLoginFailureTime)
+	err = database.DatabaseInstance().DB.QueryRow(sql, ip, since).Scan(&ipCount)
+	return accountCount, ipCount, err
+}
+
+// 登录成功之后清掉这个帐号的失败记录
+func (l *loginFailureModel) ClearAccount(account string) error {
+	sql := fmt.Sprintf("delete from %s where %s = ?", kLoginFailureTableName, kLoginFailureAccount)
+	_, err := database.DatabaseInstance().DB.Exec(sql, account)
+	return err
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"fmt"
+	"framework/database"
+	"time"
+)
+
+/* 数据迁移的记录，每个迁移完成之后写一行，之后启动时就不再执行。
+** 迁移本身需要可以重复执行，中途失败时下次启动会从头再来一遍。
+ */
+
+const (
+	kMigrationTableName = "migration"
+	kMigrationName      = "name"
+	kMigrationTime      = "time"
+)
+
+func createMigrationTable() error {
+	if database.DatabaseInstance().DoesTableExist(kMigrationTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s varchar(64) NOT NULL,
+		%s int(64) NOT NULL,
+		PRIMARY KEY (%s)
+	) CHARSET=utf8;`, kMigrationTableName, kMigrationName, kMigrationTime, kMigrationName)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+// 名为name的迁移还没有完成时执行migrate，成功之后记下来
+func runMigrationOnce(name string, migrate func() error) error {
+	if err := createMigrationTable(); err != nil {
+		return err
+	}
+	query := fmt.Sprintf("select count(*) from %s where %s = ?", kMigrationTableName, kMigrationName)
+	var count int
+	if err := database.DatabaseInstance().DB.QueryRow(query, name).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if err := migrate(); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf("insert ignore into %s(%s, %s) values(?, ?)", kMigrationTableName, kMigrationName,
+		kMigrationTime)
+	_, err := database.DatabaseInstance().DB.Exec(insert, name, time.Now().Unix())
+	return err
+}
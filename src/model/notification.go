@@ -0,0 +1,173 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"framework/database"
+	"info"
+	"sync"
+	"time"
+)
+
+const (
+	kNotificationTableName   = "notification"
+	kNotificationId          = "id"
+	kNotificationUserId      = "user_id"
+	kNotificationType        = "type"
+	kNotificationActorId     = "actor_id"
+	kNotificationCommentId   = "comment_id"
+	kNotificationCommentType = "comment_type"
+	kNotificationTypeId      = "type_id"
+	kNotificationContent     = "content"
+	kNotificationTime        = "time"
+	kNotificationReadAt      = "read_at"
+)
+
+type notificationModel struct {
+}
+
+var notificationModelInstance *notificationModel = nil
+
+var notificationOnce sync.Once
+
+func ShareNotificationModel() *notificationModel {
+	notificationOnce.Do(func() {
+		notificationModelInstance = &notificationModel{}
+	})
+	return notificationModelInstance
+}
+
+// 读者的通知收件箱，每条通知对应一条评论
+func (n *notificationModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kNotificationTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+		%s bigint(64) NOT NULL,
+		%s varchar(16) NOT NULL,
+		%s bigint(64) NOT NULL DEFAULT '0',
+		%s int(32) unsigned NOT NULL,
+		%s int(32) NOT NULL,
+		%s int(32) NOT NULL,
+		%s varchar(256) DEFAULT '',
+		%s int(64) NOT NULL,
+		%s int(64) NOT NULL DEFAULT '0',
+		PRIMARY KEY (%s),
+		KEY (%s, %s)
+	) CHARSET=utf8;`, kNotificationTableName, kNotificationId, kNotificationUserId, kNotificationType,
+		kNotificationActorId, kNotificationCommentId, kNotificationCommentType, kNotificationTypeId,
+		kNotificationContent, kNotificationTime, kNotificationReadAt, kNotificationId,
+		kNotificationUserId, kNotificationReadAt)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func notificationSelectColumns() string {
+	return fmt.Sprintf("%s, %s, %s, %s, %s, %s, %s, %s, %s, %s",
+		kNotificationId, kNotificationUserId, kNotificationType, kNotificationActorId, kNotificationCommentId,
+		kNotificationCommentType, kNotificationTypeId, kNotificationContent, kNotificationTime, kNotificationReadAt)
+}
+
+// 批量新增，写入之后会填上NotificationID和Time
+func (n *notificationModel) AddNotifications(notificationList []*info.NotificationInfo) error {
+	if len(notificationList) == 0 {
+		return nil
+	}
+	return runInTransaction(func(tx *sql.Tx) error {
+		insert := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?, ?, ?)",
+			kNotificationTableName, kNotificationUserId, kNotificationType, kNotificationActorId,
+			kNotificationCommentId, kNotificationCommentType, kNotificationTypeId, kNotificationContent,
+			kNotificationTime)
+		stmt, err := tx.Prepare(insert)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		now := time.Now().Unix()
+		for _, notification := range notificationList {
+			result, err := stmt.Exec(notification.UserID, notification.Type, notification.ActorID,
+				notification.CommentID, notification.CommentType, notification.TypeID, notification.Content, now)
+			if err != nil {
+				return err
+			}
+			insertId, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			notification.NotificationID = int(insertId)
+			notification.Time = now
+		}
+		return nil
+	})
+}
+
+// 某个读者的通知，新的在前
+func (n *notificationModel) FetchNotificationList(userId int64, offset int, limit int) ([]*info.NotificationInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? order by %s desc limit ?, ?",
+		notificationSelectColumns(), kNotificationTableName, kNotificationUserId, kNotificationId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, userId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var notificationList []*info.NotificationInfo = nil
+	for rows.Next() {
+		var notification info.NotificationInfo
+		err = rows.Scan(&notification.NotificationID, &notification.UserID, &notification.Type,
+			&notification.ActorID, &notification.CommentID, &notification.CommentType, &notification.TypeID,
+			&notification.Content, &notification.Time, &notification.ReadAt)
+		if err != nil {
+			return nil, err
+		}
+		notificationList = append(notificationList, &notification)
+	}
+	return notificationList, rows.Err()
+}
+
+func (n *notificationModel) FetchNotificationCount(userId int64) (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ?", kNotificationTableName, kNotificationUserId)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, userId).Scan(&count)
+	return count, err
+}
+
+func (n *notificationModel) FetchUnreadCount(userId int64) (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s = 0",
+		kNotificationTableName, kNotificationUserId, kNotificationReadAt)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, userId).Scan(&count)
+	return count, err
+}
+
+// idList为空时把这个读者的全部通知标记为已读，只能标记自己的通知
+func (n *notificationModel) MarkRead(userId int64, idList []int) (int, error) {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ? and %s = 0",
+		kNotificationTableName, kNotificationReadAt, kNotificationUserId, kNotificationReadAt)
+	args := []interface{}{time.Now().Unix(), userId}
+	if len(idList) > 0 {
+		placeholder, idArgs := inPlaceholder(idList)
+		sql += fmt.Sprintf(" and %s in (%s)", kNotificationId, placeholder)
+		args = append(args, idArgs...)
+	}
+	result, err := database.DatabaseInstance().DB.Exec(sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+func (n *notificationModel) DeleteCommentNotifications(commentId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ?", kNotificationTableName, kNotificationCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentId)
+	return err
+}
+
+func (n *notificationModel) DeleteNotificationsByTypeId(commentType int, typeId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ? and %s = ?",
+		kNotificationTableName, kNotificationCommentType, kNotificationTypeId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentType, typeId)
+	return err
+}
@@ -0,0 +1,226 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"framework/database"
+	"info"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kOwnerAuthTableName   = "owner_auth"
+	kOwnerAuthId          = "id"
+	kOwnerAuthUserName    = "username"
+	kOwnerAuthPassword    = "password"
+	kOwnerAuthTOTPSecret  = "totp_secret"
+	kOwnerAuthTOTPEnabled = "totp_enabled"
+	kOwnerAuthTOTPStep    = "totp_step"
+	kOwnerAuthFailedCount = "failed_count"
+	kOwnerAuthLockedUntil = "locked_until"
+	kOwnerAuthUpdateTime  = "update_time"
+)
+
+const (
+	kRecoveryCodeTableName = "owner_recovery_code"
+	kRecoveryCodeId        = "id"
+	kRecoveryCodeCode      = "code"
+	kRecoveryCodeUsedAt    = "used_at"
+)
+
+// 主人的凭据只有一行
+const kOwnerAuthRowId = 1
+
+type ownerAuthModel struct {
+}
+
+var ownerAuthModelInstance *ownerAuthModel = nil
+
+var ownerAuthOnce sync.Once
+
+func ShareOwnerAuthModel() *ownerAuthModel {
+	ownerAuthOnce.Do(func() {
+		ownerAuthModelInstance = &ownerAuthModel{}
+	})
+	return ownerAuthModelInstance
+}
+
+/* 主人登录用到两张表：
+** owner_auth，用户名、密码摘要、TOTP密钥以及连续失败次数和锁定时间；
+** owner_recovery_code，TOTP的恢复码，只保存sha256，每个只能用一次。
+ */
+func (o *ownerAuthModel) CreateTable() error {
+	if !database.DatabaseInstance().DoesTableExist(kOwnerAuthTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s int(32) unsigned NOT NULL,
+			%s varchar(256) NOT NULL DEFAULT '',
+			%s varchar(256) NOT NULL DEFAULT '',
+			%s varchar(64) NOT NULL DEFAULT '',
+			%s tinyint(1) NOT NULL DEFAULT '0',
+			%s bigint(64) NOT NULL DEFAULT '0',
+			%s int(32) NOT NULL DEFAULT '0',
+			%s int(64) NOT NULL DEFAULT '0',
+			%s int(64) NOT NULL DEFAULT '0',
+			PRIMARY KEY (%s)
+		) CHARSET=utf8;`, kOwnerAuthTableName, kOwnerAuthId, kOwnerAuthUserName, kOwnerAuthPassword,
+			kOwnerAuthTOTPSecret, kOwnerAuthTOTPEnabled, kOwnerAuthTOTPStep, kOwnerAuthFailedCount,
+			kOwnerAuthLockedUntil, kOwnerAuthUpdateTime, kOwnerAuthId)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	if !database.DatabaseInstance().DoesTableExist(kRecoveryCodeTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+			%s char(64) NOT NULL,
+			%s int(64) NOT NULL DEFAULT '0',
+			PRIMARY KEY (%s),
+			UNIQUE KEY (%s)
+		) CHARSET=utf8;`, kRecoveryCodeTableName, kRecoveryCodeId, kRecoveryCodeCode, kRecoveryCodeUsedAt,
+			kRecoveryCodeId, kRecoveryCodeCode)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 还没有设置过凭据时返回nil
+func (o *ownerAuthModel) FetchOwnerAuth() (*info.OwnerAuthInfo, error) {
+	sql := fmt.Sprintf("select %s, %s, %s, %s, %s, %s, %s from %s where %s = ?", kOwnerAuthUserName,
+		kOwnerAuthPassword, kOwnerAuthTOTPSecret, kOwnerAuthTOTPEnabled, kOwnerAuthTOTPStep,
+		kOwnerAuthFailedCount, kOwnerAuthLockedUntil, kOwnerAuthTableName, kOwnerAuthId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, kOwnerAuthRowId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	authInfo := &info.OwnerAuthInfo{}
+	var enabled int
+	if err = rows.Scan(&authInfo.UserName, &authInfo.PasswordHash, &authInfo.TOTPSecret, &enabled,
+		&authInfo.TOTPStep, &authInfo.FailedCount, &authInfo.LockedUntil); err != nil {
+		return nil, err
+	}
+	authInfo.TOTPEnabled = enabled != 0
+	return authInfo, nil
+}
+
+// 设置用户名和密码，同时清掉失败次数和锁定
+func (o *ownerAuthModel) SetCredential(userName string, passwordHash string) error {
+	sql := fmt.Sprintf(`insert into %s(%s, %s, %s, %s) values(?, ?, ?, ?)
+		on duplicate key update %s = values(%s), %s = values(%s), %s = 0, %s = 0, %s = values(%s)`,
+		kOwnerAuthTableName, kOwnerAuthId, kOwnerAuthUserName, kOwnerAuthPassword, kOwnerAuthUpdateTime,
+		kOwnerAuthUserName, kOwnerAuthUserName, kOwnerAuthPassword, kOwnerAuthPassword,
+		kOwnerAuthFailedCount, kOwnerAuthLockedUntil, kOwnerAuthUpdateTime, kOwnerAuthUpdateTime)
+	_, err := database.DatabaseInstance().DB.Exec(sql, kOwnerAuthRowId, userName, passwordHash, time.Now().Unix())
+	return err
+}
+
+/* 记一次失败，lockDuration根据累计的失败次数返回需要锁定的秒数，返回锁定到的时间。
+** 在事务里读写，并发的失败请求不会少记。
+ */
+func (o *ownerAuthModel) RecordFailure(lockDuration func(failedCount int) int64) (int64, error) {
+	var lockedUntil int64 = 0
+	err := runInTransaction(func(tx *sql.Tx) error {
+		query := fmt.Sprintf("select %s, %s from %s where %s = ? for update", kOwnerAuthFailedCount,
+			kOwnerAuthLockedUntil, kOwnerAuthTableName, kOwnerAuthId)
+		var failedCount int
+		err := tx.QueryRow(query, kOwnerAuthRowId).Scan(&failedCount, &lockedUntil)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		failedCount++
+		now := time.Now().Unix()
+		if duration := lockDuration(failedCount); duration > 0 && now+duration > lockedUntil {
+			lockedUntil = now + duration
+		}
+		update := fmt.Sprintf("update %s set %s = ?, %s = ? where %s = ?", kOwnerAuthTableName,
+			kOwnerAuthFailedCount, kOwnerAuthLockedUntil, kOwnerAuthId)
+		_, err = tx.Exec(update, failedCount, lockedUntil, kOwnerAuthRowId)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return lockedUntil, nil
+}
+
+func (o *ownerAuthModel) ResetFailure() error {
+	sql := fmt.Sprintf("update %s set %s = 0, %s = 0 where %s = ?", kOwnerAuthTableName,
+		kOwnerAuthFailedCount, kOwnerAuthLockedUntil, kOwnerAuthId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, kOwnerAuthRowId)
+	return err
+}
+
+// 保存TOTP密钥，enabled为false表示等待确认，secret为空表示关闭两步验证
+func (o *ownerAuthModel) SetTOTP(secret string, enabled bool) error {
+	sql := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = 0, %s = ? where %s = ?", kOwnerAuthTableName,
+		kOwnerAuthTOTPSecret, kOwnerAuthTOTPEnabled, kOwnerAuthTOTPStep, kOwnerAuthUpdateTime, kOwnerAuthId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, secret, boolToInt(enabled), time.Now().Unix(),
+		kOwnerAuthRowId)
+	return err
+}
+
+// 记下用过的时间步，step不比上一次大时返回false，说明这个code已经用过了
+func (o *ownerAuthModel) UseTOTPStep(step int64) (bool, error) {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ? and %s < ?", kOwnerAuthTableName,
+		kOwnerAuthTOTPStep, kOwnerAuthId, kOwnerAuthTOTPStep)
+	result, err := database.DatabaseInstance().DB.Exec(sql, step, kOwnerAuthRowId, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// 用新的恢复码替换掉原来所有的
+func (o *ownerAuthModel) ReplaceRecoveryCodes(codeHashList []string) error {
+	return runInTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(fmt.Sprintf("delete from %s", kRecoveryCodeTableName)); err != nil {
+			return err
+		}
+		if len(codeHashList) == 0 {
+			return nil
+		}
+		var placeholderList []string = nil
+		var args []interface{} = nil
+		for _, codeHash := range codeHashList {
+			placeholderList = append(placeholderList, "(?)")
+			args = append(args, codeHash)
+		}
+		insert := fmt.Sprintf("insert into %s(%s) values %s", kRecoveryCodeTableName, kRecoveryCodeCode,
+			strings.Join(placeholderList, ", "))
+		_, err := tx.Exec(insert, args...)
+		return err
+	})
+}
+
+// 恢复码存在并且没有用过时作废它，返回true
+func (o *ownerAuthModel) UseRecoveryCode(codeHash string) (bool, error) {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ? and %s = 0", kRecoveryCodeTableName,
+		kRecoveryCodeUsedAt, kRecoveryCodeCode, kRecoveryCodeUsedAt)
+	result, err := database.DatabaseInstance().DB.Exec(sql, time.Now().Unix(), codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
+
+// 还没有用过的恢复码个数
+func (o *ownerAuthModel) FetchRecoveryCodeCount() (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = 0", kRecoveryCodeTableName, kRecoveryCodeUsedAt)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"framework/database"
+	"sync"
+	"time"
+)
+
+const (
+	kPasswordResetTableName = "password_reset"
+	kPasswordResetId        = "id"
+	kPasswordResetUserId    = "user_id"
+	kPasswordResetToken     = "token"
+	kPasswordResetTime      = "time"
+	kPasswordResetExpireAt  = "expire_at"
+	kPasswordResetUsedAt    = "used_at"
+)
+
+type passwordResetModel struct {
+}
+
+var passwordResetModelInstance *passwordResetModel = nil
+
+var passwordResetOnce sync.Once
+
+func SharePasswordResetModel() *passwordResetModel {
+	passwordResetOnce.Do(func() {
+		passwordResetModelInstance = &passwordResetModel{}
+	})
+	return passwordResetModelInstance
+}
+
+// 找回密码的令牌，只保存令牌的sha256，用过一次或者过期之后作废
+func (p *passwordResetModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kPasswordResetTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+		%s bigint(64) NOT NULL,
+		%s char(64) NOT NULL,
+		%s int(64) NOT NULL,
+		%s int(64) NOT NULL,
+		%s int(64) NOT NULL DEFAULT '0',
+		PRIMARY KEY (%s),
+		UNIQUE KEY (%s),
+		KEY (%s)
+	) CHARSET=utf8;`, kPasswordResetTableName, kPasswordResetId, kPasswordResetUserId, kPasswordResetToken,
+		kPasswordResetTime, kPasswordResetExpireAt, kPasswordResetUsedAt, kPasswordResetId,
+		kPasswordResetToken, kPasswordResetUserId)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func (p *passwordResetModel) AddPasswordReset(userId int64, tokenHash string, expireAt int64) error {
+	sql := fmt.Sprintf("insert into %s(%s, %s, %s, %s) values(?, ?, ?, ?)", kPasswordResetTableName,
+		kPasswordResetUserId, kPasswordResetToken, kPasswordResetTime, kPasswordResetExpireAt)
+	_, err := database.DatabaseInstance().DB.Exec(sql, userId, tokenHash, time.Now().Unix(), expireAt)
+	return err
+}
+
+// 最近一段时间内申请的次数，用来限制发信频率
+func (p *passwordResetModel) FetchRecentCount(userId int64, since int64) (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ? and %s >= ?", kPasswordResetTableName,
+		kPasswordResetUserId, kPasswordResetTime)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, userId, since).Scan(&count)
+	return count, err
+}
+
+/* 使用令牌：令牌有效时返回对应的用户，同时作废这个用户所有没用过的令牌；
+** 令牌不存在、已经用过或者过期时返回0
+ */
+func (p *passwordResetModel) UsePasswordReset(tokenHash string) (int64, error) {
+	var userId int64 = 0
+	err := runInTransaction(func(tx *sql.Tx) error {
+		now := time.Now().Unix()
+		query := fmt.Sprintf("select %s from %s where %s = ? and %s = 0 and %s > ? for update",
+			kPasswordResetUserId, kPasswordResetTableName, kPasswordResetToken, kPasswordResetUsedAt,
+			kPasswordResetExpireAt)
+		err := tx.QueryRow(query, tokenHash, now).Scan(&userId)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		update := fmt.Sprintf("update %s set %s = ? where %s = ? and %s = 0", kPasswordResetTableName,
+			kPasswordResetUsedAt, kPasswordResetUserId, kPasswordResetUsedAt)
+		_, err = tx.Exec(update, now, userId)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userId, nil
+}
@@ -23,6 +23,7 @@ const (
 	kPluginVisitCount   = "visit"
 	kPluginPraiseCount  = "praise"
 	kPluginDissentCount = "dissent"
+	kPluginDeletedAt    = "deleted_at"
 )
 
 var pluginModelInstance *pluginModel = nil
@@ -36,9 +37,55 @@ func SharePluginModel() *pluginModel {
 	return pluginModelInstance
 }
 
+func pluginSelectColumns() string {
+	return fmt.Sprintf("%s, %s, %s, %s, %s, %s, %s, %s, %s, %s",
+		kPluginId, kPluginUUID, kPluginName, kPluginType, kPluginVersion, kPluginTime,
+		kPluginVisitCount, kPluginPraiseCount, kPluginDissentCount, kPluginDeletedAt)
+}
+
+func scanPluginInfo(rows rowScanner) (*info.PluginInfo, error) {
+	var plugin info.PluginInfo
+	err := rows.Scan(&plugin.PluginID, &plugin.PluginUUID, &plugin.PluginName,
+		&plugin.PluginType, &plugin.PluginVersion, &plugin.PluginTime, &plugin.PluginVisitCount,
+		&plugin.PluginPraiseCount, &plugin.PluginDissentCount, &plugin.PluginDeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin, nil
+}
+
+func (b *pluginModel) queryPluginList(sql string, args ...interface{}) (*list.List, error) {
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pluginList *list.List = list.New()
+	for rows.Next() {
+		plugin, err := scanPluginInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		pluginList.PushBack(*plugin)
+	}
+	return pluginList, rows.Err()
+}
+
+func (b *pluginModel) queryPlugin(sql string, args ...interface{}) (*info.PluginInfo, error) {
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return scanPluginInfo(rows)
+	}
+	return nil, rows.Err()
+}
+
 func (c *pluginModel) CreateTable() error {
 	if database.DatabaseInstance().DoesTableExist(kPluginTableName) {
-		return nil
+		return c.upgradeTable()
 	}
 	fmt.Println("Hello World")
 	sql := fmt.Sprintf(`
@@ -52,14 +99,21 @@ func (c *pluginModel) CreateTable() error {
 		%s int(32) DEFAULT '0',
 		%s int(32) DEFAULT '0',
 		%s int(32) DEFAULT '0',
+		%s int(64) NOT NULL DEFAULT '0',
 		PRIMARY KEY (%s)
 	) CHARSET=utf8;`, kPluginTableName, kPluginId,
 		kPluginUUID, kPluginName, kPluginType, kPluginVersion, kPluginTime, kPluginVisitCount,
-		kPluginPraiseCount, kPluginDissentCount, kPluginId)
+		kPluginPraiseCount, kPluginDissentCount, kPluginDeletedAt, kPluginId)
 	_, err := database.DatabaseInstance().DB.Exec(sql)
 	return err
 }
 
+// 给老版本的plugin表补上新增的列
+func (c *pluginModel) upgradeTable() error {
+	return database.DatabaseInstance().AddColumnIfNotExist(kPluginTableName, kPluginDeletedAt,
+		"int(64) NOT NULL DEFAULT '0'")
+}
+
 func (b *pluginModel) InsertPlugin(uuid string, title string, pluginType int,
 	pluginVersion string) (int, error) {
 	currentTime := time.Now().Unix()
@@ -79,8 +133,9 @@ func (b *pluginModel) InsertPlugin(uuid string, title string, pluginType int,
 func (b *pluginModel) UpdatePlugin(uuid string, title string, pluginType int,
 	pluginVersion string) (int, error) {
 	currentTime := time.Now().Unix()
-	sql := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ?, %s = ? where %s = ?",
-		kPluginTableName, kPluginName, kPluginType, kPluginVersion, kPluginTime, kPluginUUID)
+	// 回收站里的插件重新上传时顺便恢复
+	sql := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ?, %s = ?, %s = 0 where %s = ?",
+		kPluginTableName, kPluginName, kPluginType, kPluginVersion, kPluginTime, kPluginDeletedAt, kPluginUUID)
 	result, err := database.DatabaseInstance().DB.Exec(sql, title, pluginType, pluginVersion, currentTime, uuid)
 	updateId, _ := result.RowsAffected()
 	fmt.Println("updateId: ", updateId)
@@ -113,47 +168,55 @@ func (b *pluginModel) PluginIsExistByPluginID(pluginId int) (bool, error) {
 }
 
 func (b *pluginModel) FetchAllPlugin() (*list.List, error) {
-	sql := fmt.Sprintf("select * from %s order by %s desc", kPluginTableName, kPluginId)
-	rows, err := database.DatabaseInstance().DB.Query(sql)
-	if err == nil {
-		defer rows.Close()
-		var pluginList *list.List = list.New()
-		for rows.Next() {
-			var plugin info.PluginInfo
-			err = rows.Scan(&plugin.PluginID, &plugin.PluginUUID, &plugin.PluginName,
-				&plugin.PluginType, &plugin.PluginVersion, &plugin.PluginTime, &plugin.PluginVisitCount,
-				&plugin.PluginPraiseCount, &plugin.PluginDissentCount)
-			if err == nil {
-				pluginList.PushBack(plugin)
-			}
-		}
-		return pluginList, err
+	sql := fmt.Sprintf("select %s from %s where %s = 0 order by %s desc",
+		pluginSelectColumns(), kPluginTableName, kPluginDeletedAt, kPluginId)
+	pluginList, err := b.queryPluginList(sql)
+	if err != nil {
+		fmt.Println(err)
 	}
-	fmt.Println(err)
-	return nil, err
+	return pluginList, err
 }
 
-func (b *pluginModel) FetchPluginByPluginID(pluginID int) (*info.PluginInfo, error) {
-	sql := fmt.Sprintf("select * from %s where %s = ?", kPluginTableName, kPluginId)
-	rows, err := database.DatabaseInstance().DB.Query(sql, pluginID)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var plugin info.PluginInfo
-			err = rows.Scan(&plugin.PluginID, &plugin.PluginUUID, &plugin.PluginName,
-				&plugin.PluginType, &plugin.PluginVersion, &plugin.PluginTime, &plugin.PluginVisitCount,
-				&plugin.PluginPraiseCount, &plugin.PluginDissentCount)
-			if err == nil {
-				return &plugin, nil
-			}
-			break
-		}
+// 按页查询，offset/limit由调用方根据页码计算
+func (b *pluginModel) FetchPluginList(offset int, limit int) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = 0 order by %s desc limit ?, ?",
+		pluginSelectColumns(), kPluginTableName, kPluginDeletedAt, kPluginId)
+	return b.queryPluginList(sql, offset, limit)
+}
+
+// 游标分页，返回id小于cursor的limit个插件，cursor<=0表示从最新的开始
+func (b *pluginModel) FetchPluginListBefore(cursor int, limit int) (*list.List, error) {
+	if cursor <= 0 {
+		return b.FetchPluginList(0, limit)
 	}
-	return nil, err
+	sql := fmt.Sprintf("select %s from %s where %s < ? and %s = 0 order by %s desc limit ?",
+		pluginSelectColumns(), kPluginTableName, kPluginId, kPluginDeletedAt, kPluginId)
+	return b.queryPluginList(sql, cursor, limit)
+}
+
+func (b *pluginModel) FetchPluginCount() (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = 0", kPluginTableName, kPluginDeletedAt)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql).Scan(&count)
+	return count, err
+}
+
+func (b *pluginModel) FetchPluginByPluginID(pluginID int) (*info.PluginInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = 0",
+		pluginSelectColumns(), kPluginTableName, kPluginId, kPluginDeletedAt)
+	return b.queryPlugin(sql, pluginID)
+}
+
+// 回收站里的插件，恢复和彻底删除时使用
+func (b *pluginModel) FetchTrashPluginByPluginID(pluginID int) (*info.PluginInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s > 0",
+		pluginSelectColumns(), kPluginTableName, kPluginId, kPluginDeletedAt)
+	return b.queryPlugin(sql, pluginID)
 }
 
 func (b *pluginModel) GetPluginUUIDByPluginID(pluginID int) (string, error) {
-	sql := fmt.Sprintf("select %s from %s where %s = ?", kPluginUUID, kPluginTableName, kPluginId)
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = 0",
+		kPluginUUID, kPluginTableName, kPluginId, kPluginDeletedAt)
 	rows, err := database.DatabaseInstance().DB.Query(sql, pluginID)
 	if err == nil {
 		defer rows.Close()
@@ -169,23 +232,10 @@ func (b *pluginModel) GetPluginUUIDByPluginID(pluginID int) (string, error) {
 	return "", err
 }
 
+// 上传插件时使用，包括回收站里的插件
 func (b *pluginModel) FetchPluginByUUID(uuid string) (*info.PluginInfo, error) {
-	sql := fmt.Sprintf("select* from %s where %s = ?", kPluginTableName, kPluginUUID)
-	rows, err := database.DatabaseInstance().DB.Query(sql, uuid)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var plugin info.PluginInfo
-			err = rows.Scan(&plugin.PluginID, &plugin.PluginUUID, &plugin.PluginName,
-				&plugin.PluginType, &plugin.PluginVersion, &plugin.PluginTime, &plugin.PluginVisitCount,
-				&plugin.PluginPraiseCount, &plugin.PluginDissentCount)
-			if err == nil {
-				return &plugin, nil
-			}
-			break
-		}
-	}
-	return nil, err
+	sql := fmt.Sprintf("select %s from %s where %s = ?", pluginSelectColumns(), kPluginTableName, kPluginUUID)
+	return b.queryPlugin(sql, uuid)
 }
 
 func (b *pluginModel) FetchAllType() ([]int, error) {
@@ -207,52 +257,45 @@ func (b *pluginModel) FetchAllType() ([]int, error) {
 }
 
 func (b *pluginModel) FetchAllPluginBySortType(pluginType int) (*list.List, error) {
-	sql := fmt.Sprintf("select * from %s where %s = ? order by %s desc",
-		kPluginTableName, kPluginType, kPluginId)
-	rows, err := database.DatabaseInstance().DB.Query(sql, pluginType)
-	if err == nil {
-		defer rows.Close()
-		var pluginList *list.List = list.New()
-		for rows.Next() {
-			var plugin info.PluginInfo
-			err = rows.Scan(&plugin.PluginID, &plugin.PluginUUID, &plugin.PluginName,
-				&plugin.PluginType, &plugin.PluginVersion, &plugin.PluginTime, &plugin.PluginVisitCount,
-				&plugin.PluginPraiseCount, &plugin.PluginDissentCount)
-			if err == nil {
-				pluginList.PushBack(plugin)
-			}
-		}
-		return pluginList, err
-	}
-	return nil, err
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = 0 order by %s desc",
+		pluginSelectColumns(), kPluginTableName, kPluginType, kPluginDeletedAt, kPluginId)
+	return b.queryPluginList(sql, pluginType)
 }
 
 func (b *pluginModel) FetchAllPluginByTime(beginTime int64, endTime int64) (*list.List, error) {
-	sql := fmt.Sprintf("select * from %s where %s >= ? and %s <= ? order by %s desc", kPluginTableName, kPluginTime, kPluginTime, kPluginId)
-	rows, err := database.DatabaseInstance().DB.Query(sql, beginTime, endTime)
-	if err == nil {
-		defer rows.Close()
-		var pluginList *list.List = list.New()
-		for rows.Next() {
-			var plugin info.PluginInfo
-			err = rows.Scan(&plugin.PluginID, &plugin.PluginUUID, &plugin.PluginName,
-				&plugin.PluginType, &plugin.PluginVersion, &plugin.PluginTime, &plugin.PluginVisitCount,
-				&plugin.PluginPraiseCount, &plugin.PluginDissentCount)
-			if err == nil {
-				pluginList.PushBack(plugin)
-			}
-		}
-		return pluginList, err
-	}
-	return nil, err
+	sql := fmt.Sprintf("select %s from %s where %s >= ? and %s <= ? and %s = 0 order by %s desc",
+		pluginSelectColumns(), kPluginTableName, kPluginTime, kPluginTime, kPluginDeletedAt, kPluginId)
+	return b.queryPluginList(sql, beginTime, endTime)
+}
+
+// 放入回收站，只是标记删除时间
+func (b *pluginModel) TrashPlugin(pluginId int) error {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ? and %s = 0",
+		kPluginTableName, kPluginDeletedAt, kPluginId, kPluginDeletedAt)
+	_, err := database.DatabaseInstance().DB.Exec(sql, time.Now().Unix(), pluginId)
+	return err
 }
 
-func (b *pluginModel) AddVisitCount(pluginId int) error {
-	sql := fmt.Sprintf("update %s set visit = visit + 1 where %s = ?", kPluginTableName, kPluginId)
+func (b *pluginModel) RestorePlugin(pluginId int) error {
+	sql := fmt.Sprintf("update %s set %s = 0 where %s = ?", kPluginTableName, kPluginDeletedAt, kPluginId)
 	_, err := database.DatabaseInstance().DB.Exec(sql, pluginId)
 	return err
 }
 
+func (b *pluginModel) FetchTrashPluginList() (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s > 0 order by %s desc",
+		pluginSelectColumns(), kPluginTableName, kPluginDeletedAt, kPluginDeletedAt)
+	return b.queryPluginList(sql)
+}
+
+// 回收站里放入时间早于beforeTime的插件，用于定时清理
+func (b *pluginModel) FetchExpiredTrashPluginList(beforeTime int64) (*list.List, error) {
+	sql := fmt.Sprintf("select %s from %s where %s > 0 and %s < ?",
+		pluginSelectColumns(), kPluginTableName, kPluginDeletedAt, kPluginDeletedAt)
+	return b.queryPluginList(sql, beforeTime)
+}
+
+// 彻底删除
 func (b *pluginModel) DeletePlugin(pluginId int) error {
 	sql := fmt.Sprintf("delete from %s where %s = ?", kPluginTableName, kPluginId)
 	_, err := database.DatabaseInstance().DB.Exec(sql, pluginId)
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"fmt"
+	"framework/database"
+	"info"
+	"sync"
+	"time"
+)
+
+type ratingModel struct {
+}
+
+const (
+	kRatingTableName = "plugin_rating"
+	kRatingId        = "id"
+	kRatingPluginId  = "plugin_id"
+	kRatingVoter     = "voter"
+	kRatingUserId    = "user_id"
+	kRatingStars     = "stars"
+	kRatingReview    = "review"
+	kRatingTime      = "time"
+)
+
+var ratingModelInstance *ratingModel = nil
+
+var ratingOnce sync.Once
+
+func ShareRatingModel() *ratingModel {
+	ratingOnce.Do(func() {
+		ratingModelInstance = &ratingModel{}
+	})
+	return ratingModelInstance
+}
+
+// 插件评分，1到5星，每个人对同一个插件只保留最后一次评分和短评
+func (r *ratingModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kRatingTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+		%s int(32) unsigned NOT NULL,
+		%s varchar(80) NOT NULL,
+		%s bigint(64) NOT NULL DEFAULT '0',
+		%s tinyint(4) NOT NULL,
+		%s varchar(512) DEFAULT '',
+		%s int(64) NOT NULL,
+		PRIMARY KEY (%s),
+		UNIQUE KEY (%s, %s)
+	) CHARSET=utf8;`, kRatingTableName, kRatingId,
+		kRatingPluginId, kRatingVoter, kRatingUserId, kRatingStars, kRatingReview, kRatingTime,
+		kRatingId, kRatingPluginId, kRatingVoter)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func ratingSelectColumns() string {
+	return fmt.Sprintf("%s, %s, %s, %s, %s, %s, %s",
+		kRatingId, kRatingPluginId, kRatingVoter, kRatingUserId, kRatingStars, kRatingReview, kRatingTime)
+}
+
+func (r *ratingModel) queryRatingList(sql string, args ...interface{}) ([]*info.RatingInfo, error) {
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ratingList []*info.RatingInfo = nil
+	for rows.Next() {
+		var rating info.RatingInfo
+		err = rows.Scan(&rating.RatingID, &rating.PluginID, &rating.Voter, &rating.UserID,
+			&rating.Stars, &rating.Review, &rating.Time)
+		if err != nil {
+			return nil, err
+		}
+		ratingList = append(ratingList, &rating)
+	}
+	return ratingList, rows.Err()
+}
+
+// 新增或者覆盖之前的评分
+func (r *ratingModel) SetRating(pluginId int, voter string, userId int64, stars int, review string) error {
+	sql := fmt.Sprintf(`insert into %s(%s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?)
+		on duplicate key update %s = values(%s), %s = values(%s), %s = values(%s), %s = values(%s)`,
+		kRatingTableName, kRatingPluginId, kRatingVoter, kRatingUserId, kRatingStars, kRatingReview, kRatingTime,
+		kRatingUserId, kRatingUserId, kRatingStars, kRatingStars, kRatingReview, kRatingReview,
+		kRatingTime, kRatingTime)
+	_, err := database.DatabaseInstance().DB.Exec(sql, pluginId, voter, userId, stars, review, time.Now().Unix())
+	return err
+}
+
+func (r *ratingModel) DeleteRating(pluginId int, voter string) error {
+	sql := fmt.Sprintf("delete from %s where %s = ? and %s = ?", kRatingTableName, kRatingPluginId, kRatingVoter)
+	_, err := database.DatabaseInstance().DB.Exec(sql, pluginId, voter)
+	return err
+}
+
+func (r *ratingModel) FetchRating(pluginId int, voter string) (*info.RatingInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = ?",
+		ratingSelectColumns(), kRatingTableName, kRatingPluginId, kRatingVoter)
+	ratingList, err := r.queryRatingList(sql, pluginId, voter)
+	if err != nil || len(ratingList) == 0 {
+		return nil, err
+	}
+	return ratingList[0], nil
+}
+
+// 按时间倒序，用于展示短评
+func (r *ratingModel) FetchRatingList(pluginId int, offset int, limit int) ([]*info.RatingInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? order by %s desc limit ?, ?",
+		ratingSelectColumns(), kRatingTableName, kRatingPluginId, kRatingTime)
+	return r.queryRatingList(sql, pluginId, offset, limit)
+}
+
+func (r *ratingModel) FetchRatingSummary(pluginId int) (*info.RatingSummaryInfo, error) {
+	sql := fmt.Sprintf("select count(*), ifnull(avg(%s), 0) from %s where %s = ?",
+		kRatingStars, kRatingTableName, kRatingPluginId)
+	var summary info.RatingSummaryInfo
+	err := database.DatabaseInstance().DB.QueryRow(sql, pluginId).Scan(&summary.Count, &summary.Average)
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func (r *ratingModel) DeletePluginRatings(pluginId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ?", kRatingTableName, kRatingPluginId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, pluginId)
+	return err
+}
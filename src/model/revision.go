@@ -0,0 +1,140 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"framework/database"
+	"info"
+	"strings"
+	"sync"
+	"time"
+)
+
+type revisionModel struct {
+}
+
+const (
+	kRevisionTableName = "blog_revision"
+	kRevisionId        = "id"
+	kRevisionBlogId    = "blog_id"
+	kRevisionNumber    = "revision"
+	kRevisionTitle     = "title"
+	kRevisionSortType  = "sort"
+	kRevisionCategory  = "category_id"
+	kRevisionTag       = "tag"
+	kRevisionTime      = "time"
+	kRevisionNote      = "note"
+)
+
+var revisionModelInstance *revisionModel = nil
+
+var revisionOnce sync.Once
+
+func ShareRevisionModel() *revisionModel {
+	revisionOnce.Do(func() {
+		revisionModelInstance = &revisionModel{}
+	})
+	return revisionModelInstance
+}
+
+func (r *revisionModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kRevisionTableName) {
+		return database.DatabaseInstance().AddColumnIfNotExist(kRevisionTableName, kRevisionCategory,
+			"int(32) NOT NULL DEFAULT '0'")
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+		%s int(32) unsigned NOT NULL,
+		%s int(32) NOT NULL,
+		%s varchar(256) NOT NULL,
+		%s varchar(256) NOT NULL,
+		%s int(32) NOT NULL DEFAULT '0',
+		%s varchar(256) NOT NULL,
+		%s int(64) NOT NULL,
+		%s varchar(256) DEFAULT '',
+		PRIMARY KEY (%s),
+		UNIQUE KEY (%s, %s)
+	) CHARSET=utf8;`, kRevisionTableName, kRevisionId,
+		kRevisionBlogId, kRevisionNumber, kRevisionTitle, kRevisionSortType, kRevisionCategory, kRevisionTag,
+		kRevisionTime, kRevisionNote, kRevisionId, kRevisionBlogId, kRevisionNumber)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func revisionSelectColumns() string {
+	return fmt.Sprintf("%s, %s, %s, %s, %s, %s, %s, %s, %s",
+		kRevisionId, kRevisionBlogId, kRevisionNumber, kRevisionTitle, kRevisionSortType,
+		kRevisionCategory, kRevisionTag, kRevisionTime, kRevisionNote)
+}
+
+func (r *revisionModel) queryRevisionList(sql string, args ...interface{}) ([]*info.RevisionInfo, error) {
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisionList []*info.RevisionInfo = nil
+	for rows.Next() {
+		var revision info.RevisionInfo
+		var tag string
+		err = rows.Scan(&revision.RevisionID, &revision.BlogID, &revision.Revision, &revision.Title,
+			&revision.SortType, &revision.CategoryID, &tag, &revision.Time, &revision.Note)
+		if err != nil {
+			return nil, err
+		}
+		revision.TagList = splitBlogTag(tag)
+		revisionList = append(revisionList, &revision)
+	}
+	return revisionList, rows.Err()
+}
+
+// 新增一个版本，版本号在同一篇博客内从1开始递增，返回新的版本号
+func (r *revisionModel) InsertRevision(blogId int, title string, sortType string, categoryId int,
+	tagList []string, note string) (int, error) {
+	var revision int
+	err := runInTransaction(func(tx *sql.Tx) error {
+		query := fmt.Sprintf("select ifnull(max(%s), 0) + 1 from %s where %s = ? for update",
+			kRevisionNumber, kRevisionTableName, kRevisionBlogId)
+		if err := tx.QueryRow(query, blogId).Scan(&revision); err != nil {
+			return err
+		}
+		insert := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?, ?, ?)",
+			kRevisionTableName, kRevisionBlogId, kRevisionNumber, kRevisionTitle, kRevisionSortType,
+			kRevisionCategory, kRevisionTag, kRevisionTime, kRevisionNote)
+		_, err := tx.Exec(insert, blogId, revision, title, sortType, categoryId, strings.Join(tagList, "||"),
+			time.Now().Unix(), note)
+		return err
+	})
+	return revision, err
+}
+
+// 某篇博客的所有版本，新版本在前
+func (r *revisionModel) FetchRevisionList(blogId int) ([]*info.RevisionInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? order by %s desc",
+		revisionSelectColumns(), kRevisionTableName, kRevisionBlogId, kRevisionNumber)
+	return r.queryRevisionList(sql, blogId)
+}
+
+func (r *revisionModel) FetchRevision(blogId int, revision int) (*info.RevisionInfo, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ? and %s = ?",
+		revisionSelectColumns(), kRevisionTableName, kRevisionBlogId, kRevisionNumber)
+	revisionList, err := r.queryRevisionList(sql, blogId, revision)
+	if err != nil || len(revisionList) == 0 {
+		return nil, err
+	}
+	return revisionList[0], nil
+}
+
+func (r *revisionModel) FetchRevisionCount(blogId int) (int, error) {
+	sql := fmt.Sprintf("select count(*) from %s where %s = ?", kRevisionTableName, kRevisionBlogId)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, blogId).Scan(&count)
+	return count, err
+}
+
+func (r *revisionModel) DeleteBlogRevisions(blogId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ?", kRevisionTableName, kRevisionBlogId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, blogId)
+	return err
+}
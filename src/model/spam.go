@@ -0,0 +1,210 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"framework/database"
+	"info"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kSpamTokenTableName = "spam_token"
+	kSpamTokenToken     = "token"
+	kSpamTokenSpam      = "spam"
+	kSpamTokenHam       = "ham"
+
+	kSpamTrainedTableName = "spam_trained"
+	kSpamTrainedCommentId = "comment_id"
+	kSpamTrainedLabel     = "label"
+	kSpamTrainedTokens    = "tokens"
+	kSpamTrainedTime      = "time"
+)
+
+type spamModel struct {
+}
+
+var spamModelInstance *spamModel = nil
+
+var spamOnce sync.Once
+
+func ShareSpamModel() *spamModel {
+	spamOnce.Do(func() {
+		spamModelInstance = &spamModel{}
+	})
+	return spamModelInstance
+}
+
+/* 垃圾评论分类器的数据：
+** spam_token记录每个特征在垃圾评论和正常评论里出现的次数；
+** spam_trained记录每条评论按什么标签训练过以及当时的特征，主人改判时用来撤销之前的训练。
+ */
+func (s *spamModel) CreateTable() error {
+	if !database.DatabaseInstance().DoesTableExist(kSpamTokenTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s varchar(64) NOT NULL,
+			%s int(32) NOT NULL DEFAULT '0',
+			%s int(32) NOT NULL DEFAULT '0',
+			PRIMARY KEY (%s)
+		) CHARSET=utf8;`, kSpamTokenTableName, kSpamTokenToken, kSpamTokenSpam, kSpamTokenHam,
+			kSpamTokenToken)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	if database.DatabaseInstance().DoesTableExist(kSpamTrainedTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL,
+		%s varchar(8) NOT NULL,
+		%s text NOT NULL,
+		%s int(64) NOT NULL,
+		PRIMARY KEY (%s)
+	) CHARSET=utf8;`, kSpamTrainedTableName, kSpamTrainedCommentId, kSpamTrainedLabel, kSpamTrainedTokens,
+		kSpamTrainedTime, kSpamTrainedCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+func spamLabelColumn(label string) (string, error) {
+	switch label {
+	case info.SpamLabel_Spam:
+		return kSpamTokenSpam, nil
+	case info.SpamLabel_Ham:
+		return kSpamTokenHam, nil
+	}
+	return "", fmt.Errorf("unsupport spam label: %s", label)
+}
+
+// 没有出现过的特征不会出现在返回的map里
+func (s *spamModel) FetchSpamTokenMap(tokenList []string) (map[string]*info.SpamTokenInfo, error) {
+	var tokenMap map[string]*info.SpamTokenInfo = make(map[string]*info.SpamTokenInfo)
+	if len(tokenList) == 0 {
+		return tokenMap, nil
+	}
+	var placeholderList []string = nil
+	var args []interface{} = nil
+	for _, token := range tokenList {
+		placeholderList = append(placeholderList, "?")
+		args = append(args, token)
+	}
+	sql := fmt.Sprintf("select %s, %s, %s from %s where %s in (%s)",
+		kSpamTokenToken, kSpamTokenSpam, kSpamTokenHam, kSpamTokenTableName, kSpamTokenToken,
+		strings.Join(placeholderList, ", "))
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var token info.SpamTokenInfo
+		if err = rows.Scan(&token.Token, &token.Spam, &token.Ham); err != nil {
+			return nil, err
+		}
+		tokenMap[token.Token] = &token
+	}
+	return tokenMap, rows.Err()
+}
+
+// 评论之前按什么标签训练过，没有训练过时返回空字符串
+func (s *spamModel) FetchTrainedLabel(commentId int) (string, error) {
+	sql := fmt.Sprintf("select %s from %s where %s = ?",
+		kSpamTrainedLabel, kSpamTrainedTableName, kSpamTrainedCommentId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, commentId)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var label string
+	if rows.Next() {
+		err = rows.Scan(&label)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	return label, err
+}
+
+func addSpamTokens(tx *sql.Tx, tokenList []string, column string, delta int) error {
+	sql := fmt.Sprintf(`insert into %s(%s, %s) values(?, ?)
+		on duplicate key update %s = greatest(%s + ?, 0)`,
+		kSpamTokenTableName, kSpamTokenToken, column, column, column)
+	stmt, err := tx.Prepare(sql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	initValue := delta
+	if initValue < 0 {
+		initValue = 0
+	}
+	for _, token := range tokenList {
+		// 新插入的行用initValue，已有的行加上delta
+		if _, err = stmt.Exec(token, initValue, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* 用一条评论训练分类器，tokenList是评论的全部特征。
+** 评论之前按另一个标签训练过时先撤销之前的训练，按同一个标签训练过时什么都不做。
+ */
+func (s *spamModel) TrainComment(commentId int, tokenList []string, label string) error {
+	column, err := spamLabelColumn(label)
+	if err != nil {
+		return err
+	}
+	return runInTransaction(func(tx *sql.Tx) error {
+		query := fmt.Sprintf("select %s, %s from %s where %s = ? for update",
+			kSpamTrainedLabel, kSpamTrainedTokens, kSpamTrainedTableName, kSpamTrainedCommentId)
+		var oldLabel, oldTokens string
+		err := tx.QueryRow(query, commentId).Scan(&oldLabel, &oldTokens)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if oldLabel == label {
+			return nil
+		}
+		if oldLabel != "" {
+			oldColumn, err := spamLabelColumn(oldLabel)
+			if err != nil {
+				return err
+			}
+			if err = addSpamTokens(tx, strings.Fields(oldTokens), oldColumn, -1); err != nil {
+				return err
+			}
+		}
+		if err = addSpamTokens(tx, tokenList, column, 1); err != nil {
+			return err
+		}
+		save := fmt.Sprintf(`insert into %s(%s, %s, %s, %s) values(?, ?, ?, ?)
+			on duplicate key update %s = values(%s), %s = values(%s), %s = values(%s)`,
+			kSpamTrainedTableName, kSpamTrainedCommentId, kSpamTrainedLabel, kSpamTrainedTokens, kSpamTrainedTime,
+			kSpamTrainedLabel, kSpamTrainedLabel, kSpamTrainedTokens, kSpamTrainedTokens,
+			kSpamTrainedTime, kSpamTrainedTime)
+		_, err = tx.Exec(save, commentId, label, strings.Join(tokenList, " "), time.Now().Unix())
+		return err
+	})
+}
+
+// 评论被彻底删除时只删训练记录，已经学到的特征保留
+func (s *spamModel) DeleteTrainedComment(commentId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ?", kSpamTrainedTableName, kSpamTrainedCommentId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentId)
+	return err
+}
+
+func (s *spamModel) DeleteTrainedCommentsByTypeId(commentType int, typeId int) error {
+	sql := fmt.Sprintf(`delete t from %s t inner join %s c on c.%s = t.%s
+		where c.%s = ? and c.%s = ?`,
+		kSpamTrainedTableName, kCommentTableName, kCommentId, kSpamTrainedCommentId,
+		kCommentType, kCommentTypeId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, commentType, typeId)
+	return err
+}
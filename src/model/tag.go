@@ -0,0 +1,409 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"framework/database"
+	"info"
+	"strings"
+	"sync"
+	"time"
+)
+
+type tagModel struct {
+}
+
+const (
+	kTagTableName   = "tag"
+	kTagId          = "id"
+	kTagName        = "name"
+	kTagDescription = "description"
+	kTagTime        = "time"
+
+	kBlogTagTableName = "blog_tag"
+	kBlogTagBlogId    = "blog_id"
+	kBlogTagTagId     = "tag_id"
+)
+
+var tagModelInstance *tagModel = nil
+
+var tagOnce sync.Once
+
+func ShareTagModel() *tagModel {
+	tagOnce.Do(func() {
+		tagModelInstance = &tagModel{}
+	})
+	return tagModelInstance
+}
+
+func (t *tagModel) CreateTable() error {
+	if !database.DatabaseInstance().DoesTableExist(kTagTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+			%s varchar(128) NOT NULL,
+			%s varchar(1024) DEFAULT '',
+			%s int(64) NOT NULL,
+			PRIMARY KEY (%s),
+			UNIQUE KEY (%s)
+		) CHARSET=utf8;`, kTagTableName, kTagId,
+			kTagName, kTagDescription, kTagTime, kTagId, kTagName)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	if !database.DatabaseInstance().DoesTableExist(kBlogTagTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s int(32) unsigned NOT NULL,
+			%s int(32) unsigned NOT NULL,
+			PRIMARY KEY (%s, %s),
+			KEY (%s)
+		) CHARSET=utf8;`, kBlogTagTableName, kBlogTagBlogId, kBlogTagTagId,
+			kBlogTagBlogId, kBlogTagTagId, kBlogTagTagId)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return t.upgradeTable()
+}
+
+// 建表之后迁移中途失败的话，下次启动时表已经存在，所以按迁移记录决定要不要再迁移
+func (t *tagModel) upgradeTable() error {
+	return runMigrationOnce("blog_tag_from_blog_column", t.migrateFromBlogColumn)
+}
+
+// 老版本的标签以"||"拼接存放在blog.tag中，迁移到关联表，重复执行结果一样
+func (t *tagModel) migrateFromBlogColumn() error {
+	sql := fmt.Sprintf("select %s, %s from %s", kBlogId, kBlogTag, kBlogTableName)
+	rows, err := database.DatabaseInstance().DB.Query(sql)
+	if err != nil {
+		return err
+	}
+	var blogTagMap map[int][]string = make(map[int][]string)
+	for rows.Next() {
+		var blogId int
+		var tag string
+		if err = rows.Scan(&blogId, &tag); err != nil {
+			rows.Close()
+			return err
+		}
+		blogTagMap[blogId] = splitBlogTag(tag)
+	}
+	rows.Close()
+	for blogId, tagList := range blogTagMap {
+		if err = t.SetBlogTags(blogId, tagList); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizeTagList(tagList []string) []string {
+	var ret []string = nil
+	var tagSet map[string]bool = make(map[string]bool)
+	for _, tag := range tagList {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tagSet[tag] {
+			continue
+		}
+		tagSet[tag] = true
+		ret = append(ret, tag)
+	}
+	return ret
+}
+
+func (t *tagModel) fetchOrCreateTagId(tx *sql.Tx, tagName string) (int, error) {
+	query := fmt.Sprintf("select %s from %s where %s = ?", kTagId, kTagTableName, kTagName)
+	var tagId int
+	err := tx.QueryRow(query, tagName).Scan(&tagId)
+	if err == nil {
+		return tagId, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	insert := fmt.Sprintf("insert into %s(%s, %s) values(?, ?)", kTagTableName, kTagName, kTagTime)
+	result, err := tx.Exec(insert, tagName, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	insertId, err := result.LastInsertId()
+	return int(insertId), err
+}
+
+// blog.tag列作为冗余字段保留，给桌面客户端和老接口使用，每次改动关联表后重新生成
+func (t *tagModel) syncBlogTagColumn(tx *sql.Tx, blogId int) error {
+	query := fmt.Sprintf(`select t.%s from %s t inner join %s bt on bt.%s = t.%s
+		where bt.%s = ? order by t.%s`, kTagName, kTagTableName, kBlogTagTableName,
+		kBlogTagTagId, kTagId, kBlogTagBlogId, kTagId)
+	rows, err := tx.Query(query, blogId)
+	if err != nil {
+		return err
+	}
+	var tagList []string = nil
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tagList = append(tagList, name)
+	}
+	rows.Close()
+	update := fmt.Sprintf("update %s set %s = ? where %s = ?", kBlogTableName, kBlogTag, kBlogId)
+	_, err = tx.Exec(update, strings.Join(tagList, "||"), blogId)
+	return err
+}
+
+func (t *tagModel) fetchBlogIdsByTagId(tx *sql.Tx, tagId int) ([]int, error) {
+	query := fmt.Sprintf("select %s from %s where %s = ?", kBlogTagBlogId, kBlogTagTableName, kBlogTagTagId)
+	rows, err := tx.Query(query, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blogIdList []int = nil
+	for rows.Next() {
+		var blogId int
+		if err = rows.Scan(&blogId); err != nil {
+			return nil, err
+		}
+		blogIdList = append(blogIdList, blogId)
+	}
+	return blogIdList, nil
+}
+
+func (t *tagModel) fetchTagIdByName(tx *sql.Tx, tagName string) (int, error) {
+	query := fmt.Sprintf("select %s from %s where %s = ?", kTagId, kTagTableName, kTagName)
+	var tagId int
+	err := tx.QueryRow(query, tagName).Scan(&tagId)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no such tag: %s", tagName)
+	}
+	return tagId, err
+}
+
+// 在一个事务里执行f，f返回错误时回滚
+func runInTransaction(f func(tx *sql.Tx) error) error {
+	tx, err := database.DatabaseInstance().DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err = f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// 重新设置某篇blog的全部标签
+func (t *tagModel) SetBlogTags(blogId int, tagList []string) error {
+	tagList = normalizeTagList(tagList)
+	return runInTransaction(func(tx *sql.Tx) error {
+		remove := fmt.Sprintf("delete from %s where %s = ?", kBlogTagTableName, kBlogTagBlogId)
+		if _, err := tx.Exec(remove, blogId); err != nil {
+			return err
+		}
+		insert := fmt.Sprintf("insert into %s(%s, %s) values(?, ?)",
+			kBlogTagTableName, kBlogTagBlogId, kBlogTagTagId)
+		for _, tagName := range tagList {
+			tagId, err := t.fetchOrCreateTagId(tx, tagName)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.Exec(insert, blogId, tagId); err != nil {
+				return err
+			}
+		}
+		return t.syncBlogTagColumn(tx, blogId)
+	})
+}
+
+func (t *tagModel) DeleteBlogTags(blogId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ?", kBlogTagTableName, kBlogTagBlogId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, blogId)
+	return err
+}
+
+// 所有标签以及每个标签下的文章数，按文章数倒序
+func (t *tagModel) FetchAllTag() ([]*info.TagInfo, error) {
+	sql := fmt.Sprintf(`select t.%s, t.%s, t.%s, t.%s, count(b.%s) as blog_count from %s t
+		left join %s bt on bt.%s = t.%s
+		left join %s b on b.%s = bt.%s and %s
+		group by t.%s order by blog_count desc, t.%s`,
+		kTagId, kTagName, kTagDescription, kTagTime, kBlogId, kTagTableName,
+		kBlogTagTableName, kBlogTagTagId, kTagId,
+		kBlogTableName, kBlogId, kBlogTagBlogId, blogVisibleCondition("b"),
+		kTagId, kTagId)
+	rows, err := database.DatabaseInstance().DB.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tagList []*info.TagInfo = nil
+	for rows.Next() {
+		var tag info.TagInfo
+		err = rows.Scan(&tag.TagID, &tag.TagName, &tag.TagDescription, &tag.TagTime, &tag.TagBlogCount)
+		if err != nil {
+			return nil, err
+		}
+		tagList = append(tagList, &tag)
+	}
+	return tagList, nil
+}
+
+func (t *tagModel) FetchTagByName(tagName string) (*info.TagInfo, error) {
+	sql := fmt.Sprintf(`select t.%s, t.%s, t.%s, t.%s, count(b.%s) from %s t
+		left join %s bt on bt.%s = t.%s
+		left join %s b on b.%s = bt.%s and %s
+		where t.%s = ? group by t.%s`,
+		kTagId, kTagName, kTagDescription, kTagTime, kBlogId, kTagTableName,
+		kBlogTagTableName, kBlogTagTagId, kTagId,
+		kBlogTableName, kBlogId, kBlogTagBlogId, blogVisibleCondition("b"),
+		kTagName, kTagId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, tagName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var tag info.TagInfo
+		err = rows.Scan(&tag.TagID, &tag.TagName, &tag.TagDescription, &tag.TagTime, &tag.TagBlogCount)
+		if err != nil {
+			return nil, err
+		}
+		return &tag, nil
+	}
+	return nil, nil
+}
+
+func (t *tagModel) UpdateTagDescription(tagName string, description string) error {
+	sql := fmt.Sprintf("update %s set %s = ? where %s = ?", kTagTableName, kTagDescription, kTagName)
+	result, err := database.DatabaseInstance().DB.Exec(sql, description, tagName)
+	if err != nil {
+		return err
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		if tag, err := t.FetchTagByName(tagName); err != nil || tag == nil {
+			return fmt.Errorf("no such tag: %s", tagName)
+		}
+	}
+	return nil
+}
+
+// 重命名标签，如果新名字已经存在，则合并到已有标签
+func (t *tagModel) RenameTag(oldName string, newName string) error {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return fmt.Errorf("tag name must not be empty")
+	}
+	if oldName == newName {
+		return nil
+	}
+	exist, err := t.FetchTagByName(newName)
+	if err != nil {
+		return err
+	}
+	if exist != nil {
+		return t.MergeTag([]string{oldName}, newName)
+	}
+	return runInTransaction(func(tx *sql.Tx) error {
+		tagId, err := t.fetchTagIdByName(tx, oldName)
+		if err != nil {
+			return err
+		}
+		update := fmt.Sprintf("update %s set %s = ? where %s = ?", kTagTableName, kTagName, kTagId)
+		if _, err = tx.Exec(update, newName, tagId); err != nil {
+			return err
+		}
+		blogIdList, err := t.fetchBlogIdsByTagId(tx, tagId)
+		if err != nil {
+			return err
+		}
+		for _, blogId := range blogIdList {
+			if err = t.syncBlogTagColumn(tx, blogId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 把fromNames中的标签全部合并到toName，原标签删除
+func (t *tagModel) MergeTag(fromNames []string, toName string) error {
+	toName = strings.TrimSpace(toName)
+	if toName == "" {
+		return fmt.Errorf("tag name must not be empty")
+	}
+	return runInTransaction(func(tx *sql.Tx) error {
+		toId, err := t.fetchOrCreateTagId(tx, toName)
+		if err != nil {
+			return err
+		}
+		var affectedBlogMap map[int]bool = make(map[int]bool)
+		copyRelation := fmt.Sprintf("insert ignore into %s(%s, %s) select %s, ? from %s where %s = ?",
+			kBlogTagTableName, kBlogTagBlogId, kBlogTagTagId, kBlogTagBlogId, kBlogTagTableName, kBlogTagTagId)
+		removeRelation := fmt.Sprintf("delete from %s where %s = ?", kBlogTagTableName, kBlogTagTagId)
+		removeTag := fmt.Sprintf("delete from %s where %s = ?", kTagTableName, kTagId)
+		for _, fromName := range fromNames {
+			if fromName == toName {
+				continue
+			}
+			fromId, err := t.fetchTagIdByName(tx, fromName)
+			if err != nil {
+				return err
+			}
+			blogIdList, err := t.fetchBlogIdsByTagId(tx, fromId)
+			if err != nil {
+				return err
+			}
+			for _, blogId := range blogIdList {
+				affectedBlogMap[blogId] = true
+			}
+			if _, err = tx.Exec(copyRelation, toId, fromId); err != nil {
+				return err
+			}
+			if _, err = tx.Exec(removeRelation, fromId); err != nil {
+				return err
+			}
+			if _, err = tx.Exec(removeTag, fromId); err != nil {
+				return err
+			}
+		}
+		for blogId := range affectedBlogMap {
+			if err = t.syncBlogTagColumn(tx, blogId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 删除标签，同时从所有文章上移除
+func (t *tagModel) DeleteTag(tagName string) error {
+	return runInTransaction(func(tx *sql.Tx) error {
+		tagId, err := t.fetchTagIdByName(tx, tagName)
+		if err != nil {
+			return err
+		}
+		blogIdList, err := t.fetchBlogIdsByTagId(tx, tagId)
+		if err != nil {
+			return err
+		}
+		removeRelation := fmt.Sprintf("delete from %s where %s = ?", kBlogTagTableName, kBlogTagTagId)
+		if _, err = tx.Exec(removeRelation, tagId); err != nil {
+			return err
+		}
+		removeTag := fmt.Sprintf("delete from %s where %s = ?", kTagTableName, kTagId)
+		if _, err = tx.Exec(removeTag, tagId); err != nil {
+			return err
+		}
+		for _, blogId := range blogIdList {
+			if err = t.syncBlogTagColumn(tx, blogId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
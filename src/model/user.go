@@ -1,9 +1,12 @@
 package model
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"framework/database"
 	"info"
+	"strings"
 	"sync"
 	"time"
 )
@@ -27,6 +30,23 @@ const (
 	kUserSmallPicutreURL = "small_pic"
 	kUserLastLoginTime   = "login_time"
 	kUserRegisterTime    = "reg_time"
+	kUserEmail           = "email"
+	kUserWebsite         = "website"
+	kUserRole            = "role"
+	kUserBannedUntil     = "banned_until"
+	kUserHideProfile     = "hide_profile"
+	kUserHideComments    = "hide_comments"
+	kUserPassword        = "password"
+	// 本站帐号的邮箱，其它帐号是NULL，用来给本站帐号的邮箱加唯一索引
+	kUserLocalEmail = "local_email"
+	// 唯一索引的名字
+	kUserAccountIndex    = "account"
+	kUserLocalEmailIndex = "local_email"
+)
+
+var (
+	ErrLocalNameExists  = errors.New("local username already exists")
+	ErrLocalEmailExists = errors.New("local email already exists")
 )
 
 type userModel struct {
@@ -45,7 +65,7 @@ func ShareUserModel() *userModel {
 
 func (u *userModel) CreateTable() error {
 	if database.DatabaseInstance().DoesTableExist(kUserTableName) {
-		return nil
+		return u.upgradeTable()
 	}
 	sql := fmt.Sprintf(`
 	CREATE TABLE %s (
@@ -58,14 +78,84 @@ func (u *userModel) CreateTable() error {
 		%s varchar(1024) NOT NULL,
 		%s int(64) NOT NULL,
 		%s int(64) NOT NULL,
-		PRIMARY KEY (%s)
+		%s varchar(256) NOT NULL DEFAULT '',
+		%s varchar(256) NOT NULL DEFAULT '',
+		%s varchar(16) NOT NULL DEFAULT '%s',
+		%s int(64) NOT NULL DEFAULT '0',
+		%s tinyint(1) NOT NULL DEFAULT '0',
+		%s tinyint(1) NOT NULL DEFAULT '0',
+		%s varchar(256) NOT NULL DEFAULT '',
+		%s varchar(255) DEFAULT NULL,
+		PRIMARY KEY (%s),
+		UNIQUE KEY %s (%s, %s),
+		UNIQUE KEY %s (%s),
+		KEY (%s)
 	) CHARSET=utf8;`, kUserTableName, kUserId, kUserOpenId,
 		kUserName, kUserSex, kUserType, kUserBigPicutreURL, kUserSmallPicutreURL,
-		kUserLastLoginTime, kUserRegisterTime, kUserId)
+		kUserLastLoginTime, kUserRegisterTime, kUserEmail, kUserWebsite, kUserRole, info.Role_Commenter,
+		kUserBannedUntil, kUserHideProfile, kUserHideComments, kUserPassword, kUserLocalEmail, kUserId,
+		kUserAccountIndex, kUserType, kUserOpenId, kUserLocalEmailIndex, kUserLocalEmail, kUserRole)
 	_, err := database.DatabaseInstance().DB.Exec(sql)
 	return err
 }
 
+// 给老版本的user表补上新增的列
+func (u *userModel) upgradeTable() error {
+	for _, column := range []string{kUserEmail, kUserWebsite} {
+		err := database.DatabaseInstance().AddColumnIfNotExist(kUserTableName, column, "varchar(256) NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+	}
+	err := database.DatabaseInstance().AddColumnIfNotExist(kUserTableName, kUserRole,
+		fmt.Sprintf("varchar(16) NOT NULL DEFAULT '%s'", info.Role_Commenter))
+	if err != nil {
+		return err
+	}
+	err = database.DatabaseInstance().AddColumnIfNotExist(kUserTableName, kUserBannedUntil,
+		"int(64) NOT NULL DEFAULT '0'")
+	if err != nil {
+		return err
+	}
+	for _, column := range []string{kUserHideProfile, kUserHideComments} {
+		err = database.DatabaseInstance().AddColumnIfNotExist(kUserTableName, column, "tinyint(1) NOT NULL DEFAULT '0'")
+		if err != nil {
+			return err
+		}
+	}
+	err = database.DatabaseInstance().AddColumnIfNotExist(kUserTableName, kUserPassword,
+		"varchar(256) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	if err = u.upgradeLocalEmail(); err != nil {
+		return err
+	}
+	return database.DatabaseInstance().AddIndexIfNotExist(kUserTableName, kUserAccountIndex,
+		fmt.Sprintf("UNIQUE KEY %s (%s, %s)", kUserAccountIndex, kUserType, kUserOpenId))
+}
+
+/* 补上local_email列时把已有本站帐号的邮箱填进去，同一个邮箱注册过多次时只填最早的那个帐号，
+** 然后再加唯一索引
+ */
+func (u *userModel) upgradeLocalEmail() error {
+	if !database.DatabaseInstance().DoesColumnExist(kUserTableName, kUserLocalEmail) {
+		err := database.DatabaseInstance().AddColumnIfNotExist(kUserTableName, kUserLocalEmail,
+			"varchar(255) DEFAULT NULL")
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf(`update %s u join (select min(%s) as first_id from %s where %s = ? and %s != ''
+			group by %s) f on u.%s = f.first_id set u.%s = u.%s`, kUserTableName, kUserId, kUserTableName, kUserType,
+			kUserEmail, kUserEmail, kUserId, kUserLocalEmail, kUserEmail)
+		if _, err = database.DatabaseInstance().DB.Exec(query, info.AccountTypeLocal); err != nil {
+			return err
+		}
+	}
+	return database.DatabaseInstance().AddIndexIfNotExist(kUserTableName, kUserLocalEmailIndex,
+		fmt.Sprintf("UNIQUE KEY %s (%s)", kUserLocalEmailIndex, kUserLocalEmail))
+}
+
 func (u *userModel) Login(accountType int, userInfo *info.UserInfo) error {
 	isLogin, err := u.accountHasLogin(accountType, userInfo.UserOpenID)
 	if err != nil {
@@ -138,16 +228,295 @@ func (u *userModel) insertAccountInfo(accountType int, userInfo *info.UserInfo)
 }
 
 func (u *userModel) GetUserInfoById(userId int64) (*info.UserInfo, error) {
-	sql := fmt.Sprintf("select %s, %s, %s from %s where %s = ?", kUserName, kUserSex,
-		kUserSmallPicutreURL, kUserTableName, kUserId)
+	sql := fmt.Sprintf("select %s, %s, %s, %s, %s, %s, %s from %s where %s = ?", kUserName, kUserSex,
+		kUserSmallPicutreURL, kUserBigPicutreURL, kUserType, kUserWebsite, kUserRegisterTime, kUserTableName, kUserId)
 	rows, err := database.DatabaseInstance().DB.Query(sql, userId)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
 			var userInfo info.UserInfo
-			rows.Scan(&userInfo.UserName, &userInfo.Sex, &userInfo.SmallFigureurl)
+			rows.Scan(&userInfo.UserName, &userInfo.Sex, &userInfo.SmallFigureurl, &userInfo.BigFigureurl,
+				&userInfo.UserAccountType, &userInfo.Website, &userInfo.RegisterTime)
+			userInfo.UserID = userId
 			return &userInfo, nil
 		}
 	}
 	return nil, err
 }
+
+// 批量查询用户信息，不存在的用户不会出现在返回的map里
+func (u *userModel) FetchUserInfoMap(userIdList []int64) (map[int64]*info.UserInfo, error) {
+	var userMap map[int64]*info.UserInfo = make(map[int64]*info.UserInfo)
+	if len(userIdList) == 0 {
+		return userMap, nil
+	}
+	var idList []int = nil
+	for _, userId := range userIdList {
+		idList = append(idList, int(userId))
+	}
+	placeholder, args := inPlaceholder(idList)
+	sql := fmt.Sprintf("select %s, %s, %s, %s, %s, %s from %s where %s in (%s)", kUserId, kUserName, kUserSex,
+		kUserSmallPicutreURL, kUserType, kUserWebsite, kUserTableName, kUserId, placeholder)
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userInfo info.UserInfo
+		if err = rows.Scan(&userInfo.UserID, &userInfo.UserName, &userInfo.Sex, &userInfo.SmallFigureurl,
+			&userInfo.UserAccountType, &userInfo.Website); err != nil {
+			return nil, err
+		}
+		userMap[userInfo.UserID] = &userInfo
+	}
+	return userMap, rows.Err()
+}
+
+// 按昵称查找用户，用于@提及，昵称重复时返回所有同名的用户，游客收不到通知，不参与匹配
+func (u *userModel) FetchUserIdListByName(nameList []string) ([]int64, error) {
+	if len(nameList) == 0 {
+		return nil, nil
+	}
+	var placeholderList []string = nil
+	var args []interface{} = nil
+	for _, name := range nameList {
+		placeholderList = append(placeholderList, "?")
+		args = append(args, name)
+	}
+	sql := fmt.Sprintf("select %s from %s where %s in (%s) and %s != %d", kUserId, kUserTableName, kUserName,
+		strings.Join(placeholderList, ", "), kUserType, info.AccountTypeGuest)
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var userIdList []int64 = nil
+	for rows.Next() {
+		var userId int64
+		if err = rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIdList = append(userIdList, userId)
+	}
+	return userIdList, rows.Err()
+}
+
+// 昵称到用户的对应关系，用于@提及的链接，昵称重复时取最早的帐号，不包括游客
+func (u *userModel) FetchUserIdMapByName(nameList []string) (map[string]int64, error) {
+	var userIdMap map[string]int64 = make(map[string]int64)
+	if len(nameList) == 0 {
+		return userIdMap, nil
+	}
+	var placeholderList []string = nil
+	var args []interface{} = nil
+	for _, name := range nameList {
+		placeholderList = append(placeholderList, "?")
+		args = append(args, name)
+	}
+	sql := fmt.Sprintf("select %s, %s from %s where %s in (%s) and %s != %d order by %s desc", kUserId, kUserName,
+		kUserTableName, kUserName, strings.Join(placeholderList, ", "), kUserType, info.AccountTypeGuest, kUserId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userId int64
+		var name string
+		if err = rows.Scan(&userId, &name); err != nil {
+			return nil, err
+		}
+		userIdMap[name] = userId
+	}
+	return userIdMap, rows.Err()
+}
+
+// 昵称是否已经被游客以外的帐号使用，不区分大小写
+func (u *userModel) IsMemberName(name string) (bool, error) {
+	sql := fmt.Sprintf("select count(*) from %s where lower(%s) = lower(?) and %s != %d", kUserTableName,
+		kUserName, kUserType, info.AccountTypeGuest)
+	var count int
+	err := database.DatabaseInstance().DB.QueryRow(sql, name).Scan(&count)
+	return count > 0, err
+}
+
+// 新的游客，UserOpenID是随机生成的标识，插入之后填上UserID
+func (u *userModel) AddGuest(userInfo *info.UserInfo) error {
+	sql := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s, %s, %s, %s, %s) values(?, ?, ?, '', ?, '', ?, ?, ?, ?)",
+		kUserTableName, kUserType, kUserOpenId, kUserName, kUserSex, kUserBigPicutreURL, kUserSmallPicutreURL,
+		kUserLastLoginTime, kUserRegisterTime, kUserEmail, kUserWebsite)
+	currentTime := time.Now().Unix()
+	result, err := database.DatabaseInstance().DB.Exec(sql, info.AccountTypeGuest, userInfo.UserOpenID,
+		userInfo.UserName, userInfo.SmallFigureurl, currentTime, currentTime, userInfo.Email, userInfo.Website)
+	if err != nil {
+		return err
+	}
+	userInfo.UserID, err = result.LastInsertId()
+	return err
+}
+
+// 游客再次评论时更新昵称、邮箱、网址和头像
+func (u *userModel) UpdateGuest(userInfo *info.UserInfo) error {
+	sql := fmt.Sprintf("update %s set %s = ?, %s = ?, %s = ?, %s = ?, %s = ? where %s = ? and %s = ?",
+		kUserTableName, kUserName, kUserSmallPicutreURL, kUserEmail, kUserWebsite, kUserLastLoginTime,
+		kUserId, kUserType)
+	_, err := database.DatabaseInstance().DB.Exec(sql, userInfo.UserName, userInfo.SmallFigureurl, userInfo.Email,
+		userInfo.Website, time.Now().Unix(), userInfo.UserID, info.AccountTypeGuest)
+	return err
+}
+
+// 包括邮箱在内的游客信息，不是游客时返回nil
+func (u *userModel) FetchGuestInfo(userId int64) (*info.UserInfo, error) {
+	query := fmt.Sprintf("select %s, %s, %s, %s, %s from %s where %s = ? and %s = ?", kUserOpenId, kUserName,
+		kUserSmallPicutreURL, kUserEmail, kUserWebsite, kUserTableName, kUserId, kUserType)
+	userInfo := info.UserInfo{UserID: userId, UserAccountType: info.AccountTypeGuest}
+	err := database.DatabaseInstance().DB.QueryRow(query, userId, info.AccountTypeGuest).Scan(&userInfo.UserOpenID,
+		&userInfo.UserName, &userInfo.SmallFigureurl, &userInfo.Email, &userInfo.Website)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userInfo, nil
+}
+
+// 用户不存在时返回nil
+func (u *userModel) FetchRoleInfo(userId int64) (*info.RoleInfo, error) {
+	query := fmt.Sprintf("select %s, %s from %s where %s = ?", kUserRole, kUserBannedUntil, kUserTableName, kUserId)
+	roleInfo := info.RoleInfo{UserID: userId}
+	err := database.DatabaseInstance().DB.QueryRow(query, userId).Scan(&roleInfo.Role, &roleInfo.BannedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &roleInfo, nil
+}
+
+// bannedUntil只在封禁时有意义，0表示永久
+func (u *userModel) SetUserRole(userId int64, role string, bannedUntil int64) error {
+	sql := fmt.Sprintf("update %s set %s = ?, %s = ? where %s = ?", kUserTableName, kUserRole, kUserBannedUntil, kUserId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, role, bannedUntil, userId)
+	return err
+}
+
+// 某几种角色的所有用户，用于列出管理员和被封禁的用户
+func (u *userModel) FetchRoleInfoList(roleList []string) ([]*info.RoleInfo, error) {
+	if len(roleList) == 0 {
+		return nil, nil
+	}
+	var placeholderList []string = nil
+	var args []interface{} = nil
+	for _, role := range roleList {
+		placeholderList = append(placeholderList, "?")
+		args = append(args, role)
+	}
+	sql := fmt.Sprintf("select %s, %s, %s from %s where %s in (%s) order by %s", kUserId, kUserRole, kUserBannedUntil,
+		kUserTableName, kUserRole, strings.Join(placeholderList, ", "), kUserId)
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var roleInfoList []*info.RoleInfo = nil
+	for rows.Next() {
+		var roleInfo info.RoleInfo
+		if err = rows.Scan(&roleInfo.UserID, &roleInfo.Role, &roleInfo.BannedUntil); err != nil {
+			return nil, err
+		}
+		roleInfoList = append(roleInfoList, &roleInfo)
+	}
+	return roleInfoList, rows.Err()
+}
+
+// 用户不存在时返回nil
+func (u *userModel) FetchPrivacy(userId int64) (*info.PrivacyInfo, error) {
+	query := fmt.Sprintf("select %s, %s from %s where %s = ?", kUserHideProfile, kUserHideComments,
+		kUserTableName, kUserId)
+	var hideProfile, hideComments int
+	err := database.DatabaseInstance().DB.QueryRow(query, userId).Scan(&hideProfile, &hideComments)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &info.PrivacyInfo{HideProfile: hideProfile != 0, HideComments: hideComments != 0}, nil
+}
+
+func (u *userModel) SetPrivacy(userId int64, privacy *info.PrivacyInfo) error {
+	query := fmt.Sprintf("update %s set %s = ?, %s = ? where %s = ?", kUserTableName, kUserHideProfile,
+		kUserHideComments, kUserId)
+	_, err := database.DatabaseInstance().DB.Exec(query, boolToInt(privacy.HideProfile),
+		boolToInt(privacy.HideComments), userId)
+	return err
+}
+
+/* 新的本站帐号，UserOpenID是小写的用户名，passwordHash是编码之后的密码摘要，
+** 插入之后填上UserID。用户名或者邮箱已经被注册时返回ErrLocalNameExists或者ErrLocalEmailExists
+ */
+func (u *userModel) AddLocalUser(userInfo *info.UserInfo, passwordHash string) error {
+	query := fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s) values(?, ?, ?, '', '', ?, ?, ?, ?, ?, ?)",
+		kUserTableName, kUserType, kUserOpenId, kUserName, kUserSex, kUserBigPicutreURL, kUserSmallPicutreURL,
+		kUserLastLoginTime, kUserRegisterTime, kUserEmail, kUserLocalEmail, kUserPassword)
+	currentTime := time.Now().Unix()
+	result, err := database.DatabaseInstance().DB.Exec(query, info.AccountTypeLocal, userInfo.UserOpenID,
+		userInfo.UserName, userInfo.SmallFigureurl, currentTime, currentTime, userInfo.Email, userInfo.Email,
+		passwordHash)
+	if database.IsDuplicateKey(err, kUserAccountIndex) {
+		return ErrLocalNameExists
+	}
+	if database.IsDuplicateKey(err, kUserLocalEmailIndex) {
+		return ErrLocalEmailExists
+	}
+	if err != nil {
+		return err
+	}
+	userInfo.UserID, err = result.LastInsertId()
+	return err
+}
+
+// 按某一列查找本站帐号，返回用户信息和密码摘要，找不到时返回nil
+func (u *userModel) fetchLocalUser(column string, value interface{}) (*info.UserInfo, string, error) {
+	query := fmt.Sprintf("select %s, %s, %s, %s, %s, %s from %s where %s = ? and %s = ?", kUserId, kUserOpenId,
+		kUserName, kUserSmallPicutreURL, kUserEmail, kUserPassword, kUserTableName, column, kUserType)
+	userInfo := info.UserInfo{UserAccountType: info.AccountTypeLocal}
+	var passwordHash string
+	err := database.DatabaseInstance().DB.QueryRow(query, value, info.AccountTypeLocal).Scan(&userInfo.UserID,
+		&userInfo.UserOpenID, &userInfo.UserName, &userInfo.SmallFigureurl, &userInfo.Email, &passwordHash)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &userInfo, passwordHash, nil
+}
+
+func (u *userModel) FetchLocalUserByName(openId string) (*info.UserInfo, string, error) {
+	return u.fetchLocalUser(kUserOpenId, openId)
+}
+
+func (u *userModel) FetchLocalUserByEmail(email string) (*info.UserInfo, string, error) {
+	return u.fetchLocalUser(kUserLocalEmail, email)
+}
+
+func (u *userModel) FetchLocalUserById(userId int64) (*info.UserInfo, string, error) {
+	return u.fetchLocalUser(kUserId, userId)
+}
+
+func (u *userModel) SetPasswordHash(userId int64, passwordHash string) error {
+	query := fmt.Sprintf("update %s set %s = ? where %s = ? and %s = ?", kUserTableName, kUserPassword,
+		kUserId, kUserType)
+	_, err := database.DatabaseInstance().DB.Exec(query, passwordHash, userId, info.AccountTypeLocal)
+	return err
+}
+
+func (u *userModel) UpdateLoginTime(userId int64) error {
+	query := fmt.Sprintf("update %s set %s = ? where %s = ?", kUserTableName, kUserLastLoginTime, kUserId)
+	_, err := database.DatabaseInstance().DB.Exec(query, time.Now().Unix(), userId)
+	return err
+}
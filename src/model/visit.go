@@ -0,0 +1,412 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"framework/database"
+	"info"
+	"strings"
+	"sync"
+)
+
+type visitModel struct {
+}
+
+const (
+	kVisitStatTableName  = "visit_stat"
+	kVisitStatId         = "id"
+	kVisitStatTargetType = "target_type"
+	kVisitStatTargetId   = "target_id"
+	kVisitStatDay        = "day"
+	kVisitStatPageView   = "page_view"
+	kVisitStatVisitor    = "visitor"
+	kVisitStatEntry      = "entry"
+)
+
+const (
+	kVisitHitTableName  = "visit_hit"
+	kVisitHitId         = "id"
+	kVisitHitTargetType = "target_type"
+	kVisitHitTargetId   = "target_id"
+	kVisitHitDay        = "day"
+	kVisitHitTime       = "time"
+	kVisitHitReferrer   = "referrer"
+	kVisitHitTerm       = "term"
+	kVisitHitEntry      = "entry"
+)
+
+const (
+	kVisitSourceTableName  = "visit_source"
+	kVisitSourceId         = "id"
+	kVisitSourceDay        = "day"
+	kVisitSourceTargetType = "target_type"
+	kVisitSourceTargetId   = "target_id"
+	kVisitSourceKind       = "kind"
+	kVisitSourceValue      = "value"
+	kVisitSourceCount      = "count"
+)
+
+const (
+	kVisitVisitorTableName  = "visit_visitor"
+	kVisitVisitorId         = "id"
+	kVisitVisitorTargetType = "target_type"
+	kVisitVisitorTargetId   = "target_id"
+	kVisitVisitorDay        = "day"
+	kVisitVisitorHash       = "visitor_hash"
+)
+
+var visitModelInstance *visitModel = nil
+
+var visitOnce sync.Once
+
+func ShareVisitModel() *visitModel {
+	visitOnce.Do(func() {
+		visitModelInstance = &visitModel{}
+	})
+	return visitModelInstance
+}
+
+/* 访问统计用到四张表：
+** visit_stat，每天每篇博客(插件)一行，用于统计访问趋势；
+** visit_hit，原始访问记录，只保存还没有汇总的部分；
+** visit_source，每天的来源域名和搜索词，由visit_hit汇总而来；
+** visit_visitor，每天访问过每个对象的访客，用于独立访客去重，只保留最近两天。
+ */
+func (v *visitModel) CreateTable() error {
+	if !database.DatabaseInstance().DoesTableExist(kVisitStatTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+			%s varchar(16) NOT NULL,
+			%s int(32) unsigned NOT NULL,
+			%s int(32) unsigned NOT NULL,
+			%s int(32) unsigned NOT NULL DEFAULT '0',
+			%s int(32) unsigned NOT NULL DEFAULT '0',
+			%s int(32) unsigned NOT NULL DEFAULT '0',
+			PRIMARY KEY (%s),
+			UNIQUE KEY (%s, %s, %s),
+			KEY (%s)
+		) CHARSET=utf8;`, kVisitStatTableName, kVisitStatId,
+			kVisitStatTargetType, kVisitStatTargetId, kVisitStatDay, kVisitStatPageView, kVisitStatVisitor,
+			kVisitStatEntry, kVisitStatId, kVisitStatTargetType, kVisitStatTargetId, kVisitStatDay, kVisitStatDay)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	} else {
+		err := database.DatabaseInstance().AddColumnIfNotExist(kVisitStatTableName, kVisitStatEntry,
+			"int(32) unsigned NOT NULL DEFAULT '0'")
+		if err != nil {
+			return err
+		}
+	}
+	if !database.DatabaseInstance().DoesTableExist(kVisitHitTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+			%s varchar(16) NOT NULL,
+			%s int(32) unsigned NOT NULL,
+			%s int(32) unsigned NOT NULL,
+			%s int(64) NOT NULL,
+			%s varchar(128) NOT NULL DEFAULT '',
+			%s varchar(128) NOT NULL DEFAULT '',
+			%s tinyint(4) NOT NULL DEFAULT '0',
+			PRIMARY KEY (%s)
+		) CHARSET=utf8;`, kVisitHitTableName, kVisitHitId,
+			kVisitHitTargetType, kVisitHitTargetId, kVisitHitDay, kVisitHitTime, kVisitHitReferrer, kVisitHitTerm,
+			kVisitHitEntry, kVisitHitId)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	if !database.DatabaseInstance().DoesTableExist(kVisitSourceTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+			%s int(32) unsigned NOT NULL,
+			%s varchar(16) NOT NULL,
+			%s int(32) unsigned NOT NULL,
+			%s varchar(16) NOT NULL,
+			%s varchar(128) NOT NULL,
+			%s int(32) unsigned NOT NULL DEFAULT '0',
+			PRIMARY KEY (%s),
+			UNIQUE KEY (%s, %s, %s, %s, %s)
+		) CHARSET=utf8;`, kVisitSourceTableName, kVisitSourceId,
+			kVisitSourceDay, kVisitSourceTargetType, kVisitSourceTargetId, kVisitSourceKind, kVisitSourceValue,
+			kVisitSourceCount, kVisitSourceId,
+			kVisitSourceDay, kVisitSourceTargetType, kVisitSourceTargetId, kVisitSourceKind, kVisitSourceValue)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	if !database.DatabaseInstance().DoesTableExist(kVisitVisitorTableName) {
+		sql := fmt.Sprintf(`
+		CREATE TABLE %s (
+			%s int(64) unsigned NOT NULL AUTO_INCREMENT,
+			%s varchar(16) NOT NULL,
+			%s int(32) unsigned NOT NULL,
+			%s int(32) unsigned NOT NULL,
+			%s char(32) NOT NULL,
+			PRIMARY KEY (%s),
+			UNIQUE KEY (%s, %s, %s, %s),
+			KEY (%s)
+		) CHARSET=utf8;`, kVisitVisitorTableName, kVisitVisitorId,
+			kVisitVisitorTargetType, kVisitVisitorTargetId, kVisitVisitorDay, kVisitVisitorHash, kVisitVisitorId,
+			kVisitVisitorTargetType, kVisitVisitorTargetId, kVisitVisitorDay, kVisitVisitorHash, kVisitVisitorDay)
+		if _, err := database.DatabaseInstance().DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 访问量所在的表
+func visitTargetTable(targetType string) (string, string, error) {
+	switch targetType {
+	case info.VisitTarget_Blog:
+		return kBlogTableName, kBlogVisitCount, nil
+	case info.VisitTarget_Plugin:
+		return kPluginTableName, kPluginVisitCount, nil
+	}
+	return "", "", fmt.Errorf("unsupport visit target: %s", targetType)
+}
+
+/* 批量写入一段时间内的访问量。
+** VisitorList里当天第一次出现的访客写入visit_visitor，个数就是新增的独立访客数，
+** 重启之后也不会重复计数。每日统计累加到visit_stat，独立访客数累加到blog、plugin表的visit列，
+** 原始记录写入visit_hit，等待汇总，这些都在同一个事务里完成。
+ */
+func (v *visitModel) AddVisits(statList []*info.VisitStatInfo, hitList []*info.VisitHitInfo) error {
+	if len(statList) == 0 && len(hitList) == 0 {
+		return nil
+	}
+	return runInTransaction(func(tx *sql.Tx) error {
+		insert := fmt.Sprintf(`insert into %s(%s, %s, %s, %s, %s) values(?, ?, ?, ?, ?)
+			on duplicate key update %s = %s + values(%s), %s = %s + values(%s)`,
+			kVisitStatTableName, kVisitStatTargetType, kVisitStatTargetId, kVisitStatDay,
+			kVisitStatPageView, kVisitStatVisitor,
+			kVisitStatPageView, kVisitStatPageView, kVisitStatPageView,
+			kVisitStatVisitor, kVisitStatVisitor, kVisitStatVisitor)
+		visitor := fmt.Sprintf("insert ignore into %s(%s, %s, %s, %s) values(?, ?, ?, ?)",
+			kVisitVisitorTableName, kVisitVisitorTargetType, kVisitVisitorTargetId, kVisitVisitorDay,
+			kVisitVisitorHash)
+		for _, stat := range statList {
+			table, visitColumn, err := visitTargetTable(stat.TargetType)
+			if err != nil {
+				return err
+			}
+			stat.Visitor = 0
+			for _, hash := range stat.VisitorList {
+				result, err := tx.Exec(visitor, stat.TargetType, stat.TargetID, stat.Day, hash)
+				if err != nil {
+					return err
+				}
+				affected, err := result.RowsAffected()
+				if err != nil {
+					return err
+				}
+				stat.Visitor += int(affected)
+			}
+			_, err = tx.Exec(insert, stat.TargetType, stat.TargetID, stat.Day, stat.PageView, stat.Visitor)
+			if err != nil {
+				return err
+			}
+			if stat.Visitor == 0 {
+				continue
+			}
+			update := fmt.Sprintf("update %s set %s = %s + ? where id = ?", table, visitColumn, visitColumn)
+			if _, err = tx.Exec(update, stat.Visitor, stat.TargetID); err != nil {
+				return err
+			}
+		}
+		insert = fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s, %s, %s) values(?, ?, ?, ?, ?, ?, ?)",
+			kVisitHitTableName, kVisitHitTargetType, kVisitHitTargetId, kVisitHitDay, kVisitHitTime,
+			kVisitHitReferrer, kVisitHitTerm, kVisitHitEntry)
+		for _, hit := range hitList {
+			_, err := tx.Exec(insert, hit.TargetType, hit.TargetID, hit.Day, hit.Time,
+				hit.Referrer, hit.Term, boolToInt(hit.Entry))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+/* 把visit_hit里的原始记录汇总到visit_source和visit_stat的entry列，然后删掉，返回汇总的条数。
+** 只处理开始时已经存在的记录，汇总期间新写入的留到下一次。
+ */
+func (v *visitModel) RollupVisitHits() (int, error) {
+	count := 0
+	err := runInTransaction(func(tx *sql.Tx) error {
+		var maxId sql.NullInt64
+		query := fmt.Sprintf("select max(%s) from %s", kVisitHitId, kVisitHitTableName)
+		if err := tx.QueryRow(query).Scan(&maxId); err != nil {
+			return err
+		}
+		if !maxId.Valid {
+			return nil
+		}
+		for kind, column := range map[string]string{
+			info.VisitSource_Referrer: kVisitHitReferrer,
+			info.VisitSource_Term:     kVisitHitTerm,
+		} {
+			rollup := fmt.Sprintf(`insert into %s(%s, %s, %s, %s, %s, %s)
+				select %s, %s, %s, ?, %s, count(*) from %s where %s <= ? and %s != ''
+				group by %s, %s, %s, %s
+				on duplicate key update %s = %s + values(%s)`,
+				kVisitSourceTableName, kVisitSourceDay, kVisitSourceTargetType, kVisitSourceTargetId,
+				kVisitSourceKind, kVisitSourceValue, kVisitSourceCount,
+				kVisitHitDay, kVisitHitTargetType, kVisitHitTargetId, column, kVisitHitTableName,
+				kVisitHitId, column,
+				kVisitHitDay, kVisitHitTargetType, kVisitHitTargetId, column,
+				kVisitSourceCount, kVisitSourceCount, kVisitSourceCount)
+			if _, err := tx.Exec(rollup, kind, maxId.Int64); err != nil {
+				return err
+			}
+		}
+		entry := fmt.Sprintf(`update %s s inner join (
+				select %s, %s, %s, sum(%s) c from %s where %s <= ? group by %s, %s, %s
+			) h on s.%s = h.%s and s.%s = h.%s and s.%s = h.%s
+			set s.%s = s.%s + h.c`,
+			kVisitStatTableName,
+			kVisitHitDay, kVisitHitTargetType, kVisitHitTargetId, kVisitHitEntry, kVisitHitTableName, kVisitHitId,
+			kVisitHitDay, kVisitHitTargetType, kVisitHitTargetId,
+			kVisitStatDay, kVisitHitDay, kVisitStatTargetType, kVisitHitTargetType,
+			kVisitStatTargetId, kVisitHitTargetId, kVisitStatEntry, kVisitStatEntry)
+		if _, err := tx.Exec(entry, maxId.Int64); err != nil {
+			return err
+		}
+		remove := fmt.Sprintf("delete from %s where %s <= ?", kVisitHitTableName, kVisitHitId)
+		result, err := tx.Exec(remove, maxId.Int64)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		count = int(affected)
+		return err
+	})
+	return count, err
+}
+
+// 删掉day之前的访客记录，去重只需要当天的
+func (v *visitModel) DeleteVisitorsBefore(day int) error {
+	sql := fmt.Sprintf("delete from %s where %s < ?", kVisitVisitorTableName, kVisitVisitorDay)
+	_, err := database.DatabaseInstance().DB.Exec(sql, day)
+	return err
+}
+
+// targetType为空表示所有对象，targetId为0表示某类对象的全部
+func visitTargetCondition(typeColumn string, idColumn string, targetType string,
+	targetId int) (string, []interface{}) {
+	var conditionList []string = nil
+	var args []interface{} = nil
+	if targetType != "" {
+		conditionList = append(conditionList, typeColumn+" = ?")
+		args = append(args, targetType)
+		if targetId > 0 {
+			conditionList = append(conditionList, idColumn+" = ?")
+			args = append(args, targetId)
+		}
+	}
+	if len(conditionList) == 0 {
+		return "", nil
+	}
+	return " and " + strings.Join(conditionList, " and "), args
+}
+
+func (v *visitModel) queryVisitStatList(sql string, args ...interface{}) ([]*info.VisitStatInfo, error) {
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var statList []*info.VisitStatInfo = nil
+	for rows.Next() {
+		var stat info.VisitStatInfo
+		err = rows.Scan(&stat.TargetType, &stat.TargetID, &stat.Day, &stat.PageView, &stat.Visitor, &stat.Entry)
+		if err != nil {
+			return nil, err
+		}
+		statList = append(statList, &stat)
+	}
+	return statList, rows.Err()
+}
+
+// 某个对象在[beginDay, endDay]之间每天的访问量，按日期升序
+func (v *visitModel) FetchVisitStatList(targetType string, targetId int, beginDay int,
+	endDay int) ([]*info.VisitStatInfo, error) {
+	sql := fmt.Sprintf(`select %s, %s, %s, %s, %s, %s from %s
+		where %s = ? and %s = ? and %s >= ? and %s <= ? order by %s`,
+		kVisitStatTargetType, kVisitStatTargetId, kVisitStatDay, kVisitStatPageView, kVisitStatVisitor,
+		kVisitStatEntry, kVisitStatTableName, kVisitStatTargetType, kVisitStatTargetId, kVisitStatDay,
+		kVisitStatDay, kVisitStatDay)
+	return v.queryVisitStatList(sql, targetType, targetId, beginDay, endDay)
+}
+
+// 按天合计的访问量，用于画趋势图，TargetID为0
+func (v *visitModel) FetchDailyVisitTotal(targetType string, targetId int, beginDay int,
+	endDay int) ([]*info.VisitStatInfo, error) {
+	condition, args := visitTargetCondition(kVisitStatTargetType, kVisitStatTargetId, targetType, targetId)
+	sql := fmt.Sprintf(`select ?, 0, %s, sum(%s), sum(%s), sum(%s) from %s
+		where %s >= ? and %s <= ?%s group by %s order by %s`,
+		kVisitStatDay, kVisitStatPageView, kVisitStatVisitor, kVisitStatEntry, kVisitStatTableName,
+		kVisitStatDay, kVisitStatDay, condition, kVisitStatDay, kVisitStatDay)
+	args = append([]interface{}{targetType, beginDay, endDay}, args...)
+	return v.queryVisitStatList(sql, args...)
+}
+
+// 一段时间内访问量最多的对象，orderBy为page_view、visitor或者entry，Day为0
+func (v *visitModel) FetchTopVisitTargets(targetType string, beginDay int, endDay int, orderBy string,
+	limit int) ([]*info.VisitStatInfo, error) {
+	if orderBy != kVisitStatPageView && orderBy != kVisitStatVisitor && orderBy != kVisitStatEntry {
+		return nil, fmt.Errorf("unsupport order: %s", orderBy)
+	}
+	sql := fmt.Sprintf(`select %s, %s, 0, sum(%s), sum(%s), sum(%s) from %s
+		where %s = ? and %s >= ? and %s <= ? group by %s, %s order by sum(%s) desc limit ?`,
+		kVisitStatTargetType, kVisitStatTargetId, kVisitStatPageView, kVisitStatVisitor, kVisitStatEntry,
+		kVisitStatTableName, kVisitStatTargetType, kVisitStatDay, kVisitStatDay,
+		kVisitStatTargetType, kVisitStatTargetId, orderBy)
+	return v.queryVisitStatList(sql, targetType, beginDay, endDay, limit)
+}
+
+// 一段时间内最多的来源域名(VisitSource_Referrer)或者搜索词(VisitSource_Term)
+func (v *visitModel) FetchTopVisitSources(kind string, targetType string, targetId int, beginDay int,
+	endDay int, limit int) ([]*info.VisitSourceInfo, error) {
+	condition, args := visitTargetCondition(kVisitSourceTargetType, kVisitSourceTargetId, targetType, targetId)
+	sql := fmt.Sprintf(`select %s, sum(%s) c from %s
+		where %s = ? and %s >= ? and %s <= ?%s group by %s order by c desc limit ?`,
+		kVisitSourceValue, kVisitSourceCount, kVisitSourceTableName,
+		kVisitSourceKind, kVisitSourceDay, kVisitSourceDay, condition, kVisitSourceValue)
+	args = append([]interface{}{kind, beginDay, endDay}, args...)
+	args = append(args, limit)
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sourceList []*info.VisitSourceInfo = nil
+	for rows.Next() {
+		var source info.VisitSourceInfo
+		if err = rows.Scan(&source.Value, &source.Count); err != nil {
+			return nil, err
+		}
+		sourceList = append(sourceList, &source)
+	}
+	return sourceList, rows.Err()
+}
+
+// 彻底删除对象时删掉它的访问统计
+func (v *visitModel) DeleteTargetVisitStats(targetType string, targetId int) error {
+	return runInTransaction(func(tx *sql.Tx) error {
+		for _, table := range []string{kVisitStatTableName, kVisitHitTableName, kVisitSourceTableName,
+			kVisitVisitorTableName} {
+			// 这几张表的对象列名相同
+			sql := fmt.Sprintf("delete from %s where %s = ? and %s = ?",
+				table, kVisitStatTargetType, kVisitStatTargetId)
+			if _, err := tx.Exec(sql, targetType, targetId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
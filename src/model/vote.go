@@ -0,0 +1,204 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"framework/database"
+	"info"
+	"sync"
+	"time"
+)
+
+type voteModel struct {
+}
+
+const (
+	kVoteTableName  = "vote"
+	kVoteId         = "id"
+	kVoteTargetType = "target_type"
+	kVoteTargetId   = "target_id"
+	kVoteVoter      = "voter"
+	kVoteValue      = "value"
+	kVoteTime       = "time"
+)
+
+var voteModelInstance *voteModel = nil
+
+var voteOnce sync.Once
+
+func ShareVoteModel() *voteModel {
+	voteOnce.Do(func() {
+		voteModelInstance = &voteModel{}
+	})
+	return voteModelInstance
+}
+
+/* 投票表，同一个人对同一个对象只保留一票。
+** voter是登录用户的id或者匿名用户的指纹，见blog/vote。
+** 顶和踩的总数仍然保存在blog、comment、plugin表的praise、dissent列，投票时同步更新。
+ */
+func (v *voteModel) CreateTable() error {
+	if database.DatabaseInstance().DoesTableExist(kVoteTableName) {
+		return nil
+	}
+	sql := fmt.Sprintf(`
+	CREATE TABLE %s (
+		%s int(32) unsigned NOT NULL AUTO_INCREMENT,
+		%s varchar(16) NOT NULL,
+		%s int(32) unsigned NOT NULL,
+		%s varchar(80) NOT NULL,
+		%s tinyint(4) NOT NULL,
+		%s int(64) NOT NULL,
+		PRIMARY KEY (%s),
+		UNIQUE KEY (%s, %s, %s),
+		KEY (%s)
+	) CHARSET=utf8;`, kVoteTableName, kVoteId,
+		kVoteTargetType, kVoteTargetId, kVoteVoter, kVoteValue, kVoteTime,
+		kVoteId, kVoteTargetType, kVoteTargetId, kVoteVoter, kVoteVoter)
+	_, err := database.DatabaseInstance().DB.Exec(sql)
+	return err
+}
+
+// 投票对象所在的表以及计数的列
+func voteTargetTable(targetType string) (string, string, string, error) {
+	switch targetType {
+	case info.VoteTarget_Blog:
+		return kBlogTableName, kBlogPraiseCount, kBlogDissentCount, nil
+	case info.VoteTarget_Comment:
+		return kCommentTableName, kCommentPraise, kCommentDissent, nil
+	case info.VoteTarget_Plugin:
+		return kPluginTableName, kPluginPraiseCount, kPluginDissentCount, nil
+	}
+	return "", "", "", fmt.Errorf("unsupport vote target: %s", targetType)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+/* 投票或者取消投票(value为0)，返回更新之后的顶、踩数。
+** 重复投同样的票不会重复计数，改投时原来的票会被撤销。
+ */
+func (v *voteModel) SetVote(targetType string, targetId int, voter string, value int) (*info.VoteCountInfo, error) {
+	table, praiseColumn, dissentColumn, err := voteTargetTable(targetType)
+	if err != nil {
+		return nil, err
+	}
+	count := &info.VoteCountInfo{Vote: value}
+	err = runInTransaction(func(tx *sql.Tx) error {
+		query := fmt.Sprintf("select %s from %s where %s = ? and %s = ? and %s = ? for update",
+			kVoteValue, kVoteTableName, kVoteTargetType, kVoteTargetId, kVoteVoter)
+		oldValue := info.Vote_None
+		err := tx.QueryRow(query, targetType, targetId, voter).Scan(&oldValue)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if oldValue != value {
+			var change string
+			var args []interface{}
+			if value == info.Vote_None {
+				change = fmt.Sprintf("delete from %s where %s = ? and %s = ? and %s = ?",
+					kVoteTableName, kVoteTargetType, kVoteTargetId, kVoteVoter)
+				args = []interface{}{targetType, targetId, voter}
+			} else if oldValue == info.Vote_None {
+				change = fmt.Sprintf("insert into %s(%s, %s, %s, %s, %s) values(?, ?, ?, ?, ?)",
+					kVoteTableName, kVoteTargetType, kVoteTargetId, kVoteVoter, kVoteValue, kVoteTime)
+				args = []interface{}{targetType, targetId, voter, value, time.Now().Unix()}
+			} else {
+				change = fmt.Sprintf("update %s set %s = ?, %s = ? where %s = ? and %s = ? and %s = ?",
+					kVoteTableName, kVoteValue, kVoteTime, kVoteTargetType, kVoteTargetId, kVoteVoter)
+				args = []interface{}{value, time.Now().Unix(), targetType, targetId, voter}
+			}
+			if _, err = tx.Exec(change, args...); err != nil {
+				return err
+			}
+			praiseDelta := boolToInt(value == info.Vote_Up) - boolToInt(oldValue == info.Vote_Up)
+			dissentDelta := boolToInt(value == info.Vote_Down) - boolToInt(oldValue == info.Vote_Down)
+			update := fmt.Sprintf("update %s set %s = %s + ?, %s = %s + ? where id = ?",
+				table, praiseColumn, praiseColumn, dissentColumn, dissentColumn)
+			if _, err = tx.Exec(update, praiseDelta, dissentDelta, targetId); err != nil {
+				return err
+			}
+		}
+		query = fmt.Sprintf("select %s, %s from %s where id = ?", praiseColumn, dissentColumn, table)
+		return tx.QueryRow(query, targetId).Scan(&count.Praise, &count.Dissent)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return count, nil
+}
+
+// 某个人对一批对象的投票，没有投票的不在结果里
+func (v *voteModel) FetchVoteMap(targetType string, targetIdList []int, voter string) (map[int]int, error) {
+	var voteMap map[int]int = make(map[int]int)
+	if len(targetIdList) == 0 || voter == "" {
+		return voteMap, nil
+	}
+	placeholder, args := inPlaceholder(targetIdList)
+	sql := fmt.Sprintf("select %s, %s from %s where %s = ? and %s = ? and %s in (%s)",
+		kVoteTargetId, kVoteValue, kVoteTableName, kVoteTargetType, kVoteVoter, kVoteTargetId, placeholder)
+	args = append([]interface{}{targetType, voter}, args...)
+	rows, err := database.DatabaseInstance().DB.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var targetId, value int
+		if err = rows.Scan(&targetId, &value); err != nil {
+			return nil, err
+		}
+		voteMap[targetId] = value
+	}
+	return voteMap, rows.Err()
+}
+
+func (v *voteModel) FetchVote(targetType string, targetId int, voter string) (int, error) {
+	voteMap, err := v.FetchVoteMap(targetType, []int{targetId}, voter)
+	if err != nil {
+		return info.Vote_None, err
+	}
+	return voteMap[targetId], nil
+}
+
+// 彻底删除对象时删掉它的投票
+func (v *voteModel) DeleteTargetVotes(targetType string, targetId int) error {
+	sql := fmt.Sprintf("delete from %s where %s = ? and %s = ?", kVoteTableName, kVoteTargetType, kVoteTargetId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, targetType, targetId)
+	return err
+}
+
+// 删除某篇博客或者某个插件下所有评论的投票，要在删除评论之前调用
+func (v *voteModel) DeleteCommentVotesByTypeId(commentType int, typeId int) error {
+	sql := fmt.Sprintf(`delete v from %s v inner join %s c on c.%s = v.%s
+		where v.%s = ? and c.%s = ? and c.%s = ?`,
+		kVoteTableName, kCommentTableName, kCommentId, kVoteTargetId,
+		kVoteTargetType, kCommentType, kCommentTypeId)
+	_, err := database.DatabaseInstance().DB.Exec(sql, info.VoteTarget_Comment, commentType, typeId)
+	return err
+}
+
+// [beginTime, endTime)之间每天的顶、踩数，按最后一次投票的时间算
+func (v *voteModel) FetchDailyVoteCount(beginTime int64, endTime int64) ([]*info.DailyVoteInfo, error) {
+	sql := fmt.Sprintf(`select from_unixtime(%s, '%%Y%%m%%d') d, sum(%s = ?), sum(%s = ?) from %s
+		where %s >= ? and %s < ? group by d order by d`,
+		kVoteTime, kVoteValue, kVoteValue, kVoteTableName, kVoteTime, kVoteTime)
+	rows, err := database.DatabaseInstance().DB.Query(sql, info.Vote_Up, info.Vote_Down, beginTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var countList []*info.DailyVoteInfo = nil
+	for rows.Next() {
+		var count info.DailyVoteInfo
+		if err = rows.Scan(&count.Day, &count.Up, &count.Down); err != nil {
+			return nil, err
+		}
+		countList = append(countList, &count)
+	}
+	return countList, rows.Err()
+}
@@ -71,6 +71,8 @@ func (b *BuilderMgr) Run(callback ProgressCallback) {
 				if err != nil {
 					errString += err.Error()
 					fmt.Println("err: ", err)
+					// 出错时也要通知结束，调用者在等待编译完成
+					callback(outputStr+outString, errorStr+errString, true)
 					return
 				}
 				outputStr += outString
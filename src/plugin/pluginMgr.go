@@ -32,8 +32,14 @@ func (p *pluginMgr) OnPluginNeedStart(pluginId int) {
 	p.LoadPlugin(pluginId)
 }
 
-func (p *pluginMgr) OnPluginNeedStop(pluginId int) {
-	p.StopPlugin(pluginId)
+// 更新插件时停掉正在运行的旧版本，记下有没有停掉
+type stopRecorder struct {
+	mgr     *pluginMgr
+	stopped bool
+}
+
+func (s *stopRecorder) OnPluginNeedStop(pluginId int) {
+	s.stopped = s.mgr.StopPlugin(pluginId) == nil
 }
 
 func (p *pluginMgr) OnPluginShutdown(pluginId int) {
@@ -47,21 +53,25 @@ func (p *pluginMgr) Initialize() {
 	ipc.SharePluginIPCManager().StartListener()
 }
 
-func (p *pluginMgr) AddNewPlugin(rawPluginPath string, callback build.ProgressCallback) error {
-	storage := storage.NewPluginStorage(rawPluginPath, p)
+/* 保存插件并开始编译，返回插件id以及是否停掉了正在运行的旧版本，
+** 编译的进度和结果通过callback返回
+ */
+func (p *pluginMgr) AddNewPlugin(rawPluginPath string, callback build.ProgressCallback) (int, bool, error) {
+	recorder := &stopRecorder{mgr: p}
+	storage := storage.NewPluginStorage(rawPluginPath, recorder)
 	err := storage.Run()
 	if err != nil {
-		return err
+		return storage.GetPluginID(), recorder.stopped, err
 	}
 	pluginId := storage.GetPluginID()
 	fmt.Println("pluginID: ", pluginId)
 	buildMgr, err := build.NewBuilderMgr(pluginId)
 	if err != nil {
 		fmt.Println("get build failed: ", err)
-		return err
+		return pluginId, recorder.stopped, err
 	}
 	buildMgr.Run(callback)
-	return nil
+	return pluginId, recorder.stopped, nil
 }
 
 func (p *pluginMgr) LoadPlugin(pluginId int) error {
@@ -77,6 +87,10 @@ func (p *pluginMgr) LoadPlugin(pluginId int) error {
 		fmt.Println("fetch plugin info failed: ", err)
 		return err
 	}
+	// 插件不存在或者已经放入回收站
+	if loadPluginInfo == nil {
+		return errors.New("plugin not exist")
+	}
 
 	runner := run.NewPluginRunner(loadPluginInfo.PluginType, pluginId)
 	if err != nil {
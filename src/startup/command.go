@@ -0,0 +1,100 @@
+package startup
+
+import (
+	"blog/backup"
+	"blog/owner"
+	"bufio"
+	"fmt"
+	"framework/base/config"
+	"model"
+	"os"
+	"strings"
+)
+
+const kCommandUsage = `usage:
+	main                 启动服务
+	main backup [dir]    全站备份，dir默认为配置里的backup.dir
+	main verify <file>   校验备份文件
+	main restore <file>  从备份恢复数据库和存储目录，恢复前请先停止服务
+	main owner-password <username>
+	                     设置主人登录(/personal/auth)的用户名和密码，密码从标准输入读取，同时解除锁定
+	main owner-reset-totp
+	                     手机和恢复码都丢了时关闭主人的两步验证，同时解除锁定`
+
+// 命令行，返回进程的退出码
+func RunCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(kCommandUsage)
+		return 2
+	}
+	switch args[0] {
+	case "backup":
+		dir, _ := config.GetDefaultConfigJsonReader().Get("backup.dir").(string)
+		if len(args) > 1 {
+			dir = args[1]
+		}
+		if dir == "" {
+			fmt.Println("no backup dir")
+			return 2
+		}
+		path, err := backup.Backup(dir)
+		if err != nil {
+			fmt.Println("backup error: ", err)
+			return 1
+		}
+		fmt.Println("backup: ", path)
+		return 0
+	case "verify", "restore":
+		if len(args) < 2 {
+			fmt.Println(kCommandUsage)
+			return 2
+		}
+		var manifest *backup.Manifest
+		var err error
+		if args[0] == "verify" {
+			manifest, err = backup.Verify(args[1])
+		} else {
+			manifest, err = backup.Restore(args[1])
+		}
+		if err != nil {
+			fmt.Printf("%s error: %v\n", args[0], err)
+			return 1
+		}
+		fmt.Printf("%s ok: %d tables, %d files\n", args[0], len(manifest.Tables), len(manifest.Entries)-len(manifest.Tables))
+		return 0
+	case "owner-password", "owner-reset-totp":
+		if args[0] == "owner-password" && len(args) < 2 {
+			fmt.Println(kCommandUsage)
+			return 2
+		}
+		// 服务没有启动过时还没有建表
+		if err := model.ShareOwnerAuthModel().CreateTable(); err != nil {
+			fmt.Println("create table error: ", err)
+			return 1
+		}
+		var err error
+		if args[0] == "owner-password" {
+			err = setOwnerPassword(args[1])
+		} else {
+			err = owner.ResetTOTP()
+		}
+		if err != nil {
+			fmt.Printf("%s error: %v\n", args[0], err)
+			return 1
+		}
+		fmt.Printf("%s ok\n", args[0])
+		return 0
+	}
+	fmt.Println(kCommandUsage)
+	return 2
+}
+
+// 密码从标准输入读，不出现在命令行参数和shell历史里
+func setOwnerPassword(userName string) error {
+	fmt.Print("password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return err
+	}
+	return owner.SetPassword(userName, strings.TrimRight(password, "\r\n"))
+}
@@ -1,6 +1,12 @@
 package startup
 
 import (
+	"blog/backup"
+	"blog/owner"
+	"blog/publish"
+	"blog/search"
+	"blog/trash"
+	"blog/visit"
 	"controller"
 	"controller/personal"
 	"fmt"
@@ -30,13 +36,30 @@ func StartServer() {
 	server.ShareServerMgrInstance().RegisterController(controller.NewAboutController())
 	server.ShareServerMgrInstance().RegisterController(controller.NewPlayController())
 	server.ShareServerMgrInstance().RegisterController(controller.NewPluginController())
+	server.ShareServerMgrInstance().RegisterController(controller.NewSearchController())
+	server.ShareServerMgrInstance().RegisterController(controller.NewNotifyStreamController())
+	server.ShareServerMgrInstance().RegisterController(controller.NewCaptchaController())
+	server.ShareServerMgrInstance().RegisterController(controller.NewAvatarController())
+	server.ShareServerMgrInstance().RegisterController(controller.NewUserController())
+	server.ShareServerMgrInstance().RegisterController(controller.NewAccountController())
 
 	// personal api
 	server.ShareServerMgrInstance().RegisterController(personal.NewSyncController())
 	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalAuthController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalTOTPController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalTokenController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalAuditController())
 	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalFetchController())
 	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalFileController())
 	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalDeleteController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalTagController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalCategoryController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalTrashController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalRevisionController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalPublishController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalStatsController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalModerationController())
+	server.ShareServerMgrInstance().RegisterController(personal.NewPersonalRoleController())
 
 	// staitc file
 	server.ShareServerMgrInstance().RegisterStaticFile("js", filepath.Join(localWebResourcePath, "js"))
@@ -68,15 +91,69 @@ func StartServer() {
 	*/
 	// 评论表
 	database.ShareDatabaseRunner().RegisterModel(model.ShareCommentModel())
+	// 评论设置表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareCommentSettingModel())
+	// 评论编辑历史表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareCommentHistoryModel())
+	// 垃圾评论分类器
+	database.ShareDatabaseRunner().RegisterModel(model.ShareSpamModel())
 	// 博客表
 	database.ShareDatabaseRunner().RegisterModel(model.ShareBlogModel())
+	// 标签表，依赖博客表做迁移
+	database.ShareDatabaseRunner().RegisterModel(model.ShareTagModel())
+	// 分类表，依赖博客表做迁移
+	database.ShareDatabaseRunner().RegisterModel(model.ShareCategoryModel())
+	// 博客版本表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareRevisionModel())
 	// 用户表
 	database.ShareDatabaseRunner().RegisterModel(model.ShareUserModel())
+	// 找回密码令牌表
+	database.ShareDatabaseRunner().RegisterModel(model.SharePasswordResetModel())
+	// 本站帐号登录失败记录表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareLoginFailureModel())
+	// 主人登录凭据和两步验证恢复码表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareOwnerAuthModel())
+	// 主人签发的API令牌表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareAPITokenModel())
 	// 插件表
 	database.ShareDatabaseRunner().RegisterModel(model.SharePluginModel())
+	// 投票表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareVoteModel())
+	// 插件评分表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareRatingModel())
+	// 通知表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareNotificationModel())
+	// 访问统计表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareVisitModel())
+	// 审计日志表
+	database.ShareDatabaseRunner().RegisterModel(model.ShareAuditModel())
 
 	database.ShareDatabaseRunner().Start()
 
+	// 配置里的明文主人密码转存成摘要
+	if err := owner.MigrateLegacyCredential(); err != nil {
+		fmt.Println("migrate owner credential error: ", err)
+	}
+
+	// 搜索索引，博客多的时候比较慢，放到后台建
+	go func() {
+		if err := search.BuildIndex(); err != nil {
+			fmt.Println("build search index error: ", err)
+		}
+	}()
+	// 定时发布，补上服务停止期间错过的发布
+	if err := publish.StartScheduler(); err != nil {
+		fmt.Println("start publish scheduler error: ", err)
+	}
+	// 定时清理回收站
+	trash.StartPurgeTimer()
+	// 定时写入访问量
+	visit.StartFlushTimer()
+	// 定时汇总访问来源
+	visit.StartRollupTimer()
+	// 定时备份，配置了backup.dir才会启动
+	backup.StartBackupTimer()
+
 	// // plugin
 	plugin.SharePluginMgrInstance().Initialize()
 
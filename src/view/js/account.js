@@ -0,0 +1,95 @@
+var LocalAccount = LocalAccount || {}
+
+LocalAccount.errorText = {
+	2: "输入的内容不符合要求",
+	4002: "用户名或者邮箱已经被使用",
+	4003: "用户名或者密码错误",
+	4004: "链接无效或者已经过期",
+	4005: "操作太频繁，请稍后再试"
+}
+
+LocalAccount.post = function(content, callback) {
+	$.ajax({
+		url: "/account",
+		type: "POST",
+		data: JSON.stringify(content),
+		contentType: "application/json; charset=utf-8",
+		dataType: "json",
+		success: function(result) {
+			if (result.code == 0) {
+				callback(result.data);
+			} else {
+				LocalAccount.showMessage(LocalAccount.errorText[result.code] || result.msg);
+			}
+		}
+	});
+}
+
+LocalAccount.showMessage = function(text) {
+	$(".account-message").text(text);
+}
+
+$(function() {
+	// 博客页的登录和注册
+	$(".local-login").submit(function(event) {
+		event.preventDefault();
+		var form = $(this);
+		LocalAccount.post({
+			"type": "login",
+			"account": form.find("input[name=account]").val(),
+			"password": form.find("input[name=password]").val()
+		}, function() {
+			window.location.reload();
+		});
+	});
+	$(".local-register").submit(function(event) {
+		event.preventDefault();
+		var form = $(this);
+		LocalAccount.post({
+			"type": "register",
+			"name": form.find("input[name=name]").val(),
+			"email": form.find("input[name=email]").val(),
+			"password": form.find("input[name=password]").val()
+		}, function() {
+			window.location.reload();
+		});
+	});
+	$(".local-switch").click(function() {
+		$(".local-login, .local-register").toggle();
+	});
+
+	// 找回密码
+	$(".request-reset").submit(function(event) {
+		event.preventDefault();
+		LocalAccount.post({"type": "requestReset", "email": $(this).find("input[name=email]").val()}, function() {
+			LocalAccount.showMessage("如果这个邮箱注册过，重置链接已经发送到邮箱");
+		});
+	});
+	$(".reset-password").submit(function(event) {
+		event.preventDefault();
+		var form = $(this);
+		var password = form.find("input[name=password]").val();
+		if (password != form.find("input[name=confirm]").val()) {
+			LocalAccount.showMessage("两次输入的密码不一致");
+			return;
+		}
+		LocalAccount.post({"type": "resetPassword", "token": form.attr("data-token"), "password": password}, function() {
+			LocalAccount.showMessage("密码已经重置，请重新登录");
+			form.hide();
+		});
+	});
+
+	// 用户主页上修改密码
+	$(".change-password").submit(function(event) {
+		event.preventDefault();
+		var form = $(this);
+		LocalAccount.post({
+			"type": "changePassword",
+			"old_password": form.find("input[name=old_password]").val(),
+			"password": form.find("input[name=password]").val()
+		}, function() {
+			LocalAccount.showMessage("密码已经修改");
+			form[0].reset();
+		});
+	});
+});
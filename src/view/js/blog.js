@@ -1,10 +1,6 @@
 window.onload = function() {
-	$(".ds-qq").click(function() {
-		Account.loginByQQ();
-	});
-	$(".ds-weibo").click(function() {
-		console.log("loginByWeibo");
-		Account.loginByWeibo();
+	$(".ds-service-link").click(function() {
+		Account.loginBy($(this).attr("data-provider"));
 	});
 	$(".btn-send").click(function() {
 		var content = $(".wrap-text-f").val();
@@ -49,12 +45,40 @@ window.onload = function() {
 	$("#logout").click(function() {
 		Account.logout();
 	});
+	Talk.loadGuestInfo();
 }
 // Create Base64 Object
 var Base64={_keyStr:"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/=",encode:function(e){var t="";var n,r,i,s,o,u,a;var f=0;e=Base64._utf8_encode(e);while(f<e.length){n=e.charCodeAt(f++);r=e.charCodeAt(f++);i=e.charCodeAt(f++);s=n>>2;o=(n&3)<<4|r>>4;u=(r&15)<<2|i>>6;a=i&63;if(isNaN(r)){u=a=64}else if(isNaN(i)){a=64}t=t+this._keyStr.charAt(s)+this._keyStr.charAt(o)+this._keyStr.charAt(u)+this._keyStr.charAt(a)}return t},decode:function(e){var t="";var n,r,i;var s,o,u,a;var f=0;e=e.replace(/[^A-Za-z0-9+/=]/g,"");while(f<e.length){s=this._keyStr.indexOf(e.charAt(f++));o=this._keyStr.indexOf(e.charAt(f++));u=this._keyStr.indexOf(e.charAt(f++));a=this._keyStr.indexOf(e.charAt(f++));n=s<<2|o>>4;r=(o&15)<<4|u>>2;i=(u&3)<<6|a;t=t+String.fromCharCode(n);if(u!=64){t=t+String.fromCharCode(r)}if(a!=64){t=t+String.fromCharCode(i)}}t=Base64._utf8_decode(t);return t},_utf8_encode:function(e){e=e.replace(/rn/g,"n");var t="";for(var n=0;n<e.length;n++){var r=e.charCodeAt(n);if(r<128){t+=String.fromCharCode(r)}else if(r>127&&r<2048){t+=String.fromCharCode(r>>6|192);t+=String.fromCharCode(r&63|128)}else{t+=String.fromCharCode(r>>12|224);t+=String.fromCharCode(r>>6&63|128);t+=String.fromCharCode(r&63|128)}}return t},_utf8_decode:function(e){var t="";var n=0;var r=c1=c2=0;while(n<e.length){r=e.charCodeAt(n);if(r<128){t+=String.fromCharCode(r);n++}else if(r>191&&r<224){c2=e.charCodeAt(n+1);t+=String.fromCharCode((r&31)<<6|c2&63);n+=2}else{c2=e.charCodeAt(n+1);c3=e.charCodeAt(n+2);t+=String.fromCharCode((r&15)<<12|(c2&63)<<6|c3&63);n+=3}}return t}}
 
 var Talk = Talk || {}
 
+Talk.refreshCaptcha = function() {
+	$(".guest-captcha").val("");
+	$(".guest-captcha-img").attr("src", "/captcha?t=" + new Date().getTime());
+}
+
+// 会话里记住的游客身份，填到表单里
+Talk.loadGuestInfo = function() {
+	if ($(".guest-form").length == 0) {
+		return;
+	}
+	$(".guest-captcha-img").click(Talk.refreshCaptcha);
+	$.ajax({
+		url: "../api",
+		type: "POST",
+		data: JSON.stringify({"type": "guestInfo"}),
+		contentType: "application/json; charset=utf-8",
+		dataType: "json",
+		success: function(result) {
+			if (result.code == 0) {
+				$(".guest-name").val(result.data.name);
+				$(".guest-email").val(result.data.email);
+				$(".guest-website").val(result.data.website);
+			}
+		}
+	});
+}
+
 Talk.sendTalk = function (blogId, commentId, content, callback) {
 	var url = "../api";
 	var content = {
@@ -63,6 +87,15 @@ Talk.sendTalk = function (blogId, commentId, content, callback) {
 		"commentId": commentId,
 		"content": content
 	}
+	var isGuest = $(".guest-form").length > 0;
+	if (isGuest) {
+		content["guest"] = {
+			"name": $(".guest-name").val(),
+			"email": $(".guest-email").val(),
+			"website": $(".guest-website").val()
+		};
+		content["captcha"] = $(".guest-captcha").val();
+	}
 	$.ajax({
 		url: url,
 		type: "POST",
@@ -72,14 +105,26 @@ Talk.sendTalk = function (blogId, commentId, content, callback) {
 		success: function(result) {
 			if (result.code == 0) {
 				console.log("send talk success");
-				var m = $(".list-newest-b").children();
-				$(m[0]).after(Base64.decode(result.data.comment))
+				if (result.data.status == "approved") {
+					var m = $(".list-newest-b").children();
+					$(m[0]).after(Base64.decode(result.data.comment))
+				} else if (result.data.status == "pending") {
+					var m = $(".list-newest-b").children();
+					$(m[0]).after(Base64.decode(result.data.comment))
+					alert("评论已提交，审核通过之后其他人才能看到")
+				} else {
+					alert("评论已提交，等待审核")
+				}
 				if (callback != null) {
 					callback();
 				}
 			} else {
 				alert("评论失败, err: " + result.msg)
 			}
+			// 验证码用过一次就失效
+			if (isGuest) {
+				Talk.refreshCaptcha();
+			}
 		}
 	});
 }
@@ -98,7 +143,7 @@ Account.waitingLogin = function () {
 		clearInterval(Account.timer);
 		if (event.data == "login") {
 			// 登录成功
-			var url = "https://windyx.com/api";
+			var url = "/api";
 			$.ajax({
 				url: url,
 				type: "POST",
@@ -124,26 +169,10 @@ Account.waitingLogin = function () {
 	window.addEventListener('message', listener, false);
 }
 
-Account.loginByQQ = function(clientId, redirectUri) {
-	Account.waitingLogin();
-	var url = "https://graph.qq.com/oauth2.0/authorize?response_type=code&client_id=101351452&redirect_uri=https%3A%2F%2Fwindyx.com%2Flogin%3Ftype%3Dqq&scope=get_user_info";
-	var child = window.open(url);
-	Account.timer = setInterval(function() {
-		  var message = "helo";
-			child.postMessage(message, "/");
-	}, 200);
-}
-
-Account.loginByWeixin = function() {
-	// not implement
-
-}
-
-Account.loginByWeibo = function() {
-	// not implement
+// 授权链接由服务器生成，带着state和PKCE参数，回调地址来自net.host配置
+Account.loginBy = function(provider) {
 	Account.waitingLogin();
-	var url = "https://api.weibo.com/oauth2/authorize?client_id=3153747122&response_type=code&redirect_uri=https%3A%2F%2Fwindyx.com%2Flogin%3Ftype%3Dweibo"
-	var child = window.open(url);
+	var child = window.open("/login?type=" + encodeURIComponent(provider));
 	Account.timer = setInterval(function() {
 		  var message = "helo";
 			child.postMessage(message, "/");
@@ -151,7 +180,7 @@ Account.loginByWeibo = function() {
 }
 
 Account.logout = function() {
-	var url = "https://windyx.com/login?type=logout"
+	var url = "/login?type=logout"
 	$.get(url, function(result) {
 		var data = JSON.parse(result);
 		if (data.code == 0) {
@@ -0,0 +1,91 @@
+var Notify = Notify || {}
+
+Notify.typeText = {
+	"reply": "回复了你",
+	"mention": "提到了你",
+	"owner_reply": "博主也评论了"
+}
+
+Notify.post = function(content, callback) {
+	$.ajax({
+		url: "/api",
+		type: "POST",
+		data: JSON.stringify(content),
+		contentType: "application/json; charset=utf-8",
+		dataType: "json",
+		success: function(result) {
+			if (result.code == 0) {
+				callback(result.data);
+			} else {
+				console.log("notify failed: ", result.msg);
+			}
+		}
+	});
+}
+
+Notify.setUnread = function(count) {
+	var badge = $(".notify-badge");
+	badge.toggleClass("unread", count > 0);
+	badge.find(".notify-count").text(count > 0 ? count : "");
+}
+
+Notify.renderItem = function(item) {
+	var li = $("<li></li>").toggleClass("unread", !item.read);
+	var link = $("<a></a>").attr("href", item.url + "#comment").attr("data-id", item.id);
+	link.append($("<strong></strong>").text(item.actor.name));
+	link.append($("<span></span>").text(" " + (Notify.typeText[item.type] || "") + ": "));
+	link.append($("<em></em>").text(item.content));
+	return li.append(link);
+}
+
+Notify.showInbox = function() {
+	var panel = $(".notify-panel");
+	if (panel.length > 0) {
+		panel.remove();
+		return;
+	}
+	panel = $("<div class=\"notify-panel\"><a href=\"javascript:void(0)\" class=\"notify-read-all\">全部已读</a><ul></ul></div>");
+	$(".notify-badge").after(panel);
+	Notify.post({"type": "notifications", "page": 1}, function(data) {
+		var list = panel.find("ul");
+		if (data.list.length == 0) {
+			list.append($("<li class=\"empty\">没有新消息</li>"));
+		}
+		$.each(data.list, function(i, item) {
+			list.append(Notify.renderItem(item));
+		});
+		Notify.setUnread(data.unread);
+	});
+}
+
+$(function() {
+	var badge = $(".notify-badge");
+	if (badge.length == 0) {
+		return;
+	}
+	badge.click(Notify.showInbox);
+	$(document).on("click", ".notify-panel li a", function() {
+		Notify.post({"type": "markRead", "ids": [$(this).data("id")]}, function(data) {
+			Notify.setUnread(data.unread);
+		});
+	});
+	$(document).on("click", ".notify-read-all", function() {
+		Notify.post({"type": "markRead"}, function(data) {
+			Notify.setUnread(data.unread);
+			$(".notify-panel li").removeClass("unread");
+		});
+	});
+	if (window.EventSource) {
+		var source = new EventSource("/notify/stream");
+		source.addEventListener("unread", function(event) {
+			Notify.setUnread(parseInt(event.data));
+		});
+		source.addEventListener("notification", function(event) {
+			var item = JSON.parse(event.data);
+			var count = parseInt(badge.find(".notify-count").text()) || 0;
+			Notify.setUnread(count + 1);
+			$(".notify-panel ul .empty").remove();
+			$(".notify-panel ul").prepend(Notify.renderItem(item));
+		});
+	}
+});
@@ -25,4 +25,19 @@ function SetCwinHeightAndBase(baseURL) {
 	var pElement = document.createElement("base");
 	pElement.href = "baseURL";
 	iframeid.contentWindow.document.head.append(pElement)
-}
\ No newline at end of file
+}
+// 第三方登录，登录页面关闭之前会发来login消息，刷新之后显示登录状态
+$(function() {
+	$(".ds-service-link").click(function() {
+		var child = window.open("/login?type=" + encodeURIComponent($(this).attr("data-provider")));
+		var timer = setInterval(function() {
+			child.postMessage("helo", "/");
+		}, 200);
+		window.addEventListener("message", function(event) {
+			if (event.data == "login") {
+				clearInterval(timer);
+				window.location.reload();
+			}
+		}, false);
+	});
+});
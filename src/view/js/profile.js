@@ -0,0 +1,39 @@
+var Profile = Profile || {}
+
+Profile.post = function(content, callback) {
+	$.ajax({
+		url: "/api",
+		type: "POST",
+		data: JSON.stringify(content),
+		contentType: "application/json; charset=utf-8",
+		dataType: "json",
+		success: function(result) {
+			if (result.code == 0) {
+				callback(result.data);
+			} else {
+				console.log("privacy failed: ", result.msg);
+			}
+		}
+	});
+}
+
+Profile.fill = function(data) {
+	$(".profile-privacy input[name=hide_profile]").prop("checked", data.hide_profile);
+	$(".profile-privacy input[name=hide_comments]").prop("checked", data.hide_comments);
+}
+
+// 只有自己的主页上有隐私设置
+$(function() {
+	var form = $(".profile-privacy");
+	if (form.length == 0) {
+		return;
+	}
+	Profile.post({"type": "privacy"}, Profile.fill);
+	form.find("input").change(function() {
+		Profile.post({
+			"type": "setPrivacy",
+			"hide_profile": form.find("input[name=hide_profile]").prop("checked") ? 1 : 0,
+			"hide_comments": form.find("input[name=hide_comments]").prop("checked") ? 1 : 0
+		}, Profile.fill);
+	});
+});
@@ -0,0 +1,136 @@
+var Vote = Vote || {}
+
+Vote.post = function(content, callback) {
+	$.ajax({
+		url: "/api",
+		type: "POST",
+		data: JSON.stringify(content),
+		contentType: "application/json; charset=utf-8",
+		dataType: "json",
+		success: function(result) {
+			if (result.code == 0) {
+				if (callback != null) {
+					callback(result.data);
+				}
+			} else {
+				console.log("vote failed: ", result.msg);
+			}
+		}
+	});
+}
+
+// 再点一次同样的按钮是取消投票
+Vote.toggle = function(target, id, value, callback) {
+	var content = {
+		"type": "vote",
+		"target": target,
+		"id": id,
+		"value": value
+	}
+	if (value == 0) {
+		content.type = "unvote";
+	}
+	Vote.post(content, callback);
+}
+
+// 页面上没有服务端渲染投票状态的时候，用这个接口补上
+Vote.state = function(target, ids, callback) {
+	if (ids.length == 0) {
+		return;
+	}
+	Vote.post({"type": "voteState", "target": target, "ids": ids}, callback);
+}
+
+Vote.rate = function(pluginId, stars, review, callback) {
+	Vote.post({"type": "rate", "id": pluginId, "stars": stars, "review": review}, callback);
+}
+
+Vote.unrate = function(pluginId, callback) {
+	Vote.post({"type": "unrate", "id": pluginId}, callback);
+}
+
+$(function() {
+	// 博客和插件页面
+	$(".blog-vote a").click(function() {
+		var element = $(this);
+		var box = element.parent();
+		var value = element.hasClass("voted") ? 0 : parseInt(element.attr("data-value"));
+		Vote.toggle(box.attr("data-target"), parseInt(box.attr("data-id")), value, function(data) {
+			box.children("a").removeClass("voted");
+			box.children(".vote-up").find(".count").text(data.praise);
+			box.children(".vote-down").find(".count").text(data.dissent);
+			box.children("a[data-value=" + data.vote + "]").addClass("voted");
+		});
+	});
+
+	// 评论，新发的评论是动态插入的，所以用事件代理
+	$(document).on("click", ".evt-support, .evt-opposed", function() {
+		var element = $(this);
+		var up = element.hasClass("evt-support");
+		var value = element.hasClass("voted") ? 0 : (up ? 1 : -1);
+		var box = element.parents(".action-click-gw").first();
+		Vote.toggle("comment", parseInt(element.attr("data-id")), value, function(data) {
+			var support = box.find(".evt-support");
+			var opposed = box.find(".evt-opposed");
+			support.removeClass("voted").children("em").text(data.praise > 0 ? data.praise : "");
+			opposed.removeClass("voted").children("em").text(data.dissent > 0 ? data.dissent : "");
+			if (data.vote == 1) {
+				support.addClass("voted");
+			} else if (data.vote == -1) {
+				opposed.addClass("voted");
+			}
+		});
+	});
+
+	// 首页列表的喜欢
+	var dings = $("[data-action=ding]");
+	dings.click(function() {
+		var element = $(this);
+		var value = element.hasClass("voted") ? 0 : 1;
+		Vote.toggle("blog", parseInt(element.attr("data-id")), value, function(data) {
+			element.find(".count").text(data.praise);
+			element.toggleClass("voted", data.vote == 1);
+		});
+	});
+	var ids = dings.map(function() {
+		return parseInt($(this).attr("data-id"));
+	}).get();
+	Vote.state("blog", ids, function(data) {
+		dings.each(function() {
+			$(this).toggleClass("voted", data[$(this).attr("data-id")] == 1);
+		});
+	});
+
+	// 插件评分
+	$(".rating-form .star").click(function() {
+		var form = $(this).parents(".rating-form");
+		form.attr("data-stars", $(this).attr("data-value"));
+		form.find(".star").each(function() {
+			$(this).toggleClass("on", parseInt($(this).attr("data-value")) <= parseInt(form.attr("data-stars")));
+		});
+	});
+	$(".rating-form .btn-rate").click(function() {
+		var form = $(this).parents(".rating-form");
+		var stars = parseInt(form.attr("data-stars"));
+		if (!(stars > 0)) {
+			return;
+		}
+		Vote.rate(parseInt(form.attr("data-id")), stars, form.find(".rating-review").val(), function(data) {
+			$(".rating-summary .rating-average").text(data.average.toFixed(1));
+			$(".rating-summary .rating-count").text(data.count);
+			form.find(".btn-unrate").show();
+		});
+	});
+	$(".rating-form .btn-unrate").click(function() {
+		var form = $(this).parents(".rating-form");
+		var element = $(this);
+		Vote.unrate(parseInt(form.attr("data-id")), function(data) {
+			$(".rating-summary .rating-average").text(data.average.toFixed(1));
+			$(".rating-summary .rating-count").text(data.count);
+			form.attr("data-stars", 0);
+			form.find(".star").removeClass("on");
+			form.find(".rating-review").val("");
+			element.hide();
+		});
+	});
+});